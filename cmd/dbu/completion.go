@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+
+	"github.com/rowjay/db-backup-utility/internal/app"
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// completionTimeout bounds the storage listing behind --key completion.
+const completionTimeout = 10 * time.Second
+
+func newCompletionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion [bash|zsh|fish|powershell]",
+		Short: "Generate a shell completion script",
+		Long: `Generate a shell completion script for dbu.
+
+  bash:       source <(dbu completion bash)
+  zsh:        dbu completion zsh > "${fpath[1]}/_dbu"
+  fish:       dbu completion fish > ~/.config/fish/completions/dbu.fish
+  powershell: dbu completion powershell | Out-String | Invoke-Expression
+
+Backup keys for --key are completed from storage using the same --config and
+flags as the command being completed.`,
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			root := cmd.Root()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(out, true)
+			case "zsh":
+				return root.GenZshCompletion(out)
+			case "fish":
+				return root.GenFishCompletion(out, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(out)
+			default:
+				return fmt.Errorf("unsupported shell: %s", args[0])
+			}
+		},
+	}
+}
+
+// completeBackupKeys completes --key from the backups in storage. It skips the
+// keyring and logging setup of a normal run so nothing is printed or prompted,
+// and offers no suggestions when the config or storage is unusable.
+func completeBackupKeys(root *rootFlags, overrides *overrideFlags) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		cfg, err := config.Load(root.ConfigPath)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		applyOverrides(cfg, root, overrides)
+		store, err := storage.New(cfg.Storage)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+		defer cancel()
+		keys, err := app.New(cfg, nil, store, zerolog.Nop(), nil).BackupKeys(ctx)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var matches []string
+		for _, key := range keys {
+			if strings.HasPrefix(key, toComplete) {
+				matches = append(matches, key)
+			}
+		}
+		return matches, cobra.ShellCompDirectiveNoFileComp
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompleteBackupKeys(t *testing.T) {
+	dir := t.TempDir()
+	prefix := filepath.Join(dir, "sqlite", "app.db")
+	if err := os.MkdirAll(prefix, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"20240101T000000Z_full.backup.zst",
+		"20240101T000000Z_full.backup.zst.manifest.json",
+		"20240102T000000Z_full.backup.zst.part-0000",
+		"20240102T000000Z_full.backup.zst.part-0001",
+	} {
+		if err := os.WriteFile(filepath.Join(prefix, name), []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"__complete", "restore", "--db-type", "sqlite", "--db-name", "app.db", "--storage-path", dir, "--key", "sqlite/"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{"sqlite/app.db/20240101T000000Z_full.backup.zst\n", "sqlite/app.db/20240102T000000Z_full.backup.zst\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in completions:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, ".manifest.json") || strings.Contains(got, ".part-") {
+		t.Errorf("manifests and parts should not be offered:\n%s", got)
+	}
+}
+
+func TestCompletionCmdRejectsUnknownShell(t *testing.T) {
+	cmd := newRootCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetArgs([]string{"completion", "tcsh"})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected an error for an unsupported shell")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDryRunOnlyWhereImplemented(t *testing.T) {
+	for _, args := range [][]string{
+		{"clone", "--target-config", "target.yaml", "--drop-existing", "--dry-run"},
+		{"reencrypt", "--key", "stub/appdb/x.backup.gz.enc", "--new-encryption-key", "k", "--dry-run"},
+	} {
+		cmd := newRootCmd()
+		cmd.SetArgs(args)
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		err := cmd.Execute()
+		if err == nil || !strings.Contains(err.Error(), "unknown flag: --dry-run") || exitCode(err) != exitConfig {
+			t.Fatalf("%v: expected --dry-run to be refused, got %v", args, err)
+		}
+	}
+	for _, name := range []string{"backup", "restore"} {
+		cmd, _, err := newRootCmd().Find([]string{name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cmd.Flags().Lookup("dry-run") == nil {
+			t.Fatalf("%s has no --dry-run", name)
+		}
+	}
+}
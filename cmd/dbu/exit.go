@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/rowjay/db-backup-utility/internal/app"
+)
+
+// Exit codes are part of the CLI contract so schedulers can tell failure classes apart.
+const (
+	exitOK           = 0
+	exitFailure      = 1
+	exitConfig       = 2
+	exitConnectivity = 3
+	exitBudget       = 4
+)
+
+// configError marks errors caused by invalid flags or configuration.
+type configError struct{ err error }
+
+func (e configError) Error() string { return e.err.Error() }
+func (e configError) Unwrap() error { return e.err }
+
+func asConfigError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return configError{err: err}
+}
+
+func exitCode(err error) int {
+	var cfgErr configError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &cfgErr):
+		return exitConfig
+	case errors.Is(err, app.ErrConnectivity):
+		return exitConnectivity
+	case errors.Is(err, app.ErrBudgetExceeded):
+		return exitBudget
+	default:
+		return exitFailure
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rowjay/db-backup-utility/internal/app"
+)
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{errors.New("upload failed"), exitFailure},
+		{asConfigError(errors.New("bad yaml")), exitConfig},
+		{fmt.Errorf("target config: %w", asConfigError(errors.New("missing"))), exitConfig},
+		{fmt.Errorf("source: %w", fmt.Errorf("%w: refused", app.ErrConnectivity)), exitConnectivity},
+		{fmt.Errorf("%w: more than 10 bytes", app.ErrBudgetExceeded), exitBudget},
+	}
+	for _, tc := range cases {
+		if got := exitCode(tc.err); got != tc.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
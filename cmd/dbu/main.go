@@ -1,19 +1,40 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 
 	"github.com/rowjay/db-backup-utility/internal/app"
+	"github.com/rowjay/db-backup-utility/internal/audit"
+	"github.com/rowjay/db-backup-utility/internal/bench"
+	"github.com/rowjay/db-backup-utility/internal/compress"
 	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
 	"github.com/rowjay/db-backup-utility/internal/db"
+	"github.com/rowjay/db-backup-utility/internal/keyring"
 	"github.com/rowjay/db-backup-utility/internal/logging"
 	"github.com/rowjay/db-backup-utility/internal/notify"
+	"github.com/rowjay/db-backup-utility/internal/serve"
 	"github.com/rowjay/db-backup-utility/internal/storage"
 	"github.com/rowjay/db-backup-utility/internal/util"
 	"github.com/rowjay/db-backup-utility/internal/version"
@@ -23,12 +44,19 @@ type rootFlags struct {
 	ConfigPath string
 	LogLevel   string
 	LogFormat  string
+	DryRun     bool
+	Actor      string
+	Verbose    bool
+	Quiet      bool
 }
 
 type overrideFlags struct {
 	DBType        string
 	DBHost        string
 	DBPort        int
+	DBSocket      string
+	DBReadHost    string
+	DBReadPort    int
 	DBUser        string
 	DBPassword    string
 	DBName        string
@@ -40,29 +68,59 @@ type overrideFlags struct {
 	S3AccessKey   string
 	S3SecretKey   string
 	S3Region      string
+	S3Profile     string
 	S3UseSSL      string
 	S3PathStyle   string
+	OutputPrefix  string
 	EncryptionKey string
+	// Read the secret from stdin instead of argv, where process listings and
+	// shell history would show it.
+	EncryptionKeyStdin bool
+	DBPasswordStdin    bool
 }
 
 func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+func newRootCmd() *cobra.Command {
 	root := &rootFlags{}
 	overrides := &overrideFlags{}
 
 	rootCmd := &cobra.Command{
 		Use:   "dbu",
 		Short: "Universal database backup and restore utility",
+		// Errors are printed once by main; usage is only useful for flag errors.
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		cmd.PrintErrln(cmd.UsageString())
+		return asConfigError(err)
+	})
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return readStdinSecrets(overrides, cmd.InOrStdin())
 	}
 
 	rootCmd.PersistentFlags().StringVar(&root.ConfigPath, "config", "", "Path to config file (yaml/toml/json or .enc)")
 	rootCmd.PersistentFlags().StringVar(&root.LogLevel, "log-level", "", "Log level (debug, info, warn, error)")
 	rootCmd.PersistentFlags().StringVar(&root.LogFormat, "log-format", "", "Log format (json, console)")
+	rootCmd.PersistentFlags().BoolVarP(&root.Verbose, "verbose", "v", false, "Stream database tool output to stderr as it runs")
+	rootCmd.PersistentFlags().BoolVarP(&root.Quiet, "quiet", "q", false, "Only log errors")
+	rootCmd.PersistentFlags().StringVar(&root.Actor, "actor", "", "Actor recorded in the audit log (default: DBU_ACTOR or OS user)")
 
 	rootCmd.PersistentFlags().StringVar(&overrides.DBType, "db-type", "", "Database type (postgres, mysql, mongodb, sqlite)")
 	rootCmd.PersistentFlags().StringVar(&overrides.DBHost, "db-host", "", "Database host")
 	rootCmd.PersistentFlags().IntVar(&overrides.DBPort, "db-port", 0, "Database port")
+	rootCmd.PersistentFlags().StringVar(&overrides.DBSocket, "db-socket", "", "Unix socket to connect through instead of the host: its directory for PostgreSQL, the socket file for MySQL")
+	rootCmd.PersistentFlags().StringVar(&overrides.DBReadHost, "db-read-host", "", "Read replica to dump from; keys and manifests keep the database's name")
+	rootCmd.PersistentFlags().IntVar(&overrides.DBReadPort, "db-read-port", 0, "Read replica port (default: the database port)")
 	rootCmd.PersistentFlags().StringVar(&overrides.DBUser, "db-user", "", "Database username")
 	rootCmd.PersistentFlags().StringVar(&overrides.DBPassword, "db-password", "", "Database password")
+	rootCmd.PersistentFlags().BoolVar(&overrides.DBPasswordStdin, "db-password-stdin", false, "Read the database password from the first line of stdin")
 	rootCmd.PersistentFlags().StringVar(&overrides.DBName, "db-name", "", "Database name")
 	rootCmd.PersistentFlags().StringVar(&overrides.SQLitePath, "sqlite-path", "", "SQLite file path")
 
@@ -73,85 +131,1307 @@ func main() {
 	rootCmd.PersistentFlags().StringVar(&overrides.S3AccessKey, "s3-access-key", "", "S3 access key")
 	rootCmd.PersistentFlags().StringVar(&overrides.S3SecretKey, "s3-secret-key", "", "S3 secret key")
 	rootCmd.PersistentFlags().StringVar(&overrides.S3Region, "s3-region", "", "S3 region")
+	rootCmd.PersistentFlags().StringVar(&overrides.S3Profile, "s3-profile", "", "AWS shared config/SSO profile for S3 credentials")
 	rootCmd.PersistentFlags().StringVar(&overrides.S3UseSSL, "s3-ssl", "", "Use SSL for S3 endpoint (true/false)")
 	rootCmd.PersistentFlags().StringVar(&overrides.S3PathStyle, "s3-path-style", "", "Force path-style S3 (true/false)")
+	rootCmd.PersistentFlags().StringVar(&overrides.OutputPrefix, "output-prefix", "", "Folder under the storage prefix for backups, e.g. nightly or {{.Year}}/{{.Month}}")
 	rootCmd.PersistentFlags().StringVar(&overrides.EncryptionKey, "encryption-key", "", "Encryption key (base64 or hex) for backups")
+	rootCmd.PersistentFlags().BoolVar(&overrides.EncryptionKeyStdin, "encryption-key-stdin", false, "Read the encryption key from the first line of stdin")
+	rootCmd.MarkFlagsMutuallyExclusive("db-password", "db-password-stdin")
+	rootCmd.MarkFlagsMutuallyExclusive("encryption-key", "encryption-key-stdin")
+	// stdin holds one secret; supply the other through the config or its environment variable.
+	rootCmd.MarkFlagsMutuallyExclusive("db-password-stdin", "encryption-key-stdin")
+
+	rootCmd.AddCommand(newBackupCmd(root, overrides))
+	rootCmd.AddCommand(newRestoreCmd(root, overrides))
+	rootCmd.AddCommand(newValidateCmd(root, overrides))
+	rootCmd.AddCommand(newListCmd(root, overrides))
+	rootCmd.AddCommand(newCloneCmd(root, overrides))
+	rootCmd.AddCommand(newReencryptCmd(root, overrides))
+	rootCmd.AddCommand(newConvertCmd(root, overrides))
+	rootCmd.AddCommand(newCompactCmd(root, overrides))
+	rootCmd.AddCommand(newVerifyCmd(root, overrides))
+	rootCmd.AddCommand(newStatusCmd(root, overrides))
+	rootCmd.AddCommand(newDiffCmd(root, overrides))
+	rootCmd.AddCommand(newScheduleCmd(root, overrides))
+	rootCmd.AddCommand(newServeCmd(root, overrides))
+	rootCmd.AddCommand(newHoldCmd(root, overrides))
+	rootCmd.AddCommand(newReleaseCmd(root, overrides))
+	rootCmd.AddCommand(newStorageCmd(root, overrides))
+	rootCmd.AddCommand(newDictCmd(root, overrides))
+	rootCmd.AddCommand(newBenchCmd(root, overrides))
+	rootCmd.AddCommand(newMigrateStorageCmd(root, overrides))
+	rootCmd.AddCommand(newConfigCmd())
+	rootCmd.AddCommand(newVersionCmd())
+	rootCmd.AddCommand(newCompletionCmd())
+
+	_ = rootCmd.RegisterFlagCompletionFunc("db-type", cobra.FixedCompletions(db.Types, cobra.ShellCompDirectiveNoFileComp))
+	_ = rootCmd.RegisterFlagCompletionFunc("storage", cobra.FixedCompletions([]string{"local", "s3"}, cobra.ShellCompDirectiveNoFileComp))
+	return rootCmd
+}
+
+func newBackupCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	backup := &cobra.Command{
+		Use:   "backup",
+		Short: "Create a backup",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			if len(backupLabels) > 0 {
+				labels, err := parseLabels(backupLabels)
+				if err != nil {
+					return asConfigError(err)
+				}
+				// Flags add to the labels from the config file and win on the same key.
+				cfg.Backup.Labels = mergeLabels(cfg.Backup.Labels, labels)
+			}
+			if err := app.CheckLabels(cfg.Backup.Labels); err != nil {
+				return asConfigError(err)
+			}
+			if backupAll {
+				if err := checkAllFlags(overrides); err != nil {
+					return err
+				}
+				return backupProfiles(cfg, backupParallel, cmd.OutOrStdout())
+			}
+			if cmd.Flags().Changed("parallel") {
+				return asConfigError(fmt.Errorf("--parallel needs --all"))
+			}
+			appSvc, logger, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+			appSvc.Force = backupForce
+			appSvc.NoLock = backupNoLock
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			if backupEstimate {
+				est, err := appSvc.EstimateBackup(ctx)
+				if err != nil {
+					return err
+				}
+				printEstimate(est)
+				return nil
+			}
+			if cfg.Global.DryRun {
+				plan, err := appSvc.PlanBackup(ctx)
+				if err != nil {
+					return err
+				}
+				printPlan(plan)
+				return nil
+			}
+			return runBackup(ctx, appSvc, logger)
+		},
+	}
+	backup.Flags().StringSliceVar(&overridesDBTables, "tables", nil, "Tables to include (PG/MySQL)")
+	backup.Flags().StringSliceVar(&overridesDBSchemas, "schemas", nil, "Schemas to include, e.g. tenant_* (PostgreSQL)")
+	backup.Flags().StringSliceVar(&overridesDBExcludeSchemas, "exclude-schemas", nil, "Schemas to leave out (PostgreSQL)")
+	backup.Flags().StringSliceVar(&overridesDBCollections, "collections", nil, "Collections to include (MongoDB)")
+	backup.Flags().StringVar(&backupType, "type", "", "Backup type (full/incremental/differential)")
+	backup.Flags().StringVar(&backupCompression, "compression", "", "Compression (none/gzip/zstd/br)")
+	backup.Flags().BoolVar(&backupEncryption, "encrypt", false, "Enable encryption")
+	backup.Flags().IntVar(&backupRetry, "retry", 0, "Retry attempts")
+	backup.Flags().DurationVar(&backupRetryBackoff, "retry-backoff", 0, "Retry backoff")
+	backup.Flags().DurationVar(&backupRetryJitter, "retry-jitter", 0, "Add a random wait of up to this long to each retry backoff")
+	backup.Flags().DurationVar(&backupRetryMaxElapsed, "retry-max-elapsed", 0, "Stop retrying once this long has passed since the first attempt, e.g. 3h")
+	backup.Flags().Int64Var(&backupMaxSize, "max-size", 0, "Abort the backup once it stores more than this many bytes")
+	backup.Flags().DurationVar(&backupMaxDuration, "max-duration", 0, "Abort the backup once its dump and upload run longer than this, e.g. 2h")
+	backup.Flags().BoolVar(&backupSchemaOnly, "schema-only", false, "Dump only the schema, no data")
+	backup.Flags().BoolVar(&backupDataOnly, "data-only", false, "Dump only the data, no schema")
+	backup.MarkFlagsMutuallyExclusive("schema-only", "data-only")
+	backup.Flags().BoolVar(&backupNoBlobs, "no-blobs", false, "Leave large objects out of the dump (PostgreSQL)")
+	backup.Flags().BoolVar(&backupBlobsOnly, "blobs-only", false, "Dump only large objects (PostgreSQL)")
+	backup.MarkFlagsMutuallyExclusive("no-blobs", "blobs-only")
+	backup.Flags().BoolVar(&root.DryRun, "dry-run", false, "Plan the backup without touching the database or writing to storage")
+	backup.Flags().BoolVar(&backupEstimate, "estimate", false, "Print the database size and an estimated backup size without dumping")
+	backup.Flags().BoolVar(&backupForce, "force", false, "Run even outside the configured backup window (emergency override, audited)")
+	backup.Flags().StringArrayVar(&backupLabels, "label", nil, "Label the backup with key=value (repeatable); a bare value is stored as reason=<value>")
+	backup.Flags().BoolVar(&backupNoLock, "no-lock", false, "Do not take the lock file, e.g. when a stale lock blocks an urgent backup (emergency override, audited)")
+	backup.Flags().BoolVar(&backupAll, "all", false, "Back up every database under profiles, each under its own lock file")
+	backup.Flags().IntVar(&backupParallel, "parallel", 1, "With --all, back up up to this many profiles at once")
+	backup.MarkFlagsMutuallyExclusive("all", "dry-run")
+	backup.MarkFlagsMutuallyExclusive("all", "estimate")
+	return backup
+}
+
+// runBackup runs one backup with the configured retries and logs its outcome. A
+// run skipped for the backup window or a pause is not an error.
+func runBackup(ctx context.Context, appSvc *app.App, logger zerolog.Logger) error {
+	backupCfg := appSvc.Cfg.Backup
+	policy := util.RetryPolicy{
+		Attempts:   backupCfg.RetryCount,
+		Backoff:    backupCfg.RetryBackoff,
+		Jitter:     backupCfg.RetryJitter,
+		MaxElapsed: backupCfg.RetryMaxElapsed,
+	}
+	err := util.RetryWith(ctx, policy, func() error {
+		res, err := appSvc.Backup(ctx)
+		// A retry of a backup over budget would only outgrow it again.
+		if errors.Is(err, app.ErrWindowSkipped) || errors.Is(err, app.ErrPaused) || errors.Is(err, app.ErrBudgetExceeded) {
+			return util.Permanent(err)
+		}
+		if err != nil {
+			return err
+		}
+		event := logger.Info().Str("key", res.Key).Int64("size", res.Manifest.SizeBytes).
+			Int64("uncompressed_size", res.Manifest.UncompressedBytes).
+			Float64("compression_ratio", res.Manifest.CompressionRatio())
+		if t := res.Manifest.Timings; t != nil {
+			event = event.Int64("dump_ms", t.DumpMS).Int64("process_ms", t.ProcessMS).Int64("upload_ms", t.UploadMS)
+		}
+		event.Msg("backup completed")
+		return nil
+	})
+	if errors.Is(err, app.ErrWindowSkipped) {
+		logger.Info().Msg("skipped: outside backup window")
+		return nil
+	}
+	if errors.Is(err, app.ErrPaused) {
+		logger.Info().Msg(err.Error())
+		return nil
+	}
+	return err
+}
+
+var (
+	overridesDBTables         []string
+	overridesDBSchemas        []string
+	overridesDBExcludeSchemas []string
+	overridesDBCollections    []string
+	backupType                string
+	backupCompression         string
+	backupEncryption          bool
+	backupRetry               int
+	backupRetryBackoff        time.Duration
+	backupRetryJitter         time.Duration
+	backupRetryMaxElapsed     time.Duration
+	backupMaxSize             int64
+	backupMaxDuration         time.Duration
+	backupSchemaOnly          bool
+	backupDataOnly            bool
+	backupNoBlobs             bool
+	backupBlobsOnly           bool
+	backupEstimate            bool
+	backupForce               bool
+	backupNoLock              bool
+	backupLabels              []string
+	backupAll                 bool
+	backupParallel            int
+)
+
+// labelReasonKey is the key of a label given without one, e.g. --label pre-migration.
+const labelReasonKey = "reason"
+
+// parseLabels parses key=value label flags; a bare value is stored under reason.
+func parseLabels(flags []string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, flag := range flags {
+		key, value, ok := strings.Cut(flag, "=")
+		if !ok {
+			key, value = labelReasonKey, flag
+		}
+		key = strings.TrimSpace(key)
+		if key == "" || value == "" {
+			return nil, fmt.Errorf("invalid label %q: use key=value or a bare value", flag)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+func mergeLabels(base, extra map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(extra))
+	maps.Copy(merged, base)
+	maps.Copy(merged, extra)
+	return merged
+}
+
+func printPlan(plan *app.Plan) {
+	fmt.Printf("key:\t%s\n", plan.Key)
+	switch {
+	case !plan.InWindow && plan.Forced:
+		fmt.Println("window:\toutside configured backup window; proceeding (--force)")
+	case !plan.InWindow:
+		fmt.Println("window:\toutside configured backup window; backup would be refused")
+	}
+	switch {
+	case plan.Paused && plan.Forced:
+		fmt.Println("paused:\tbackups are paused; proceeding (--force)")
+	case plan.Paused:
+		fmt.Println("paused:\tbackups are paused; backup would be refused")
+	}
+	for _, k := range plan.RetentionMoves {
+		fmt.Printf("move to cold:\t%s\n", k)
+	}
+	for _, k := range plan.RetentionDeletes {
+		fmt.Printf("delete:\t%s\n", k)
+	}
+	for _, n := range plan.Notifications {
+		fmt.Printf("notify:\t%s\n", n)
+	}
+}
+
+func printEstimate(est *app.Estimate) {
+	fmt.Printf("database_size:\t%s\n", formatBytes(est.DatabaseBytes))
+	if est.PreviousKey == "" {
+		fmt.Println("previous_backup:\tnone")
+	} else {
+		fmt.Printf("previous_backup:\t%s\n", est.PreviousKey)
+		fmt.Printf("previous_size:\t%s\n", formatBytes(est.PreviousBytes))
+		if est.PreviousUncompressedBytes > 0 {
+			fmt.Printf("previous_uncompressed_size:\t%s\n", formatBytes(est.PreviousUncompressedBytes))
+		}
+	}
+	if est.EstimatedBytes > 0 {
+		fmt.Printf("estimated_size:\t%s\n", formatBytes(est.EstimatedBytes))
+	} else {
+		fmt.Println("estimated_size:\tunknown (no previous full backup with a recorded compression ratio)")
+	}
+}
+
+// formatBytes renders n as raw bytes followed by a binary-unit approximation.
+func formatBytes(n int64) string {
+	if n < 1024 {
+		return shortBytes(n)
+	}
+	return fmt.Sprintf("%d (%s)", n, shortBytes(n))
+}
+
+// shortBytes renders n in binary units, e.g. 1.5 GiB.
+func shortBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// progressBar renders restore progress on a single, rewritten line of w.
+func progressBar(w io.Writer) func(app.RestoreProgress) {
+	const width = 30
+	return func(p app.RestoreProgress) {
+		line := shortBytes(p.Read) + " read"
+		if pct := p.Percent(); pct >= 0 {
+			filled := int(pct / 100 * width)
+			line = fmt.Sprintf("[%s%s] %5.1f%%  %s / %s", strings.Repeat("=", filled), strings.Repeat(" ", width-filled), pct, shortBytes(p.Read), shortBytes(p.Total))
+		}
+		if p.ETA > 0 {
+			line += "  ETA " + p.ETA.Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "\r%-80s", line)
+		if p.Done {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+func newRestoreCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var key string
+	var tables []string
+	var schemas []string
+	var collections []string
+	var dropExisting bool
+	var createDatabase bool
+	var singleTransaction bool
+	var force bool
+	var manifestID string
+	var rawURL string
+	var listContents bool
+	var progress bool
+	var tableMap map[string]string
+
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore a backup",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if key == "" && manifestID == "" && rawURL == "" {
+				return fmt.Errorf("--key, --id or --url is required")
+			}
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			if cfg.Global.DryRun {
+				cfg.Restore.DryRun = true
+			}
+			if len(tables) > 0 {
+				cfg.Restore.Tables = tables
+			}
+			if len(schemas) > 0 {
+				cfg.Restore.Schemas = schemas
+			}
+			if len(collections) > 0 {
+				cfg.Restore.Collections = collections
+			}
+			if len(tableMap) > 0 {
+				cfg.Restore.TableMap = tableMap
+			}
+			cfg.Restore.DropExisting = dropExisting
+			if createDatabase {
+				cfg.Restore.CreateDatabase = true
+			}
+			if singleTransaction {
+				cfg.Restore.SingleTransaction = true
+			}
+
+			appSvc, logger, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			if manifestID != "" {
+				if key, err = appSvc.ResolveManifestID(ctx, manifestID); err != nil {
+					return err
+				}
+				logger.Info().Str("id", manifestID).Str("key", key).Msg("resolved manifest ID")
+			}
+			if rawURL != "" {
+				if appSvc, key, err = appSvc.WithURL(rawURL); err != nil {
+					return asConfigError(err)
+				}
+			}
+
+			if listContents {
+				contents, err := appSvc.ListContents(ctx, key)
+				if err != nil {
+					return err
+				}
+				for _, obj := range contents.Objects {
+					name := obj.Name
+					if obj.Schema != "" {
+						name = obj.Schema + "." + name
+					}
+					fmt.Printf("%s\t%s\t%s\n", obj.Kind, name, sizeOrDash(obj.Size))
+				}
+				logger.Info().Str("key", key).Int("objects", len(contents.Objects)).Msg("contents listed")
+				return nil
+			}
+
+			if progress {
+				appSvc.OnRestoreProgress = progressBar(os.Stderr)
+			}
+			appSvc.Force = force
+			if err := appSvc.Restore(ctx, key); err != nil {
+				return err
+			}
+			logger.Info().Str("key", key).Msg("restore completed")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&key, "key", "", "Backup object key to restore")
+	cmd.Flags().StringVar(&manifestID, "id", "", "Manifest ID of the backup to restore (e.g. appdb-1700000000000000000), instead of --key")
+	cmd.Flags().StringVar(&rawURL, "url", "", "Restore the backup served at this http(s) URL instead of one in storage (restore.url_token is sent as a bearer token)")
+	cmd.Flags().StringSliceVar(&tables, "tables", nil, "Tables to restore")
+	cmd.Flags().StringSliceVar(&schemas, "schemas", nil, "Schemas to restore (PostgreSQL)")
+	cmd.Flags().StringSliceVar(&collections, "collections", nil, "Collections to restore")
+	cmd.Flags().StringToStringVar(&tableMap, "table-map", nil, "Restore only these tables under new names, e.g. users=users_recovered (PostgreSQL)")
+	cmd.Flags().BoolVar(&root.DryRun, "dry-run", false, "Check the connection and the backup's manifest without restoring")
+	cmd.Flags().BoolVar(&dropExisting, "drop-existing", false, "Drop existing objects before restore")
+	cmd.Flags().BoolVar(&createDatabase, "create-database", false, "Create the target database first (recreated only with --drop-existing)")
+	cmd.Flags().BoolVar(&force, "force", false, "Restore even though the target database already holds tables or collections (audited)")
+	cmd.Flags().BoolVar(&singleTransaction, "single-transaction", false, "Restore in one transaction, rolled back entirely if anything fails (PostgreSQL)")
+	cmd.Flags().BoolVar(&progress, "progress", false, "Show a progress bar with the percentage restored and an ETA on stderr")
+	cmd.Flags().BoolVar(&listContents, "list-contents", false, "List the tables, collections or files in the backup with their sizes instead of restoring it")
+	_ = cmd.RegisterFlagCompletionFunc("key", completeBackupKeys(root, overrides))
+	cmd.MarkFlagsMutuallyExclusive("key", "id", "url")
+
+	return cmd
+}
+
+func newValidateCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Validate configuration and connectivity",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			if errs := notify.Check(cfg.Notifications); len(errs) > 0 {
+				return asConfigError(errors.Join(errs...))
+			}
+			appSvc, logger, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+			if err := appSvc.Validate(ctx); err != nil {
+				return err
+			}
+			logger.Info().Msg("validation succeeded")
+			return nil
+		},
+	}
+}
+
+func newListCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var all, cold, showLabels bool
+	var labelFilter []string
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List available backups",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			appSvc, logger, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+			if all {
+				items, err := appSvc.ListAll(ctx)
+				if err != nil {
+					return err
+				}
+				for _, item := range items {
+					fmt.Printf("%s\t%s\t%s\t%d\t%s\n", orDash(item.DatabaseType), orDash(item.Database), item.Key, item.Size, item.Modified.Format(time.RFC3339))
+				}
+				logger.Info().Int("objects", len(items)).Msg("list completed")
+				return nil
+			}
+			if showLabels || len(labelFilter) > 0 {
+				want, err := parseLabels(labelFilter)
+				if err != nil {
+					return asConfigError(err)
+				}
+				records, err := appSvc.ListManifests(ctx)
+				if err != nil {
+					return err
+				}
+				for _, rec := range records {
+					if !app.MatchLabels(rec.Manifest.Labels, want) {
+						continue
+					}
+					fmt.Printf("%s\t%d\t%s\t%s\n", rec.Object.Key, rec.Object.Size, rec.Object.Modified.Format(time.RFC3339), orDash(app.FormatLabels(rec.Manifest.Labels)))
+				}
+				logger.Info().Msg("list completed")
+				return nil
+			}
+			list := appSvc.List
+			if cold {
+				list = appSvc.ListCold
+			}
+			items, err := list(ctx)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				fmt.Printf("%s\t%d\t%s\n", item.Key, item.Size, item.Modified.Format(time.RFC3339))
+			}
+			logger.Info().Msg("list completed")
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "List every object under storage.prefix with the database type and name parsed from its key")
+	cmd.Flags().BoolVar(&cold, "cold", false, "List this database's backups in the cold tier (storage.tiers.cold)")
+	cmd.Flags().BoolVar(&showLabels, "labels", false, "List backups with their labels, one line per backup")
+	cmd.Flags().StringArrayVar(&labelFilter, "label", nil, "Only list backups labeled key=value (repeatable; a bare value matches reason=<value>)")
+	cmd.MarkFlagsMutuallyExclusive("all", "cold")
+	cmd.MarkFlagsMutuallyExclusive("all", "labels")
+	cmd.MarkFlagsMutuallyExclusive("all", "label")
+	cmd.MarkFlagsMutuallyExclusive("cold", "labels")
+	cmd.MarkFlagsMutuallyExclusive("cold", "label")
+	return cmd
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func newCloneCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var targetConfig string
+	var dropExisting bool
+	var createDatabase bool
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "clone",
+		Short: "Stream a database directly into another database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if targetConfig == "" {
+				return fmt.Errorf("--target-config is required")
+			}
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			target, err := config.Load(targetConfig)
+			if err != nil {
+				return asConfigError(fmt.Errorf("target config: %w", err))
+			}
+			target.Database.Type = strings.ToLower(target.Database.Type)
+			if dropExisting {
+				target.Restore.DropExisting = true
+			}
+			if createDatabase {
+				target.Restore.CreateDatabase = true
+			}
+			targetAdapter, err := db.NewAdapter(target.Database.Type, db.Options{AllowMissingTools: target.Global.AllowMissingTools, Verbose: cfg.Global.Verbose})
+			if err != nil {
+				return asConfigError(err)
+			}
+			appSvc, logger, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			appSvc.Force = force
+			if err := appSvc.Clone(ctx, target, targetAdapter); err != nil {
+				return err
+			}
+			logger.Info().Str("source", cfg.Database.Database).Str("target", target.Database.Database).Msg("clone completed")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&targetConfig, "target-config", "", "Config file describing the target database")
+	cmd.Flags().BoolVar(&dropExisting, "drop-existing", false, "Drop existing objects in the target before restore")
+	cmd.Flags().BoolVar(&createDatabase, "create-database", false, "Create the target database first (recreated only with --drop-existing)")
+	cmd.Flags().BoolVar(&force, "force", false, "Clone even though the target database already holds tables or collections (audited)")
+
+	return cmd
+}
+
+func newReencryptCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var key string
+	var newKey string
+	var outputKey string
+
+	cmd := &cobra.Command{
+		Use:   "reencrypt",
+		Short: "Re-encrypt a backup under a new encryption key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if key == "" {
+				return fmt.Errorf("--key is required")
+			}
+			if newKey == "" {
+				return fmt.Errorf("--new-encryption-key is required")
+			}
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			resolvedKey, err := keyring.Expand(newKey)
+			if err != nil {
+				return asConfigError(fmt.Errorf("new encryption key: %w", err))
+			}
+			appSvc, logger, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			manifest, err := appSvc.Reencrypt(ctx, key, resolvedKey, outputKey)
+			if err != nil {
+				return err
+			}
+			logger.Info().Str("key", manifest.Key).Str("key_fingerprint", manifest.KeyFingerprint).Msg("reencrypt completed")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&key, "key", "", "Backup object key to re-encrypt")
+	cmd.Flags().StringVar(&newKey, "new-encryption-key", "", "New encryption key (base64 or hex); the current key comes from --encryption-key or config")
+	cmd.Flags().StringVar(&outputKey, "output-key", "", "Write the re-encrypted backup to this key instead of replacing the original")
+	_ = cmd.RegisterFlagCompletionFunc("key", completeBackupKeys(root, overrides))
+
+	return cmd
+}
+
+func newConvertCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var key string
+	var compression string
+	var decrypt bool
+	var keepOriginal bool
+	var detect bool
+
+	cmd := &cobra.Command{
+		Use:   "convert",
+		Short: "Re-encode a backup with another compression, or decrypt it for archival",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if key == "" {
+				return fmt.Errorf("--key is required")
+			}
+			if !detect && compression == "" && !decrypt {
+				return fmt.Errorf("--compression, --decrypt or --detect is required")
+			}
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			appSvc, logger, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			if detect {
+				format, err := appSvc.DetectFormat(ctx, key)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s\t%s\n", key, format)
+				return nil
+			}
+			manifest, err := appSvc.Convert(ctx, key, app.ConvertOptions{Compression: compression, Decrypt: decrypt, KeepOriginal: keepOriginal})
+			if err != nil {
+				return err
+			}
+			logger.Info().Str("from", key).Str("key", manifest.Key).Str("compression", manifest.Compression).Bool("encrypted", manifest.Encryption).Msg("convert completed")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&key, "key", "", "Backup object key to convert")
+	cmd.Flags().StringVar(&compression, "compression", "", "Compression to re-encode the backup with (gzip|zstd|br|none); unset keeps the current one")
+	cmd.Flags().BoolVar(&decrypt, "decrypt", false, "Store the converted backup unencrypted")
+	cmd.Flags().BoolVar(&keepOriginal, "keep-original", false, "Keep the original backup beside the converted one")
+	cmd.Flags().BoolVar(&detect, "detect", false, "Print how the backup is compressed and whether it is encrypted, and convert nothing")
+	cmd.MarkFlagsMutuallyExclusive("detect", "compression")
+	cmd.MarkFlagsMutuallyExclusive("detect", "decrypt")
+	_ = cmd.RegisterFlagCompletionFunc("key", completeBackupKeys(root, overrides))
+	_ = cmd.RegisterFlagCompletionFunc("compression", cobra.FixedCompletions(compress.Types, cobra.ShellCompDirectiveNoFileComp))
+
+	return cmd
+}
+
+func newCompactCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var key string
+	var scratch string
+	var prune bool
+	var dropExisting bool
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "compact",
+		Short: "Rebuild a differential backup and its base as one full backup",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if key == "" {
+				return fmt.Errorf("--key is required")
+			}
+			if scratch == "" {
+				return fmt.Errorf("--scratch-database is required")
+			}
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			appSvc, logger, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+			appSvc.Force = force
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			res, err := appSvc.Compact(ctx, key, app.CompactOptions{Scratch: scratch, DropExisting: dropExisting, Prune: prune})
+			if res != nil {
+				logger.Info().Str("key", res.Key).Str("compacted_from", key).Int64("size", res.Manifest.SizeBytes).Strs("pruned", res.Pruned).Msg("compaction completed")
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&key, "key", "", "Differential backup to compact")
+	cmd.Flags().StringVar(&scratch, "scratch-database", "", "Database to restore the chain into; it is created and must not exist yet")
+	cmd.Flags().BoolVar(&dropExisting, "drop-existing", false, "Drop and recreate the scratch database if it already exists")
+	cmd.Flags().BoolVar(&prune, "prune", false, "Delete the differential, and its base if nothing else uses it, once compacted")
+	cmd.Flags().BoolVar(&force, "force", false, "Run even outside the configured backup window")
+	_ = cmd.RegisterFlagCompletionFunc("key", completeBackupKeys(root, overrides))
+
+	return cmd
+}
+
+func newVerifyCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var keys []string
+	var all, deep, asJSON bool
+	var since, maxTime time.Duration
+	var parallel int
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check backups against their manifests without restoring them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if all {
+				deep = true
+			}
+			if parallel < 1 {
+				return asConfigError(fmt.Errorf("--parallel must be at least 1"))
+			}
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			appSvc, _, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			report := verifyReport{Database: cfg.Database.Database, Deep: deep, StartedAt: time.Now().UTC()}
+			results, err := appSvc.Verify(ctx, app.VerifyOptions{
+				Keys:     keys,
+				Since:    since,
+				Deep:     deep,
+				Parallel: parallel,
+				MaxTime:  maxTime,
+				Progress: func(res app.VerifyResult) {
+					if asJSON {
+						return
+					}
+					switch {
+					case res.Skipped:
+						fmt.Printf("SKIP\t%s\tnot checked within --max-time\n", res.Key)
+					case res.Err != nil:
+						fmt.Printf("FAIL\t%s\t%v\n", res.Key, res.Err)
+					case deep && !res.Checksummed:
+						fmt.Printf("PASS\t%s\t%d\t(no checksum recorded)\n", res.Key, res.StoredSize)
+					default:
+						fmt.Printf("PASS\t%s\t%d\n", res.Key, res.StoredSize)
+					}
+				},
+			})
+			report.add(results)
+			report.Duration = time.Since(report.StartedAt).Round(time.Millisecond).String()
+			if err != nil {
+				report.Error = err.Error()
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if encErr := enc.Encode(report); encErr != nil {
+					return encErr
+				}
+				return err
+			}
+			if report.Skipped > 0 {
+				fmt.Printf("Verified %d backups: %d passed, %d failed, %d skipped\n", report.Total, report.Passed, report.Failed, report.Skipped)
+			} else {
+				fmt.Printf("Verified %d backups: %d passed, %d failed\n", report.Total, report.Passed, report.Failed)
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&keys, "key", nil, "Backup object key to verify (repeatable; default: every backup)")
+	cmd.Flags().BoolVar(&all, "all", false, "Deep-verify every backup (with --since, every recent one); for recurring checks")
+	cmd.Flags().BoolVar(&deep, "deep", false, "Stream each backup through decryption and decompression and compare its checksum")
+	cmd.Flags().Var((*dayDuration)(&since), "since", "Only verify backups written within this long, e.g. 168h or 7d (ignored with --key)")
+	cmd.Flags().IntVar(&parallel, "parallel", 1, "Backups to verify at once")
+	cmd.Flags().Var((*dayDuration)(&maxTime), "max-time", "Stop starting checks after this long and report the rest as skipped, e.g. 2h (0: no limit)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print a JSON summary report instead of one line per backup")
+	cmd.MarkFlagsMutuallyExclusive("all", "key")
+	_ = cmd.RegisterFlagCompletionFunc("key", completeBackupKeys(root, overrides))
+
+	return cmd
+}
+
+// verifyReport is the JSON summary of dbu verify --json.
+type verifyReport struct {
+	Database  string              `json:"database"`
+	Deep      bool                `json:"deep"`
+	StartedAt time.Time           `json:"started_at"`
+	Duration  string              `json:"duration"`
+	Total     int                 `json:"total"`
+	Passed    int                 `json:"passed"`
+	Failed    int                 `json:"failed"`
+	Skipped   int                 `json:"skipped"`
+	Error     string              `json:"error,omitempty"`
+	Backups   []verifyReportEntry `json:"backups"`
+}
+
+type verifyReportEntry struct {
+	Key         string `json:"key"`
+	Status      string `json:"status"` // pass, fail or skipped
+	StoredSize  int64  `json:"stored_size"`
+	PlainSize   int64  `json:"plain_size,omitempty"`
+	Checksummed bool   `json:"checksummed"`
+	Error       string `json:"error,omitempty"`
+}
+
+func (r *verifyReport) add(results []app.VerifyResult) {
+	r.Backups = make([]verifyReportEntry, 0, len(results))
+	for _, res := range results {
+		if res.Key == "" {
+			continue // not reached before the operation timed out
+		}
+		entry := verifyReportEntry{Key: res.Key, Status: "pass", StoredSize: res.StoredSize, PlainSize: res.PlainSize, Checksummed: res.Checksummed}
+		switch {
+		case res.Skipped:
+			entry.Status = "skipped"
+			r.Skipped++
+		case res.Err != nil:
+			entry.Status, entry.Error = "fail", res.Err.Error()
+			r.Failed++
+		default:
+			r.Passed++
+		}
+		r.Backups = append(r.Backups, entry)
+	}
+	r.Total = len(r.Backups)
+}
+
+// dayDuration is a time.Duration flag that also takes whole days, e.g. 7d.
+type dayDuration time.Duration
+
+func (d *dayDuration) Set(s string) error {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		*d = dayDuration(time.Duration(n) * 24 * time.Hour)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = dayDuration(v)
+	return nil
+}
+
+func (d *dayDuration) String() string { return time.Duration(*d).String() }
+
+func (d *dayDuration) Type() string { return "duration" }
+
+func newStatusCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the last success and failure of each operation on the database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			appSvc, _, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			status, err := appSvc.Status(ctx)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(status)
+			}
+			ops := slices.Sorted(maps.Keys(status.Operations))
+			for _, op := range ops {
+				st := status.Operations[op]
+				fmt.Printf("%s\tlast success %s\t%s\t%d\n", op, formatStatusTime(st.LastSuccess), orDash(st.LastSuccessKey), st.LastSuccessSize)
+				if !st.LastFailure.IsZero() {
+					fmt.Printf("%s\tlast failure %s\t%s\t%s\n", op, formatStatusTime(st.LastFailure), orDash(st.LastFailureKey), st.LastError)
+				}
+			}
+			if len(ops) == 0 {
+				fmt.Printf("No operations recorded for %s/%s\n", status.DatabaseType, status.Database)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the status object as JSON")
+
+	return cmd
+}
+
+func formatStatusTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func newDiffCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var from, to string
+	var deep bool
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compare two backups' manifests and, with --deep, their contents",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if from == "" || to == "" {
+				return fmt.Errorf("--from and --to are required")
+			}
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			appSvc, _, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			diff, err := appSvc.Diff(ctx, from, to, deep)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(diff)
+			}
+			fmt.Printf("size\t%d -> %d\t%+d\n", diff.FromSize, diff.ToSize, diff.SizeDelta)
+			if diff.FromPlainSize > 0 && diff.ToPlainSize > 0 {
+				fmt.Printf("dump size\t%d -> %d\t%+d\n", diff.FromPlainSize, diff.ToPlainSize, diff.ToPlainSize-diff.FromPlainSize)
+			}
+			for _, name := range diff.AddedTables {
+				fmt.Printf("+\ttable\t%s\n", name)
+			}
+			for _, name := range diff.RemovedTables {
+				fmt.Printf("-\ttable\t%s\n", name)
+			}
+			for _, name := range diff.ChangedTables {
+				fmt.Printf("~\ttable\t%s\tchecksum changed\n", name)
+			}
+			for _, obj := range diff.Objects {
+				switch obj.Change {
+				case "added":
+					fmt.Printf("+\t%s\t%s\t%s\n", obj.Kind, obj.Name, sizeOrDash(obj.ToSize))
+				case "removed":
+					fmt.Printf("-\t%s\t%s\t%s\n", obj.Kind, obj.Name, sizeOrDash(obj.FromSize))
+				default:
+					fmt.Printf("~\t%s\t%s\t%d -> %d\n", obj.Kind, obj.Name, obj.FromSize, obj.ToSize)
+				}
+			}
+			if diff.Empty() {
+				fmt.Println("No table or object differences")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "Backup object key to compare from (usually the older one)")
+	cmd.Flags().StringVar(&to, "to", "", "Backup object key to compare to")
+	cmd.Flags().BoolVar(&deep, "deep", false, "Also read both dumps and compare their tables of contents")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the differences as JSON")
+	_ = cmd.RegisterFlagCompletionFunc("from", completeBackupKeys(root, overrides))
+	_ = cmd.RegisterFlagCompletionFunc("to", completeBackupKeys(root, overrides))
+
+	return cmd
+}
+
+func sizeOrDash(size int64) string {
+	if size <= 0 {
+		return "-"
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+func newScheduleCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var reason string
+	var until string
+	var pauseFor time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "schedule",
+		Short: "Pause and resume scheduled backups of the database",
+	}
+
+	pause := &cobra.Command{
+		Use:   "pause",
+		Short: "Skip backups of the database until resumed; running backups finish",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if until != "" && pauseFor > 0 {
+				return fmt.Errorf("--until and --for are mutually exclusive")
+			}
+			var pauseUntil time.Time
+			switch {
+			case until != "":
+				var err error
+				if pauseUntil, err = parseUntil(until); err != nil {
+					return asConfigError(err)
+				}
+			case pauseFor > 0:
+				pauseUntil = time.Now().Add(pauseFor)
+			}
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			appSvc, logger, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			p, err := appSvc.Pause(ctx, reason, pauseUntil)
+			if err != nil {
+				return err
+			}
+			event := logger.Info().Str("database", cfg.Database.Database).Str("reason", p.Reason)
+			if !p.Until.IsZero() {
+				event = event.Time("until", p.Until)
+			}
+			event.Msg("backups paused")
+			return nil
+		},
+	}
+	pause.Flags().StringVar(&reason, "reason", "", "Why backups are paused, shown in logs and dbu schedule status")
+	pause.Flags().StringVar(&until, "until", "", "Resume automatically at this date (YYYY-MM-DD or RFC 3339)")
+	pause.Flags().DurationVar(&pauseFor, "for", 0, "Resume automatically after this long, e.g. 4h")
+
+	resume := &cobra.Command{
+		Use:   "resume",
+		Short: "Let backups of the database run again",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			appSvc, logger, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			lifted, err := appSvc.Resume(ctx)
+			if err != nil {
+				return err
+			}
+			if !lifted {
+				logger.Info().Str("database", cfg.Database.Database).Msg("backups were not paused")
+				return nil
+			}
+			logger.Info().Str("database", cfg.Database.Database).Msg("backups resumed")
+			return nil
+		},
+	}
+
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "Show whether backups of the database are paused",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			appSvc, _, err := newApp(cfg)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			p, paused, err := appSvc.ReadPause(ctx)
+			if err != nil {
+				return err
+			}
+			if !paused {
+				fmt.Println("running")
+			} else {
+				fmt.Printf("paused\tsince %s\tuntil %s\t%s\t%s\n", p.Since.Format(time.RFC3339), formatPauseUntil(p.Until), orDash(p.Host), orDash(p.Reason))
+			}
+			if cfg.Schedule.WindowStart != "" || cfg.Schedule.WindowEnd != "" {
+				fmt.Printf("window\t%s-%s\n", cfg.Schedule.WindowStart, cfg.Schedule.WindowEnd)
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(pause, resume, status)
+	return cmd
+}
+
+func formatPauseUntil(t time.Time) string {
+	if t.IsZero() {
+		return "resumed"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func newServeCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var listen string
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve stored backups for download over read-only HTTP",
+		Long: `Serve the backups and manifests under the storage prefix over HTTP, so another
+system can download one without storage credentials. GET /backups/ lists them as
+JSON and GET /backups/<key> downloads one, with range requests. Every request
+needs "Authorization: Bearer <serve.token>"; the server refuses to start without
+a token. Nothing is written to storage.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(root, overrides)
+			if err != nil {
+				return err
+			}
+			if listen != "" {
+				cfg.Serve.Listen = listen
+			}
+			if cfg.Serve.Token == "" {
+				return asConfigError(fmt.Errorf("serve.token (or DBU_SERVE_TOKEN) is required"))
+			}
+			if (cfg.Serve.TLSCert == "") != (cfg.Serve.TLSKey == "") {
+				return asConfigError(fmt.Errorf("serve.tls_cert and serve.tls_key must be set together"))
+			}
+			logger := newLogger(cfg)
+			store, err := storage.New(cfg.Storage)
+			if err != nil {
+				return asConfigError(err)
+			}
+
+			server := &http.Server{
+				Addr: cfg.Serve.Listen,
+				Handler: &serve.Handler{
+					Storage: store,
+					Prefix:  util.BuildPrefix(cfg.Storage.Prefix, "", "", ""),
+					Token:   cfg.Serve.Token,
+					Log:     logger,
+				},
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			errc := make(chan error, 1)
+			go func() {
+				if cfg.Serve.TLSCert != "" {
+					errc <- server.ListenAndServeTLS(cfg.Serve.TLSCert, cfg.Serve.TLSKey)
+				} else {
+					errc <- server.ListenAndServe()
+				}
+			}()
+			logger.Info().Str("listen", cfg.Serve.Listen).Bool("tls", cfg.Serve.TLSCert != "").Msg("serving backups")
+			if cfg.Serve.TLSCert == "" {
+				logger.Warn().Msg("serving without TLS: the token and backups cross the network in the clear unless a TLS proxy fronts dbu serve")
+			}
+			select {
+			case err := <-errc:
+				return err
+			case <-ctx.Done():
+			}
+			// Let downloads in flight finish, within reason.
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				return err
+			}
+			logger.Info().Msg("server stopped")
+			return nil
+		},
+	}
 
-	rootCmd.AddCommand(newBackupCmd(root, overrides))
-	rootCmd.AddCommand(newRestoreCmd(root, overrides))
-	rootCmd.AddCommand(newValidateCmd(root, overrides))
-	rootCmd.AddCommand(newListCmd(root, overrides))
-	rootCmd.AddCommand(newConfigCmd())
-	rootCmd.AddCommand(newVersionCmd())
+	cmd.Flags().StringVar(&listen, "listen", "", "Address to listen on (default serve.listen, 127.0.0.1:8089)")
 
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
-	}
+	return cmd
 }
 
-func newBackupCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
-	backup := &cobra.Command{
-		Use:   "backup",
-		Short: "Create a backup",
+func newHoldCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var key string
+	var until string
+
+	cmd := &cobra.Command{
+		Use:   "hold",
+		Short: "Keep a backup from being deleted by retention",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := loadConfig(root, overrides)
-			if err != nil {
-				return err
+			if key == "" {
+				return fmt.Errorf("--key is required")
 			}
-			logger := logging.Configure(cfg.Global.LogLevel, cfg.Global.LogFormat)
-			adapter, err := db.NewAdapter(cfg.Database.Type, cfg.Global.AllowMissingTools)
+			var retainUntil time.Time
+			if until != "" {
+				var err error
+				if retainUntil, err = parseUntil(until); err != nil {
+					return asConfigError(err)
+				}
+			}
+			cfg, err := loadConfig(root, overrides)
 			if err != nil {
 				return err
 			}
-			store, err := storage.New(cfg.Storage)
+			appSvc, logger, err := newApp(cfg)
 			if err != nil {
 				return err
 			}
-			appSvc := app.New(cfg, adapter, store, logger, notify.FromConfig(cfg.Notifications))
 
 			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
 			defer cancel()
 
-			return util.Retry(ctx, cfg.Backup.RetryCount, cfg.Backup.RetryBackoff, func() error {
-				res, err := appSvc.Backup(ctx)
-				if err != nil {
-					return err
-				}
-				logger.Info().Str("key", res.Key).Int64("size", res.Manifest.SizeBytes).Msg("backup completed")
-				return nil
-			})
+			manifest, err := appSvc.Hold(ctx, key, retainUntil)
+			if err != nil {
+				return err
+			}
+			event := logger.Info().Str("key", key).Bool("legal_hold", manifest.LegalHold)
+			if !manifest.RetainUntil.IsZero() {
+				event = event.Time("retain_until", manifest.RetainUntil)
+			}
+			event.Msg("hold placed")
+			return nil
 		},
 	}
-	backup.Flags().StringSliceVar(&overridesDBTables, "tables", nil, "Tables to include (PG/MySQL)")
-	backup.Flags().StringSliceVar(&overridesDBCollections, "collections", nil, "Collections to include (MongoDB)")
-	backup.Flags().StringVar(&backupType, "type", "", "Backup type (full/incremental/differential)")
-	backup.Flags().StringVar(&backupCompression, "compression", "", "Compression (none/gzip/zstd)")
-	backup.Flags().BoolVar(&backupEncryption, "encrypt", false, "Enable encryption")
-	backup.Flags().IntVar(&backupRetry, "retry", 0, "Retry attempts")
-	backup.Flags().DurationVar(&backupRetryBackoff, "retry-backoff", 0, "Retry backoff")
-	return backup
+
+	cmd.Flags().StringVar(&key, "key", "", "Backup object key to hold")
+	cmd.Flags().StringVar(&until, "until", "", "Retain until this date (YYYY-MM-DD or RFC 3339) instead of placing an open-ended legal hold")
+	_ = cmd.RegisterFlagCompletionFunc("key", completeBackupKeys(root, overrides))
+
+	return cmd
 }
 
-var (
-	overridesDBTables      []string
-	overridesDBCollections []string
-	backupType             string
-	backupCompression      string
-	backupEncryption       bool
-	backupRetry            int
-	backupRetryBackoff     time.Duration
-)
+// parseUntil accepts a date (midnight UTC) or an RFC 3339 timestamp.
+func parseUntil(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("--until: want YYYY-MM-DD or an RFC 3339 time, got %q", s)
+	}
+	return t, nil
+}
 
-func newRestoreCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+func newReleaseCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
 	var key string
-	var dryRun bool
-	var tables []string
-	var collections []string
-	var dropExisting bool
 
 	cmd := &cobra.Command{
-		Use:   "restore",
-		Short: "Restore a backup",
+		Use:   "release",
+		Short: "Lift a backup's legal hold and retain-until date",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if key == "" {
 				return fmt.Errorf("--key is required")
@@ -160,19 +1440,39 @@ func newRestoreCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
 			if err != nil {
 				return err
 			}
-			if dryRun {
-				cfg.Restore.DryRun = true
-			}
-			if len(tables) > 0 {
-				cfg.Restore.Tables = tables
+			appSvc, logger, err := newApp(cfg)
+			if err != nil {
+				return err
 			}
-			if len(collections) > 0 {
-				cfg.Restore.Collections = collections
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			if _, err := appSvc.Release(ctx, key); err != nil {
+				return err
 			}
-			cfg.Restore.DropExisting = dropExisting
+			logger.Info().Str("key", key).Msg("hold released")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&key, "key", "", "Backup object key to release")
+	_ = cmd.RegisterFlagCompletionFunc("key", completeBackupKeys(root, overrides))
+
+	return cmd
+}
+
+func newStorageCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "storage",
+		Short: "Storage backend utilities",
+	}
 
-			logger := logging.Configure(cfg.Global.LogLevel, cfg.Global.LogFormat)
-			adapter, err := db.NewAdapter(cfg.Database.Type, cfg.Global.AllowMissingTools)
+	test := &cobra.Command{
+		Use:   "test",
+		Short: "Round-trip a sentinel object through the configured storage backend",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(root, overrides)
 			if err != nil {
 				return err
 			}
@@ -180,90 +1480,242 @@ func newRestoreCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
 			if err != nil {
 				return err
 			}
-			appSvc := app.New(cfg, adapter, store, logger, notify.FromConfig(cfg.Notifications))
 
 			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
 			defer cancel()
 
-			if err := appSvc.Restore(ctx, key); err != nil {
-				return err
+			failed := false
+			for _, res := range storage.RoundTrip(ctx, store, cfg.Storage.Prefix) {
+				if res.Err != nil {
+					failed = true
+					fmt.Printf("FAIL\t%s\t%s\t%v\n", res.Step, res.Duration.Round(time.Millisecond), res.Err)
+					continue
+				}
+				fmt.Printf("PASS\t%s\t%s\n", res.Step, res.Duration.Round(time.Millisecond))
+			}
+			if failed {
+				return fmt.Errorf("storage round-trip failed for backend %q", cfg.Storage.Backend)
 			}
-			logger.Info().Str("key", key).Msg("restore completed")
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&key, "key", "", "Backup object key to restore")
-	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Perform a dry run")
-	cmd.Flags().StringSliceVar(&tables, "tables", nil, "Tables to restore")
-	cmd.Flags().StringSliceVar(&collections, "collections", nil, "Collections to restore")
-	cmd.Flags().BoolVar(&dropExisting, "drop-existing", false, "Drop existing objects before restore")
-
+	cmd.AddCommand(test)
 	return cmd
 }
 
-func newValidateCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
-	return &cobra.Command{
-		Use:   "validate",
-		Short: "Validate configuration and connectivity",
+func newMigrateStorageCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var targetConfig string
+	var deleteSource bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate-storage",
+		Short: "Copy all backups and manifests to another storage backend",
+		Long: `Copy every object under the storage prefix to the storage described by
+--target-config, keeping keys and verifying each copy by SHA-256. Objects already
+at the destination with the same size are skipped, so an interrupted migration
+can simply be re-run.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if targetConfig == "" {
+				return fmt.Errorf("--target-config is required")
+			}
 			cfg, err := loadConfig(root, overrides)
 			if err != nil {
 				return err
 			}
-			logger := logging.Configure(cfg.Global.LogLevel, cfg.Global.LogFormat)
-			adapter, err := db.NewAdapter(cfg.Database.Type, cfg.Global.AllowMissingTools)
+			target, err := config.Load(targetConfig)
 			if err != nil {
-				return err
+				return asConfigError(fmt.Errorf("target config: %w", err))
 			}
-			store, err := storage.New(cfg.Storage)
+			if sameStorage(cfg.Storage, target.Storage) {
+				return asConfigError(fmt.Errorf("source and target storage are the same"))
+			}
+			src, err := storage.New(cfg.Storage)
 			if err != nil {
 				return err
 			}
-			appSvc := app.New(cfg, adapter, store, logger, notify.FromConfig(cfg.Notifications))
+			dst, err := storage.New(target.Storage)
+			if err != nil {
+				return fmt.Errorf("target storage: %w", err)
+			}
+
 			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
 			defer cancel()
-			if err := appSvc.Validate(ctx); err != nil {
-				return err
-			}
-			logger.Info().Msg("validation succeeded")
-			return nil
+
+			var copied, skipped int
+			var total int64
+			err = storage.Migrate(ctx, src, dst, util.BuildPrefix(cfg.Storage.Prefix, "", "", ""), storage.MigrateOptions{
+				DeleteSource: deleteSource,
+				Progress: func(res storage.MigrateResult) {
+					switch {
+					case res.Err != nil:
+						fmt.Printf("FAIL\t%s\t%v\n", res.Key, res.Err)
+					case res.Skipped:
+						skipped++
+						fmt.Printf("SKIP\t%s\n", res.Key)
+					default:
+						copied++
+						total += res.Size
+						fmt.Printf("COPY\t%s\t%d\n", res.Key, res.Size)
+					}
+				},
+			})
+			fmt.Printf("Copied %d objects totalling %s, skipped %d already present\n", copied, formatBytes(total), skipped)
+			return err
 		},
 	}
+
+	cmd.Flags().StringVar(&targetConfig, "target-config", "", "Config file whose storage section is the destination")
+	cmd.Flags().BoolVar(&deleteSource, "delete-source", false, "Delete each backup from the source once all of it is copied and verified")
+
+	return cmd
 }
 
-func newListCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
-	return &cobra.Command{
-		Use:   "list",
-		Short: "List available backups",
+// sameStorage reports whether two storage configs point at the same objects.
+func sameStorage(a, b config.StorageConfig) bool {
+	if !strings.EqualFold(a.Backend, b.Backend) {
+		return false
+	}
+	if strings.EqualFold(a.Backend, "s3") {
+		return a.S3.Endpoint == b.S3.Endpoint && a.S3.Bucket == b.S3.Bucket
+	}
+	pa, errA := filepath.Abs(a.Local.Path)
+	pb, errB := filepath.Abs(b.Local.Path)
+	return errA == nil && errB == nil && pa == pb
+}
+
+func newDictCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var samples int
+	var maxSize int
+	var allDatabases bool
+
+	cmd := &cobra.Command{
+		Use:   "dict",
+		Short: "Manage shared zstd compression dictionaries",
+	}
+
+	train := &cobra.Command{
+		Use:   "train",
+		Short: "Train a zstd dictionary from recent backups and store it",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := loadConfig(root, overrides)
 			if err != nil {
 				return err
 			}
-			logger := logging.Configure(cfg.Global.LogLevel, cfg.Global.LogFormat)
-			adapter, err := db.NewAdapter(cfg.Database.Type, cfg.Global.AllowMissingTools)
+			appSvc, _, err := newApp(cfg)
 			if err != nil {
 				return err
 			}
-			store, err := storage.New(cfg.Storage)
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+			defer cancel()
+
+			dict, err := appSvc.TrainDictionary(ctx, samples, maxSize, allDatabases)
 			if err != nil {
 				return err
 			}
-			appSvc := app.New(cfg, adapter, store, logger, notify.FromConfig(cfg.Notifications))
-			ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
-			defer cancel()
-			items, err := appSvc.List(ctx)
+			fmt.Printf("Trained dictionary %08x from %d backups, size %s, stored at %s\n", dict.ID, len(dict.Samples), formatBytes(int64(dict.Size)), dict.Key)
+			fmt.Printf("Use it for new backups with:\n  backup:\n    zstd_dictionary: \"%08x\"\n", dict.ID)
+			return nil
+		},
+	}
+	train.Flags().IntVar(&samples, "samples", 100, "Number of recent backups to sample (0 for all)")
+	train.Flags().IntVar(&maxSize, "max-size", app.DefaultDictionarySize, "Maximum dictionary size in bytes")
+	train.Flags().BoolVar(&allDatabases, "all-databases", false, "Sample backups of every database under the storage prefix")
+
+	cmd.AddCommand(train)
+	return cmd
+}
+
+func newBenchCmd(root *rootFlags, overrides *overrideFlags) *cobra.Command {
+	var size int64
+	var file string
+	var key string
+	var codecs []string
+	var ciphers []string
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Measure compression and encryption throughput and ratio on this host",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if size <= 0 {
+				return asConfigError(fmt.Errorf("--size must be positive"))
+			}
+			var data []byte
+			var source string
+			switch {
+			case file != "":
+				f, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				if data, err = io.ReadAll(io.LimitReader(f, size)); err != nil {
+					return err
+				}
+				source = file
+			case key != "":
+				cfg, err := loadConfig(root, overrides)
+				if err != nil {
+					return err
+				}
+				appSvc, _, err := newApp(cfg)
+				if err != nil {
+					return err
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+				defer cancel()
+				if data, err = appSvc.ReadSample(ctx, key, size); err != nil {
+					return err
+				}
+				source = key
+			default:
+				data, source = bench.Synthetic(size), "synthetic"
+			}
+			if len(data) == 0 {
+				return fmt.Errorf("%s holds no data to measure", source)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			results, err := bench.Run(ctx, data, codecs, ciphers)
 			if err != nil {
 				return err
 			}
-			for _, item := range items {
-				fmt.Printf("%s\t%d\t%s\n", item.Key, item.Size, item.Modified.Format(time.RFC3339))
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(struct {
+					Source  string         `json:"source"`
+					Bytes   int            `json:"bytes"`
+					Results []bench.Result `json:"results"`
+				}{source, len(data), results})
 			}
-			logger.Info().Msg("list completed")
-			return nil
+			fmt.Printf("Measured on %s of %s data\n\n", shortBytes(int64(len(data))), source)
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "KIND\tNAME\tRATIO\tOUTPUT\tWRITE MiB/s\tREAD MiB/s")
+			for _, res := range results {
+				name := res.Name
+				if res.Default {
+					name += " (default)"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%.2f\t%s\t%.1f\t%.1f\n", res.Kind, name, res.Ratio, shortBytes(res.OutputBytes), res.WriteMiBs, res.ReadMiBs)
+			}
+			return tw.Flush()
 		},
 	}
+
+	cmd.Flags().Int64Var(&size, "size", 64<<20, "Bytes of data to measure with")
+	cmd.Flags().StringVar(&file, "file", "", "Measure with the start of this file, e.g. an uncompressed dump, instead of synthetic data")
+	cmd.Flags().StringVar(&key, "key", "", "Measure with the start of this backup's dump, read through the configured storage")
+	cmd.Flags().StringSliceVar(&codecs, "codecs", compress.Types, "Compression codecs to measure")
+	cmd.Flags().StringSliceVar(&ciphers, "ciphers", cryptoutil.Ciphers, "Cipher suites to measure")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the results as JSON")
+	cmd.MarkFlagsMutuallyExclusive("file", "key")
+	_ = cmd.RegisterFlagCompletionFunc("key", completeBackupKeys(root, overrides))
+
+	return cmd
 }
 
 func newConfigCmd() *cobra.Command {
@@ -291,25 +1743,185 @@ func newConfigCmd() *cobra.Command {
 	encrypt.Flags().StringVar(&key, "key", "", "Encryption key (base64 or hex)")
 
 	cmd.AddCommand(encrypt)
+	cmd.AddCommand(newSetKeyCmd(), newGetKeyCmd())
+	return cmd
+}
+
+func newSetKeyCmd() *cobra.Command {
+	var account string
+	var key string
+	var generate bool
+
+	cmd := &cobra.Command{
+		Use:   "set-key",
+		Short: "Store the backup encryption key in the OS keychain",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (key == "") == !generate {
+				return fmt.Errorf("exactly one of --key or --generate is required")
+			}
+			if generate {
+				raw := make([]byte, 32)
+				if _, err := rand.Read(raw); err != nil {
+					return err
+				}
+				key = "base64:" + base64.StdEncoding.EncodeToString(raw)
+			}
+			if _, err := cryptoutil.ParseKey(key); err != nil {
+				return err
+			}
+			if err := keyring.Set(account, key); err != nil {
+				return err
+			}
+			fmt.Printf("stored key for account %q; use encryption_key: %s%s\n", account, keyring.Prefix, account)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&account, "account", keyring.DefaultAccount, "Keychain account name")
+	cmd.Flags().StringVar(&key, "key", "", "Encryption key (base64 or hex)")
+	cmd.Flags().BoolVar(&generate, "generate", false, "Generate a new random key")
+	return cmd
+}
+
+func newGetKeyCmd() *cobra.Command {
+	var account string
+
+	cmd := &cobra.Command{
+		Use:   "get-key",
+		Short: "Print the backup encryption key stored in the OS keychain",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := keyring.Get(account)
+			if err != nil {
+				return err
+			}
+			fmt.Println(key)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&account, "account", keyring.DefaultAccount, "Keychain account name")
 	return cmd
 }
 
+// versionInfo is the machine-readable output of "dbu version --json".
+type versionInfo struct {
+	version.BuildInfo
+	DatabaseTypes []string `json:"database_types"`
+	Compression   []string `json:"compression"`
+}
+
 func newVersionCmd() *cobra.Command {
-	return &cobra.Command{
+	var asJSON bool
+
+	cmd := &cobra.Command{
 		Use:   "version",
 		Short: "Show version",
-		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Printf("dbu %s (commit %s, built %s)\n", version.Version, version.Commit, version.Date)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(versionInfo{BuildInfo: version.Info(), DatabaseTypes: db.Types, Compression: compress.Types})
+			}
+			info := version.Info()
+			fmt.Fprintf(cmd.OutOrStdout(), "dbu %s (commit %s, built %s)\n", info.Version, info.Commit, info.Date)
+			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print build metadata and supported features as JSON")
+
+	return cmd
+}
+
+func newApp(cfg *config.Config) (*app.App, zerolog.Logger, error) {
+	appSvc, logger, err := newStorageApp(cfg)
+	if err != nil {
+		return nil, logger, err
+	}
+	if appSvc.Adapter, err = newAdapter(cfg); err != nil {
+		return nil, logger, err
+	}
+	return appSvc, logger, nil
+}
+
+func newAdapter(cfg *config.Config) (db.Adapter, error) {
+	adapter, err := db.NewAdapter(cfg.Database.Type, db.Options{AllowMissingTools: cfg.Global.AllowMissingTools, Verbose: cfg.Global.Verbose})
+	if err != nil {
+		return nil, asConfigError(err)
+	}
+	return adapter, nil
+}
+
+// newStorageApp builds an App without a database adapter, for commands that only
+// work on storage or that pick the database later.
+func newStorageApp(cfg *config.Config) (*app.App, zerolog.Logger, error) {
+	logger := newLogger(cfg)
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		return nil, logger, asConfigError(err)
+	}
+	auditLog, err := audit.Open(cfg.Audit, audit.ResolveActor(cfg.Audit.Actor))
+	if err != nil {
+		return nil, logger, asConfigError(err)
+	}
+	notifier, warnings := notify.FromConfig(cfg.Notifications)
+	for _, warning := range warnings {
+		logger.Warn().Err(warning).Msg("skipping notification channel")
+	}
+	appSvc := app.New(cfg, nil, store, logger, notifier)
+	appSvc.Audit = auditLog
+	return appSvc, logger, nil
+}
+
+func newLogger(cfg *config.Config) zerolog.Logger {
+	return logging.Configure(logging.Options{
+		Level:      cfg.Global.LogLevel,
+		Format:     cfg.Global.LogFormat,
+		Stdout:     cfg.Global.LogStdout,
+		File:       cfg.Global.LogFile,
+		MaxSizeMB:  cfg.Global.LogMaxSizeMB,
+		MaxAgeDays: cfg.Global.LogMaxAgeDays,
+		MaxBackups: cfg.Global.LogMaxBackups,
+	})
+}
+
+// readStdinSecrets fills the overrides requested with --db-password-stdin or
+// --encryption-key-stdin from the first line of in.
+func readStdinSecrets(overrides *overrideFlags, in io.Reader) error {
+	var target *string
+	var flag string
+	switch {
+	case overrides.DBPasswordStdin:
+		target, flag = &overrides.DBPassword, "--db-password-stdin"
+	case overrides.EncryptionKeyStdin:
+		target, flag = &overrides.EncryptionKey, "--encryption-key-stdin"
+	default:
+		return nil
+	}
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return asConfigError(fmt.Errorf("%s: %w", flag, err))
+	}
+	secret := strings.TrimRight(line, "\r\n")
+	if secret == "" {
+		return asConfigError(fmt.Errorf("%s: nothing was read from stdin", flag))
+	}
+	*target = secret
+	return nil
 }
 
 func loadConfig(root *rootFlags, overrides *overrideFlags) (*config.Config, error) {
 	cfg, err := config.Load(root.ConfigPath)
 	if err != nil {
-		return nil, err
+		return nil, asConfigError(err)
 	}
 	applyOverrides(cfg, root, overrides)
+	if overrides.OutputPrefix != "" {
+		if cfg.Backup.OutputPrefix, err = util.RenderPrefix(overrides.OutputPrefix, time.Now()); err != nil {
+			return nil, asConfigError(err)
+		}
+	}
+	if cfg.Backup.EncryptionKey, err = keyring.Expand(cfg.Backup.EncryptionKey); err != nil {
+		return nil, asConfigError(fmt.Errorf("encryption key: %w", err))
+	}
 	return cfg, nil
 }
 
@@ -317,9 +1929,21 @@ func applyOverrides(cfg *config.Config, root *rootFlags, overrides *overrideFlag
 	if root.LogLevel != "" {
 		cfg.Global.LogLevel = root.LogLevel
 	}
+	if root.Quiet {
+		cfg.Global.LogLevel = "error"
+	}
 	if root.LogFormat != "" {
 		cfg.Global.LogFormat = root.LogFormat
 	}
+	if root.DryRun {
+		cfg.Global.DryRun = true
+	}
+	if root.Verbose {
+		cfg.Global.Verbose = true
+	}
+	if root.Actor != "" {
+		cfg.Audit.Actor = root.Actor
+	}
 
 	if overrides.DBType != "" {
 		cfg.Database.Type = overrides.DBType
@@ -330,6 +1954,15 @@ func applyOverrides(cfg *config.Config, root *rootFlags, overrides *overrideFlag
 	if overrides.DBPort != 0 {
 		cfg.Database.Port = overrides.DBPort
 	}
+	if overrides.DBSocket != "" {
+		cfg.Database.Socket = overrides.DBSocket
+	}
+	if overrides.DBReadHost != "" {
+		cfg.Database.ReadHost = overrides.DBReadHost
+	}
+	if overrides.DBReadPort != 0 {
+		cfg.Database.ReadPort = overrides.DBReadPort
+	}
 	if overrides.DBUser != "" {
 		cfg.Database.Username = overrides.DBUser
 	}
@@ -364,6 +1997,9 @@ func applyOverrides(cfg *config.Config, root *rootFlags, overrides *overrideFlag
 	if overrides.S3Region != "" {
 		cfg.Storage.S3.Region = overrides.S3Region
 	}
+	if overrides.S3Profile != "" {
+		cfg.Storage.S3.Profile = overrides.S3Profile
+	}
 	if overrides.S3Endpoint != "" {
 		cfg.Storage.S3.Endpoint = overrides.S3Endpoint
 	}
@@ -383,19 +2019,62 @@ func applyOverrides(cfg *config.Config, root *rootFlags, overrides *overrideFlag
 	}
 	if backupCompression != "" {
 		cfg.Backup.Compression = strings.ToLower(backupCompression)
+		if cfg.Backup.Compression != compress.TypeZstd {
+			cfg.Backup.ZstdDictionary = ""
+		}
 	}
 	if backupEncryption {
 		cfg.Backup.Encryption = true
 	}
+	// Flags beat the per-type overrides from the config file.
+	if o, ok := cfg.Backup.Overrides[strings.ToLower(cfg.Backup.Type)]; ok {
+		if backupCompression != "" {
+			o.Compression, o.ZstdDictionary = "", ""
+		}
+		if backupEncryption {
+			o.Encryption = nil
+		}
+		cfg.Backup.Overrides[strings.ToLower(cfg.Backup.Type)] = o
+	}
 	if backupRetry > 0 {
 		cfg.Backup.RetryCount = backupRetry
 	}
 	if backupRetryBackoff > 0 {
 		cfg.Backup.RetryBackoff = backupRetryBackoff
 	}
+	if backupRetryJitter > 0 {
+		cfg.Backup.RetryJitter = backupRetryJitter
+	}
+	if backupRetryMaxElapsed > 0 {
+		cfg.Backup.RetryMaxElapsed = backupRetryMaxElapsed
+	}
+	if backupMaxSize > 0 {
+		cfg.Backup.MaxSizeBytes = backupMaxSize
+	}
+	if backupMaxDuration > 0 {
+		cfg.Backup.MaxDuration = backupMaxDuration
+	}
+	if backupSchemaOnly {
+		cfg.Backup.IncludeSchema, cfg.Backup.IncludeData = true, false
+	}
+	if backupDataOnly {
+		cfg.Backup.IncludeSchema, cfg.Backup.IncludeData = false, true
+	}
+	if backupNoBlobs {
+		cfg.Backup.NoBlobs, cfg.Backup.BlobsOnly = true, false
+	}
+	if backupBlobsOnly {
+		cfg.Backup.NoBlobs, cfg.Backup.BlobsOnly = false, true
+	}
 	if len(overridesDBTables) > 0 {
 		cfg.Backup.Tables = overridesDBTables
 	}
+	if len(overridesDBSchemas) > 0 {
+		cfg.Backup.Schemas = overridesDBSchemas
+	}
+	if len(overridesDBExcludeSchemas) > 0 {
+		cfg.Backup.ExcludeSchemas = overridesDBExcludeSchemas
+	}
 	if len(overridesDBCollections) > 0 {
 		cfg.Backup.Collections = overridesDBCollections
 	}
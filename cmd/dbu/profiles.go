@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rowjay/db-backup-utility/internal/app"
+	"github.com/rowjay/db-backup-utility/internal/config"
+)
+
+// checkAllFlags refuses the flags that pick a database alongside --all, where
+// every profile names its own.
+func checkAllFlags(overrides *overrideFlags) error {
+	if overrides.DBType != "" || overrides.DBHost != "" || overrides.DBPort != 0 || overrides.DBSocket != "" ||
+		overrides.DBReadHost != "" || overrides.DBReadPort != 0 || overrides.DBUser != "" || overrides.DBPassword != "" ||
+		overrides.DBName != "" || overrides.SQLitePath != "" {
+		return asConfigError(errors.New("--all backs up the databases under profiles; the database flags pick a single one"))
+	}
+	return nil
+}
+
+// backupProfiles backs up every profile in cfg, up to parallel at a time, in the
+// order of cfg.ProfileNames, and prints one line per profile to out. Each backup
+// takes its own lock file (global.lock_scope database), so a slow database does
+// not hold up the others. It fails when any profile's backup did.
+func backupProfiles(cfg *config.Config, parallel int, out io.Writer) error {
+	if parallel < 1 {
+		return asConfigError(fmt.Errorf("--parallel must be at least 1, got %d", parallel))
+	}
+	names := cfg.ProfileNames()
+	if len(names) == 0 {
+		return asConfigError(errors.New("--all needs at least one database under profiles"))
+	}
+	base, logger, err := newStorageApp(cfg)
+	if err != nil {
+		return err
+	}
+	base.Force = backupForce
+	base.NoLock = backupNoLock
+
+	errs := make([]error, len(names))
+	var g errgroup.Group
+	g.SetLimit(parallel)
+	for i, name := range names {
+		g.Go(func() error {
+			errs[i] = backupProfile(base, name)
+			if errs[i] != nil {
+				logger.Error().Err(errs[i]).Str("profile", name).Msg("profile backup failed")
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	var failed []string
+	for i, name := range names {
+		if errs[i] != nil {
+			fmt.Fprintf(out, "%s\tfailed: %v\n", name, errs[i])
+			failed = append(failed, name)
+			continue
+		}
+		fmt.Fprintf(out, "%s\tok\n", name)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d profile backups failed: %s", len(failed), len(names), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// backupProfile runs the backup of one profile with the storage, audit trail and
+// notifications of base.
+func backupProfile(base *app.App, name string) error {
+	cfg, err := base.Cfg.ForProfile(name)
+	if err != nil {
+		return err
+	}
+	cfg.Database.Type = strings.ToLower(cfg.Database.Type)
+	cfg.Global.LockScope = "database"
+	adapter, err := newAdapter(cfg)
+	if err != nil {
+		return err
+	}
+	logger := base.Log.With().Str("profile", name).Logger()
+	appSvc := app.New(cfg, adapter, base.Storage, logger, base.Notifier)
+	appSvc.Audit = base.Audit
+	appSvc.Force = base.Force
+	appSvc.NoLock = base.NoLock
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Global.OperationTimeout)
+	defer cancel()
+	return runBackup(ctx, appSvc, logger)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupAllReportsEachProfile(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not available")
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"auth", "billing"} {
+		if out, err := exec.Command("sqlite3", filepath.Join(dir, name+".db"), "CREATE TABLE t (id INTEGER); INSERT INTO t VALUES (1);").CombinedOutput(); err != nil {
+			t.Fatalf("create %s: %v: %s", name, err, out)
+		}
+	}
+	cfgPath := filepath.Join(dir, "dbu.yaml")
+	cfgYAML := fmt.Sprintf(`global:
+  lock_file: %[1]s/dbu.lock
+backup:
+  compression: gzip
+storage:
+  local:
+    path: %[1]s/backups
+profiles:
+  auth:
+    database: {type: sqlite, database: auth, sqlite_path: %[1]s/auth.db}
+  billing:
+    database: {type: sqlite, database: billing, sqlite_path: %[1]s/billing.db}
+  broken:
+    database: {type: sqlite, database: broken, sqlite_path: %[1]s/missing.db}
+`, dir)
+	if err := os.WriteFile(cfgPath, []byte(cfgYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetArgs([]string{"backup", "--config", cfgPath, "--all", "--parallel", "2", "--retry", "1", "--quiet"})
+	cmd.SetOut(&out)
+	cmd.SetErr(&bytes.Buffer{})
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 profile backups failed: broken") || exitCode(err) != exitFailure {
+		t.Fatalf("expected the broken profile to fail the run, got %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || lines[0] != "auth\tok" || lines[1] != "billing\tok" || !strings.HasPrefix(lines[2], "broken\tfailed: ") {
+		t.Fatalf("unexpected report:\n%s", out.String())
+	}
+	for _, name := range []string{"auth", "billing"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, "backups", "sqlite", name, "*.manifest.json"))
+		if len(matches) != 1 {
+			t.Fatalf("expected one backup of %s, got %v", name, matches)
+		}
+	}
+}
+
+func TestBackupAllRefusesDatabaseFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"backup", "--all", "--db-name", "appdb"},
+		{"backup", "--parallel", "2"},
+	} {
+		cmd := newRootCmd()
+		cmd.SetArgs(args)
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		if err := cmd.Execute(); err == nil || exitCode(err) != exitConfig {
+			t.Fatalf("%v: expected a config error, got %v", args, err)
+		}
+	}
+}
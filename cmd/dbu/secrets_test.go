@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadStdinSecrets(t *testing.T) {
+	overrides := &overrideFlags{EncryptionKeyStdin: true}
+	if err := readStdinSecrets(overrides, strings.NewReader("base64:c2VjcmV0 key\r\nignored\n")); err != nil {
+		t.Fatal(err)
+	}
+	if overrides.EncryptionKey != "base64:c2VjcmV0 key" {
+		t.Fatalf("encryption key = %q", overrides.EncryptionKey)
+	}
+
+	overrides = &overrideFlags{DBPasswordStdin: true}
+	if err := readStdinSecrets(overrides, strings.NewReader("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+	if overrides.DBPassword != "hunter2" {
+		t.Fatalf("password = %q", overrides.DBPassword)
+	}
+
+	err := readStdinSecrets(&overrideFlags{DBPasswordStdin: true}, strings.NewReader("\n"))
+	if err == nil || exitCode(err) != exitConfig {
+		t.Fatalf("expected a config error for empty stdin, got %v", err)
+	}
+}
+
+func TestStdinSecretFlagsExclusive(t *testing.T) {
+	for _, args := range [][]string{
+		{"version", "--encryption-key", "k", "--encryption-key-stdin"},
+		{"version", "--db-password-stdin", "--encryption-key-stdin"},
+	} {
+		cmd := newRootCmd()
+		cmd.SetArgs(args)
+		cmd.SetIn(strings.NewReader("secret\n"))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "none of the others can be") {
+			t.Fatalf("%v: expected a mutually exclusive flag error, got %v", args, err)
+		}
+	}
+}
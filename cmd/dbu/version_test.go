@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestVersionJSON(t *testing.T) {
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"version", "--json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Version       string   `json:"version"`
+		GoVersion     string   `json:"go_version"`
+		OS            string   `json:"os"`
+		Arch          string   `json:"arch"`
+		DatabaseTypes []string `json:"database_types"`
+		Compression   []string `json:"compression"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	if got.Version == "" || got.GoVersion != runtime.Version() || got.OS != runtime.GOOS || got.Arch != runtime.GOARCH {
+		t.Fatalf("unexpected build metadata %+v", got)
+	}
+	if !slices.Contains(got.DatabaseTypes, "postgres") || !slices.Contains(got.Compression, "zstd") {
+		t.Fatalf("missing feature lists %+v", got)
+	}
+}
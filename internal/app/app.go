@@ -1,22 +1,31 @@
 package app
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/rowjay/db-backup-utility/internal/audit"
 	"github.com/rowjay/db-backup-utility/internal/compress"
 	"github.com/rowjay/db-backup-utility/internal/config"
 	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
 	"github.com/rowjay/db-backup-utility/internal/db"
-	"github.com/rowjay/db-backup-utility/internal/lock"
 	"github.com/rowjay/db-backup-utility/internal/notify"
 	"github.com/rowjay/db-backup-utility/internal/storage"
 	"github.com/rowjay/db-backup-utility/internal/util"
@@ -29,9 +38,24 @@ type App struct {
 	Storage  storage.Storage
 	Log      zerolog.Logger
 	Notifier notify.Notifier
+	Audit    *audit.Logger
+	// Emergency overrides for manual backups (--force, --no-lock); recorded in the audit trail.
+	Force  bool // run outside the backup window, or restore into a non-empty database
+	NoLock bool // skip the lock file
+	// OnRestoreProgress, when set, is called about every second while a restore
+	// streams a backup, and once more when it has finished with it.
+	OnRestoreProgress func(RestoreProgress)
+
+	// compacting, when set, makes backup dump a scratch copy of a restored chain.
+	compacting *compaction
 }
 
+// New builds an App. With storage.listing_cache_ttl set, store is wrapped in a
+// listing cache that every operation of the App shares until its results expire.
 func New(cfg *config.Config, adapter db.Adapter, store storage.Storage, log zerolog.Logger, notifier notify.Notifier) *App {
+	if cfg.Storage.ListingCacheTTL > 0 {
+		store = storage.NewCachedTTL(store, cfg.Storage.ListingCacheTTL)
+	}
 	return &App{Cfg: cfg, Adapter: adapter, Storage: store, Log: log, Notifier: notifier}
 }
 
@@ -40,69 +64,178 @@ type BackupResult struct {
 	Key      string
 }
 
+// Plan describes what a backup would do without touching the database or writing to storage.
+type Plan struct {
+	Key              string
+	InWindow         bool
+	Paused           bool // dbu schedule pause holds the database's backups
+	Forced           bool // --force runs the backup outside the window or while paused
+	RetentionDeletes []string
+	RetentionMoves   []string // to the cold tier
+	Notifications    []string
+}
+
+// PlanBackup computes the object key, retention deletions, and notification targets
+// for a backup run. Storage is listed but never written.
+func (a *App) PlanBackup(ctx context.Context) (*Plan, error) {
+	a = a.withBackupOverrides()
+	now := time.Now()
+	inWindow, err := util.InWindow(now, a.Cfg.Schedule.WindowStart, a.Cfg.Schedule.WindowEnd, a.Cfg.Schedule.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	_, paused, err := a.ReadPause(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read pause: %w", err)
+	}
+	status := statusFromErr(nil)
+	switch {
+	case a.Force:
+	case !inWindow:
+		status = statusFromErr(ErrWindowSkipped)
+	case paused:
+		status = statusFromErr(ErrPaused)
+	}
+	ext := buildExtension(a.Cfg.Backup.Compression, a.Cfg.Backup.Encryption)
+	plan := &Plan{
+		Key:           util.BuildObjectKey(a.Cfg.Storage.Prefix, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database, a.Cfg.Backup.Type, now, ext),
+		InWindow:      inWindow,
+		Paused:        paused,
+		Forced:        a.Force,
+		Notifications: notify.Targets(a.Cfg.Notifications, "backup", status),
+	}
+	pending := &backupObject{ObjectInfo: storage.ObjectInfo{Key: plan.Key, Modified: now}}
+	candidates, err := a.retentionCandidates(ctx, pending)
+	if err != nil {
+		return nil, err
+	}
+	cold := a.coldTier()
+	for _, obj := range candidates {
+		if cold != nil {
+			plan.RetentionMoves = append(plan.RetentionMoves, obj.Key)
+		} else {
+			plan.RetentionDeletes = append(plan.RetentionDeletes, obj.Key)
+		}
+	}
+	if cold != nil {
+		expired, err := cold.retentionCandidates(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range expired {
+			plan.RetentionDeletes = append(plan.RetentionDeletes, obj.Key)
+		}
+	}
+	return plan, nil
+}
+
+// Backup runs one backup with the overrides for its type applied. Storage lookups
+// are cached for this call only, so a retry or a later run starts from fresh
+// listings, unless storage.listing_cache_ttl shares them across runs.
 func (a *App) Backup(ctx context.Context) (*BackupResult, error) {
+	op := a.withBackupOverrides()
+	op.Storage = a.cachedStorage()
+	return op.backup(ctx)
+}
+
+// cachedStorage returns the storage an operation caches its lookups in: the
+// App's shared listing cache when it has one, or a cache for the operation.
+func (a *App) cachedStorage() storage.Storage {
+	if cached, ok := a.Storage.(*storage.Cached); ok {
+		return cached
+	}
+	return storage.NewCached(a.Storage)
+}
+
+func (a *App) backup(ctx context.Context) (*BackupResult, error) {
 	start := time.Now()
 	var opErr error
 	var key string
-	defer func() {
-		if a.Notifier == nil {
-			return
-		}
-		event := notify.Event{
-			Type:      "backup",
-			Message:   fmt.Sprintf("backup %s", a.Cfg.Database.Database),
-			Status:    statusFromErr(opErr),
-			Database:  a.Cfg.Database.Database,
-			DBType:    a.Cfg.Database.Type,
-			StartedAt: start,
-			EndedAt:   time.Now(),
-			Duration:  time.Since(start).String(),
-			Key:       key,
-		}
-		if opErr != nil {
-			event.Error = opErr.Error()
-		}
-		_ = a.Notifier.Notify(context.Background(), event)
-	}()
+	var size int64
+	defer func() { a.finish("backup", start, key, opErr) }()
+	defer func() { a.recordStatus("backup", key, size, opErr) }()
 
-	guard, err := lock.Acquire(a.Cfg.Global.LockFile)
-	if err != nil {
-		opErr = err
-		return nil, err
+	if a.NoLock {
+		a.Log.Warn().Str("lock_file", lockPath(a.Cfg)).Msg("NOT acquiring the lock (--no-lock): concurrent backups and restores are not prevented")
+	} else {
+		guard, err := a.acquireLock(a.Cfg)
+		if err != nil {
+			opErr = err
+			return nil, err
+		}
+		defer guard.Release()
 	}
-	defer guard.Release()
 
 	ok, err := util.InWindow(time.Now(), a.Cfg.Schedule.WindowStart, a.Cfg.Schedule.WindowEnd, a.Cfg.Schedule.Timezone)
 	if err != nil {
+		opErr = err
 		return nil, err
 	}
 	if !ok {
-		opErr = fmt.Errorf("current time is outside configured backup window")
-		return nil, opErr
+		if !a.Force {
+			opErr = ErrWindowSkipped
+			return nil, opErr
+		}
+		a.Log.Warn().Str("window_start", a.Cfg.Schedule.WindowStart).Str("window_end", a.Cfg.Schedule.WindowEnd).
+			Msg("running outside the backup window (--force)")
 	}
-	if err := a.Adapter.Validate(ctx, a.Cfg.Database); err != nil {
+	if err := a.checkPaused(ctx); err != nil {
 		opErr = err
 		return nil, err
 	}
-	caps := a.Adapter.Capabilities()
-	if strings.EqualFold(a.Cfg.Backup.Type, "incremental") && !caps.Incremental {
-		opErr = fmt.Errorf("incremental backups are not supported for %s", a.Adapter.Name())
+	source, fromReplica := a.readSource()
+	if a.compacting != nil {
+		source, fromReplica = a.compacting.scratch, false
+	}
+	if err := a.Adapter.Validate(ctx, source); err != nil {
+		if fromReplica {
+			err = fmt.Errorf("read replica %s: %w", replicaAddr(source), err)
+		}
+		opErr = connectivityError(err)
 		return nil, opErr
 	}
-	if strings.EqualFold(a.Cfg.Backup.Type, "differential") && !caps.Differential {
-		opErr = fmt.Errorf("differential backups are not supported for %s", a.Adapter.Name())
+	if fromReplica {
+		a.Log.Info().Str("read_replica", replicaAddr(source)).Msg("dumping from the read replica; the backup reflects its state, which may lag the primary")
+	}
+	if err := a.checkBackup(ctx); err != nil {
+		opErr = err
+		return nil, err
+	}
+	metadata := a.backupMetadata(a.Cfg.Backup.Labels)
+	if a.sealsSidecars() && a.Cfg.Backup.EncryptionKey == "" {
+		opErr = fmt.Errorf("encrypt_manifest is enabled but encryption_key is empty")
 		return nil, opErr
 	}
-	if a.Cfg.Backup.Encryption && a.Cfg.Backup.EncryptionKey == "" {
-		opErr = fmt.Errorf("encryption is enabled but encryption_key is empty")
+	dictID, dict, err := a.backupDictionary(ctx)
+	if err != nil {
+		opErr = stageError(ErrCompress, err)
 		return nil, opErr
 	}
+	var base storage.Manifest
+	if isDifferential(a.Cfg.Backup.Type) {
+		if base, err = a.differentialBase(ctx); err != nil {
+			opErr = err
+			return nil, err
+		}
+	}
 
 	ext := buildExtension(a.Cfg.Backup.Compression, a.Cfg.Backup.Encryption)
-	key = util.BuildObjectKey(a.Cfg.Storage.Prefix, a.Cfg.Database.Type, a.Cfg.Database.Database, a.Cfg.Backup.Type, time.Now(), ext)
+	key = util.BuildObjectKey(a.Cfg.Storage.Prefix, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database, a.Cfg.Backup.Type, time.Now(), ext)
 
 	if a.Cfg.Backup.Idempotent {
-		exists, err := a.Storage.Exists(ctx, key)
+		if retentionEnabled(a.Cfg.Backup.RetentionPolicy) {
+			// Retention lists the prefix after the upload anyway; listing it now
+			// answers the probe below and retention from the same request.
+			if _, err := a.List(ctx); err != nil {
+				opErr = err
+				return nil, err
+			}
+		}
+		probe := key
+		if a.Cfg.Backup.ChunkSize > 0 {
+			probe = storage.ChunkKey(key, 0)
+		}
+		exists, err := a.Storage.Exists(ctx, probe)
 		if err != nil {
 			opErr = err
 			return nil, err
@@ -113,58 +246,92 @@ func (a *App) Backup(ctx context.Context) (*BackupResult, error) {
 		}
 	}
 
-	dumpStream, err := a.Adapter.Dump(ctx, a.Cfg.Database, a.Cfg.Backup)
-	if err != nil {
+	// The post hook is deferred before the pre hook runs so a partially applied
+	// pre hook (e.g. writes already paused) is still undone.
+	defer func() { a.postHook(ctx, "backup", key, opErr) }()
+	if err := a.runHook(ctx, "pre", "backup", key, nil); err != nil {
 		opErr = err
 		return nil, err
 	}
+
+	dumpCfg := a.Cfg.Backup
+	var checksums map[string]string
+	if isDifferential(dumpCfg.Type) || dumpCfg.TableChecksums {
+		// Checksums are taken before the dump, so a write racing the dump is at worst
+		// picked up again by the next differential.
+		if checksums, err = a.tableChecksums(ctx, source); err != nil {
+			opErr = err
+			return nil, err
+		}
+	}
+	// The dump and upload run under the backup's time budget. The dump gets its
+	// own context so a failed upload or processing step can stop it; otherwise the
+	// tool blocks writing to a pipe nobody reads and Wait hangs.
+	budgetCtx, cancelBudget := a.backupBudget(ctx)
+	defer cancelBudget()
+	dumpCtx, cancelDump := context.WithCancel(budgetCtx)
+	defer cancelDump()
+	var dumpStream *db.DumpStream
+	dumpStart := time.Now()
+	if isDifferential(dumpCfg.Type) {
+		changed, dropped := changedTables(base.TableChecksums, checksums)
+		if len(dropped) > 0 {
+			a.Log.Warn().Strs("tables", dropped).Msg("tables dropped since the base are not removed by a differential restore")
+		}
+		a.Log.Info().Str("base", base.Key).Strs("tables", changed).Msg("differential backup")
+		dumpCfg.Tables = changed
+	}
+	if isDifferential(dumpCfg.Type) && len(dumpCfg.Tables) == 0 {
+		// Nothing changed; an empty differential still records that the base is current.
+		dumpStream = &db.DumpStream{Reader: io.NopCloser(strings.NewReader("")), Wait: func() error { return nil }}
+	} else if dumpStream, err = a.Adapter.Dump(dumpCtx, source, dumpCfg); err != nil {
+		if fromReplica {
+			err = replicaError(source, err)
+		}
+		opErr = stageError(ErrDump, err)
+		return nil, opErr
+	}
 	defer dumpStream.Reader.Close()
 
 	pipeReader, pipeWriter := io.Pipe()
-	eg, egCtx := errgroup.WithContext(ctx)
+	eg, egCtx := errgroup.WithContext(budgetCtx)
+	// egCtx is done once either side fails. Closing the reader unblocks a read the
+	// processing side is stuck in, and also stops dumps that are not subprocesses.
+	stopDump := context.AfterFunc(egCtx, func() {
+		cancelDump()
+		_ = dumpStream.Reader.Close()
+	})
+	defer stopDump()
 
+	// putErr is kept apart from the group's error: once the upload fails, the
+	// processing side only sees a closed pipe, and the upload's error is the cause.
+	var chunks []string
+	var putErr error
 	eg.Go(func() error {
 		defer pipeReader.Close()
-		return a.Storage.Put(egCtx, key, pipeReader, -1, map[string]string{"dbu-backup": "true"})
+		if a.Cfg.Backup.ChunkSize > 0 {
+			chunks, putErr = a.putChunks(egCtx, key, pipeReader, a.Cfg.Backup.ChunkSize, metadata)
+		} else {
+			putErr = a.Storage.Put(egCtx, key, pipeReader, -1, metadata)
+		}
+		putErr = stageError(ErrUpload, putErr)
+		return putErr
 	})
 
+	// plain sees the dump before compression; stored sees what is handed to storage.
+	stored := &meterWriter{w: stageWriter{w: pipeWriter, stage: ErrUpload}}
+	storedHash := sha256.New()
+	plain := &meterWriter{}
+	a.sizeBudget(plain, stored).limit = a.Cfg.Backup.MaxSizeBytes
+	var dedup *dedupWriter
+	var closeTime time.Duration
 	eg.Go(func() error {
-		writer := io.Writer(pipeWriter)
-		closers := []io.Closer{pipeWriter}
-		if a.Cfg.Backup.Compression != "" && a.Cfg.Backup.Compression != compress.TypeNone {
-			compWriter, err := compress.WrapWriter(a.Cfg.Backup.Compression, writer)
-			if err != nil {
-				_ = pipeWriter.CloseWithError(err)
-				return err
-			}
-			writer = compWriter
-			closers = append(closers, compWriter)
-		}
-		if a.Cfg.Backup.Encryption {
-			keyBytes, err := cryptoutil.ParseKey(a.Cfg.Backup.EncryptionKey)
-			if err != nil {
-				_ = pipeWriter.CloseWithError(err)
-				return err
-			}
-			encWriter, err := cryptoutil.EncryptWriter(writer, keyBytes)
-			if err != nil {
-				_ = pipeWriter.CloseWithError(err)
-				return err
-			}
-			writer = encWriter
-			closers = append(closers, encWriter)
-		}
-		_, err := io.Copy(writer, dumpStream.Reader)
+		var err error
+		dedup, closeTime, err = a.encodeDump(egCtx, dumpStream.Reader, io.MultiWriter(storedHash, stored), plain, dictID, dict, a.encryptionBinding(key))
 		if err != nil {
 			_ = pipeWriter.CloseWithError(err)
 			return err
 		}
-		for i := len(closers) - 1; i >= 0; i-- {
-			if err := closers[i].Close(); err != nil {
-				_ = pipeWriter.CloseWithError(err)
-				return err
-			}
-		}
 		if err := pipeWriter.Close(); err != nil {
 			_ = pipeWriter.CloseWithError(err)
 			return err
@@ -172,198 +339,1119 @@ func (a *App) Backup(ctx context.Context) (*BackupResult, error) {
 		return nil
 	})
 
-	if err := dumpStream.Wait(); err != nil {
+	dumpErr := dumpStream.Wait()
+	if fromReplica {
+		dumpErr = replicaError(source, dumpErr)
+	}
+	// egCtx is only done this early if the pipeline failed and the dump was stopped
+	// because of it; the pipeline's error is then the one to report.
+	if dumpErr != nil && egCtx.Err() == nil {
+		err := stageError(ErrDump, dumpErr)
 		_ = pipeWriter.CloseWithError(err)
 		_ = eg.Wait()
-		opErr = err
-		return nil, err
+		a.discardUpload(ctx, key, chunks)
+		opErr = budgetError(budgetCtx, err)
+		return nil, opErr
 	}
+	dumpTime := time.Since(dumpStart)
 	if err := eg.Wait(); err != nil {
-		opErr = err
-		return nil, err
+		if errors.Is(err, ErrUpload) && putErr != nil {
+			err = putErr
+		}
+		a.discardUpload(ctx, key, chunks)
+		opErr = budgetError(budgetCtx, err)
+		return nil, opErr
+	}
+	if dumpErr != nil {
+		a.discardUpload(ctx, key, chunks)
+		opErr = budgetError(budgetCtx, stageError(ErrDump, dumpErr))
+		return nil, opErr
+	}
+	timings := &storage.StageTimings{
+		DumpMS:    dumpTime.Milliseconds(),
+		ProcessMS: (plain.elapsed + closeTime - stored.elapsed).Milliseconds(),
+		UploadMS:  stored.elapsed.Milliseconds(),
 	}
 
-	stat, err := a.Storage.Stat(ctx, key)
+	if a.Cfg.Backup.ChunkSize > 0 {
+		size, err = a.statChunks(ctx, chunks)
+	} else {
+		var stat storage.ObjectInfo
+		stat, err = a.Storage.Stat(ctx, key)
+		size = stat.Size
+	}
 	if err != nil {
-		opErr = err
-		return nil, err
+		a.discardUpload(ctx, key, chunks)
+		opErr = stageError(ErrUpload, err)
+		return nil, opErr
 	}
-	manifest := storage.Manifest{
-		ID:           fmt.Sprintf("%s-%d", a.Cfg.Database.Database, time.Now().UnixNano()),
-		Key:          key,
-		DatabaseType: a.Cfg.Database.Type,
-		Database:     a.Cfg.Database.Database,
-		BackupType:   a.Cfg.Backup.Type,
-		Compression:  a.Cfg.Backup.Compression,
-		Encryption:   a.Cfg.Backup.Encryption,
-		CreatedAt:    time.Now().UTC(),
-		SizeBytes:    stat.Size,
-		Tables:       a.Cfg.Backup.Tables,
-		Collections:  a.Cfg.Backup.Collections,
-		ToolVersion:  version.Version,
+	manifest := a.newManifest(source, fromReplica, dumpCfg, dumpStream, dictID)
+	manifest.Key = key
+	manifest.EncryptionBinding = a.encryptionBinding(key)
+	manifest.SizeBytes = size
+	manifest.SHA256 = hex.EncodeToString(storedHash.Sum(nil))
+	manifest.Chunks = chunks
+	manifest.TableChecksums = checksums
+	manifest.BaseKey = base.Key
+	manifest.UncompressedBytes = plain.n
+	manifest.Timings = timings
+	if dedup != nil {
+		manifest.DedupChunks = dedup.meta.Chunks
+	}
+	if a.compacting != nil {
+		manifest.CompactedFrom = a.compacting.from
 	}
 
 	if err := a.writeManifest(ctx, manifest); err != nil {
 		a.Log.Warn().Err(err).Msg("failed to write manifest")
 	}
+	if manifest.Held(time.Now()) {
+		if err := a.tagHold(ctx, manifest); err != nil {
+			a.Log.Warn().Err(err).Msg("failed to tag held backup")
+		}
+	}
 
-	_ = a.applyRetention(ctx)
+	stats, err := a.applyRetention(ctx)
+	if err != nil {
+		a.Log.Warn().Err(err).Int("deleted", stats.Deleted).Int("moved", stats.Moved).Int("failed", stats.Failed).Msg("retention incomplete")
+	}
+	if a.Cfg.Backup.Dedup || stats.Deleted > 0 {
+		if deleted, err := a.collectDedupChunks(ctx); err != nil {
+			a.Log.Warn().Err(err).Int("deleted", deleted).Msg("dedup chunk cleanup incomplete")
+		} else if deleted > 0 {
+			a.Log.Info().Int("deleted", deleted).Msg("deleted unused dedup chunks")
+		}
+	}
 
 	return &BackupResult{Manifest: manifest, Key: key}, nil
 }
 
+// checkBackup rejects settings a backup cannot run with before anything starts.
+func (a *App) checkBackup(ctx context.Context) error {
+	if err := db.CheckToolVersions(ctx, a.Cfg.Backup.RequireToolVersion); err != nil {
+		return err
+	}
+	if err := CheckLabels(a.Cfg.Backup.Labels); err != nil {
+		return err
+	}
+	if _, err := a.keyDerivation(); err != nil {
+		return err
+	}
+	caps := a.Adapter.Capabilities()
+	if strings.EqualFold(a.Cfg.Backup.Type, "incremental") && !caps.Incremental {
+		return fmt.Errorf("incremental backups are not supported for %s", a.Adapter.Name())
+	}
+	if strings.EqualFold(a.Cfg.Backup.Type, "differential") && !caps.Differential {
+		return fmt.Errorf("differential backups are not supported for %s", a.Adapter.Name())
+	}
+	if (a.Cfg.Backup.NoBlobs || a.Cfg.Backup.BlobsOnly) && !caps.LargeObjects {
+		return fmt.Errorf("no_blobs and blobs_only are not supported for %s", a.Adapter.Name())
+	}
+	if len(a.Cfg.Backup.Schemas) > 0 || len(a.Cfg.Backup.ExcludeSchemas) > 0 {
+		if !caps.Schemas {
+			return fmt.Errorf("schemas and exclude_schemas are not supported for %s", a.Adapter.Name())
+		}
+		// A differential dumps its changed tables by name, whatever schema they are in.
+		if isDifferential(a.Cfg.Backup.Type) {
+			return fmt.Errorf("schemas and exclude_schemas cannot be combined with differential backups")
+		}
+	}
+	if a.Cfg.Backup.Dedup && a.Cfg.Backup.ChunkSize > 0 {
+		return fmt.Errorf("dedup and chunk_size cannot be combined; dedup_chunk_size sets the chunk size")
+	}
+	if a.Cfg.Backup.Dedup && a.Cfg.Storage.Tiers.Cold.Prefix != "" {
+		return fmt.Errorf("deduplicated backups cannot be moved to a cold tier; unset storage.tiers.cold or dedup")
+	}
+	if a.Cfg.Backup.Encryption && a.Cfg.Backup.EncryptionKey == "" {
+		return fmt.Errorf("encryption is enabled but encryption_key is empty")
+	}
+	return nil
+}
+
+// encodeDump copies the dump into out through compression and encryption, or
+// through the dedup writer, as configured. plain meters the dump itself. The
+// encrypted stream is bound to binding when it is set.
+func (a *App) encodeDump(ctx context.Context, dump io.Reader, out io.Writer, plain *meterWriter, dictID uint32, dict []byte, binding *storage.EncryptionBinding) (dedup *dedupWriter, closeTime time.Duration, err error) {
+	writer := out
+	var closers []io.Closer
+	if a.Cfg.Backup.Dedup {
+		// Chunks are compressed and encrypted on their own; the backup's object
+		// is the chunk map.
+		if dedup, err = a.newDedupWriter(ctx, writer, dictID, dict); err != nil {
+			return nil, 0, err
+		}
+		writer = dedup
+		closers = append(closers, dedup)
+	}
+	// Encryption wraps the stored stream so compression runs on plaintext.
+	if a.Cfg.Backup.Encryption && !a.Cfg.Backup.Dedup {
+		keyBytes, err := a.backupDataKey()
+		if err != nil {
+			return dedup, 0, stageError(ErrEncrypt, err)
+		}
+		if keyBytes, err = bindKey(keyBytes, binding); err != nil {
+			return dedup, 0, stageError(ErrEncrypt, err)
+		}
+		encWriter, err := cryptoutil.EncryptWriter(writer, keyBytes)
+		if err != nil {
+			return dedup, 0, stageError(ErrEncrypt, err)
+		}
+		encStage := stageWriter{w: encWriter, stage: ErrEncrypt}
+		writer = encStage
+		closers = append(closers, encStage)
+	}
+	if a.Cfg.Backup.Compression != "" && a.Cfg.Backup.Compression != compress.TypeNone && !a.Cfg.Backup.Dedup {
+		var compWriter io.WriteCloser
+		if dict != nil {
+			compWriter, err = compress.WrapWriterDict(a.Cfg.Backup.Compression, writer, dict)
+		} else {
+			compWriter, err = compress.WrapWriter(a.Cfg.Backup.Compression, writer)
+		}
+		if err != nil {
+			return dedup, 0, stageError(ErrCompress, err)
+		}
+		compStage := stageWriter{w: compWriter, stage: ErrCompress}
+		writer = compStage
+		closers = append(closers, compStage)
+	}
+	plain.w = writer
+	if _, err := io.Copy(plain, stageReader{r: dump, stage: ErrDump}); err != nil {
+		return dedup, 0, err
+	}
+	closeStart := time.Now()
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			return dedup, 0, err
+		}
+	}
+	return dedup, time.Since(closeStart), nil
+}
+
+// newManifest describes a backup of source taken with dumpCfg; the caller adds
+// where it went and what it holds.
+func (a *App) newManifest(source config.DatabaseConfig, fromReplica bool, dumpCfg config.BackupConfig, dumpStream *db.DumpStream, dictID uint32) storage.Manifest {
+	manifest := storage.Manifest{
+		SchemaVersion:   storage.ManifestSchemaVersion,
+		ID:              fmt.Sprintf("%s-%d", a.Cfg.Database.Database, time.Now().UnixNano()),
+		DatabaseType:    a.Cfg.Database.Type,
+		Database:        a.Cfg.Database.Database,
+		BackupType:      a.Cfg.Backup.Type,
+		Compression:     a.Cfg.Backup.Compression,
+		CompressionDict: dictID,
+		Encryption:      a.Cfg.Backup.Encryption,
+		CreatedAt:       time.Now().UTC(),
+		Tables:          dumpCfg.Tables,
+		Schemas:         dumpCfg.Schemas,
+		ExcludeSchemas:  dumpCfg.ExcludeSchemas,
+		Collections:     a.Cfg.Backup.Collections,
+		Container:       dumpStream.Container,
+		DumpTool:        dumpStream.Tool,
+		NoBlobs:         dumpCfg.NoBlobs,
+		BlobsOnly:       dumpCfg.BlobsOnly,
+		ToolVersion:     version.Version,
+		Labels:          a.Cfg.Backup.Labels,
+		LegalHold:       a.Cfg.Backup.LegalHold,
+	}
+	recordCodecs(&manifest)
+	if a.Cfg.Backup.Encryption {
+		manifest.KeyDerivation, _ = a.keyDerivation()
+		if keyBytes, err := a.backupDataKey(); err == nil {
+			manifest.KeyFingerprint = cryptoutil.Fingerprint(keyBytes)
+		}
+	}
+	if fromReplica {
+		manifest.ReadReplica = replicaAddr(source)
+	}
+	if a.Cfg.Backup.RetainFor > 0 {
+		manifest.RetainUntil = manifest.CreatedAt.Add(a.Cfg.Backup.RetainFor)
+	}
+	return manifest
+}
+
 func (a *App) Restore(ctx context.Context, key string) error {
 	start := time.Now()
 	var opErr error
+	defer func() { a.finish("restore", start, key, opErr) }()
 	defer func() {
-		if a.Notifier == nil {
-			return
-		}
-		event := notify.Event{
-			Type:      "restore",
-			Message:   fmt.Sprintf("restore %s", a.Cfg.Database.Database),
-			Status:    statusFromErr(opErr),
-			Database:  a.Cfg.Database.Database,
-			DBType:    a.Cfg.Database.Type,
-			StartedAt: start,
-			EndedAt:   time.Now(),
-			Duration:  time.Since(start).String(),
-			Key:       key,
-		}
-		if opErr != nil {
-			event.Error = opErr.Error()
-		}
-		_ = a.Notifier.Notify(context.Background(), event)
+		// A dry run loads nothing, so it is not a restore worth recording.
+		if !a.Cfg.Restore.DryRun {
+			a.recordStatus("restore", key, 0, opErr)
+		}
 	}()
 
-	guard, err := lock.Acquire(a.Cfg.Global.LockFile)
+	guard, err := a.acquireLock(a.Cfg)
 	if err != nil {
 		opErr = err
 		return err
 	}
 	defer guard.Release()
 
-	if err := a.Adapter.Validate(ctx, a.Cfg.Database); err != nil {
+	if err := validateTarget(ctx, a.Adapter, a.Cfg.Database, a.Cfg.Restore); err != nil {
+		opErr = connectivityError(err)
+		return opErr
+	}
+	if !a.Cfg.Restore.CreateDatabase {
+		if err := a.preflightRestore(ctx, a.Adapter, a.Cfg.Database, a.Cfg.Restore); err != nil {
+			opErr = err
+			return err
+		}
+	}
+	manifest, manifestErr := a.readManifest(ctx, key)
+	if manifestErr != nil {
+		a.Log.Warn().Err(manifestErr).Str("key", key).Msg("manifest unavailable; inferring pipeline from object key")
+	} else if err := checkDecodable(key, manifest); err != nil {
 		opErr = err
 		return err
 	}
-	manifest, _ := a.readManifest(ctx, key)
 
 	if a.Cfg.Restore.DryRun {
 		a.Log.Info().Str("key", key).Msg("dry run restore")
 		return nil
 	}
 
-	reader, err := a.Storage.Get(ctx, key)
+	if len(a.Cfg.Restore.TableMap) > 0 && !a.Adapter.Capabilities().TableRename {
+		opErr = fmt.Errorf("table_map is not supported for %s", a.Adapter.Name())
+		return opErr
+	}
+	if len(a.Cfg.Restore.Schemas) > 0 && !a.Adapter.Capabilities().Schemas {
+		opErr = fmt.Errorf("restoring schemas is not supported for %s", a.Adapter.Name())
+		return opErr
+	}
+	if a.Cfg.Restore.SingleTransaction && !a.Adapter.Capabilities().SingleTransaction {
+		opErr = fmt.Errorf("single_transaction is not supported for %s", a.Adapter.Name())
+		return opErr
+	}
+	if len(a.Cfg.Restore.Schemas) > 0 && len(a.Cfg.Restore.TableMap) > 0 {
+		opErr = fmt.Errorf("table_map cannot be combined with schemas")
+		return opErr
+	}
+	if err := a.checkTargetEmpty(ctx, a.Adapter, a.Cfg.Database, a.Cfg.Restore); err != nil {
+		opErr = err
+		return err
+	}
+	if err := a.checkRestoreTables(ctx, key, manifest, manifestErr); err != nil {
+		opErr = err
+		return err
+	}
+	querier, expectations, err := a.prepareAssertions()
 	if err != nil {
 		opErr = err
 		return err
 	}
-	defer reader.Close()
 
-	payload := io.Reader(reader)
-	if manifest.Encryption || a.Cfg.Backup.Encryption {
-		if a.Cfg.Backup.EncryptionKey == "" {
-			opErr = fmt.Errorf("encryption key is required to restore encrypted backup")
-			return opErr
+	defer func() { a.postHook(ctx, "restore", key, opErr) }()
+	if err := a.runHook(ctx, "pre", "restore", key, nil); err != nil {
+		opErr = err
+		return err
+	}
+
+	markerKey := storage.RestoreMarkerKey(util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database))
+	if err := a.checkPriorRestore(ctx, markerKey); err != nil {
+		opErr = err
+		return err
+	}
+	// The database is only created (or dropped and recreated) and the marker only
+	// written once data is about to reach the database, so a backup that cannot be
+	// read leaves the database as it was and unmarked.
+	begin := sync.OnceValue(func() error {
+		if a.Cfg.Restore.CreateDatabase {
+			if err := a.createTarget(ctx, a.Adapter, a.Cfg.Database, a.Cfg.Restore); err != nil {
+				return err
+			}
 		}
-		keyBytes, err := cryptoutil.ParseKey(a.Cfg.Backup.EncryptionKey)
-		if err != nil {
+		return a.markRestore(ctx, markerKey, key)
+	})
+
+	if manifest.BaseKey != "" {
+		if err := a.restoreDifferential(ctx, key, manifest, begin); err != nil {
 			opErr = err
 			return err
 		}
-		payload, err = cryptoutil.DecryptReader(payload, keyBytes)
-		if err != nil {
+	} else if err := a.restoreObject(ctx, key, manifest, manifestErr, a.Cfg.Restore, begin); err != nil {
+		opErr = err
+		return err
+	}
+	if err := a.Storage.Delete(ctx, markerKey); err != nil {
+		a.Log.Warn().Err(err).Str("marker", markerKey).Msg("failed to clear restore marker")
+	}
+	if querier != nil {
+		if err := a.checkAssertions(ctx, querier, expectations); err != nil {
 			opErr = err
 			return err
 		}
 	}
+	return nil
+}
 
-	compression := manifest.Compression
-	if compression == "" {
-		compression = a.Cfg.Backup.Compression
-	}
-	compReader, err := compress.WrapReader(compression, payload)
-	if err != nil {
-		opErr = err
-		return err
+// restoreObject streams one stored backup into the database. begin, when set, runs
+// once the backup is open and decoding, just before the database is touched.
+func (a *App) restoreObject(ctx context.Context, key string, manifest storage.Manifest, manifestErr error, restoreCfg config.RestoreConfig, begin func() error) error {
+	var compReader io.ReadCloser
+	if len(manifest.DedupChunks) > 0 {
+		// The stored object is only the chunk map, so progress is counted in dump bytes.
+		reader, err := a.openBackup(ctx, key, manifest, manifestErr)
+		if err != nil {
+			return err
+		}
+		var stopProgress func()
+		compReader, stopProgress = a.trackRestore(key, reader, dumpSize(manifest.DedupChunks))
+		defer stopProgress()
+	} else {
+		stored, err := a.openStored(ctx, key, manifest)
+		if err != nil {
+			return err
+		}
+		stored, stopProgress := a.trackRestore(key, stored, a.storedSize(ctx, key, manifest))
+		defer stopProgress()
+		if compReader, err = a.decodeStored(ctx, key, stored, manifest, manifestErr); err != nil {
+			return err
+		}
 	}
 	defer compReader.Close()
 
-	restoreStream, err := a.Adapter.Restore(ctx, a.Cfg.Database, a.Cfg.Restore, manifest)
+	if begin != nil {
+		if err := begin(); err != nil {
+			return err
+		}
+	}
+	restoreStream, err := a.Adapter.Restore(ctx, a.Cfg.Database, restoreCfg, manifest)
 	if err != nil {
-		opErr = err
 		return err
 	}
-
 	if _, err := io.Copy(restoreStream.Writer, compReader); err != nil {
-		opErr = err
 		return err
 	}
 	if err := restoreStream.Writer.Close(); err != nil {
-		opErr = err
-		return err
-	}
-	if err := restoreStream.Wait(); err != nil {
-		opErr = err
-		return err
-	}
-	return nil
-}
-
-func (a *App) Validate(ctx context.Context) error {
-	if err := a.Adapter.Validate(ctx, a.Cfg.Database); err != nil {
 		return err
 	}
-	prefix := util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Database.Type, a.Cfg.Database.Database)
-	_, err := a.Storage.List(ctx, prefix)
-	return err
-}
-
-func (a *App) List(ctx context.Context) ([]storage.ObjectInfo, error) {
-	prefix := util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Database.Type, a.Cfg.Database.Database)
-	return a.Storage.List(ctx, prefix)
+	return restoreStream.Wait()
 }
 
-func (a *App) writeManifest(ctx context.Context, manifest storage.Manifest) error {
-	payload, err := json.MarshalIndent(manifest, "", "  ")
+// restoreDifferential restores the differential's base and then replaces the tables
+// that changed since it. begin is passed on to restoreObject.
+func (a *App) restoreDifferential(ctx context.Context, key string, manifest storage.Manifest, begin func() error) error {
+	base, err := a.readManifest(ctx, manifest.BaseKey)
 	if err != nil {
+		return fmt.Errorf("read base manifest %s: %w", manifest.BaseKey, err)
+	}
+	if err := checkDecodable(manifest.BaseKey, base); err != nil {
 		return err
 	}
-	key := storage.ManifestKey(manifest.Key)
-	return a.Storage.Put(ctx, key, strings.NewReader(string(payload)), int64(len(payload)), map[string]string{"dbu-manifest": "true"})
-}
+	a.Log.Info().Str("base", manifest.BaseKey).Msg("restoring differential base")
+	if err := a.restoreObject(ctx, manifest.BaseKey, base, nil, a.Cfg.Restore, begin); err != nil {
+		return fmt.Errorf("restore base %s: %w", manifest.BaseKey, err)
+	}
 
-func (a *App) readManifest(ctx context.Context, key string) (storage.Manifest, error) {
-	manifestKey := storage.ManifestKey(key)
-	reader, err := a.Storage.Get(ctx, manifestKey)
-	if err != nil {
-		return storage.Manifest{}, err
+	diffCfg := a.Cfg.Restore
+	diffCfg.DropExisting = true
+	diffCfg.Tables = nil
+	for _, table := range a.Cfg.Restore.Tables {
+		if slices.Contains(manifest.Tables, table) {
+			diffCfg.Tables = append(diffCfg.Tables, table)
+		}
 	}
-	defer reader.Close()
-	var manifest storage.Manifest
-	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
-		return storage.Manifest{}, err
+	if len(manifest.Tables) == 0 || (len(a.Cfg.Restore.Tables) > 0 && len(diffCfg.Tables) == 0) {
+		return nil
 	}
-	return manifest, nil
+	a.Log.Info().Strs("tables", manifest.Tables).Msg("applying differential")
+	return a.restoreObject(ctx, key, manifest, nil, diffCfg, begin)
 }
 
-func (a *App) applyRetention(ctx context.Context) error {
-	policy := a.Cfg.Backup.RetentionPolicy
-	if policy.KeepDays == 0 && policy.KeepLast == 0 && policy.MaxBytes == 0 {
+// checkTargetEmpty refuses to restore into a database that already holds
+// restore.refuse_if_nonempty tables or collections, which is how a backup ends up
+// mixed into the wrong database. Replacing it (drop_existing), creating it
+// (create_database), --force, and table_map restores, which never touch live
+// tables, go ahead.
+func (a *App) checkTargetEmpty(ctx context.Context, adapter db.Adapter, target config.DatabaseConfig, restore config.RestoreConfig) error {
+	if restore.RefuseIfNonempty <= 0 || restore.DropExisting || restore.CreateDatabase || len(restore.TableMap) > 0 {
 		return nil
 	}
-	prefix := util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Database.Type, a.Cfg.Database.Database)
-	objects, err := a.Storage.List(ctx, prefix)
+	counter, ok := adapter.(db.ObjectCounter)
+	if !ok {
+		return nil
+	}
+	n, err := counter.CountObjects(ctx, target)
 	if err != nil {
-		return err
+		return fmt.Errorf("check that database %s is empty: %w", target.Database, err)
 	}
-	var backups []storage.ObjectInfo
-	for _, obj := range objects {
-		if obj.IsManifest {
-			continue
+	if n < restore.RefuseIfNonempty {
+		return nil
+	}
+	if a.Force {
+		a.Log.Warn().Str("database", target.Database).Int("objects", n).Msg("restoring into a non-empty database (--force)")
+		return nil
+	}
+	return fmt.Errorf("database %s already holds %d tables or collections; restoring over it would mix the backup into existing data. Re-run with --drop-existing to replace it, or --force to restore into it anyway (restore.refuse_if_nonempty: 0 turns this check off)", target.Database, n)
+}
+
+// validateTarget checks the connection to the database a restore loads into. With
+// create_database the target may not exist yet, so the connection is checked to
+// the database it is created from instead.
+func validateTarget(ctx context.Context, adapter db.Adapter, cfg config.DatabaseConfig, restore config.RestoreConfig) error {
+	if restore.CreateDatabase {
+		creator, ok := adapter.(db.DatabaseCreator)
+		if !ok {
+			return fmt.Errorf("create_database is not supported for %s", adapter.Name())
+		}
+		cfg = creator.MaintenanceDatabase(cfg)
+	}
+	return adapter.Validate(ctx, cfg)
+}
+
+// createTarget creates the database a restore loads into, dropping it first with
+// drop_existing, and then runs the restore preflight that could not run against a
+// database that did not exist yet. It is called only once the data is about to be
+// loaded, so no check that can still refuse the restore runs after the drop.
+func (a *App) createTarget(ctx context.Context, adapter db.Adapter, cfg config.DatabaseConfig, restore config.RestoreConfig) error {
+	creator, ok := adapter.(db.DatabaseCreator)
+	if !ok {
+		return fmt.Errorf("create_database is not supported for %s", adapter.Name())
+	}
+	if err := creator.CreateDatabase(ctx, cfg, restore); err != nil {
+		return err
+	}
+	return a.preflightRestore(ctx, adapter, cfg, restore)
+}
+
+// preflightRestore runs the adapter's restore preflight, logging the privileges
+// it could not tell the restore needs instead of failing on them.
+func (a *App) preflightRestore(ctx context.Context, adapter db.Adapter, cfg config.DatabaseConfig, restore config.RestoreConfig) error {
+	err := adapter.PreflightRestore(ctx, cfg, restore)
+	var warning *db.PreflightWarning
+	if errors.As(err, &warning) {
+		a.Log.Warn().Err(warning.Err).Str("database", cfg.Database).Msg("restore preflight")
+		return nil
+	}
+	return err
+}
+
+// checkPriorRestore refuses to load over a previous restore that never completed
+// unless drop_existing is set.
+func (a *App) checkPriorRestore(ctx context.Context, markerKey string) error {
+	exists, err := a.Storage.Exists(ctx, markerKey)
+	if err != nil || !exists {
+		return err
+	}
+	prior := a.readRestoreMarker(ctx, markerKey)
+	if !a.Cfg.Restore.DropExisting {
+		return fmt.Errorf("previous restore of %s (started %s on %s) did not complete; re-run with --drop-existing to restore over it",
+			prior.Key, prior.StartedAt.Format(time.RFC3339), prior.Host)
+	}
+	a.Log.Warn().Str("previous_key", prior.Key).Msg("previous restore did not complete; dropping existing objects")
+	return nil
+}
+
+// markRestore records the restore of key as in progress, replacing the marker of a
+// previous restore that never completed.
+func (a *App) markRestore(ctx context.Context, markerKey, key string) error {
+	if err := a.Storage.Delete(ctx, markerKey); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	host, _ := os.Hostname()
+	payload, err := json.Marshal(storage.RestoreMarker{Key: key, Host: host, StartedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	if payload, err = a.sealSidecar(payload, a.Cfg.Backup.EncryptionKey); err != nil {
+		return err
+	}
+	return a.Storage.Put(ctx, markerKey, bytes.NewReader(payload), int64(len(payload)), map[string]string{"dbu-restore-marker": "true"})
+}
+
+func (a *App) readRestoreMarker(ctx context.Context, markerKey string) storage.RestoreMarker {
+	var marker storage.RestoreMarker
+	reader, err := a.Storage.Get(ctx, markerKey)
+	if err != nil {
+		return marker
+	}
+	defer reader.Close()
+	payload, err := io.ReadAll(reader)
+	if err != nil {
+		return marker
+	}
+	if payload, err = a.openSidecar("restore marker "+markerKey, payload); err != nil {
+		return marker
+	}
+	_ = json.Unmarshal(payload, &marker)
+	return marker
+}
+
+// Clone streams the source database dump directly into the target database without writing a backup object.
+func (a *App) Clone(ctx context.Context, target *config.Config, targetAdapter db.Adapter) error {
+	start := time.Now()
+	var opErr error
+	defer func() { a.finish("clone", start, target.Database.Database, opErr) }()
+
+	if a.Adapter.Name() != targetAdapter.Name() {
+		opErr = fmt.Errorf("cannot clone %s into %s", a.Adapter.Name(), targetAdapter.Name())
+		return opErr
+	}
+
+	// The clone writes into the target, so that is the database it locks.
+	lockCfg := *a.Cfg
+	lockCfg.Database = target.Database
+	guard, err := a.acquireLock(&lockCfg)
+	if err != nil {
+		opErr = err
+		return err
+	}
+	defer guard.Release()
+
+	source, fromReplica := a.readSource()
+	if err := a.Adapter.Validate(ctx, source); err != nil {
+		opErr = fmt.Errorf("source: %w", connectivityError(err))
+		return opErr
+	}
+	if err := validateTarget(ctx, targetAdapter, target.Database, target.Restore); err != nil {
+		opErr = fmt.Errorf("target: %w", connectivityError(err))
+		return opErr
+	}
+	if !target.Restore.CreateDatabase {
+		if err := a.preflightRestore(ctx, targetAdapter, target.Database, target.Restore); err != nil {
+			opErr = fmt.Errorf("target: %w", err)
+			return opErr
+		}
+	}
+	if err := a.checkTargetEmpty(ctx, targetAdapter, target.Database, target.Restore); err != nil {
+		opErr = fmt.Errorf("target: %w", err)
+		return opErr
+	}
+
+	dumpStream, err := a.Adapter.Dump(ctx, source, a.Cfg.Backup)
+	if err != nil {
+		if fromReplica {
+			err = replicaError(source, err)
 		}
-		backups = append(backups, obj)
+		opErr = err
+		return err
+	}
+	defer dumpStream.Reader.Close()
+	// The target is created only once the source is dumping, as a restore does once
+	// the backup decodes.
+	if target.Restore.CreateDatabase {
+		if err := a.createTarget(ctx, targetAdapter, target.Database, target.Restore); err != nil {
+			_ = dumpStream.Reader.Close()
+			_ = dumpStream.Wait()
+			opErr = fmt.Errorf("target: %w", err)
+			return opErr
+		}
+	}
+
+	manifest := storage.Manifest{
+		DatabaseType:   a.Cfg.Database.Type,
+		Database:       a.Cfg.Database.Database,
+		BackupType:     a.Cfg.Backup.Type,
+		Tables:         a.Cfg.Backup.Tables,
+		Schemas:        a.Cfg.Backup.Schemas,
+		ExcludeSchemas: a.Cfg.Backup.ExcludeSchemas,
+		Collections:    a.Cfg.Backup.Collections,
+		Container:      dumpStream.Container,
+		DumpTool:       dumpStream.Tool,
+		ToolVersion:    version.Version,
+	}
+	restoreStream, err := targetAdapter.Restore(ctx, target.Database, target.Restore, manifest)
+	if err != nil {
+		opErr = err
+		return err
+	}
+
+	_, copyErr := io.Copy(restoreStream.Writer, dumpStream.Reader)
+	closeErr := restoreStream.Writer.Close()
+	if copyErr != nil {
+		// Stops a source tool still writing, so that it exits.
+		_ = dumpStream.Reader.Close()
+	}
+	// Both tools are waited for, so neither is left running and their stderr is kept.
+	sourceErr := dumpStream.Wait()
+	if sourceErr != nil && fromReplica {
+		sourceErr = replicaError(source, sourceErr)
+	}
+	targetErr := restoreStream.Wait()
+	switch {
+	case copyErr != nil && targetErr != nil:
+		// Usually the copy failed because the target tool exited; its error says why.
+		opErr = fmt.Errorf("target: %w", targetErr)
+	case sourceErr != nil:
+		opErr = fmt.Errorf("source: %w", sourceErr)
+	case targetErr != nil:
+		opErr = fmt.Errorf("target: %w", targetErr)
+	case copyErr != nil:
+		opErr = copyErr
+	case closeErr != nil:
+		opErr = closeErr
+	}
+	return opErr
+}
+
+// checkRestoreTables verifies every requested table and schema is present in the
+// dump's own table of contents before any data is restored. A schema the backup
+// excluded is refused from the manifest alone.
+func (a *App) checkRestoreTables(ctx context.Context, key string, manifest storage.Manifest, manifestErr error) error {
+	tables := slices.Clone(a.Cfg.Restore.Tables)
+	for table := range a.Cfg.Restore.TableMap {
+		tables = append(tables, table)
+	}
+	schemas := a.Cfg.Restore.Schemas
+	for _, schema := range schemas {
+		if slices.Contains(manifest.ExcludeSchemas, schema) {
+			return fmt.Errorf("schema %s was excluded from backup %s", schema, key)
+		}
+	}
+	if len(tables) == 0 && len(schemas) == 0 {
+		return nil
+	}
+	sort.Strings(tables)
+	lister, ok := a.Adapter.(db.ContentLister)
+	if !ok {
+		return nil
+	}
+	reader, err := a.openBackup(ctx, key, manifest, manifestErr)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	objects, err := lister.ListContents(ctx, reader)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, table := range tables {
+		if !db.FindTable(objects, table) {
+			missing = append(missing, table)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("tables not found in backup %s: %s", key, strings.Join(missing, ", "))
+	}
+	for _, schema := range schemas {
+		if db.FindSchema(objects, schema) {
+			continue
+		}
+		if len(manifest.Schemas) > 0 {
+			return fmt.Errorf("schema %s not found in backup %s, which holds schemas %s", schema, key, strings.Join(manifest.Schemas, ", "))
+		}
+		return fmt.Errorf("schema %s not found in backup %s", schema, key)
+	}
+	return nil
+}
+
+// openBackup returns the decrypted, decompressed payload of the backup stored at key.
+// The object's own headers are authoritative; the manifest (or, without one, the
+// object key and then config) only fills in what the headers cannot show.
+func (a *App) openBackup(ctx context.Context, key string, manifest storage.Manifest, manifestErr error) (io.ReadCloser, error) {
+	reader, err := a.openStored(ctx, key, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return a.decodeStored(ctx, key, reader, manifest, manifestErr)
+}
+
+// openStored streams the backup's stored bytes, joining its chunks.
+func (a *App) openStored(ctx context.Context, key string, manifest storage.Manifest) (io.ReadCloser, error) {
+	if len(manifest.Chunks) > 0 {
+		return &chunkReader{ctx: ctx, store: a.Storage, keys: manifest.Chunks}, nil
+	}
+	return a.Storage.Get(ctx, key)
+}
+
+// decodeStored decrypts and decompresses the stored bytes in reader, which it
+// takes ownership of.
+func (a *App) decodeStored(ctx context.Context, key string, reader io.ReadCloser, manifest storage.Manifest, manifestErr error) (io.ReadCloser, error) {
+	compression, encrypted, source := declaredPipeline(key, manifest, manifestErr)
+
+	// Large enough to hold the first encrypted package for streamKey.
+	stored := bufio.NewReaderSize(reader, cryptoutil.MaxPackageLen)
+	if isDedupIndex(stored) {
+		return a.openDedup(ctx, key, stored, reader, manifest)
+	}
+	head, err := stored.Peek(4)
+	if err != nil && err != io.EOF {
+		reader.Close()
+		return nil, err
+	}
+	payload := io.Reader(stored)
+	switch {
+	case cryptoutil.IsEncryptedStream(head) && !encrypted && source == streamSource:
+		encrypted = true
+	case cryptoutil.IsEncryptedStream(head) && !encrypted:
+		// A plaintext stream can start with bytes that look like a DARE header, so
+		// the header only wins over the declaration when the stream decrypts.
+		switch {
+		case a.opensEncrypted(key, manifest, manifestErr, stored):
+			a.Log.Warn().Str("key", key).Str("source", source).Msg("object is encrypted although its " + source + " says otherwise; using the object header")
+			encrypted = true
+		case a.Cfg.Backup.EncryptionKey == "":
+			a.Log.Warn().Str("key", key).Str("source", source).Msg("object starts like an encrypted stream but no encryption key is set to check it; using the " + source)
+		}
+	case (encrypted || manifest.EncryptionBinding != nil) && !cryptoutil.IsEncryptedStream(head):
+		// Restoring plaintext in place of a backup declared encrypted would load
+		// whatever anyone with write access to storage put there.
+		reader.Close()
+		return nil, fmt.Errorf("%s says backup %s is encrypted but the object has no encryption header", source, key)
+	}
+
+	if encrypted {
+		if a.Cfg.Backup.EncryptionKey == "" {
+			reader.Close()
+			return nil, fmt.Errorf("encryption key is required to restore encrypted backup")
+		}
+		keyBytes, err := a.storedDataKey(manifest, manifestErr)
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+		if manifest.KeyFingerprint != "" && manifest.KeyFingerprint != cryptoutil.Fingerprint(keyBytes) {
+			reader.Close()
+			return nil, fmt.Errorf("encryption key does not match backup %s (key fingerprint %s)", key, manifest.KeyFingerprint)
+		}
+		if keyBytes, err = a.streamKey(key, manifest, stored, keyBytes); err != nil {
+			reader.Close()
+			return nil, err
+		}
+		payload, err = cryptoutil.DecryptReader(payload, keyBytes)
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+	}
+
+	observed, payload, err := compress.Detect(payload)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	switch {
+	case observed != compress.TypeNone && compression != observed:
+		if compression != "" {
+			a.Log.Warn().Str("key", key).Str("source", source).Str("declared", compression).Str("compression", observed).Msg("stream compression differs from its " + source + "; using the stream header")
+		}
+		compression = observed
+	case observed == compress.TypeNone && compression == compress.TypeBrotli:
+		// Brotli has no header to check, so the manifest or key is trusted.
+	case observed == compress.TypeNone && compression != "" && compression != compress.TypeNone:
+		reader.Close()
+		return nil, fmt.Errorf("%s says backup %s is %s-compressed but the stream has no %s header", source, key, compression, compression)
+	}
+	a.Log.Info().Str("key", key).Str("source", source).Str("compression", compression).Bool("encrypted", encrypted).Msg("resolved restore pipeline")
+
+	var dict []byte
+	if compression == compress.TypeZstd {
+		// The frame header names the dictionary, so backups whose manifest is lost
+		// still find theirs.
+		zr := bufio.NewReader(payload)
+		head, err := zr.Peek(compress.ZstdHeaderLen)
+		if err != nil && err != io.EOF {
+			reader.Close()
+			return nil, err
+		}
+		payload = zr
+		id := compress.FrameDictID(head)
+		if manifest.CompressionDict != 0 && manifest.CompressionDict != id {
+			a.Log.Warn().Str("key", key).Uint32("manifest_dict", manifest.CompressionDict).Uint32("stream_dict", id).Msg("stream dictionary differs from the manifest; using the stream header")
+		}
+		if id != 0 {
+			if dict, err = a.loadDictionary(ctx, id); err != nil {
+				reader.Close()
+				return nil, err
+			}
+		}
+	}
+
+	var compReader io.ReadCloser
+	if dict != nil {
+		compReader, err = compress.WrapReaderDict(compression, payload, dict)
+	} else {
+		compReader, err = compress.WrapReader(compression, payload)
+	}
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	if compression == "" {
+		compression = compress.TypeNone
+	}
+	return readCloser{Reader: compReader, closers: []io.Closer{compReader, reader}, format: Format{Compression: compression, Encrypted: encrypted}}, nil
+}
+
+// opensEncrypted reports whether the stored stream authenticates under the
+// backup's data key, bound to key or not.
+func (a *App) opensEncrypted(key string, manifest storage.Manifest, manifestErr error, stored *bufio.Reader) bool {
+	if a.Cfg.Backup.EncryptionKey == "" {
+		return false
+	}
+	keyBytes, err := a.storedDataKey(manifest, manifestErr)
+	if err != nil {
+		return false
+	}
+	if binding, ok := storage.BindingFor(key); ok {
+		if bound, err := bindKey(keyBytes, &binding); err == nil && cryptoutil.OpensWith(stored, bound) {
+			return true
+		}
+	}
+	return cryptoutil.OpensWith(stored, keyBytes)
+}
+
+// streamSource is the source of a pipeline that nothing declares, which is then
+// read from the object and stream headers alone.
+const streamSource = "stream header"
+
+// declaredPipeline reports how the backup claims to be encoded and where the claim
+// came from: its manifest, else its object key. The current config is never
+// consulted; it describes new backups, not this one.
+func declaredPipeline(key string, manifest storage.Manifest, manifestErr error) (compression string, encrypted bool, source string) {
+	if manifestErr == nil {
+		return manifest.Compression, manifest.Encryption, "manifest"
+	}
+	if c, enc, ok := parseExtension(key); ok {
+		return c, enc, "object key"
+	}
+	return "", false, streamSource
+}
+
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+	// format is how the stored bytes were encoded, when the reader decoded them.
+	format Format
+}
+
+func (r readCloser) Close() error {
+	var errs []error
+	for _, c := range r.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (a *App) Validate(ctx context.Context) error {
+	if err := a.Adapter.Validate(ctx, a.Cfg.Database); err != nil {
+		return connectivityError(err)
+	}
+	if source, fromReplica := a.readSource(); fromReplica {
+		if err := a.Adapter.Validate(ctx, source); err != nil {
+			return connectivityError(fmt.Errorf("read replica %s: %w", replicaAddr(source), err))
+		}
+	}
+	if err := db.CheckToolVersions(ctx, a.Cfg.Backup.RequireToolVersion); err != nil {
+		return err
+	}
+	prefix := util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database)
+	_, err := a.Storage.List(ctx, prefix)
+	return err
+}
+
+func (a *App) List(ctx context.Context) ([]storage.ObjectInfo, error) {
+	prefix := util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database)
+	return a.Storage.List(ctx, prefix)
+}
+
+// ListedObject is a stored object with the database parsed back out of its key.
+type ListedObject struct {
+	storage.ObjectInfo
+	DatabaseType string // empty when the key is not a backup key
+	Database     string
+}
+
+// ListAll lists every object under the storage prefix, across databases and output
+// prefixes. Dictionaries, restore markers and foreign objects have no database set.
+func (a *App) ListAll(ctx context.Context) ([]ListedObject, error) {
+	objects, err := a.Storage.List(ctx, util.BuildPrefix(a.Cfg.Storage.Prefix, "", "", ""))
+	if err != nil {
+		return nil, err
+	}
+	listed := make([]ListedObject, len(objects))
+	for i, obj := range objects {
+		listed[i].ObjectInfo = obj
+		listed[i].DatabaseType, listed[i].Database, _ = util.ParseObjectKey(obj.Key)
+	}
+	return listed, nil
+}
+
+// BackupKeys returns the keys of the backups under the configured prefix, with
+// chunked backups folded into one key and manifests omitted.
+func (a *App) BackupKeys(ctx context.Context) ([]string, error) {
+	objects, err := a.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	backups := groupBackups(objects)
+	keys := make([]string, 0, len(backups))
+	for _, b := range backups {
+		keys = append(keys, b.Key)
+	}
+	return keys, nil
+}
+
+func (a *App) writeManifest(ctx context.Context, manifest storage.Manifest) error {
+	return a.writeManifestWithKey(ctx, manifest, a.Cfg.Backup.EncryptionKey)
+}
+
+func (a *App) writeManifestWithKey(ctx context.Context, manifest storage.Manifest, encryptionKey string) error {
+	payload, err := a.sealManifest(manifest, encryptionKey)
+	if err != nil {
+		return err
+	}
+	key := storage.ManifestKey(manifest.Key)
+	return a.Storage.Put(ctx, key, bytes.NewReader(payload), int64(len(payload)), map[string]string{"dbu-manifest": "true"})
+}
+
+func (a *App) sealManifest(manifest storage.Manifest, encryptionKey string) ([]byte, error) {
+	payload, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return a.sealSidecar(payload, encryptionKey)
+}
+
+// replaceObject writes payload over the object stored at key. Immutable local
+// storage refuses to overwrite a file, so there the stored object, which payload
+// supersedes, is removed first.
+func (a *App) replaceObject(ctx context.Context, key string, payload []byte, metadata map[string]string) error {
+	if (a.Cfg.Storage.Backend == "local" || a.Cfg.Storage.Backend == "") && a.Cfg.Storage.Local.Immutable {
+		if err := a.Storage.Delete(ctx, key); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return a.Storage.Put(ctx, key, bytes.NewReader(payload), int64(len(payload)), metadata)
+}
+
+func (a *App) readManifest(ctx context.Context, key string) (storage.Manifest, error) {
+	manifestKey := storage.ManifestKey(key)
+	reader, err := a.Storage.Get(ctx, manifestKey)
+	if err != nil {
+		return storage.Manifest{}, err
+	}
+	defer reader.Close()
+	payload, err := io.ReadAll(reader)
+	if err != nil {
+		return storage.Manifest{}, err
+	}
+	if payload, err = a.openSidecar("manifest "+manifestKey, payload); err != nil {
+		return storage.Manifest{}, err
+	}
+	var manifest storage.Manifest
+	if err := json.Unmarshal(payload, &manifest); err != nil {
+		return storage.Manifest{}, err
+	}
+	return storage.MigrateManifest(manifest)
+}
+
+type retentionStats struct {
+	Deleted int
+	Moved   int // to the cold tier
+	Failed  int
+}
+
+// applyRetention deletes the backups the policy expires or, with a cold tier,
+// moves them there and then applies the cold tier's own retention.
+func (a *App) applyRetention(ctx context.Context) (retentionStats, error) {
+	var stats retentionStats
+	candidates, err := a.retentionCandidates(ctx, nil)
+	if err != nil {
+		return stats, err
+	}
+	tiered := a.coldTier() != nil
+	var errs []error
+	for _, obj := range candidates {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if tiered {
+			if err := a.moveToCold(ctx, obj); err != nil {
+				stats.Failed++
+				errs = append(errs, err)
+			} else {
+				stats.Moved++
+			}
+			continue
+		}
+		deleted, err := a.deleteBackup(ctx, obj)
+		if !deleted {
+			stats.Failed++
+		} else {
+			stats.Deleted++
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cold := a.coldTier(); cold != nil && ctx.Err() == nil {
+		coldStats, err := cold.applyRetention(ctx)
+		stats.Deleted += coldStats.Deleted
+		stats.Failed += coldStats.Failed
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cold tier: %w", err))
+		}
+	}
+	return stats, errors.Join(errs...)
+}
+
+// deleteBackup removes a backup's parts and then its manifest. It reports whether
+// the data is gone; a manifest left behind is only returned as an error.
+func (a *App) deleteBackup(ctx context.Context, obj backupObject) (bool, error) {
+	for _, part := range obj.Parts {
+		if err := a.Storage.Delete(ctx, part); err != nil {
+			return false, fmt.Errorf("delete %s: %w", part, err)
+		}
+	}
+	if err := a.Storage.Delete(ctx, storage.ManifestKey(obj.Key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return true, fmt.Errorf("delete %s: %w", storage.ManifestKey(obj.Key), err)
+	}
+	return true, nil
+}
+
+// effectiveBackup merges the override for the configured backup type over the base
+// settings. A compression override other than zstd drops the base dictionary.
+func effectiveBackup(base config.BackupConfig) config.BackupConfig {
+	override, ok := base.Overrides[strings.ToLower(base.Type)]
+	if !ok {
+		return base
+	}
+	if override.Compression != "" {
+		base.Compression = override.Compression
+		if override.Compression != compress.TypeZstd {
+			base.ZstdDictionary = ""
+		}
+	}
+	if override.ZstdDictionary != "" {
+		base.ZstdDictionary = override.ZstdDictionary
+	}
+	if override.Encryption != nil {
+		base.Encryption = *override.Encryption
+	}
+	return base
+}
+
+// withBackupOverrides returns a copy of a whose config has the per-type backup
+// overrides applied.
+func (a *App) withBackupOverrides() *App {
+	cfg := *a.Cfg
+	cfg.Backup = effectiveBackup(cfg.Backup)
+	op := *a
+	op.Cfg = &cfg
+	return &op
+}
+
+func retentionEnabled(policy config.Retention) bool {
+	return policy.KeepDays != 0 || policy.KeepLast != 0 || policy.MaxBytes != 0
+}
+
+// retentionCandidates returns the backups the retention policy would delete, newest
+// first. pending, when set, is counted as the newest backup without being listed.
+func (a *App) retentionCandidates(ctx context.Context, pending *backupObject) ([]backupObject, error) {
+	policy := a.Cfg.Backup.RetentionPolicy
+	if !retentionEnabled(policy) {
+		return nil, nil
+	}
+	prefix := util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database)
+	objects, err := a.Storage.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	backups := groupBackups(objects)
+	if pending != nil {
+		backups = append(backups, *pending)
 	}
 	sort.Slice(backups, func(i, j int) bool { return backups[i].Modified.After(backups[j].Modified) })
 
@@ -372,21 +1460,89 @@ func (a *App) applyRetention(ctx context.Context) error {
 	for _, obj := range backups {
 		totalSize += obj.Size
 	}
+	var candidates, kept []backupObject
 	for i, obj := range backups {
-		if policy.KeepLast > 0 && i < policy.KeepLast {
+		keep := (policy.KeepLast > 0 && i < policy.KeepLast) ||
+			(policy.KeepDays > 0 && obj.Modified.After(cutoff)) ||
+			(policy.MaxBytes > 0 && totalSize <= policy.MaxBytes)
+		if keep {
+			if pending == nil || obj.Key != pending.Key {
+				kept = append(kept, obj)
+			}
 			continue
 		}
-		if policy.KeepDays > 0 && obj.Modified.After(cutoff) {
-			continue
+		candidates = append(candidates, obj)
+		totalSize -= obj.Size
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	// Held backups are never deleted, whatever the policy says.
+	now := time.Now()
+	deletable := candidates[:0]
+	for _, obj := range candidates {
+		if a.held(ctx, obj.Key, now) {
+			kept = append(kept, obj)
+		} else {
+			deletable = append(deletable, obj)
+		}
+	}
+	// The latest keep_full chains stay restorable whatever their age.
+	if policy.KeepFull > 0 {
+		protected := a.protectedChains(ctx, backups, deletable, policy.KeepFull)
+		unprotected := deletable[:0]
+		for _, obj := range deletable {
+			if protected[obj.Key] {
+				kept = append(kept, obj)
+			} else {
+				unprotected = append(unprotected, obj)
+			}
 		}
-		if policy.MaxBytes > 0 && totalSize <= policy.MaxBytes {
+		deletable = unprotected
+	}
+	// A base must outlive every differential that is kept.
+	bases := a.referencedBases(ctx, kept)
+	pruned := deletable[:0]
+	for _, obj := range deletable {
+		if !bases[obj.Key] {
+			pruned = append(pruned, obj)
+		}
+	}
+	return pruned, nil
+}
+
+// backupObject is one logical backup, which may be stored as several chunk parts.
+type backupObject struct {
+	storage.ObjectInfo
+	Parts []string
+}
+
+// groupBackups folds chunk parts into their logical backup and drops manifests.
+func groupBackups(objects []storage.ObjectInfo) []backupObject {
+	index := map[string]int{}
+	var backups []backupObject
+	for _, obj := range objects {
+		if obj.IsManifest || storage.IsRestoreMarker(obj.Key) || storage.IsStatus(obj.Key) || storage.IsPause(obj.Key) {
 			continue
 		}
-		_ = a.Storage.Delete(ctx, obj.Key)
-		_ = a.Storage.Delete(ctx, storage.ManifestKey(obj.Key))
-		totalSize -= obj.Size
+		base := obj.Key
+		if storage.IsChunkKey(obj.Key) {
+			base = storage.ChunkBase(obj.Key)
+		}
+		i, ok := index[base]
+		if !ok {
+			index[base] = len(backups)
+			backups = append(backups, backupObject{ObjectInfo: storage.ObjectInfo{Key: base, Modified: obj.Modified}})
+			i = len(backups) - 1
+		}
+		b := &backups[i]
+		b.Size += obj.Size
+		b.Parts = append(b.Parts, obj.Key)
+		if obj.Modified.After(b.Modified) {
+			b.Modified = obj.Modified
+		}
 	}
-	return nil
+	return backups
 }
 
 func buildExtension(compression string, encryption bool) string {
@@ -396,6 +1552,8 @@ func buildExtension(compression string, encryption bool) string {
 		ext += ".gz"
 	case compress.TypeZstd:
 		ext += ".zst"
+	case compress.TypeBrotli:
+		ext += ".br"
 	}
 	if encryption {
 		ext += ".enc"
@@ -403,9 +1561,124 @@ func buildExtension(compression string, encryption bool) string {
 	return strings.TrimPrefix(ext, ".")
 }
 
+// finish records the outcome of an operation in the audit trail and notifies.
+func (a *App) finish(opType string, start time.Time, key string, opErr error) {
+	entry := audit.Entry{
+		Operation:  opType,
+		DBType:     a.Cfg.Database.Type,
+		Database:   a.Cfg.Database.Database,
+		Key:        key,
+		Status:     statusFromErr(opErr),
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if opErr != nil {
+		entry.Error = opErr.Error()
+	}
+	switch opType {
+	case "backup", "restore", "clone":
+		entry.Overrides = a.backupOverrides()
+	}
+	if err := a.Audit.Record(entry); err != nil {
+		a.Log.Error().Err(err).Msg("failed to write audit record")
+	}
+	a.notify(opType, start, key, opErr)
+}
+
+// backupOverrides names the emergency overrides in effect for a backup, restore
+// or clone.
+func (a *App) backupOverrides() []string {
+	var overrides []string
+	if a.Force {
+		overrides = append(overrides, "force")
+	}
+	if a.NoLock {
+		overrides = append(overrides, "no-lock")
+	}
+	return overrides
+}
+
+func (a *App) notify(opType string, start time.Time, key string, opErr error) {
+	if a.Notifier == nil {
+		return
+	}
+	event := notify.Event{
+		Type:      opType,
+		Message:   fmt.Sprintf("%s %s", opType, a.Cfg.Database.Database),
+		Status:    statusFromErr(opErr),
+		Database:  a.Cfg.Database.Database,
+		DBType:    a.Cfg.Database.Type,
+		StartedAt: start,
+		EndedAt:   time.Now(),
+		Duration:  time.Since(start).String(),
+		Key:       key,
+	}
+	if opErr != nil {
+		event.Error = opErr.Error()
+	}
+	if errors.Is(opErr, ErrBudgetExceeded) {
+		event.Message = fmt.Sprintf("%s %s aborted: budget exceeded", opType, a.Cfg.Database.Database)
+	}
+	if err := a.Notifier.Notify(context.Background(), event); err != nil {
+		a.Log.Warn().Err(err).Str("operation", opType).Msg("notification failed")
+	}
+}
+
+// recordCodecs notes in the manifest what decoding the backup takes beyond its
+// compression: the zstd window and the cipher suite, as this build writes them.
+func recordCodecs(manifest *storage.Manifest) {
+	manifest.ZstdWindowLog, manifest.Cipher = 0, ""
+	if manifest.Compression == compress.TypeZstd {
+		manifest.ZstdWindowLog = compress.ZstdWindowLog
+	}
+	if manifest.Encryption {
+		manifest.Cipher, _ = cryptoutil.DefaultCipher()
+	}
+}
+
+// checkDecodable fails when the manifest records a compression, zstd window or
+// cipher suite this build cannot decode, as a newer dbu may write, so the restore
+// stops before anything is loaded rather than partway through the stream.
+func checkDecodable(key string, manifest storage.Manifest) error {
+	if manifest.Compression != "" && !slices.Contains(compress.Types, manifest.Compression) {
+		return fmt.Errorf("backup %s uses %s compression, which dbu %s cannot decode; upgrade dbu to restore it", key, manifest.Compression, version.Version)
+	}
+	if manifest.ZstdWindowLog > compress.MaxZstdWindowLog {
+		return fmt.Errorf("backup %s uses zstd window log %d, more than the %d dbu %s decodes; upgrade dbu to restore it", key, manifest.ZstdWindowLog, compress.MaxZstdWindowLog, version.Version)
+	}
+	if manifest.Cipher != "" && !slices.Contains(cryptoutil.Ciphers, manifest.Cipher) {
+		return fmt.Errorf("backup %s is encrypted with %s, which dbu %s cannot decrypt; upgrade dbu to restore it", key, manifest.Cipher, version.Version)
+	}
+	return nil
+}
+
+// parseExtension infers the pipeline from an object key produced by buildExtension.
+func parseExtension(key string) (compression string, encrypted bool, ok bool) {
+	name := path.Base(key)
+	if strings.HasSuffix(name, ".enc") {
+		encrypted = true
+		name = strings.TrimSuffix(name, ".enc")
+	}
+	switch {
+	case strings.HasSuffix(name, ".backup.gz"):
+		return compress.TypeGzip, encrypted, true
+	case strings.HasSuffix(name, ".backup.zst"):
+		return compress.TypeZstd, encrypted, true
+	case strings.HasSuffix(name, ".backup.br"):
+		return compress.TypeBrotli, encrypted, true
+	case strings.HasSuffix(name, ".backup"):
+		return compress.TypeNone, encrypted, true
+	default:
+		return "", false, false
+	}
+}
+
 func statusFromErr(err error) string {
-	if err == nil {
+	switch {
+	case err == nil:
 		return "success"
+	case errors.Is(err, ErrWindowSkipped), errors.Is(err, ErrPaused):
+		return "skipped"
+	default:
+		return "failed"
 	}
-	return "failed"
 }
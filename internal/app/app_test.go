@@ -0,0 +1,92 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+)
+
+func TestEffectiveBackup(t *testing.T) {
+	off := false
+	base := config.BackupConfig{
+		Compression:    "zstd",
+		ZstdDictionary: "0000abcd",
+		Encryption:     true,
+		Overrides: map[string]config.BackupOverride{
+			"incremental":  {Compression: "gzip", Encryption: &off},
+			"differential": {ZstdDictionary: "0000beef"},
+		},
+	}
+	cases := []struct {
+		typ         string
+		compression string
+		dict        string
+		encryption  bool
+	}{
+		{"full", "zstd", "0000abcd", true},
+		{"Incremental", "gzip", "", false},
+		{"differential", "zstd", "0000beef", true},
+	}
+	for _, tc := range cases {
+		cfg := base
+		cfg.Type = tc.typ
+		got := effectiveBackup(cfg)
+		if got.Compression != tc.compression || got.ZstdDictionary != tc.dict || got.Encryption != tc.encryption {
+			t.Fatalf("%s: got compression=%s dict=%s encryption=%v", tc.typ, got.Compression, got.ZstdDictionary, got.Encryption)
+		}
+	}
+	if base.Compression != "zstd" || !base.Encryption {
+		t.Fatalf("base config modified")
+	}
+}
+
+// TestEncodeDumpCloseOrder pins how the backup pipeline is layered and closed:
+// encryption wraps the stored stream and compression runs inside it on the
+// plaintext, and the compressor is closed first, so its trailer is encrypted
+// before the encryptor seals the stream.
+func TestEncodeDumpCloseOrder(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", Encryption: true, EncryptionKey: "hex:" + strings.Repeat("ab", 32)}
+	a := New(cfg, nil, nil, zerolog.Nop(), nil)
+	dump := bytes.Repeat([]byte("row\n"), 4096)
+
+	var stored bytes.Buffer
+	if _, _, err := a.encodeDump(context.Background(), bytes.NewReader(dump), &stored, &meterWriter{}, 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !cryptoutil.IsEncryptedStream(stored.Bytes()) {
+		t.Fatal("expected the stored stream to be encrypted")
+	}
+	key, err := a.backupDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := cryptoutil.DecryptReader(&stored, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(decrypted)
+	if err != nil {
+		t.Fatalf("the encrypted stream was not sealed after everything was written to it: %v", err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		t.Fatalf("expected gzip inside the encryption: %v", err)
+	}
+	got, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("the gzip stream lacks its trailer, so it was closed after the encryptor: %v", err)
+	}
+	if !bytes.Equal(got, dump) {
+		t.Fatal("the stored stream does not decode to the dump")
+	}
+}
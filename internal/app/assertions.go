@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/db"
+)
+
+// expectOps are the comparisons restore.assertions accept, longest first so
+// ">=" is not read as ">".
+var expectOps = []string{"==", "!=", ">=", "<=", "=", ">", "<"}
+
+// expectation is a parsed Assertion.Expect.
+type expectation struct {
+	op, value string
+}
+
+// parseExpect reads "<op> <value>"; a bare value means "=", and an empty expect
+// requires a true or non-zero result.
+func parseExpect(expect string) (expectation, error) {
+	expect = strings.TrimSpace(expect)
+	if expect == "" {
+		return expectation{}, nil
+	}
+	e := expectation{op: "="}
+	for _, op := range expectOps {
+		if rest, ok := strings.CutPrefix(expect, op); ok {
+			e.op, expect = op, strings.TrimSpace(rest)
+			if e.op == "==" {
+				e.op = "="
+			}
+			break
+		}
+	}
+	e.value = unquote(expect)
+	if e.op != "=" && e.op != "!=" {
+		if _, err := strconv.ParseFloat(e.value, 64); err != nil {
+			return e, fmt.Errorf("expect %q: %s needs a number", expect, e.op)
+		}
+	}
+	return e, nil
+}
+
+// holds reports whether a query result satisfies the expectation. Results that
+// parse as numbers compare numerically, so "5.0" = "5".
+func (e expectation) holds(got string) bool {
+	if e.op == "" {
+		return truthy(got)
+	}
+	g, gerr := strconv.ParseFloat(got, 64)
+	w, werr := strconv.ParseFloat(e.value, 64)
+	numeric := gerr == nil && werr == nil
+	switch e.op {
+	case "=":
+		return got == e.value || (numeric && g == w)
+	case "!=":
+		return got != e.value && !(numeric && g == w)
+	case ">":
+		return numeric && g > w
+	case ">=":
+		return numeric && g >= w
+	case "<":
+		return numeric && g < w
+	case "<=":
+		return numeric && g <= w
+	}
+	return false
+}
+
+func (e expectation) String() string {
+	if e.op == "" {
+		return "true or non-zero"
+	}
+	return e.op + " " + e.value
+}
+
+// truthy accepts how the engines print true (t, true, 1) and any other non-zero number.
+func truthy(got string) bool {
+	switch strings.ToLower(got) {
+	case "t", "true":
+		return true
+	}
+	n, err := strconv.ParseFloat(got, 64)
+	return err == nil && n != 0
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// assertionName labels an assertion in logs and errors by its name, or its query.
+func assertionName(i int, assertion config.Assertion) string {
+	if assertion.Name != "" {
+		return assertion.Name
+	}
+	return fmt.Sprintf("#%d (%s)", i+1, strings.TrimSpace(assertion.Query))
+}
+
+// prepareAssertions checks restore.assertions before anything is restored, so a
+// typo does not cost a full restore.
+func (a *App) prepareAssertions() (db.Querier, []expectation, error) {
+	assertions := a.Cfg.Restore.Assertions
+	if len(assertions) == 0 {
+		return nil, nil, nil
+	}
+	querier, ok := a.Adapter.(db.Querier)
+	if !ok {
+		return nil, nil, fmt.Errorf("restore.assertions are not supported for %s", a.Adapter.Name())
+	}
+	expectations := make([]expectation, len(assertions))
+	for i, assertion := range assertions {
+		if strings.TrimSpace(assertion.Query) == "" {
+			return nil, nil, fmt.Errorf("restore assertion %s: query is empty", assertionName(i, assertion))
+		}
+		e, err := parseExpect(assertion.Expect)
+		if err != nil {
+			return nil, nil, fmt.Errorf("restore assertion %s: %w", assertionName(i, assertion), err)
+		}
+		expectations[i] = e
+	}
+	return querier, expectations, nil
+}
+
+// checkAssertions runs every assertion against the restored database and fails
+// with ErrAssertion naming those that did not hold.
+func (a *App) checkAssertions(ctx context.Context, querier db.Querier, expectations []expectation) error {
+	var failed []string
+	for i, assertion := range a.Cfg.Restore.Assertions {
+		name := assertionName(i, assertion)
+		got, err := querier.Query(ctx, a.Cfg.Database, assertion.Query)
+		if err != nil {
+			a.Log.Error().Err(err).Str("assertion", name).Msg("restore assertion query failed")
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if !expectations[i].holds(got) {
+			a.Log.Error().Str("assertion", name).Str("result", got).Str("expect", expectations[i].String()).Msg("restore assertion failed")
+			failed = append(failed, fmt.Sprintf("%s: got %q, want %s", name, got, expectations[i]))
+			continue
+		}
+		a.Log.Info().Str("assertion", name).Str("result", got).Msg("restore assertion passed")
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: %d of %d: %s", ErrAssertion, len(failed), len(a.Cfg.Restore.Assertions), strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// queryAdapter answers "rows <table>" with the length of the table's contents.
+type queryAdapter struct {
+	*memAdapter
+}
+
+func (q queryAdapter) Query(_ context.Context, cfg config.DatabaseConfig, query string) (string, error) {
+	table, ok := strings.CutPrefix(query, "rows ")
+	if !ok {
+		return "", errors.New("syntax error")
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return fmt.Sprint(len(q.dbs[cfg.Database][table])), nil
+}
+
+func TestExpectations(t *testing.T) {
+	cases := []struct {
+		expect, got string
+		want        bool
+	}{
+		{"> 0", "3", true},
+		{">0", "0", false},
+		{">= 3", "3.0", true},
+		{"< 10", "abc", false},
+		{"= 5", "5.0", true},
+		{"== 'ok'", "ok", true},
+		{"ok", "ok", true},
+		{"!= 0", "0", false},
+		{"", "t", true},
+		{"", "true", true},
+		{"", "f", false},
+		{"", "0", false},
+		{"", "2", true},
+	}
+	for _, c := range cases {
+		e, err := parseExpect(c.expect)
+		if err != nil {
+			t.Fatalf("parseExpect(%q): %v", c.expect, err)
+		}
+		if got := e.holds(c.got); got != c.want {
+			t.Errorf("%q holds for %q = %v, want %v", c.expect, c.got, got, c.want)
+		}
+	}
+	if _, err := parseExpect("> many"); err == nil {
+		t.Error("expected an ordering against a non-number to be rejected")
+	}
+}
+
+func TestRestoreAssertions(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "mem", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	mem := &memAdapter{dbs: map[string]map[string]string{"appdb": {"users": "ada,grace"}}}
+	a := New(cfg, queryAdapter{mem}, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Restore.DropExisting = true
+
+	cfg.Restore.Assertions = []config.Assertion{{Name: "users", Query: "rows users", Expect: "> 0"}}
+	if err := a.Restore(ctx, res.Key); err != nil {
+		t.Fatalf("expected the assertion to hold: %v", err)
+	}
+
+	cfg.Restore.Assertions = append(cfg.Restore.Assertions,
+		config.Assertion{Query: "rows orders", Expect: ">= 1"},
+		config.Assertion{Name: "broken", Query: "select"})
+	err = a.Restore(ctx, res.Key)
+	if !errors.Is(err, ErrAssertion) || !strings.Contains(err.Error(), "2 of 3") ||
+		!strings.Contains(err.Error(), `#2 (rows orders): got "0", want >= 1`) || !strings.Contains(err.Error(), "broken: syntax error") {
+		t.Fatalf("expected two failed assertions, got %v", err)
+	}
+
+	// Mistakes in the assertions are caught before anything is restored.
+	mem.dbs["appdb"] = map[string]string{}
+	cfg.Restore.Assertions = []config.Assertion{{Query: "rows users", Expect: "> lots"}}
+	if err := a.Restore(ctx, res.Key); err == nil || errors.Is(err, ErrAssertion) || len(mem.dbs["appdb"]) != 0 {
+		t.Fatalf("expected a config error before restoring, got %v", err)
+	}
+	cfg.Restore.Assertions = []config.Assertion{{Query: "rows users"}}
+	a.Adapter = mem
+	if err := a.Restore(ctx, res.Key); err == nil || !strings.Contains(err.Error(), "not supported for mem") {
+		t.Fatalf("expected adapters without queries to be rejected, got %v", err)
+	}
+}
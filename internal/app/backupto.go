@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// BackupTo runs a backup's dump, compression and encryption into w instead of
+// storage, for embedders that ship backups elsewhere. The returned manifest has
+// no key and nothing is stored, so retention does not run; differential and
+// deduplicated backups, which depend on storage, are refused. The lock, hooks,
+// audit trail and notifications work as for Backup, but the backup window is
+// not checked: the caller decides when to run. A failed write to w is reported
+// as ErrUpload.
+func (a *App) BackupTo(ctx context.Context, w io.Writer) (storage.Manifest, error) {
+	op := a.withBackupOverrides()
+	op.Storage = a.cachedStorage()
+	return op.backupTo(ctx, w)
+}
+
+func (a *App) backupTo(ctx context.Context, w io.Writer) (storage.Manifest, error) {
+	start := time.Now()
+	var opErr error
+	defer func() { a.finish("backup", start, "", opErr) }()
+
+	if isDifferential(a.Cfg.Backup.Type) {
+		opErr = fmt.Errorf("differential backups need their base in storage and cannot be streamed")
+		return storage.Manifest{}, opErr
+	}
+	if a.Cfg.Backup.Dedup {
+		opErr = fmt.Errorf("deduplicated backups store their chunks in storage and cannot be streamed")
+		return storage.Manifest{}, opErr
+	}
+	if a.NoLock {
+		a.Log.Warn().Str("lock_file", lockPath(a.Cfg)).Msg("NOT acquiring the lock (--no-lock): concurrent backups and restores are not prevented")
+	} else {
+		guard, err := a.acquireLock(a.Cfg)
+		if err != nil {
+			opErr = err
+			return storage.Manifest{}, err
+		}
+		defer guard.Release()
+	}
+
+	source, fromReplica := a.readSource()
+	if err := a.Adapter.Validate(ctx, source); err != nil {
+		if fromReplica {
+			err = fmt.Errorf("read replica %s: %w", replicaAddr(source), err)
+		}
+		opErr = connectivityError(err)
+		return storage.Manifest{}, opErr
+	}
+	if err := a.checkBackup(ctx); err != nil {
+		opErr = err
+		return storage.Manifest{}, err
+	}
+	dictID, dict, err := a.backupDictionary(ctx)
+	if err != nil {
+		opErr = stageError(ErrCompress, err)
+		return storage.Manifest{}, opErr
+	}
+
+	defer func() { a.postHook(ctx, "backup", "", opErr) }()
+	if err := a.runHook(ctx, "pre", "backup", "", nil); err != nil {
+		opErr = err
+		return storage.Manifest{}, err
+	}
+
+	dumpCfg := a.Cfg.Backup
+	var checksums map[string]string
+	if dumpCfg.TableChecksums {
+		if checksums, err = a.tableChecksums(ctx, source); err != nil {
+			opErr = err
+			return storage.Manifest{}, err
+		}
+	}
+	dumpCtx, cancelDump := context.WithCancel(ctx)
+	defer cancelDump()
+	dumpStart := time.Now()
+	dumpStream, err := a.Adapter.Dump(dumpCtx, source, dumpCfg)
+	if err != nil {
+		if fromReplica {
+			err = replicaError(source, err)
+		}
+		opErr = stageError(ErrDump, err)
+		return storage.Manifest{}, opErr
+	}
+	defer dumpStream.Reader.Close()
+
+	stored := &meterWriter{w: stageWriter{w: w, stage: ErrUpload}}
+	storedHash := sha256.New()
+	plain := &meterWriter{}
+	_, closeTime, encodeErr := a.encodeDump(ctx, dumpStream.Reader, io.MultiWriter(storedHash, stored), plain, dictID, dict, nil)
+	if encodeErr != nil {
+		// Nobody reads the dump any more; stop it so Wait does not hang.
+		cancelDump()
+		_ = dumpStream.Reader.Close()
+	}
+	dumpErr := dumpStream.Wait()
+	dumpTime := time.Since(dumpStart)
+	if fromReplica {
+		dumpErr = replicaError(source, dumpErr)
+	}
+	switch {
+	case encodeErr != nil && !errors.Is(encodeErr, ErrDump):
+		opErr = encodeErr
+	case dumpErr != nil:
+		opErr = stageError(ErrDump, dumpErr)
+	case encodeErr != nil:
+		opErr = encodeErr
+	}
+	if opErr != nil {
+		return storage.Manifest{}, opErr
+	}
+
+	manifest := a.newManifest(source, fromReplica, dumpCfg, dumpStream, dictID)
+	manifest.SizeBytes = stored.n
+	manifest.SHA256 = hex.EncodeToString(storedHash.Sum(nil))
+	manifest.TableChecksums = checksums
+	manifest.UncompressedBytes = plain.n
+	manifest.Timings = &storage.StageTimings{
+		DumpMS:    dumpTime.Milliseconds(),
+		ProcessMS: (plain.elapsed + closeTime - stored.elapsed).Milliseconds(),
+		UploadMS:  stored.elapsed.Milliseconds(),
+	}
+	return manifest, nil
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// failingWriter fails every write.
+type failingWriter struct{ err error }
+
+func (f failingWriter) Write([]byte) (int, error) { return 0, f.err }
+
+func TestBackupTo(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	dump := bytes.Repeat([]byte("rows"), 1024)
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	a := New(cfg, &stubAdapter{data: dump}, store, zerolog.Nop(), nil)
+
+	var buf bytes.Buffer
+	manifest, err := a.BackupTo(ctx, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	if manifest.Key != "" || manifest.SizeBytes != int64(buf.Len()) || manifest.SHA256 != hex.EncodeToString(sum[:]) ||
+		manifest.UncompressedBytes != int64(len(dump)) || manifest.Compression != "gzip" || manifest.Database != "appdb" {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(zr); err != nil || !bytes.Equal(got, dump) {
+		t.Fatalf("stream does not decode to the dump: %v", err)
+	}
+	if objects, err := store.List(ctx, ""); err != nil || len(objects) != 0 {
+		t.Fatalf("BackupTo wrote to storage: %+v, %v", objects, err)
+	}
+
+	cfg.Backup.Dedup = true
+	if _, err := a.BackupTo(ctx, io.Discard); err == nil {
+		t.Fatal("expected deduplicated backups to be refused")
+	}
+}
+
+func TestBackupToFailedWriteStopsDump(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "none"}
+	a := New(cfg, &hungAdapter{}, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+
+	boom := errors.New("boom")
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.BackupTo(context.Background(), failingWriter{err: boom})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrUpload) || !errors.Is(err, boom) {
+			t.Fatalf("expected the write error, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("BackupTo hung after the writer failed")
+	}
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// Encrypted backups are bound to their identity: the stream is sealed with a key
+// derived from the encryption key and the backup's database and object name, so an
+// object copied over another backup's key (even one of the same database, under
+// the same encryption key) fails to decrypt instead of restoring as that backup.
+// Deduplicated chunks are shared between backups and stay unbound; backups
+// streamed with BackupTo have no key to bind to.
+
+// encryptionBinding returns what a new encrypted backup at key is bound to, or nil
+// when its stream is not encrypted as a whole or key does not name a backup.
+func (a *App) encryptionBinding(key string) *storage.EncryptionBinding {
+	if !a.Cfg.Backup.Encryption || a.Cfg.Backup.Dedup {
+		return nil
+	}
+	binding, ok := storage.BindingFor(key)
+	if !ok {
+		return nil
+	}
+	return &binding
+}
+
+// bindKey returns the stream key for binding, or keyBytes itself without one.
+func bindKey(keyBytes []byte, binding *storage.EncryptionBinding) ([]byte, error) {
+	if binding == nil {
+		return keyBytes, nil
+	}
+	return cryptoutil.BindKey(keyBytes, binding.String())
+}
+
+// streamKey returns the key the encrypted stream buffered in stored was sealed
+// with: bound to the backup at key or, for backups written before binding, the
+// encryption key itself. The binding comes from the key that was asked for, never
+// from the manifest, and a manifest that records a binding rules the unbound key
+// out. stored must be at least cryptoutil.MaxPackageLen in size.
+func (a *App) streamKey(key string, manifest storage.Manifest, stored *bufio.Reader, keyBytes []byte) ([]byte, error) {
+	if binding, ok := storage.BindingFor(key); ok {
+		bound, err := bindKey(keyBytes, &binding)
+		if err != nil {
+			return nil, err
+		}
+		if cryptoutil.OpensWith(stored, bound) {
+			return bound, nil
+		}
+		if manifest.EncryptionBinding != nil {
+			return nil, fmt.Errorf("backup %s does not decrypt as %s/%s/%s: the object belongs to another backup or was modified",
+				key, binding.DatabaseType, binding.Database, binding.Name)
+		}
+	}
+	return keyBytes, nil
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestBrotliBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "mem", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "br"}
+	adapter := &memAdapter{dbs: map[string]map[string]string{"appdb": {"users": strings.Repeat("ada,grace;", 100)}}}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	a := New(cfg, adapter, store, zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(res.Key, ".backup.br") || res.Manifest.Compression != "br" {
+		t.Fatalf("unexpected backup %s, manifest %+v", res.Key, res.Manifest)
+	}
+
+	// Restores follow the manifest, then the key, whatever the current config says.
+	cfg.Backup.Compression = "gzip"
+	cfg.Restore.DropExisting = true
+	for _, dropManifest := range []bool{false, true} {
+		if dropManifest {
+			if err := store.Delete(ctx, storage.ManifestKey(res.Key)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		adapter.dbs["appdb"] = map[string]string{}
+		if err := a.Restore(ctx, res.Key); err != nil {
+			t.Fatalf("restore (manifest dropped: %v): %v", dropManifest, err)
+		}
+		if adapter.dbs["appdb"]["users"] != strings.Repeat("ada,grace;", 100) {
+			t.Fatalf("restore (manifest dropped: %v) got %q", dropManifest, adapter.dbs["appdb"]["users"])
+		}
+	}
+}
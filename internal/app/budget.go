@@ -0,0 +1,37 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// backupBudget bounds a backup's dump and upload by backup.max_duration. The
+// operation timeout covers every retry; the budget covers one attempt, and when
+// it runs out the attempt fails with ErrBudgetExceeded instead of a deadline.
+func (a *App) backupBudget(ctx context.Context) (context.Context, context.CancelFunc) {
+	if a.Cfg.Backup.MaxDuration <= 0 {
+		return context.WithCancel(ctx)
+	}
+	cause := fmt.Errorf("%w: running longer than %s (backup.max_duration)", ErrBudgetExceeded, a.Cfg.Backup.MaxDuration)
+	return context.WithTimeoutCause(ctx, a.Cfg.Backup.MaxDuration, cause)
+}
+
+// budgetError reports err as the budget ctx ran out of when that is what caused
+// it, rather than the killed dump or cancelled upload that followed.
+func budgetError(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrBudgetExceeded) {
+		return cause
+	}
+	return err
+}
+
+// sizeBudget returns the meter backup.max_size_bytes applies to: what is stored,
+// or for deduplicated backups, whose chunks are stored outside the pipeline, the
+// dump itself.
+func (a *App) sizeBudget(plain, stored *meterWriter) *meterWriter {
+	if a.Cfg.Backup.Dedup {
+		return plain
+	}
+	return stored
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/db"
+	"github.com/rowjay/db-backup-utility/internal/notify"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// stalledAdapter dumps some data and then hangs until the dump is stopped.
+type stalledAdapter struct{ stubAdapter }
+
+func (s *stalledAdapter) Dump(ctx context.Context, _ config.DatabaseConfig, _ config.BackupConfig) (*db.DumpStream, error) {
+	reader, writer := io.Pipe()
+	go func() {
+		_, _ = writer.Write(s.data)
+		<-ctx.Done()
+		_ = writer.CloseWithError(ctx.Err())
+	}()
+	return &db.DumpStream{Reader: reader, Wait: func() error { <-ctx.Done(); return ctx.Err() }}, nil
+}
+
+// recordingNotifier keeps the events it is sent.
+type recordingNotifier struct{ events []notify.Event }
+
+func (r *recordingNotifier) Notify(_ context.Context, event notify.Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestBackupOverBudgetIsAbortedAndCleanedUp(t *testing.T) {
+	cases := []struct {
+		name      string
+		adapter   db.Adapter
+		chunkSize int64
+		maxSize   int64
+		maxTime   time.Duration
+	}{
+		{name: "size", adapter: &stubAdapter{data: bytes.Repeat([]byte("rows"), 4096)}, maxSize: 1000},
+		{name: "size chunked", adapter: &stubAdapter{data: bytes.Repeat([]byte("rows"), 4096)}, chunkSize: 1024, maxSize: 5000},
+		{name: "duration", adapter: &stalledAdapter{stubAdapter{data: []byte("rows")}}, maxTime: 50 * time.Millisecond},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &config.Config{}
+			cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+			cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+			cfg.Backup = config.BackupConfig{Type: "full", Compression: "none", ChunkSize: tc.chunkSize,
+				MaxSizeBytes: tc.maxSize, MaxDuration: tc.maxTime}
+			store := storage.NewLocal(filepath.Join(dir, "backups"))
+			notifier := &recordingNotifier{}
+			a := New(cfg, tc.adapter, store, zerolog.Nop(), notifier)
+
+			_, err := a.Backup(context.Background())
+			if !errors.Is(err, ErrBudgetExceeded) {
+				t.Fatalf("expected the budget to be exceeded, got %v", err)
+			}
+			for _, stage := range pipelineStages {
+				if errors.Is(err, stage) {
+					t.Fatalf("budget error %v is attributed to %v", err, stage)
+				}
+			}
+			objects, err := store.List(context.Background(), "stub")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, obj := range objects {
+				if !storage.IsStatus(obj.Key) {
+					t.Fatalf("aborted backup left %+v", objects)
+				}
+			}
+			if len(notifier.events) != 1 || notifier.events[0].Status != "failed" || notifier.events[0].Message != "backup appdb aborted: budget exceeded" {
+				t.Fatalf("unexpected notifications %+v", notifier.events)
+			}
+		})
+	}
+}
+
+func TestBackupWithinBudget(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "none", MaxSizeBytes: 4, MaxDuration: time.Minute}
+	a := New(cfg, &stubAdapter{data: []byte("rows")}, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+	if _, err := a.Backup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
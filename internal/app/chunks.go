@@ -0,0 +1,95 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"maps"
+
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// putChunks splits r into parts of at most size bytes and stores them in order,
+// each with metadata and the key of the backup it belongs to.
+func (a *App) putChunks(ctx context.Context, key string, r io.Reader, size int64, metadata map[string]string) ([]string, error) {
+	br := bufio.NewReader(r)
+	var keys []string
+	for i := 0; ; i++ {
+		if _, err := br.Peek(1); err == io.EOF {
+			return keys, nil
+		} else if err != nil {
+			return keys, err
+		}
+		chunkKey := storage.ChunkKey(key, i)
+		partMetadata := maps.Clone(metadata)
+		partMetadata["dbu-chunk-of"] = key
+		if err := a.Storage.Put(ctx, chunkKey, io.LimitReader(br, size), -1, partMetadata); err != nil {
+			return keys, err
+		}
+		keys = append(keys, chunkKey)
+	}
+}
+
+// discardUpload removes what a failed backup left in storage: the object, or the
+// parts written so far and the one being written when it failed. Without a
+// manifest these would otherwise show up in listings as backups.
+func (a *App) discardUpload(ctx context.Context, key string, chunks []string) {
+	parts := []string{key}
+	if a.Cfg.Backup.ChunkSize > 0 {
+		parts = append(chunks, storage.ChunkKey(key, len(chunks)))
+	}
+	a.deleteParts(ctx, parts)
+}
+
+func (a *App) statChunks(ctx context.Context, keys []string) (int64, error) {
+	var total int64
+	for _, k := range keys {
+		stat, err := a.Storage.Stat(ctx, k)
+		if err != nil {
+			return 0, err
+		}
+		total += stat.Size
+	}
+	return total, nil
+}
+
+// chunkReader concatenates stored parts, opening each one only when the previous is exhausted.
+type chunkReader struct {
+	ctx     context.Context
+	store   storage.Storage
+	keys    []string
+	current io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.keys) == 0 {
+				return 0, io.EOF
+			}
+			rc, err := c.store.Get(c.ctx, c.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			c.current = rc
+			c.keys = c.keys[1:]
+		}
+		n, err := c.current.Read(p)
+		if err == io.EOF {
+			_ = c.current.Close()
+			c.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.current == nil {
+		return nil
+	}
+	return c.current.Close()
+}
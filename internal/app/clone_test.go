@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/db"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// waitedSource records whether the dump stream was waited for.
+type waitedSource struct {
+	*memAdapter
+	waited bool
+}
+
+func (w *waitedSource) Dump(ctx context.Context, cfg config.DatabaseConfig, backup config.BackupConfig) (*db.DumpStream, error) {
+	stream, err := w.memAdapter.Dump(ctx, cfg, backup)
+	if err != nil {
+		return nil, err
+	}
+	wait := stream.Wait
+	stream.Wait = func() error {
+		w.waited = true
+		return wait()
+	}
+	return stream, nil
+}
+
+// exitedTarget is a restore tool that exits on bad input: writes to it fail with a
+// broken pipe, and its exit status carries the reason.
+type exitedTarget struct {
+	*memAdapter
+	waited bool
+}
+
+func (e *exitedTarget) Restore(context.Context, config.DatabaseConfig, config.RestoreConfig, storage.Manifest) (*db.RestoreStream, error) {
+	return &db.RestoreStream{Writer: nopWriteCloser{failingWriter{syscall.EPIPE}}, Wait: func() error {
+		e.waited = true
+		return errors.New(`psql: ERROR: permission denied for schema public`)
+	}}, nil
+}
+
+func TestCloneReportsTargetFailure(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "mem", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full"}
+	mem := &memAdapter{dbs: map[string]map[string]string{"appdb": {"users": "alice,bob"}}}
+	source := &waitedSource{memAdapter: mem}
+	target := &exitedTarget{memAdapter: mem}
+	a := New(cfg, source, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+
+	targetCfg := *cfg
+	targetCfg.Database.Database = "copy"
+	err := a.Clone(context.Background(), &targetCfg, target)
+	if err == nil || !strings.Contains(err.Error(), "target: psql: ERROR: permission denied") {
+		t.Fatalf("expected the target tool's error, got %v", err)
+	}
+	if !source.waited || !target.waited {
+		t.Fatalf("expected both tools to be waited for (source %v, target %v)", source.waited, target.waited)
+	}
+}
+
+// mydumperSource dumps as mydumper does: a tar of the files the tool wrote.
+type mydumperSource struct{ *memAdapter }
+
+func (m mydumperSource) Dump(ctx context.Context, cfg config.DatabaseConfig, backup config.BackupConfig) (*db.DumpStream, error) {
+	stream, err := m.memAdapter.Dump(ctx, cfg, backup)
+	if err != nil {
+		return nil, err
+	}
+	stream.Container, stream.Tool = db.ContainerTar, db.ToolMydumper
+	return stream, nil
+}
+
+// manifestTarget records the manifest a restore was started with.
+type manifestTarget struct {
+	*memAdapter
+	manifest storage.Manifest
+}
+
+func (m *manifestTarget) Restore(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig, manifest storage.Manifest) (*db.RestoreStream, error) {
+	m.manifest = manifest
+	return m.memAdapter.Restore(ctx, cfg, restore, manifest)
+}
+
+func TestCloneLoadsWithTheDumpTool(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "mem", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full"}
+	mem := &memAdapter{dbs: map[string]map[string]string{"appdb": {"users": "alice,bob"}}}
+	target := &manifestTarget{memAdapter: mem}
+	a := New(cfg, mydumperSource{mem}, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+
+	targetCfg := *cfg
+	targetCfg.Database.Database = "copy"
+	if err := a.Clone(context.Background(), &targetCfg, target); err != nil {
+		t.Fatal(err)
+	}
+	if target.manifest.DumpTool != db.ToolMydumper || target.manifest.Container != db.ContainerTar {
+		t.Fatalf("expected the target to load a mydumper tar, got tool %q, container %q", target.manifest.DumpTool, target.manifest.Container)
+	}
+}
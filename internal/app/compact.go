@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+// compaction points a backup at a scratch database holding a restored chain.
+type compaction struct {
+	scratch config.DatabaseConfig
+	from    string // the differential the scratch copy was restored from
+}
+
+// CompactResult is the new full backup and the chain members pruned after it.
+type CompactResult struct {
+	BackupResult
+	Pruned []string
+}
+
+// CompactOptions tune Compact.
+type CompactOptions struct {
+	// Scratch is the database the chain is restored into; it must not be the
+	// configured database.
+	Scratch string
+	// DropExisting replaces a scratch database that already exists, which is
+	// otherwise refused.
+	DropExisting bool
+	// Prune deletes the differential once compacted, and its base once no other
+	// differential needs it.
+	Prune bool
+}
+
+// Compact rebuilds a differential and its base as one new full backup, so restoring
+// it takes a single pass. The chain is restored into a newly created scratch
+// database, and the scratch copy is dumped under this database's prefix.
+func (a *App) Compact(ctx context.Context, key string, opts CompactOptions) (*CompactResult, error) {
+	start := time.Now()
+	var opErr error
+	defer func() { a.finish("compact", start, key, opErr) }()
+	defer func() { a.recordStatus("compact", key, 0, opErr) }()
+
+	if opts.Scratch == "" || opts.Scratch == a.Cfg.Database.Database {
+		opErr = fmt.Errorf("compaction needs a scratch database other than %s", a.Cfg.Database.Database)
+		return nil, opErr
+	}
+	manifest, err := a.readManifest(ctx, key)
+	if err != nil {
+		opErr = fmt.Errorf("read manifest %s: %w", key, err)
+		return nil, opErr
+	}
+	if manifest.BaseKey == "" {
+		opErr = fmt.Errorf("%s is not a differential backup; only differential chains can be compacted", key)
+		return nil, opErr
+	}
+
+	scratchCfg := *a.Cfg
+	scratchCfg.Database.Database = opts.Scratch
+	scratchCfg.Restore = config.RestoreConfig{CreateDatabase: true, DropExisting: opts.DropExisting}
+	if err := a.restoreScratch(ctx, &scratchCfg, key, manifest); err != nil {
+		opErr = err
+		return nil, err
+	}
+
+	// The rebuilt full must be able to serve as the base of later differentials, and
+	// must never replace the base it was built from.
+	op := a.withBackupOverrides()
+	op.Cfg.Backup.Type = "full"
+	op.Cfg.Backup.TableChecksums = true
+	op.Cfg.Backup.Idempotent = true
+	// The rebuilt full stands in for the differential, so it keeps its labels.
+	labels := maps.Clone(manifest.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	maps.Copy(labels, a.Cfg.Backup.Labels)
+	op.Cfg.Backup.Labels = labels
+	op.Storage = a.cachedStorage()
+	op.Notifier = nil
+	op.compacting = &compaction{scratch: scratchCfg.Database, from: key}
+	res, err := op.backup(ctx)
+	if err != nil {
+		opErr = fmt.Errorf("back up compacted copy: %w", err)
+		return nil, opErr
+	}
+	result := &CompactResult{BackupResult: *res}
+	if opts.Prune {
+		result.Pruned, opErr = a.pruneChain(ctx, key, manifest.BaseKey)
+	}
+	return result, opErr
+}
+
+// restoreScratch creates the scratch database, once the base decodes, and restores
+// the differential into it.
+func (a *App) restoreScratch(ctx context.Context, cfg *config.Config, key string, manifest storage.Manifest) error {
+	guard, err := a.acquireLock(cfg)
+	if err != nil {
+		return err
+	}
+	defer guard.Release()
+
+	if err := validateTarget(ctx, a.Adapter, cfg.Database, cfg.Restore); err != nil {
+		return connectivityError(err)
+	}
+	scratch := *a
+	scratch.Cfg = cfg
+	begin := sync.OnceValue(func() error {
+		if err := a.createTarget(ctx, a.Adapter, cfg.Database, cfg.Restore); err != nil {
+			return fmt.Errorf("scratch database: %w", err)
+		}
+		return nil
+	})
+	a.Log.Info().Str("key", key).Str("scratch", cfg.Database.Database).Msg("restoring chain into scratch database")
+	if err := scratch.restoreDifferential(ctx, key, manifest, begin); err != nil {
+		return fmt.Errorf("restore into scratch database: %w", err)
+	}
+	return nil
+}
+
+// pruneChain deletes the compacted differential, then its base unless another
+// differential still applies on top of it. Held backups are left alone.
+func (a *App) pruneChain(ctx context.Context, key, baseKey string) ([]string, error) {
+	prefix := util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database)
+	objects, err := a.Storage.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	backups := groupBackups(objects)
+	var diff, base *backupObject
+	var others []backupObject
+	for i := range backups {
+		switch backups[i].Key {
+		case key:
+			diff = &backups[i]
+		case baseKey:
+			base = &backups[i]
+		default:
+			others = append(others, backups[i])
+		}
+	}
+	now := time.Now()
+	if diff != nil && a.held(ctx, key, now) {
+		// A held differential still needs its base, so neither is pruned.
+		a.Log.Info().Str("key", key).Msg("keeping differential; it is held")
+		return nil, nil
+	}
+	if base != nil && a.held(ctx, baseKey, now) {
+		a.Log.Info().Str("base", baseKey).Msg("keeping base; it is held")
+		base = nil
+	}
+	var pruned []string
+	if diff != nil {
+		if _, err := a.deleteBackup(ctx, *diff); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, key)
+	}
+	if base == nil {
+		return pruned, nil
+	}
+	if a.referencedBases(ctx, others)[baseKey] {
+		a.Log.Info().Str("base", baseKey).Msg("keeping base; other differentials depend on it")
+		return pruned, nil
+	}
+	if _, err := a.deleteBackup(ctx, *base); err != nil {
+		return pruned, err
+	}
+	return append(pruned, baseKey), nil
+}
@@ -0,0 +1,192 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/db"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// memAdapter keeps databases as table contents in memory; a dump is the selected
+// tables as JSON.
+type memAdapter struct {
+	mu  sync.Mutex
+	dbs map[string]map[string]string
+}
+
+func (m *memAdapter) Name() string { return "mem" }
+func (m *memAdapter) Validate(context.Context, config.DatabaseConfig) error {
+	return nil
+}
+func (m *memAdapter) PreflightRestore(context.Context, config.DatabaseConfig, config.RestoreConfig) error {
+	return nil
+}
+func (m *memAdapter) Capabilities() db.Capabilities {
+	return db.Capabilities{Differential: true, TableRestore: true}
+}
+
+func (m *memAdapter) Dump(_ context.Context, cfg config.DatabaseConfig, backup config.BackupConfig) (*db.DumpStream, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tables := map[string]string{}
+	for name, rows := range m.dbs[cfg.Database] {
+		if len(backup.Tables) == 0 || contains(backup.Tables, name) {
+			tables[name] = rows
+		}
+	}
+	data, err := json.Marshal(tables)
+	if err != nil {
+		return nil, err
+	}
+	return &db.DumpStream{Reader: io.NopCloser(bytes.NewReader(data)), Wait: func() error { return nil }}, nil
+}
+
+func (m *memAdapter) Restore(_ context.Context, cfg config.DatabaseConfig, _ config.RestoreConfig, _ storage.Manifest) (*db.RestoreStream, error) {
+	var buf bytes.Buffer
+	return &db.RestoreStream{Writer: nopWriteCloser{&buf}, Wait: func() error {
+		var tables map[string]string
+		if err := json.Unmarshal(buf.Bytes(), &tables); err != nil {
+			return err
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.dbs[cfg.Database] == nil {
+			m.dbs[cfg.Database] = map[string]string{}
+		}
+		for name, rows := range tables {
+			m.dbs[cfg.Database][name] = rows
+		}
+		return nil
+	}}, nil
+}
+
+func (m *memAdapter) MaintenanceDatabase(cfg config.DatabaseConfig) config.DatabaseConfig {
+	cfg.Database = "postgres"
+	return cfg
+}
+
+func (m *memAdapter) CreateDatabase(_ context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.dbs[cfg.Database]; ok && !restore.DropExisting {
+		return errors.New("database " + cfg.Database + " already exists; pass --drop-existing to recreate it")
+	}
+	m.dbs[cfg.Database] = map[string]string{}
+	return nil
+}
+
+func (m *memAdapter) TableChecksums(_ context.Context, cfg config.DatabaseConfig, _ []string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sums := map[string]string{}
+	for name, rows := range m.dbs[cfg.Database] {
+		sum := sha256.Sum256([]byte(rows))
+		sums[name] = hex.EncodeToString(sum[:])
+	}
+	return sums, nil
+}
+
+func (m *memAdapter) CountObjects(_ context.Context, cfg config.DatabaseConfig) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.dbs[cfg.Database]), nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCompactDifferential(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "mem", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", TableChecksums: true}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	adapter := &memAdapter{dbs: map[string]map[string]string{
+		"appdb": {"users": "alice", "orders": "1,2"},
+	}}
+	a := New(cfg, adapter, store, zerolog.Nop(), nil)
+
+	full, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter.dbs["appdb"]["orders"] = "1,2,3"
+	cfg.Backup.Type = "differential"
+	diff, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Manifest.BaseKey != full.Key {
+		t.Fatalf("differential base = %q, want %q", diff.Manifest.BaseKey, full.Key)
+	}
+
+	if _, err := a.Compact(ctx, full.Key, CompactOptions{Scratch: "scratch"}); err == nil {
+		t.Fatal("expected compacting a full backup to fail")
+	}
+	if _, err := a.Compact(ctx, diff.Key, CompactOptions{Scratch: "appdb"}); err == nil {
+		t.Fatal("expected the live database to be refused as scratch")
+	}
+
+	// Keys have one-second resolution; keep the compacted full's apart from the base's.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	adapter.dbs["scratch"] = map[string]string{"users": "someone else's"}
+	if _, err := a.Compact(ctx, diff.Key, CompactOptions{Scratch: "scratch", Prune: true}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected an existing scratch database to be refused, got %v", err)
+	}
+	if adapter.dbs["scratch"]["users"] != "someone else's" {
+		t.Fatalf("existing scratch database was replaced: %v", adapter.dbs["scratch"])
+	}
+	res, err := a.Compact(ctx, diff.Key, CompactOptions{Scratch: "scratch", DropExisting: true, Prune: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := res.Manifest
+	if m.BackupType != "full" || m.BaseKey != "" || m.CompactedFrom != diff.Key || m.Database != "appdb" || len(m.TableChecksums) != 2 {
+		t.Fatalf("unexpected compacted manifest %+v", m)
+	}
+	if want := []string{diff.Key, full.Key}; !reflect.DeepEqual(res.Pruned, want) {
+		t.Fatalf("pruned %v, want %v", res.Pruned, want)
+	}
+	keys, err := a.BackupKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{res.Key}) {
+		t.Fatalf("remaining backups %v, want only %s", keys, res.Key)
+	}
+
+	cfg.Database.Database = "restored"
+	if err := a.Restore(ctx, res.Key); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"users": "alice", "orders": "1,2,3"}; !reflect.DeepEqual(adapter.dbs["restored"], want) {
+		t.Fatalf("restored %v, want %v", adapter.dbs["restored"], want)
+	}
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rowjay/db-backup-utility/internal/db"
+)
+
+// Contents is a backup's inventory as read from the dump itself.
+type Contents struct {
+	Objects []db.DumpObject
+	// Missing names the tables and collections the manifest records that the dump
+	// does not contain.
+	Missing []string
+}
+
+// ListContents reads the backup stored at key through the same decrypt and
+// decompress pipeline as a restore and lists what the dump holds, without
+// touching the database.
+func (a *App) ListContents(ctx context.Context, key string) (Contents, error) {
+	lister, ok := a.Adapter.(db.ContentLister)
+	if !ok {
+		return Contents{}, fmt.Errorf("listing backup contents is not supported for %s", a.Adapter.Name())
+	}
+	manifest, manifestErr := a.readManifest(ctx, key)
+	reader, err := a.openBackup(ctx, key, manifest, manifestErr)
+	if err != nil {
+		return Contents{}, err
+	}
+	defer reader.Close()
+	objects, err := lister.ListContents(ctx, reader)
+	if err != nil {
+		return Contents{}, fmt.Errorf("list contents of %s: %w", key, err)
+	}
+	contents := Contents{Objects: objects}
+	for _, table := range manifest.Tables {
+		if !db.FindTable(objects, table) {
+			contents.Missing = append(contents.Missing, table)
+		}
+	}
+	for _, collection := range manifest.Collections {
+		if !findCollection(objects, collection) {
+			contents.Missing = append(contents.Missing, collection)
+		}
+	}
+	if len(contents.Missing) > 0 {
+		a.Log.Warn().Str("key", key).Strs("missing", contents.Missing).Msg("backup is missing objects its manifest records")
+	}
+	return contents, nil
+}
+
+// findCollection reports whether the collection, optionally database-qualified,
+// is present in objects.
+func findCollection(objects []db.DumpObject, collection string) bool {
+	for _, obj := range objects {
+		if obj.Kind == "COLLECTION" && (obj.Name == collection || obj.Schema+"."+obj.Name == collection) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/db"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// lineLister lists one table per line of the dump.
+type lineLister struct {
+	stubAdapter
+}
+
+func (l *lineLister) ListContents(ctx context.Context, r io.Reader) ([]db.DumpObject, error) {
+	data, err := io.ReadAll(r)
+	var objects []db.DumpObject
+	for _, line := range strings.Fields(string(data)) {
+		objects = append(objects, db.DumpObject{Kind: "TABLE", Name: line, Size: int64(len(line))})
+	}
+	return objects, err
+}
+
+func TestListContents(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "mysql", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "zstd", Tables: []string{"users", "orders"}}
+	adapter := &lineLister{stubAdapter{data: []byte("users\n")}}
+	a := New(cfg, adapter, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := a.ListContents(ctx, res.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents.Objects) != 1 || contents.Objects[0].Name != "users" || contents.Objects[0].Size != 5 {
+		t.Fatalf("unexpected objects %+v", contents.Objects)
+	}
+	if len(contents.Missing) != 1 || contents.Missing[0] != "orders" {
+		t.Fatalf("expected orders to be reported missing, got %v", contents.Missing)
+	}
+
+	a.Adapter = &adapter.stubAdapter
+	if _, err := a.ListContents(ctx, res.Key); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("expected an unsupported error, got %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rowjay/db-backup-utility/internal/compress"
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+// Format is how a stored backup is encoded.
+type Format struct {
+	Compression string
+	Encrypted   bool
+}
+
+func (f Format) String() string {
+	if f.Encrypted {
+		return f.Compression + ", encrypted"
+	}
+	return f.Compression
+}
+
+// ConvertOptions says what a backup is converted to. An empty Compression keeps
+// the backup's own.
+type ConvertOptions struct {
+	Compression string
+	Decrypt     bool
+	// KeepOriginal leaves the source backup in place beside the converted one.
+	KeepOriginal bool
+}
+
+// DetectFormat reports how the backup at key is encoded, as its object and stream
+// headers show; the manifest or key only fills in what the headers cannot.
+func (a *App) DetectFormat(ctx context.Context, key string) (Format, error) {
+	manifest, manifestErr := a.readManifest(ctx, key)
+	if len(manifest.DedupChunks) > 0 {
+		return Format{}, fmt.Errorf("backup %s is deduplicated; its chunks are encoded one by one", key)
+	}
+	reader, err := a.openBackup(ctx, key, manifest, manifestErr)
+	if err != nil {
+		return Format{}, err
+	}
+	defer reader.Close()
+	decoded, ok := reader.(readCloser)
+	if !ok {
+		return Format{}, fmt.Errorf("cannot tell how backup %s is encoded", key)
+	}
+	return decoded.format, nil
+}
+
+// Convert re-encodes the backup at key with another compression, or without its
+// encryption, and returns the manifest of the result. The backup is streamed from
+// storage through the restore pipeline and back through the backup pipeline under
+// a key with the new extension; no database is involved. The result is read back
+// and compared with the original plaintext before the original is deleted, which
+// is refused while the original is held or is the base of a differential.
+func (a *App) Convert(ctx context.Context, key string, opts ConvertOptions) (storage.Manifest, error) {
+	start := time.Now()
+	var opErr error
+	defer func() { a.finish("convert", start, key, opErr) }()
+
+	guard, err := a.acquireLock(a.Cfg)
+	if err != nil {
+		opErr = err
+		return storage.Manifest{}, err
+	}
+	defer guard.Release()
+
+	if opts.Compression != "" && !slices.Contains(compress.Types, opts.Compression) {
+		opErr = fmt.Errorf("unsupported compression %q (want one of %s)", opts.Compression, strings.Join(compress.Types, ", "))
+		return storage.Manifest{}, opErr
+	}
+	manifest, manifestErr, err := a.rewriteManifest(ctx, key)
+	if err != nil {
+		opErr = err
+		return storage.Manifest{}, err
+	}
+	if len(manifest.DedupChunks) > 0 {
+		// Its chunks are shared with other backups and encoded one by one.
+		opErr = fmt.Errorf("backup %s is deduplicated; converting deduplicated backups is not supported", key)
+		return storage.Manifest{}, opErr
+	}
+
+	source, err := a.openBackup(ctx, key, manifest, manifestErr)
+	if err != nil {
+		opErr = err
+		return storage.Manifest{}, err
+	}
+	defer source.Close()
+	decoded, ok := source.(readCloser)
+	if !ok {
+		opErr = fmt.Errorf("cannot tell how backup %s is encoded", key)
+		return storage.Manifest{}, opErr
+	}
+	from := decoded.format
+	to := Format{Compression: opts.Compression, Encrypted: from.Encrypted && !opts.Decrypt}
+	if to.Compression == "" {
+		to.Compression = from.Compression
+	}
+	if to == from {
+		opErr = fmt.Errorf("backup %s is already %s", key, from)
+		return storage.Manifest{}, opErr
+	}
+	dstKey, ok := convertedKey(key, to)
+	if !ok {
+		opErr = fmt.Errorf("cannot name the converted backup: %s has no backup extension", key)
+		return storage.Manifest{}, opErr
+	}
+	if exists, err := a.Storage.Exists(ctx, dstKey); err != nil || exists {
+		if err == nil {
+			err = fmt.Errorf("%s already exists", dstKey)
+		}
+		opErr = err
+		return storage.Manifest{}, err
+	}
+	if !opts.KeepOriginal {
+		if err := a.checkReplaceable(ctx, key); err != nil {
+			opErr = err
+			return storage.Manifest{}, err
+		}
+	}
+
+	// An encrypted result keeps the data key, bound to where it ends up.
+	var streamKey, keyBytes []byte
+	var binding *storage.EncryptionBinding
+	if to.Encrypted {
+		if keyBytes, err = a.storedDataKey(manifest, manifestErr); err != nil {
+			opErr = err
+			return storage.Manifest{}, err
+		}
+		if b, ok := storage.BindingFor(dstKey); ok {
+			binding = &b
+		}
+		if streamKey, err = bindKey(keyBytes, binding); err != nil {
+			opErr = err
+			return storage.Manifest{}, err
+		}
+	}
+
+	parts, storedSum, plainSum, plainBytes, err := a.writeConverted(ctx, source, dstKey, to, streamKey, a.backupMetadata(manifest.Labels))
+	if err != nil {
+		a.deleteParts(ctx, parts)
+		opErr = fmt.Errorf("convert %s: %w", key, err)
+		return storage.Manifest{}, opErr
+	}
+	size, err := a.statChunks(ctx, parts)
+	if err != nil {
+		a.deleteParts(ctx, parts)
+		opErr = err
+		return storage.Manifest{}, err
+	}
+
+	converted := manifest
+	converted.Key = dstKey
+	converted.Compression = to.Compression
+	converted.CompressionDict = 0
+	converted.Encryption = to.Encrypted
+	recordCodecs(&converted)
+	converted.EncryptionBinding = binding
+	converted.SizeBytes = size
+	converted.SHA256 = hex.EncodeToString(storedSum)
+	converted.UncompressedBytes = plainBytes
+	converted.Chunks = nil
+	if a.Cfg.Backup.ChunkSize > 0 {
+		converted.Chunks = parts
+	}
+	converted.ConvertedFrom = key
+	if to.Encrypted {
+		converted.KeyFingerprint = cryptoutil.Fingerprint(keyBytes)
+	} else {
+		converted.KeyFingerprint, converted.KeyDerivation = "", nil
+	}
+	if converted.ID == "" || opts.KeepOriginal {
+		// Both backups stay, so each needs its own ID.
+		converted.ID = fmt.Sprintf("%s-%d", a.Cfg.Database.Database, time.Now().UnixNano())
+	}
+
+	if err := a.verifyConverted(ctx, converted, plainSum); err != nil {
+		a.deleteParts(ctx, parts)
+		opErr = err
+		return storage.Manifest{}, err
+	}
+	if err := a.writeManifest(ctx, converted); err != nil {
+		a.deleteParts(ctx, parts)
+		opErr = fmt.Errorf("write manifest: %w", err)
+		return storage.Manifest{}, opErr
+	}
+	a.Log.Info().Str("key", key).Str("from", from.String()).Str("to", to.String()).Str("converted", dstKey).Msg("backup converted")
+
+	if !opts.KeepOriginal {
+		srcParts := []string{key}
+		if len(manifest.Chunks) > 0 {
+			srcParts = manifest.Chunks
+		}
+		if _, err := a.deleteBackup(ctx, backupObject{ObjectInfo: storage.ObjectInfo{Key: key}, Parts: srcParts}); err != nil {
+			opErr = fmt.Errorf("converted to %s, but the original was not deleted: %w", dstKey, err)
+			return converted, opErr
+		}
+	}
+	return converted, nil
+}
+
+// convertedKey returns key with its extension replaced by the one of format.
+func convertedKey(key string, format Format) (string, bool) {
+	if _, _, ok := parseExtension(key); !ok {
+		return "", false
+	}
+	i := strings.LastIndex(key, ".backup")
+	return key[:i] + "." + buildExtension(format.Compression, format.Encrypted), true
+}
+
+// checkReplaceable refuses to delete a backup that must stay: it is held, or a
+// differential is built on it and would lose its base.
+func (a *App) checkReplaceable(ctx context.Context, key string) error {
+	if a.held(ctx, key, time.Now()) {
+		return fmt.Errorf("backup %s is held and cannot be replaced; convert it with --keep-original", key)
+	}
+	objects, err := a.Storage.List(ctx, util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database))
+	if err != nil {
+		return err
+	}
+	if a.referencedBases(ctx, groupBackups(objects))[key] {
+		return fmt.Errorf("backup %s is the base of a differential and cannot be replaced; convert it with --keep-original", key)
+	}
+	return nil
+}
+
+// writeConverted encodes plain as format into dstKey, chunked as configured. It
+// returns the stored parts, digests of the stored and plain bytes, and the number
+// of plain bytes. streamKey is the encryption key when format is encrypted.
+func (a *App) writeConverted(ctx context.Context, plain io.Reader, dstKey string, format Format, streamKey []byte, metadata map[string]string) ([]string, []byte, []byte, int64, error) {
+	pipeReader, pipeWriter := io.Pipe()
+	eg, egCtx := errgroup.WithContext(ctx)
+	parts := []string{dstKey}
+	eg.Go(func() error {
+		defer pipeReader.Close()
+		if a.Cfg.Backup.ChunkSize > 0 {
+			var err error
+			parts, err = a.putChunks(egCtx, dstKey, pipeReader, a.Cfg.Backup.ChunkSize, metadata)
+			return err
+		}
+		return a.Storage.Put(egCtx, dstKey, pipeReader, -1, metadata)
+	})
+
+	storedHash, plainHash := sha256.New(), sha256.New()
+	var plainBytes int64
+	eg.Go(func() error {
+		err := func() error {
+			writer := io.MultiWriter(pipeWriter, storedHash)
+			var closers []io.Closer
+			if format.Encrypted {
+				encWriter, err := cryptoutil.EncryptWriter(writer, streamKey)
+				if err != nil {
+					return err
+				}
+				writer = encWriter
+				closers = append(closers, encWriter)
+			}
+			compWriter, err := compress.WrapWriter(format.Compression, writer)
+			if err != nil {
+				return err
+			}
+			closers = append(closers, compWriter)
+			if plainBytes, err = io.Copy(compWriter, io.TeeReader(plain, plainHash)); err != nil {
+				return err
+			}
+			for i := len(closers) - 1; i >= 0; i-- {
+				if err := closers[i].Close(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}()
+		if err != nil {
+			_ = pipeWriter.CloseWithError(err)
+			return err
+		}
+		return pipeWriter.Close()
+	})
+	if err := eg.Wait(); err != nil {
+		return parts, nil, nil, 0, err
+	}
+	return parts, storedHash.Sum(nil), plainHash.Sum(nil), plainBytes, nil
+}
+
+// verifyConverted reads the converted backup back as a restore would and compares
+// its plaintext digest with the original's.
+func (a *App) verifyConverted(ctx context.Context, manifest storage.Manifest, want []byte) error {
+	reader, err := a.openBackup(ctx, manifest.Key, manifest, nil)
+	if err != nil {
+		return fmt.Errorf("verify converted backup: %w", err)
+	}
+	defer reader.Close()
+	digest := sha256.New()
+	if _, err := io.Copy(digest, reader); err != nil {
+		return fmt.Errorf("verify converted backup: %w", err)
+	}
+	if !bytes.Equal(digest.Sum(nil), want) {
+		return fmt.Errorf("verify converted backup: plaintext digest mismatch")
+	}
+	return nil
+}
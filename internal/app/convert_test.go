@@ -0,0 +1,138 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestConvert(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", Encryption: true, EncryptionKey: "hex:" + strings.Repeat("ab", 32)}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	dump := tenantDump(1)
+	a := New(cfg, &stubAdapter{data: dump}, store, zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if format, err := a.DetectFormat(ctx, res.Key); err != nil || format != (Format{Compression: "gzip", Encrypted: true}) {
+		t.Fatalf("detected %v, %v; want gzip, encrypted", format, err)
+	}
+	restored := func(key string) []byte {
+		t.Helper()
+		manifest, err := a.readManifest(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := a.openBackup(ctx, key, manifest, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if _, err := a.Convert(ctx, res.Key, ConvertOptions{Compression: "gzip"}); err == nil || !strings.Contains(err.Error(), "already gzip, encrypted") {
+		t.Fatalf("expected converting to the same format to fail, got %v", err)
+	}
+
+	zst, err := a.Convert(ctx, res.Key, ConvertOptions{Compression: "zstd"})
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	if want := strings.TrimSuffix(res.Key, ".backup.gz.enc") + ".backup.zst.enc"; zst.Key != want {
+		t.Fatalf("converted key %s, want %s", zst.Key, want)
+	}
+	if zst.Compression != "zstd" || !zst.Encryption || zst.ConvertedFrom != res.Key || zst.ID != res.Manifest.ID {
+		t.Fatalf("unexpected manifest %+v", zst)
+	}
+	if exists, _ := store.Exists(ctx, res.Key); exists {
+		t.Fatal("expected the original to be deleted")
+	}
+	if got := restored(zst.Key); !bytes.Equal(got, dump) {
+		t.Fatal("converted backup does not restore the dump")
+	}
+
+	plain, err := a.Convert(ctx, zst.Key, ConvertOptions{Decrypt: true, KeepOriginal: true})
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if !strings.HasSuffix(plain.Key, ".backup.zst") || plain.Encryption || plain.KeyFingerprint != "" || plain.ID == zst.ID {
+		t.Fatalf("unexpected manifest %+v", plain)
+	}
+	if exists, _ := store.Exists(ctx, zst.Key); !exists {
+		t.Fatal("expected --keep-original to keep the original")
+	}
+	if format, err := a.DetectFormat(ctx, plain.Key); err != nil || format != (Format{Compression: "zstd"}) {
+		t.Fatalf("detected %v, %v; want zstd", format, err)
+	}
+	if got := restored(plain.Key); !bytes.Equal(got, dump) {
+		t.Fatal("decrypted backup does not restore the dump")
+	}
+}
+
+func TestConvertKeepsHeldBackups(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", LegalHold: true}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	a := New(cfg, &stubAdapter{data: tenantDump(1)}, store, zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if _, err := a.Convert(ctx, res.Key, ConvertOptions{Compression: "zstd"}); err == nil || !strings.Contains(err.Error(), "held") {
+		t.Fatalf("expected a held backup to be refused, got %v", err)
+	}
+	if exists, _ := store.Exists(ctx, strings.TrimSuffix(res.Key, ".gz")+".zst"); exists {
+		t.Fatal("expected nothing to be written")
+	}
+	converted, err := a.Convert(ctx, res.Key, ConvertOptions{Compression: "zstd", KeepOriginal: true})
+	if err != nil {
+		t.Fatalf("convert with keep original: %v", err)
+	}
+	if !converted.LegalHold {
+		t.Fatal("expected the converted backup to stay held")
+	}
+}
+
+func TestConvertedKey(t *testing.T) {
+	cases := []struct {
+		key    string
+		format Format
+		want   string
+	}{
+		{"pg/appdb/appdb_full.20240101T000000Z.backup.gz.enc", Format{Compression: "zstd", Encrypted: true}, "pg/appdb/appdb_full.20240101T000000Z.backup.zst.enc"},
+		{"pg/appdb/appdb_full.20240101T000000Z.backup.br.enc", Format{Compression: "br"}, "pg/appdb/appdb_full.20240101T000000Z.backup.br"},
+		{"pg/appdb/appdb_full.20240101T000000Z.backup", Format{Compression: "gzip"}, "pg/appdb/appdb_full.20240101T000000Z.backup.gz"},
+		{"pg/appdb/export.sql", Format{Compression: "gzip"}, ""},
+	}
+	for _, tc := range cases {
+		got, _ := convertedKey(tc.key, tc.format)
+		if got != tc.want {
+			t.Errorf("convertedKey(%s) = %q, want %q", tc.key, got, tc.want)
+		}
+	}
+}
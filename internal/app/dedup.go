@@ -0,0 +1,400 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/compress"
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+// dedupDir holds the chunks of deduplicated backups, under the storage prefix.
+const dedupDir = "_dedup-chunks"
+
+// defaultDedupChunkSize is the dump bytes per chunk when dedup_chunk_size is unset.
+const defaultDedupChunkSize = 16 << 20
+
+// maxDedupIndex bounds the index read back from a deduplicated backup's object.
+const maxDedupIndex = 64 << 20
+
+// dedupIndexMagic starts the object stored at a deduplicated backup's key, which
+// holds its chunk map rather than the dump.
+var dedupIndexMagic = []byte("DBUDEDUP1\n")
+
+// dedupIndex is the chunk map stored at a deduplicated backup's key, so the
+// backup can be restored without its manifest.
+type dedupIndex struct {
+	Compression     string `json:"compression"`
+	CompressionDict uint32 `json:"compression_dict,omitempty"`
+	Encryption      bool   `json:"encryption"`
+	// KeyDerivation is how the chunks' data key was derived, as in the manifest.
+	KeyDerivation *storage.KeyDerivation `json:"key_derivation,omitempty"`
+	ChunkSize     int64                  `json:"chunk_size"`
+	Store         string                 `json:"store"` // chunk directory under the storage prefix
+	Chunks        []storage.DedupChunk   `json:"chunks"`
+}
+
+// dedupStore is where this database's chunks are stored, relative to the storage
+// prefix. It sits outside the database prefix so chunks never show up as backups.
+func (a *App) dedupStore() string {
+	return util.BuildPrefix(dedupDir, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database)
+}
+
+// dedupChunkKey names a stored chunk.
+func (a *App) dedupChunkKey(store, hash string) string {
+	return path.Join(a.Cfg.Storage.Prefix, store, hash)
+}
+
+// dedupSecret keys chunk hashes: with encryption, the data key, so names reveal
+// nothing about the data and chunks written under another key are never reused.
+func (a *App) dedupSecret(encrypted bool, derivation *storage.KeyDerivation) ([]byte, error) {
+	if !encrypted {
+		return nil, nil
+	}
+	return dataKey(a.Cfg.Backup.EncryptionKey, derivation)
+}
+
+// newDedupHash returns the hash naming chunks. The compression settings are part
+// of it, since a chunk is stored compressed.
+func newDedupHash(secret []byte, compression string, dictID uint32) hash.Hash {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s/%08x\x00", compression, dictID)
+	return mac
+}
+
+// dumpSize adds up the dump bytes of chunks.
+func dumpSize(chunks []storage.DedupChunk) int64 {
+	var n int64
+	for _, chunk := range chunks {
+		n += chunk.Size
+	}
+	return n
+}
+
+// dedupWriter cuts the dump into fixed-size chunks and stores each one not
+// already in storage, compressed and encrypted on its own. Close writes the
+// chunk map to index, which is what gets stored at the backup's key.
+type dedupWriter struct {
+	ctx    context.Context
+	a      *App
+	index  io.Writer
+	dict   []byte
+	secret []byte
+	meta   dedupIndex
+	buf    []byte
+
+	reused, reusedBytes int
+}
+
+func (a *App) newDedupWriter(ctx context.Context, index io.Writer, dictID uint32, dict []byte) (*dedupWriter, error) {
+	var derivation *storage.KeyDerivation
+	if a.Cfg.Backup.Encryption {
+		var err error
+		if derivation, err = a.keyDerivation(); err != nil {
+			return nil, stageError(ErrEncrypt, err)
+		}
+	}
+	secret, err := a.dedupSecret(a.Cfg.Backup.Encryption, derivation)
+	if err != nil {
+		return nil, stageError(ErrEncrypt, err)
+	}
+	size := a.Cfg.Backup.DedupChunkSize
+	if size <= 0 {
+		size = defaultDedupChunkSize
+	}
+	return &dedupWriter{
+		ctx:    ctx,
+		a:      a,
+		index:  index,
+		dict:   dict,
+		secret: secret,
+		meta:   dedupIndex{Compression: a.Cfg.Backup.Compression, CompressionDict: dictID, Encryption: a.Cfg.Backup.Encryption, KeyDerivation: derivation, ChunkSize: size, Store: a.dedupStore()},
+		buf:    make([]byte, 0, size),
+	}, nil
+}
+
+func (w *dedupWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flush stores the buffered chunk unless a chunk with the same hash exists.
+func (w *dedupWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	mac := newDedupHash(w.secret, w.meta.Compression, w.meta.CompressionDict)
+	mac.Write(w.buf)
+	chunk := storage.DedupChunk{Hash: hex.EncodeToString(mac.Sum(nil)), Size: int64(len(w.buf))}
+	chunkKey := w.a.dedupChunkKey(w.meta.Store, chunk.Hash)
+	info, err := w.a.Storage.Stat(w.ctx, chunkKey)
+	switch {
+	case err == nil:
+		chunk.Stored = info.Size
+		w.reused++
+		w.reusedBytes += len(w.buf)
+	case storage.IsNotFound(err):
+		encoded, err := w.a.encodeChunk(w.buf, w.dict)
+		if err != nil {
+			return err
+		}
+		if err := w.a.Storage.Put(w.ctx, chunkKey, bytes.NewReader(encoded), int64(len(encoded)), map[string]string{"dbu-dedup-chunk": "true"}); err != nil {
+			return stageError(ErrUpload, err)
+		}
+		chunk.Stored = int64(len(encoded))
+	default:
+		return stageError(ErrUpload, err)
+	}
+	w.meta.Chunks = append(w.meta.Chunks, chunk)
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close stores the last chunk and writes the chunk map.
+func (w *dedupWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(w.meta)
+	if err != nil {
+		return err
+	}
+	if _, err := w.index.Write(append(append([]byte{}, dedupIndexMagic...), data...)); err != nil {
+		return err
+	}
+	w.a.Log.Info().Int("chunks", len(w.meta.Chunks)).Int("reused", w.reused).Int("reused_bytes", w.reusedBytes).Msg("deduplicated backup")
+	return nil
+}
+
+// encodeChunk compresses and encrypts one chunk the way backups are.
+func (a *App) encodeChunk(raw, dict []byte) ([]byte, error) {
+	var out bytes.Buffer
+	var writer io.Writer = &out
+	var closers []io.Closer
+	if a.Cfg.Backup.Encryption {
+		keyBytes, err := a.backupDataKey()
+		if err != nil {
+			return nil, stageError(ErrEncrypt, err)
+		}
+		encWriter, err := cryptoutil.EncryptWriter(writer, keyBytes)
+		if err != nil {
+			return nil, stageError(ErrEncrypt, err)
+		}
+		writer = encWriter
+		closers = append(closers, stageWriter{w: encWriter, stage: ErrEncrypt})
+	}
+	var compWriter io.WriteCloser
+	var err error
+	if dict != nil {
+		compWriter, err = compress.WrapWriterDict(a.Cfg.Backup.Compression, writer, dict)
+	} else {
+		compWriter, err = compress.WrapWriter(a.Cfg.Backup.Compression, writer)
+	}
+	if err != nil {
+		return nil, stageError(ErrCompress, err)
+	}
+	closers = append(closers, stageWriter{w: compWriter, stage: ErrCompress})
+	if _, err := compWriter.Write(raw); err != nil {
+		return nil, stageError(ErrCompress, err)
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			return nil, err
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// isDedupIndex reports whether the stored bytes in r are a deduplicated backup's
+// chunk map.
+func isDedupIndex(r *bufio.Reader) bool {
+	head, _ := r.Peek(len(dedupIndexMagic))
+	return bytes.Equal(head, dedupIndexMagic)
+}
+
+// openDedup reads the chunk map from stored and returns the backup's dump,
+// joined from its chunks. Closing the result closes reader, which stored reads.
+func (a *App) openDedup(ctx context.Context, key string, stored *bufio.Reader, reader io.ReadCloser, manifest storage.Manifest) (io.ReadCloser, error) {
+	index, err := parseDedupIndex(stored)
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("read chunk map of %s: %w", key, err)
+	}
+	secret, err := a.dedupSecret(index.Encryption, index.KeyDerivation)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	a.Log.Info().Str("key", key).Int("chunks", len(index.Chunks)).Str("compression", index.Compression).Bool("encrypted", index.Encryption).Msg("resolved deduplicated backup")
+	// Chunks decode like whole backups; their pipeline is only logged when it differs.
+	quiet := *a
+	quiet.Log = a.Log.Level(zerolog.WarnLevel)
+	return &dedupReader{ctx: ctx, a: &quiet, key: key, index: index, secret: secret, keyFingerprint: manifest.KeyFingerprint, closer: reader}, nil
+}
+
+// dedupReader joins the decoded chunks of a deduplicated backup, opening each one
+// only when the previous is exhausted and checking it against its hash.
+type dedupReader struct {
+	ctx            context.Context
+	a              *App
+	key            string
+	index          dedupIndex
+	secret         []byte
+	keyFingerprint string
+	closer         io.Closer
+
+	current io.ReadCloser
+	chunk   storage.DedupChunk
+	hash    hash.Hash
+	n       int64
+}
+
+func (r *dedupReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.index.Chunks) == 0 {
+				return 0, io.EOF
+			}
+			r.chunk = r.index.Chunks[0]
+			r.index.Chunks = r.index.Chunks[1:]
+			chunkKey := r.a.dedupChunkKey(r.index.Store, r.chunk.Hash)
+			stored, err := r.a.Storage.Get(r.ctx, chunkKey)
+			if err != nil {
+				return 0, fmt.Errorf("read chunk %s of %s: %w", r.chunk.Hash, r.key, err)
+			}
+			declared := storage.Manifest{Compression: r.index.Compression, CompressionDict: r.index.CompressionDict, Encryption: r.index.Encryption, KeyDerivation: r.index.KeyDerivation, KeyFingerprint: r.keyFingerprint}
+			if r.current, err = r.a.decodeStored(r.ctx, chunkKey, stored, declared, nil); err != nil {
+				return 0, fmt.Errorf("read chunk %s of %s: %w", r.chunk.Hash, r.key, err)
+			}
+			r.hash = newDedupHash(r.secret, r.index.Compression, r.index.CompressionDict)
+			r.n = 0
+		}
+		n, err := r.current.Read(p)
+		r.hash.Write(p[:n])
+		r.n += int64(n)
+		if err != io.EOF {
+			return n, err
+		}
+		_ = r.current.Close()
+		r.current = nil
+		if r.n != r.chunk.Size || hex.EncodeToString(r.hash.Sum(nil)) != r.chunk.Hash {
+			return n, fmt.Errorf("chunk %s of %s is corrupt: its contents do not match its hash", r.chunk.Hash, r.key)
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *dedupReader) Close() error {
+	if r.current != nil {
+		_ = r.current.Close()
+	}
+	return r.closer.Close()
+}
+
+// collectDedupChunks deletes the stored chunks that no remaining backup uses and
+// returns how many it deleted. A backup whose manifest cannot be read has its
+// chunk map read from its object instead; if that fails too, nothing is deleted.
+func (a *App) collectDedupChunks(ctx context.Context) (int, error) {
+	dir := path.Join(a.Cfg.Storage.Prefix, a.dedupStore())
+	chunks, err := a.Storage.List(ctx, dir)
+	if err != nil || len(chunks) == 0 {
+		return 0, err
+	}
+	records, err := a.ListManifests(ctx)
+	if err != nil {
+		return 0, err
+	}
+	used := map[string]bool{}
+	for _, rec := range records {
+		list := rec.Manifest.DedupChunks
+		if rec.Err != nil {
+			index, err := a.readDedupIndex(ctx, rec.Object.Key)
+			if err != nil {
+				return 0, fmt.Errorf("keeping all dedup chunks: %s: %w", rec.Object.Key, err)
+			}
+			list = index.Chunks
+		}
+		for _, chunk := range list {
+			used[chunk.Hash] = true
+		}
+	}
+	deleted := 0
+	for _, obj := range chunks {
+		// The listing also matches the chunks of databases whose name extends this one.
+		if path.Dir(obj.Key) != dir || used[path.Base(obj.Key)] {
+			continue
+		}
+		if err := a.Storage.Delete(ctx, obj.Key); err != nil {
+			return deleted, fmt.Errorf("delete %s: %w", obj.Key, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// checkDedupChunks confirms every chunk of a deduplicated backup is stored with
+// the size its manifest records.
+func (a *App) checkDedupChunks(ctx context.Context, manifest storage.Manifest) error {
+	for _, chunk := range manifest.DedupChunks {
+		info, err := a.Storage.Stat(ctx, a.dedupChunkKey(a.dedupStore(), chunk.Hash))
+		if err != nil {
+			return fmt.Errorf("chunk %s: %w", chunk.Hash, err)
+		}
+		if info.Size != chunk.Stored {
+			return fmt.Errorf("chunk %s is %d bytes, manifest records %d", chunk.Hash, info.Size, chunk.Stored)
+		}
+	}
+	return nil
+}
+
+// readDedupIndex reads the chunk map stored at key; it is empty when the backup
+// is not deduplicated.
+func (a *App) readDedupIndex(ctx context.Context, key string) (dedupIndex, error) {
+	reader, err := a.Storage.Get(ctx, key)
+	if err != nil {
+		return dedupIndex{}, err
+	}
+	defer reader.Close()
+	stored := bufio.NewReader(reader)
+	if !isDedupIndex(stored) {
+		return dedupIndex{}, nil
+	}
+	return parseDedupIndex(stored)
+}
+
+// parseDedupIndex reads a chunk map, magic included.
+func parseDedupIndex(r io.Reader) (dedupIndex, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxDedupIndex))
+	if err != nil {
+		return dedupIndex{}, err
+	}
+	var index dedupIndex
+	err = json.Unmarshal(bytes.TrimPrefix(data, dedupIndexMagic), &index)
+	return index, err
+}
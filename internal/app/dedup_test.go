@@ -0,0 +1,104 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestDedupBackups(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{
+		Type: "full", Compression: "zstd", Encryption: true, EncryptionKey: "hex:" + strings.Repeat("ab", 32),
+		Dedup: true, DedupChunkSize: 8, RetentionPolicy: config.Retention{KeepLast: 1},
+	}
+	root := filepath.Join(dir, "backups")
+	adapter := &stubAdapter{data: []byte("aaaaaaaabbbbbbbbcc")}
+	a := New(cfg, adapter, storage.NewLocal(root), zerolog.Nop(), nil)
+	chunkDir := filepath.Join(root, "_dedup-chunks", "stub", "appdb")
+	storedChunks := func() int {
+		entries, _ := os.ReadDir(chunkDir)
+		return len(entries)
+	}
+	restored := func(key string) []byte {
+		manifest, err := a.readManifest(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := a.openBackup(ctx, key, manifest, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	first, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Manifest.DedupChunks) != 3 || storedChunks() != 3 || first.Manifest.UncompressedBytes != 18 {
+		t.Fatalf("unexpected chunk map %+v", first.Manifest.DedupChunks)
+	}
+	if got := restored(first.Key); !bytes.Equal(got, adapter.data) {
+		t.Fatalf("restored %q", got)
+	}
+
+	// Only the changed middle chunk is stored again; the first backup's copy of it
+	// is collected once retention deletes that backup.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	adapter.data = []byte("aaaaaaaaBBBBBBBBcc")
+	second, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := restored(second.Key); !bytes.Equal(got, adapter.data) {
+		t.Fatalf("restored %q", got)
+	}
+	if second.Manifest.DedupChunks[0] != first.Manifest.DedupChunks[0] || second.Manifest.DedupChunks[1].Hash == first.Manifest.DedupChunks[1].Hash {
+		t.Fatalf("unexpected chunk maps %+v and %+v", first.Manifest.DedupChunks, second.Manifest.DedupChunks)
+	}
+	if n := storedChunks(); n != 3 {
+		t.Fatalf("expected the unused chunk to be deleted, %d stored", n)
+	}
+	results, err := a.Verify(ctx, VerifyOptions{Keys: []string{second.Key}, Deep: true})
+	if err != nil || results[0].PlainSize != 18 {
+		t.Fatalf("verify: %+v, %v", results, err)
+	}
+
+	// A chunk swapped for another fails its hash check.
+	middle := filepath.Join(chunkDir, second.Manifest.DedupChunks[1].Hash)
+	last, err := os.ReadFile(filepath.Join(chunkDir, second.Manifest.DedupChunks[2].Hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(middle, last, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := a.openBackup(ctx, second.Key, second.Manifest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if _, err := io.ReadAll(reader); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Fatalf("expected a corrupt chunk error, got %v", err)
+	}
+}
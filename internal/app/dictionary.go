@@ -0,0 +1,162 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rowjay/db-backup-utility/internal/compress"
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+// dictionaryDir holds trained zstd dictionaries under the storage prefix, shared by
+// every database. Backup keys never start with "_".
+const dictionaryDir = "_zstd-dictionaries"
+
+const (
+	// DefaultDictionarySize is the trained dictionary size when none is given.
+	DefaultDictionarySize = 112 << 10
+	// maxDictionarySample bounds how much of one backup is used for training.
+	maxDictionarySample = 4 << 20
+)
+
+// Dictionary describes a trained zstd dictionary stored alongside the backups.
+type Dictionary struct {
+	ID      uint32
+	Key     string
+	Size    int
+	Samples []string
+}
+
+// DictionaryKey returns where the dictionary with id is stored.
+func (a *App) DictionaryKey(id uint32) string {
+	return path.Join(util.BuildPrefix(a.Cfg.Storage.Prefix, "", "", ""), dictionaryDir, fmt.Sprintf("%08x.zdict", id))
+}
+
+// ParseDictionaryID reads a dictionary ID as printed by "dbu dict train".
+func ParseDictionaryID(s string) (uint32, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "0x"), 16, 32)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid zstd dictionary id %q", s)
+	}
+	return uint32(id), nil
+}
+
+// TrainDictionary builds a zstd dictionary from the newest backups and stores it.
+// Backups of the configured database are used, or of every database under the
+// storage prefix when allDatabases is set. Backups that cannot be read are skipped.
+func (a *App) TrainDictionary(ctx context.Context, samples, maxSize int, allDatabases bool) (*Dictionary, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultDictionarySize
+	}
+	prefix := util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database)
+	if allDatabases {
+		prefix = util.BuildPrefix(a.Cfg.Storage.Prefix, "", "", "")
+	}
+	objects, err := a.Storage.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	backups := groupBackups(objects)
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Modified.After(backups[j].Modified) })
+
+	dict := &Dictionary{}
+	var data [][]byte
+	for _, b := range backups {
+		if samples > 0 && len(data) >= samples {
+			break
+		}
+		if path.Base(path.Dir(b.Key)) == dictionaryDir {
+			continue
+		}
+		sample, err := a.ReadSample(ctx, b.Key, maxDictionarySample)
+		if err != nil {
+			a.Log.Debug().Err(err).Str("key", b.Key).Msg("skipping backup for dictionary training")
+			continue
+		}
+		if len(sample) == 0 {
+			continue
+		}
+		data = append(data, sample)
+		dict.Samples = append(dict.Samples, b.Key)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no readable backups under %q to train a dictionary from", prefix)
+	}
+
+	trained, err := compress.TrainDict(data, maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("train dictionary: %w", err)
+	}
+	if dict.ID, err = compress.DictID(trained); err != nil {
+		return nil, err
+	}
+	dict.Key = a.DictionaryKey(dict.ID)
+	dict.Size = len(trained)
+	// The dictionary holds fragments of the dumps it was trained on.
+	payload, err := a.sealSidecar(trained, a.Cfg.Backup.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("store dictionary: %w", err)
+	}
+	if err := a.Storage.Put(ctx, dict.Key, bytes.NewReader(payload), int64(len(payload)), map[string]string{"dbu-zstd-dictionary": "true"}); err != nil {
+		return nil, fmt.Errorf("store dictionary: %w", err)
+	}
+	return dict, nil
+}
+
+// ReadSample returns up to limit bytes from the start of a backup's dump.
+func (a *App) ReadSample(ctx context.Context, key string, limit int64) ([]byte, error) {
+	manifest, manifestErr := a.readManifest(ctx, key)
+	reader, err := a.openBackup(ctx, key, manifest, manifestErr)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(io.LimitReader(reader, limit))
+}
+
+// loadDictionary fetches the dictionary with id and checks it is the one asked for.
+func (a *App) loadDictionary(ctx context.Context, id uint32) ([]byte, error) {
+	key := a.DictionaryKey(id)
+	reader, err := a.Storage.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("load zstd dictionary %08x: %w", id, err)
+	}
+	defer reader.Close()
+	dict, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("load zstd dictionary %08x: %w", id, err)
+	}
+	if dict, err = a.openSidecar("zstd dictionary "+key, dict); err != nil {
+		return nil, err
+	}
+	got, err := compress.DictID(dict)
+	if err != nil {
+		return nil, fmt.Errorf("load zstd dictionary %08x: %w", id, err)
+	}
+	if got != id {
+		return nil, fmt.Errorf("zstd dictionary %s has id %08x, want %08x", key, got, id)
+	}
+	return dict, nil
+}
+
+// backupDictionary loads the dictionary configured for new backups, if any.
+func (a *App) backupDictionary(ctx context.Context) (uint32, []byte, error) {
+	if a.Cfg.Backup.ZstdDictionary == "" {
+		return 0, nil, nil
+	}
+	if a.Cfg.Backup.Compression != compress.TypeZstd {
+		return 0, nil, fmt.Errorf("zstd_dictionary requires zstd compression, not %q", a.Cfg.Backup.Compression)
+	}
+	id, err := ParseDictionaryID(a.Cfg.Backup.ZstdDictionary)
+	if err != nil {
+		return 0, nil, err
+	}
+	dict, err := a.loadDictionary(ctx, id)
+	return id, dict, err
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func tenantDump(i int) []byte {
+	var b bytes.Buffer
+	for row := 0; row < 40; row++ {
+		fmt.Fprintf(&b, "INSERT INTO tenants (id, name, plan) VALUES (%d, 'tenant-%d-%d', 'plan-%d');\n", i*1000+row, i, row*7, row%3)
+	}
+	return b.Bytes()
+}
+
+func TestTrainedDictionaryRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "zstd"}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("stub/appdb/202401%02dT000000Z_full.backup", i+1)
+		data := tenantDump(i)
+		if err := store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := New(cfg, &stubAdapter{data: tenantDump(99)}, store, zerolog.Nop(), nil)
+	dict, err := a.TrainDictionary(ctx, 0, 4096, false)
+	if err != nil {
+		t.Fatalf("train: %v", err)
+	}
+	if len(dict.Samples) != 20 || dict.Key != fmt.Sprintf("_zstd-dictionaries/%08x.zdict", dict.ID) {
+		t.Fatalf("unexpected dictionary %+v", dict)
+	}
+
+	cfg.Backup.ZstdDictionary = fmt.Sprintf("%08x", dict.ID)
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	manifest, err := a.readManifest(ctx, res.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.CompressionDict != dict.ID {
+		t.Fatalf("manifest dictionary = %08x, want %08x", manifest.CompressionDict, dict.ID)
+	}
+
+	// The frame header is enough to find the dictionary without the manifest.
+	reader, err := a.openBackup(ctx, res.Key, storage.Manifest{}, fmt.Errorf("no manifest"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(got, tenantDump(99)) {
+		t.Fatalf("payload mismatch")
+	}
+}
+
+func TestBackupDictionaryRequiresZstd(t *testing.T) {
+	a := New(&config.Config{Backup: config.BackupConfig{Compression: "gzip", ZstdDictionary: "0000abcd"}}, nil, nil, zerolog.Nop(), nil)
+	if _, _, err := a.backupDictionary(context.Background()); err == nil {
+		t.Fatalf("expected an error for a dictionary with gzip")
+	}
+}
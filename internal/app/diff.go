@@ -0,0 +1,155 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/rowjay/db-backup-utility/internal/db"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// BackupDiff is what changed from one backup to another.
+type BackupDiff struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	FromSize  int64  `json:"from_size"`
+	ToSize    int64  `json:"to_size"`
+	SizeDelta int64  `json:"size_delta"`
+	// FromPlainSize and ToPlainSize are the dump sizes before compression, where
+	// the manifests record them.
+	FromPlainSize int64 `json:"from_plain_size,omitempty"`
+	ToPlainSize   int64 `json:"to_plain_size,omitempty"`
+	// AddedTables and RemovedTables compare the tables and collections the
+	// manifests record; ChangedTables are those whose recorded checksums differ.
+	AddedTables   []string `json:"added_tables,omitempty"`
+	RemovedTables []string `json:"removed_tables,omitempty"`
+	ChangedTables []string `json:"changed_tables,omitempty"`
+	// Deep is set when the dumps themselves were compared; Objects then holds the
+	// entries that were added, removed or changed size.
+	Deep    bool           `json:"deep"`
+	Objects []ObjectChange `json:"objects,omitempty"`
+}
+
+// ObjectChange is one dump entry that differs between two backups.
+type ObjectChange struct {
+	Change   string `json:"change"` // added, removed or resized
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	FromSize int64  `json:"from_size,omitempty"`
+	ToSize   int64  `json:"to_size,omitempty"`
+}
+
+// Empty reports whether the backups differ in nothing but their size.
+func (d BackupDiff) Empty() bool {
+	return len(d.AddedTables) == 0 && len(d.RemovedTables) == 0 && len(d.ChangedTables) == 0 && len(d.Objects) == 0
+}
+
+// Diff compares the backups at from and to by their manifests and, with deep,
+// by the contents of the dumps, read through the same pipeline as a restore.
+// A differential holds only its changed tables, so deep diffs against one list
+// everything else as removed.
+func (a *App) Diff(ctx context.Context, from, to string, deep bool) (BackupDiff, error) {
+	fromManifest, err := a.readManifest(ctx, from)
+	if err != nil {
+		return BackupDiff{}, fmt.Errorf("read manifest of %s: %w", from, err)
+	}
+	toManifest, err := a.readManifest(ctx, to)
+	if err != nil {
+		return BackupDiff{}, fmt.Errorf("read manifest of %s: %w", to, err)
+	}
+	diff := BackupDiff{
+		From:          from,
+		To:            to,
+		FromSize:      fromManifest.SizeBytes,
+		ToSize:        toManifest.SizeBytes,
+		SizeDelta:     toManifest.SizeBytes - fromManifest.SizeBytes,
+		FromPlainSize: fromManifest.UncompressedBytes,
+		ToPlainSize:   toManifest.UncompressedBytes,
+		Deep:          deep,
+	}
+	fromTables, toTables := manifestTables(fromManifest), manifestTables(toManifest)
+	for _, name := range slices.Sorted(maps.Keys(toTables)) {
+		if _, ok := fromTables[name]; !ok {
+			diff.AddedTables = append(diff.AddedTables, name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(fromTables)) {
+		sum, ok := toTables[name]
+		switch {
+		case !ok:
+			diff.RemovedTables = append(diff.RemovedTables, name)
+		case sum != "" && fromTables[name] != "" && sum != fromTables[name]:
+			diff.ChangedTables = append(diff.ChangedTables, name)
+		}
+	}
+	if !deep {
+		return diff, nil
+	}
+
+	fromContents, err := a.ListContents(ctx, from)
+	if err != nil {
+		return BackupDiff{}, err
+	}
+	toContents, err := a.ListContents(ctx, to)
+	if err != nil {
+		return BackupDiff{}, err
+	}
+	diff.Objects = diffObjects(fromContents.Objects, toContents.Objects)
+	return diff, nil
+}
+
+// manifestTables maps the tables and collections a manifest records to their
+// checksums, or to "" where none was taken.
+func manifestTables(m storage.Manifest) map[string]string {
+	tables := make(map[string]string, len(m.Tables)+len(m.Collections)+len(m.TableChecksums))
+	for _, name := range m.Tables {
+		tables[name] = ""
+	}
+	for _, name := range m.Collections {
+		tables[name] = ""
+	}
+	maps.Copy(tables, m.TableChecksums)
+	return tables
+}
+
+// diffObjects returns the entries added to, removed from or resized between two
+// dump listings, ordered by kind and name. Sizes are compared only where both
+// listings show one.
+func diffObjects(from, to []db.DumpObject) []ObjectChange {
+	type objectID struct{ kind, name string }
+	index := func(objects []db.DumpObject) map[objectID]int64 {
+		sizes := make(map[objectID]int64, len(objects))
+		for _, obj := range objects {
+			name := obj.Name
+			if obj.Schema != "" {
+				name = obj.Schema + "." + name
+			}
+			sizes[objectID{obj.Kind, name}] += obj.Size
+		}
+		return sizes
+	}
+	fromSizes, toSizes := index(from), index(to)
+
+	var changes []ObjectChange
+	for id, size := range toSizes {
+		if _, ok := fromSizes[id]; !ok {
+			changes = append(changes, ObjectChange{Change: "added", Kind: id.kind, Name: id.name, ToSize: size})
+		}
+	}
+	for id, size := range fromSizes {
+		toSize, ok := toSizes[id]
+		switch {
+		case !ok:
+			changes = append(changes, ObjectChange{Change: "removed", Kind: id.kind, Name: id.name, FromSize: size})
+		case size > 0 && toSize > 0 && size != toSize:
+			changes = append(changes, ObjectChange{Change: "resized", Kind: id.kind, Name: id.name, FromSize: size, ToSize: toSize})
+		}
+	}
+	slices.SortFunc(changes, func(x, y ObjectChange) int {
+		return cmp.Or(cmp.Compare(x.Kind, y.Kind), cmp.Compare(x.Name, y.Name))
+	})
+	return changes
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestDiffReportsSchemaDrift(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "zstd", Tables: []string{"app.users", "app.orders"}}
+	adapter := &schemaLister{stubAdapter{data: []byte("app.users\napp.orders\n")}}
+	a := New(cfg, adapter, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+
+	older, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	cfg.Backup.Tables = []string{"app.users", "app.events"}
+	adapter.data = []byte("app.users\napp.events\naudit.log\n")
+	newer, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := a.Diff(ctx, older.Key, newer.Key, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.SizeDelta != newer.Manifest.SizeBytes-older.Manifest.SizeBytes || diff.Objects != nil {
+		t.Fatalf("unexpected shallow diff %+v", diff)
+	}
+	if !slices.Equal(diff.AddedTables, []string{"app.events"}) || !slices.Equal(diff.RemovedTables, []string{"app.orders"}) {
+		t.Fatalf("manifest tables: added %v, removed %v", diff.AddedTables, diff.RemovedTables)
+	}
+
+	diff, err = a.Diff(ctx, older.Key, newer.Key, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ObjectChange{
+		{Change: "added", Kind: "TABLE", Name: "app.events"},
+		{Change: "removed", Kind: "TABLE", Name: "app.orders"},
+		{Change: "added", Kind: "TABLE", Name: "audit.log"},
+	}
+	if !slices.Equal(diff.Objects, want) {
+		t.Fatalf("objects = %+v, want %+v", diff.Objects, want)
+	}
+
+	if diff, err := a.Diff(ctx, newer.Key, newer.Key, true); err != nil || !diff.Empty() {
+		t.Fatalf("a backup should not differ from itself: %+v, %v", diff, err)
+	}
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/db"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+func isDifferential(backupType string) bool {
+	return strings.EqualFold(backupType, "differential")
+}
+
+// tableChecksums fingerprints the configured tables of source (all tables when none are set).
+func (a *App) tableChecksums(ctx context.Context, source config.DatabaseConfig) (map[string]string, error) {
+	summer, ok := a.Adapter.(db.TableChecksummer)
+	if !ok {
+		return nil, fmt.Errorf("%s cannot checksum tables", a.Adapter.Name())
+	}
+	sums, err := summer.TableChecksums(ctx, source, a.Cfg.Backup.Tables)
+	if err != nil {
+		return nil, fmt.Errorf("table checksums: %w", err)
+	}
+	return sums, nil
+}
+
+// differentialBase returns the manifest of the newest full backup, which must have
+// been taken with backup.table_checksums enabled.
+func (a *App) differentialBase(ctx context.Context) (storage.Manifest, error) {
+	prefix := util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database)
+	objects, err := a.Storage.List(ctx, prefix)
+	if err != nil {
+		return storage.Manifest{}, err
+	}
+	backups := groupBackups(objects)
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Modified.After(backups[j].Modified) })
+	for _, obj := range backups {
+		if !strings.Contains(obj.Key, "_full.") {
+			continue
+		}
+		manifest, err := a.readManifest(ctx, obj.Key)
+		if err != nil {
+			return storage.Manifest{}, fmt.Errorf("read base manifest %s: %w", obj.Key, err)
+		}
+		if len(manifest.TableChecksums) == 0 {
+			return storage.Manifest{}, fmt.Errorf("latest full backup %s has no table checksums; take a full backup with backup.table_checksums enabled", obj.Key)
+		}
+		return manifest, nil
+	}
+	return storage.Manifest{}, fmt.Errorf("no full backup to base a differential on; take a full backup with backup.table_checksums enabled")
+}
+
+// changedTables lists tables that are new or whose checksum differs from base, and
+// tables present in base that no longer exist.
+func changedTables(base, current map[string]string) (changed, dropped []string) {
+	for table, sum := range current {
+		if base[table] != sum {
+			changed = append(changed, table)
+		}
+	}
+	for table := range base {
+		if _, ok := current[table]; !ok {
+			dropped = append(dropped, table)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(dropped)
+	return changed, dropped
+}
+
+// protectedChains returns the keys of the latest keepFull full backups among
+// backups, which are sorted newest first, and of the candidates that are
+// differentials built on one of them. A differential whose manifest cannot be
+// read is not protected.
+func (a *App) protectedChains(ctx context.Context, backups, candidates []backupObject, keepFull int) map[string]bool {
+	fulls := map[string]bool{}
+	for _, obj := range backups {
+		if len(fulls) == keepFull {
+			break
+		}
+		if strings.Contains(obj.Key, "_full.") {
+			fulls[obj.Key] = true
+		}
+	}
+	protected := maps.Clone(fulls)
+	for _, obj := range candidates {
+		if !strings.Contains(obj.Key, "_differential.") {
+			continue
+		}
+		manifest, err := a.readManifest(ctx, obj.Key)
+		if err != nil {
+			a.Log.Warn().Err(err).Str("key", obj.Key).Msg("cannot read differential manifest; it is not protected by keep_full")
+			continue
+		}
+		if fulls[manifest.BaseKey] {
+			protected[obj.Key] = true
+		}
+	}
+	return protected
+}
+
+// referencedBases returns the base keys of the differentials among backups.
+func (a *App) referencedBases(ctx context.Context, backups []backupObject) map[string]bool {
+	bases := map[string]bool{}
+	for _, obj := range backups {
+		if !strings.Contains(obj.Key, "_differential.") {
+			continue
+		}
+		manifest, err := a.readManifest(ctx, obj.Key)
+		if err != nil {
+			a.Log.Warn().Err(err).Str("key", obj.Key).Msg("cannot read differential manifest; its base may be pruned")
+			continue
+		}
+		if manifest.BaseKey != "" {
+			bases[manifest.BaseKey] = true
+		}
+	}
+	return bases
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrWindowSkipped is returned when a backup is skipped because the current time is
+	// outside the configured window. It is recorded as "skipped", not "failed".
+	ErrWindowSkipped = errors.New("skipped: outside configured backup window")
+	// ErrPaused is returned when a backup is skipped because backups of the database
+	// are paused (dbu schedule pause). It is recorded as "skipped", not "failed".
+	ErrPaused = errors.New("skipped: backups are paused")
+	// ErrConnectivity wraps failures to reach a database before any work starts.
+	ErrConnectivity = errors.New("database unreachable")
+	// ErrAssertion is returned when data was restored but a restore.assertions
+	// query did not hold.
+	ErrAssertion = errors.New("restore assertion failed")
+	// ErrBudgetExceeded is returned when a backup outgrew backup.max_size_bytes or
+	// backup.max_duration and was aborted.
+	ErrBudgetExceeded = errors.New("backup budget exceeded")
+
+	// Backup pipeline stages. A failed backup wraps exactly one of these so callers
+	// can tell where it broke with errors.Is.
+	ErrDump     = errors.New("dump failed")
+	ErrCompress = errors.New("compression failed")
+	ErrEncrypt  = errors.New("encryption failed")
+	ErrUpload   = errors.New("upload failed")
+)
+
+var pipelineStages = []error{ErrDump, ErrCompress, ErrEncrypt, ErrUpload}
+
+func connectivityError(err error) error {
+	return fmt.Errorf("%w: %w", ErrConnectivity, err)
+}
+
+// stageError attributes err to a pipeline stage unless an earlier stage already
+// claimed it, e.g. a compressor passing on a write error from the upload. An
+// exceeded budget is no stage's failure and is passed on as is.
+func stageError(stage, err error) error {
+	if err == nil || errors.Is(err, ErrBudgetExceeded) {
+		return err
+	}
+	for _, s := range pipelineStages {
+		if errors.Is(err, s) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %w", stage, err)
+}
+
+// stageReader attributes read errors other than io.EOF to a stage.
+type stageReader struct {
+	r     io.Reader
+	stage error
+}
+
+func (s stageReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = stageError(s.stage, err)
+	}
+	return n, err
+}
+
+// stageWriter attributes write and close errors to a stage.
+type stageWriter struct {
+	w     io.Writer
+	stage error
+}
+
+func (s stageWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	return n, stageError(s.stage, err)
+}
+
+func (s stageWriter) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return stageError(s.stage, c.Close())
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/db"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// stubAdapter dumps data, or fails at the configured point.
+type stubAdapter struct {
+	data    []byte
+	dumpErr error // returned by Dump
+	waitErr error // returned by the dump stream's Wait
+	readErr error // returned by the dump reader after data
+}
+
+func (s *stubAdapter) Name() string { return "stub" }
+func (s *stubAdapter) Validate(context.Context, config.DatabaseConfig) error {
+	return nil
+}
+func (s *stubAdapter) PreflightRestore(context.Context, config.DatabaseConfig, config.RestoreConfig) error {
+	return nil
+}
+func (s *stubAdapter) Capabilities() db.Capabilities { return db.Capabilities{} }
+
+func (s *stubAdapter) Dump(context.Context, config.DatabaseConfig, config.BackupConfig) (*db.DumpStream, error) {
+	if s.dumpErr != nil {
+		return nil, s.dumpErr
+	}
+	r := io.Reader(bytes.NewReader(s.data))
+	if s.readErr != nil {
+		r = io.MultiReader(r, errReader{s.readErr})
+	}
+	return &db.DumpStream{Reader: io.NopCloser(r), Wait: func() error { return s.waitErr }}, nil
+}
+
+func (s *stubAdapter) Restore(context.Context, config.DatabaseConfig, config.RestoreConfig, storage.Manifest) (*db.RestoreStream, error) {
+	return nil, errors.New("not implemented")
+}
+
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
+
+// failingPut rejects uploads after reading part of the stream.
+type failingPut struct {
+	storage.Storage
+	err error
+}
+
+func (f failingPut) Put(_ context.Context, _ string, r io.Reader, _ int64, _ map[string]string) error {
+	_, _ = io.CopyN(io.Discard, r, 10)
+	return f.err
+}
+
+func TestBackupWrapsPipelineStage(t *testing.T) {
+	boom := errors.New("boom")
+	cases := []struct {
+		name    string
+		adapter *stubAdapter
+		store   func(storage.Storage) storage.Storage
+		key     string
+		want    error
+	}{
+		{name: "dump start", adapter: &stubAdapter{dumpErr: boom}, want: ErrDump},
+		{name: "dump exit", adapter: &stubAdapter{data: []byte("rows"), waitErr: boom}, want: ErrDump},
+		{name: "dump read", adapter: &stubAdapter{data: []byte("rows"), readErr: boom}, want: ErrDump},
+		{name: "encryption key", adapter: &stubAdapter{data: []byte("rows")}, key: "not-a-key", want: ErrEncrypt},
+		{
+			name:    "upload",
+			adapter: &stubAdapter{data: bytes.Repeat([]byte("rows"), 1<<16)},
+			store:   func(s storage.Storage) storage.Storage { return failingPut{Storage: s, err: boom} },
+			want:    ErrUpload,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &config.Config{}
+			cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+			cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+			cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+			if tc.key != "" {
+				cfg.Backup.Encryption = true
+				cfg.Backup.EncryptionKey = tc.key
+			}
+			var store storage.Storage = storage.NewLocal(filepath.Join(dir, "backups"))
+			if tc.store != nil {
+				store = tc.store(store)
+			}
+			_, err := New(cfg, tc.adapter, store, zerolog.Nop(), nil).Backup(context.Background())
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+			for _, stage := range pipelineStages {
+				if stage != tc.want && errors.Is(err, stage) {
+					t.Fatalf("error %v also matches %v", err, stage)
+				}
+			}
+			if tc.adapter.dumpErr == nil && tc.adapter.waitErr == nil && tc.adapter.readErr == nil && tc.key == "" && !errors.Is(err, boom) {
+				t.Fatalf("expected the cause to be preserved, got %v", err)
+			}
+		})
+	}
+}
+
+// partialPut stores the first limit bytes of each upload after the first skip
+// uploads succeed, then reports failure, like an upload cut off mid-stream.
+type partialPut struct {
+	storage.Storage
+	skip  int
+	limit int64
+}
+
+func (p *partialPut) Put(ctx context.Context, key string, r io.Reader, size int64, metadata map[string]string) error {
+	if p.skip > 0 {
+		p.skip--
+		return p.Storage.Put(ctx, key, r, size, metadata)
+	}
+	if err := p.Storage.Put(ctx, key, io.LimitReader(r, p.limit), -1, metadata); err != nil {
+		return err
+	}
+	return errors.New("connection reset")
+}
+
+func TestFailedUploadLeavesNothingBehind(t *testing.T) {
+	for _, chunkSize := range []int64{0, 1024} {
+		dir := t.TempDir()
+		cfg := &config.Config{}
+		cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+		cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+		cfg.Backup = config.BackupConfig{Type: "full", Compression: "none", ChunkSize: chunkSize}
+		local := storage.NewLocal(filepath.Join(dir, "backups"))
+		store := &partialPut{Storage: local, skip: 2, limit: 100}
+		if chunkSize == 0 {
+			store.skip = 0
+		}
+		a := New(cfg, &stubAdapter{data: bytes.Repeat([]byte("rows"), 4096)}, store, zerolog.Nop(), nil)
+		if _, err := a.Backup(context.Background()); !errors.Is(err, ErrUpload) {
+			t.Fatalf("chunk size %d: expected an upload error, got %v", chunkSize, err)
+		}
+		objects, err := local.List(context.Background(), "stub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The status object records the failure; nothing of the backup may remain.
+		for _, obj := range objects {
+			if !storage.IsStatus(obj.Key) {
+				t.Fatalf("chunk size %d: failed backup left %+v", chunkSize, objects)
+			}
+		}
+	}
+}
+
+// hungAdapter runs a dump tool that writes a little and then stalls.
+type hungAdapter struct{ stubAdapter }
+
+func (h *hungAdapter) Dump(ctx context.Context, _ config.DatabaseConfig, _ config.BackupConfig) (*db.DumpStream, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", "printf rowsrowsrows; exec sleep 60")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &db.DumpStream{Reader: stdout, Wait: cmd.Wait}, nil
+}
+
+func TestFailedUploadStopsDump(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "none"}
+	boom := errors.New("boom")
+	store := failingPut{Storage: storage.NewLocal(filepath.Join(dir, "backups")), err: boom}
+	a := New(cfg, &hungAdapter{}, store, zerolog.Nop(), nil)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.Backup(context.Background())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrUpload) || !errors.Is(err, boom) {
+			t.Fatalf("expected the upload error, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("backup still waiting on the dump after the upload failed")
+	}
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rowjay/db-backup-utility/internal/db"
+)
+
+// Estimate previews the size of a backup without dumping the database.
+type Estimate struct {
+	// DatabaseBytes is the engine's own size report (pg_database_size,
+	// information_schema, dbStats.dataSize or the SQLite files).
+	DatabaseBytes int64
+	// Previous* describe the newest full backup, if any.
+	PreviousKey               string
+	PreviousBytes             int64
+	PreviousUncompressedBytes int64
+	// EstimatedBytes scales DatabaseBytes by the previous backup's compression
+	// ratio; 0 when no previous backup recorded one.
+	EstimatedBytes int64
+}
+
+// EstimateBackup asks the engine for the database size and compares it with the
+// newest full backup. Nothing is dumped or written.
+func (a *App) EstimateBackup(ctx context.Context) (*Estimate, error) {
+	estimator, ok := a.Adapter.(db.SizeEstimator)
+	if !ok {
+		return nil, fmt.Errorf("size estimates are not supported for %s", a.Adapter.Name())
+	}
+	source, _ := a.readSource()
+	size, err := estimator.EstimateSize(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("estimate database size: %w", err)
+	}
+	est := &Estimate{DatabaseBytes: size}
+
+	objects, err := a.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	backups := groupBackups(objects)
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Modified.After(backups[j].Modified) })
+	for _, obj := range backups {
+		if !strings.Contains(obj.Key, "_full.") {
+			continue
+		}
+		est.PreviousKey = obj.Key
+		est.PreviousBytes = obj.Size
+		manifest, err := a.readManifest(ctx, obj.Key)
+		if err != nil {
+			a.Log.Debug().Err(err).Str("key", obj.Key).Msg("previous manifest unavailable; no compression ratio")
+			break
+		}
+		est.PreviousUncompressedBytes = manifest.UncompressedBytes
+		if ratio := manifest.CompressionRatio(); ratio > 0 {
+			est.EstimatedBytes = int64(float64(size) / ratio)
+		}
+		break
+	}
+	return est, nil
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// Object tags mirroring a backup's hold on backends that support tags.
+const (
+	tagLegalHold   = "dbu-legal-hold"
+	tagRetainUntil = "dbu-retain-until"
+)
+
+// Hold keeps a backup from being deleted by retention: with a zero until it places
+// a legal hold, otherwise it retains the backup until then.
+func (a *App) Hold(ctx context.Context, key string, until time.Time) (storage.Manifest, error) {
+	return a.setHold(ctx, "hold", key, func(m *storage.Manifest) {
+		if until.IsZero() {
+			m.LegalHold = true
+		} else {
+			m.RetainUntil = until.UTC()
+		}
+	})
+}
+
+// Release lifts a backup's legal hold and retain-until date.
+func (a *App) Release(ctx context.Context, key string) (storage.Manifest, error) {
+	return a.setHold(ctx, "release", key, func(m *storage.Manifest) {
+		m.LegalHold = false
+		m.RetainUntil = time.Time{}
+	})
+}
+
+// setHold applies change to the backup's manifest under the lock, so a concurrent
+// retention run sees either the old or the new hold, then mirrors it into tags.
+func (a *App) setHold(ctx context.Context, opType, key string, change func(*storage.Manifest)) (storage.Manifest, error) {
+	start := time.Now()
+	var opErr error
+	defer func() { a.finish(opType, start, key, opErr) }()
+
+	guard, err := a.acquireLock(a.Cfg)
+	if err != nil {
+		opErr = err
+		return storage.Manifest{}, err
+	}
+	defer guard.Release()
+
+	manifest, err := a.readManifest(ctx, key)
+	if err != nil {
+		// The manifest is where the hold lives; a backup without one cannot carry it.
+		opErr = fmt.Errorf("read manifest %s: %w", key, err)
+		return storage.Manifest{}, opErr
+	}
+	change(&manifest)
+	if err := a.replaceManifest(ctx, manifest, a.Cfg.Backup.EncryptionKey); err != nil {
+		opErr = fmt.Errorf("write manifest: %w", err)
+		return storage.Manifest{}, opErr
+	}
+	if err := a.tagHold(ctx, manifest); err != nil {
+		opErr = fmt.Errorf("manifest updated, but tagging the backup failed: %w", err)
+		return manifest, opErr
+	}
+	return manifest, nil
+}
+
+// tagHold mirrors the manifest's hold into the tags of every stored part, where
+// the backend supports tags, so it is visible to tools that never read manifests.
+func (a *App) tagHold(ctx context.Context, manifest storage.Manifest) error {
+	labels := map[string]string{tagLegalHold: "", tagRetainUntil: ""}
+	if manifest.LegalHold {
+		labels[tagLegalHold] = "true"
+	}
+	if !manifest.RetainUntil.IsZero() {
+		labels[tagRetainUntil] = manifest.RetainUntil.UTC().Format(time.RFC3339)
+	}
+	parts := manifest.Chunks
+	if len(parts) == 0 {
+		parts = []string{manifest.Key}
+	}
+	for _, part := range parts {
+		if _, err := storage.SetTags(ctx, a.Storage, part, labels); err != nil {
+			return fmt.Errorf("tag %s: %w", part, err)
+		}
+	}
+	return nil
+}
+
+// held reports whether retention must keep the backup: it is held, or it carries
+// labels and retention.keep_labeled is set. A backup without a manifest is not
+// held; one whose manifest cannot be read is kept, since it may be.
+func (a *App) held(ctx context.Context, key string, now time.Time) bool {
+	manifest, err := a.readManifest(ctx, key)
+	if storage.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		a.Log.Warn().Err(err).Str("key", key).Msg("cannot read manifest; keeping backup in case it is held")
+		return true
+	}
+	if a.Cfg.Backup.RetentionPolicy.KeepLabeled && len(manifest.Labels) > 0 {
+		return true
+	}
+	return manifest.Held(now)
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestRetentionKeepsHeldBackups(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", RetentionPolicy: config.Retention{KeepLast: 1}}
+	root := filepath.Join(dir, "backups")
+	store := storage.NewLocal(root)
+	a := New(cfg, &stubAdapter{data: []byte("rows")}, store, zerolog.Nop(), nil)
+
+	old := func(day int, m storage.Manifest) string {
+		when := time.Date(2000, 1, day, 0, 0, 0, 0, time.UTC)
+		key := "stub/appdb/" + when.Format("20060102T150405Z") + "_full.backup.gz"
+		if err := store.Put(ctx, key, strings.NewReader("old"), 3, nil); err != nil {
+			t.Fatal(err)
+		}
+		m.Key, m.BackupType, m.Compression = key, "full", "gzip"
+		if err := a.writeManifest(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(root, key), when, when); err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	legal := old(1, storage.Manifest{})
+	old(2, storage.Manifest{})
+	retained := old(3, storage.Manifest{})
+	old(4, storage.Manifest{RetainUntil: time.Now().Add(-time.Hour)})
+
+	if _, err := a.Hold(ctx, legal, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := a.Hold(ctx, retained, time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.LegalHold || m.RetainUntil.IsZero() {
+		t.Fatalf("unexpected hold %+v", m)
+	}
+	if _, err := a.Hold(ctx, "stub/appdb/missing.backup.gz", time.Time{}); err == nil {
+		t.Fatal("expected holding a backup without a manifest to fail")
+	}
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertKeys := func(want ...string) {
+		t.Helper()
+		keys, err := a.BackupKeys(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(keys)
+		sort.Strings(want)
+		if !reflect.DeepEqual(keys, want) {
+			t.Fatalf("backups %v, want %v", keys, want)
+		}
+	}
+	assertKeys(res.Key, legal, retained)
+
+	if _, err := a.Release(ctx, legal); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.applyRetention(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assertKeys(res.Key, retained)
+}
+
+func TestHoldOnImmutableStorage(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	cfg.Storage.Local.Immutable = true
+	a := New(cfg, &stubAdapter{data: []byte("rows")}, writeOnce{storage.NewLocal(filepath.Join(dir, "backups"))}, zerolog.Nop(), nil)
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Hold(ctx, res.Key, time.Time{}); err != nil {
+		t.Fatalf("hold: %v", err)
+	}
+	if manifest, err := a.readManifest(ctx, res.Key); err != nil || !manifest.LegalHold {
+		t.Fatalf("expected a legal hold, got %+v, %v", manifest, err)
+	}
+	if _, err := a.Release(ctx, res.Key); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if manifest, err := a.readManifest(ctx, res.Key); err != nil || manifest.LegalHold {
+		t.Fatalf("expected the hold to be released, got %+v, %v", manifest, err)
+	}
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+// runHook executes a configured shell hook. The operation, database, key and (for
+// post hooks) the outcome are exported as DBU_* variables.
+func (a *App) runHook(ctx context.Context, stage, opType, key string, opErr error) error {
+	command := a.hookCommand(stage, opType)
+	if command == "" {
+		return nil
+	}
+	env := map[string]string{
+		"DBU_HOOK":      stage,
+		"DBU_OPERATION": opType,
+		"DBU_DB_TYPE":   a.Cfg.Database.Type,
+		"DBU_DATABASE":  a.Cfg.Database.Database,
+		"DBU_KEY":       key,
+	}
+	if stage == "post" {
+		env["DBU_STATUS"] = statusFromErr(opErr)
+	}
+	output, err := util.Command(ctx, "sh", []string{"-c", command}, env).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%s-%s hook failed: %w: %s", stage, opType, err, msg)
+		}
+		return fmt.Errorf("%s-%s hook failed: %w", stage, opType, err)
+	}
+	a.Log.Debug().Str("hook", stage+"-"+opType).Msg("hook completed")
+	return nil
+}
+
+// postHook runs the post hook regardless of outcome; failures are logged, not returned.
+// It ignores ctx cancellation so writes are re-enabled even after a timeout.
+func (a *App) postHook(ctx context.Context, opType, key string, opErr error) {
+	if err := a.runHook(context.WithoutCancel(ctx), "post", opType, key, opErr); err != nil {
+		a.Log.Error().Err(err).Msg("post hook failed")
+	}
+}
+
+func (a *App) hookCommand(stage, opType string) string {
+	switch opType + "/" + stage {
+	case "backup/pre":
+		return a.Cfg.Backup.PreHook
+	case "backup/post":
+		return a.Cfg.Backup.PostHook
+	case "restore/pre":
+		return a.Cfg.Restore.PreHook
+	case "restore/post":
+		return a.Cfg.Restore.PostHook
+	}
+	return ""
+}
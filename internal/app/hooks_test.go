@@ -0,0 +1,94 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// hookApp returns an App backing up a stub database, its storage and logs, and
+// a scratch directory for hooks to write to.
+func hookApp(t *testing.T) (*App, *storage.Local, *bytes.Buffer, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	var logs bytes.Buffer
+	a := New(cfg, &stubAdapter{data: []byte("rows")}, store, zerolog.New(&logs), nil)
+	return a, store, &logs, dir
+}
+
+func TestPreHookFailureAbortsBackup(t *testing.T) {
+	ctx := context.Background()
+	a, store, _, dir := hookApp(t)
+	a.Cfg.Backup.PreHook = "echo writes still enabled >&2; exit 3"
+	a.Cfg.Backup.PostHook = `echo "$DBU_STATUS" > ` + filepath.Join(dir, "post")
+
+	_, err := a.Backup(ctx)
+	if err == nil || !strings.Contains(err.Error(), "pre-backup hook failed") || !strings.Contains(err.Error(), "writes still enabled") {
+		t.Fatalf("expected the pre hook's failure, got %v", err)
+	}
+	objects, err := store.List(ctx, "stub/appdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range objects {
+		if !storage.IsStatus(obj.Key) {
+			t.Fatalf("expected nothing to be backed up, found %s", obj.Key)
+		}
+	}
+	// The post hook still runs, to undo whatever the pre hook got done.
+	status, err := os.ReadFile(filepath.Join(dir, "post"))
+	if err != nil {
+		t.Fatalf("expected the post hook to run: %v", err)
+	}
+	if got := strings.TrimSpace(string(status)); got != "failed" {
+		t.Fatalf("post hook saw DBU_STATUS=%q, want failed", got)
+	}
+}
+
+func TestPostHookFailureIsReported(t *testing.T) {
+	a, _, logs, _ := hookApp(t)
+	a.Cfg.Backup.PostHook = "echo could not resume writes >&2; exit 1"
+	if _, err := a.Backup(context.Background()); err != nil {
+		t.Fatalf("a failing post hook must not fail the backup: %v", err)
+	}
+	if !strings.Contains(logs.String(), `"message":"post hook failed"`) || !strings.Contains(logs.String(), "could not resume writes") {
+		t.Fatalf("expected the post hook's failure to be logged, got:\n%s", logs.String())
+	}
+}
+
+func TestHookEnvironment(t *testing.T) {
+	a, _, _, dir := hookApp(t)
+	a.Cfg.Backup.PreHook = "env | grep -E '^DBU_(HOOK|OPERATION|DB_TYPE|DATABASE|KEY|STATUS)=' | sort > " + filepath.Join(dir, "pre.env")
+	a.Cfg.Backup.PostHook = "env | grep -E '^DBU_(HOOK|OPERATION|DB_TYPE|DATABASE|KEY|STATUS)=' | sort > " + filepath.Join(dir, "post.env")
+	res, err := a.Backup(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"pre":  "DBU_DATABASE=appdb\nDBU_DB_TYPE=stub\nDBU_HOOK=pre\nDBU_KEY=" + res.Key + "\nDBU_OPERATION=backup\n",
+		"post": "DBU_DATABASE=appdb\nDBU_DB_TYPE=stub\nDBU_HOOK=post\nDBU_KEY=" + res.Key + "\nDBU_OPERATION=backup\nDBU_STATUS=success\n",
+	}
+	for stage, env := range want {
+		got, err := os.ReadFile(filepath.Join(dir, stage+".env"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != env {
+			t.Errorf("%s hook environment:\n%s\nwant:\n%s", stage, got, env)
+		}
+	}
+}
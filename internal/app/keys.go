@@ -0,0 +1,61 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// keyDerivationDatabase derives each database's data key from the encryption key
+// (backup.key_derivation: database), so databases sharing one managed secret are
+// still encrypted under separate keys. Sidecars stay under the encryption key:
+// manifests must be readable before the derivation they record is known.
+const keyDerivationDatabase = "database"
+
+// keyDerivation returns how new backups derive their data key, or nil when they
+// use the encryption key as is.
+func (a *App) keyDerivation() (*storage.KeyDerivation, error) {
+	switch a.Cfg.Backup.KeyDerivation {
+	case "", "none":
+		return nil, nil
+	case keyDerivationDatabase:
+		return &storage.KeyDerivation{
+			Scheme: cryptoutil.KeyDerivationHKDF,
+			Info:   cryptoutil.DatabaseKeyInfo(a.Cfg.Database.Type, a.Cfg.Database.Database),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown backup.key_derivation %q (want database or none)", a.Cfg.Backup.KeyDerivation)
+	}
+}
+
+// dataKey parses encryptionKey and derives the data key from it as derivation
+// says, or returns it as is without one.
+func dataKey(encryptionKey string, derivation *storage.KeyDerivation) ([]byte, error) {
+	master, err := cryptoutil.ParseKey(encryptionKey)
+	if err != nil || derivation == nil {
+		return master, err
+	}
+	if derivation.Scheme != cryptoutil.KeyDerivationHKDF {
+		return nil, fmt.Errorf("unsupported key derivation %q", derivation.Scheme)
+	}
+	return cryptoutil.DeriveKey(master, derivation.Info)
+}
+
+// backupDataKey returns the key new backups are encrypted with.
+func (a *App) backupDataKey() ([]byte, error) {
+	derivation, err := a.keyDerivation()
+	if err != nil {
+		return nil, err
+	}
+	return dataKey(a.Cfg.Backup.EncryptionKey, derivation)
+}
+
+// storedDataKey returns the key a stored backup was encrypted with, as its
+// manifest records. Without a manifest it is assumed to follow the config.
+func (a *App) storedDataKey(manifest storage.Manifest, manifestErr error) ([]byte, error) {
+	if manifestErr != nil {
+		return a.backupDataKey()
+	}
+	return dataKey(a.Cfg.Backup.EncryptionKey, manifest.KeyDerivation)
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestDerivedDatabaseKeys(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	master := "hex:" + strings.Repeat("ab", 32)
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "zstd", Encryption: true, EncryptionKey: master, KeyDerivation: "database"}
+	dump := bytes.Repeat([]byte("row data\n"), 1000)
+	a := New(cfg, &stubAdapter{data: dump}, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+
+	masterBytes, err := cryptoutil.ParseKey(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	derived, err := cryptoutil.DeriveKey(masterBytes, cryptoutil.DatabaseKeyInfo("stub", "appdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(key string) []byte {
+		t.Helper()
+		manifest, manifestErr := a.readManifest(ctx, key)
+		r, err := a.openBackup(ctx, key, manifest, manifestErr)
+		if err != nil {
+			t.Fatalf("open %s: %v", key, err)
+		}
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("read %s: %v", key, err)
+		}
+		return data
+	}
+
+	var keys []string
+	for _, dedup := range []bool{false, true} {
+		cfg.Backup.Dedup = dedup
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+		res, err := a.Backup(ctx)
+		if err != nil {
+			t.Fatalf("backup (dedup %v): %v", dedup, err)
+		}
+		d := res.Manifest.KeyDerivation
+		if d == nil || d.Scheme != cryptoutil.KeyDerivationHKDF || d.Info != cryptoutil.DatabaseKeyInfo("stub", "appdb") {
+			t.Fatalf("manifest does not record the derivation: %+v", d)
+		}
+		if res.Manifest.KeyFingerprint != cryptoutil.Fingerprint(derived) {
+			t.Fatalf("fingerprint %s is not the derived key's", res.Manifest.KeyFingerprint)
+		}
+		keys = append(keys, res.Key)
+	}
+
+	// The manifest, not the config, says how to derive the key again.
+	cfg.Backup.KeyDerivation = ""
+	for _, key := range keys {
+		if !bytes.Equal(read(key), dump) {
+			t.Fatalf("%s does not round-trip", key)
+		}
+	}
+
+	cfg.Backup.KeyDerivation = "per-table"
+	if _, err := a.Backup(ctx); err == nil || !strings.Contains(err.Error(), "unknown backup.key_derivation") {
+		t.Fatalf("expected an unknown derivation to be refused, got %v", err)
+	}
+}
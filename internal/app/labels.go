@@ -0,0 +1,69 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// metaLabelPrefix prefixes a label's key in the object metadata of a backup.
+const metaLabelPrefix = "dbu-label-"
+
+// labelKeyPattern keeps label keys valid as object metadata names. S3 lowercases
+// metadata names, so upper case is rejected rather than silently changed.
+var labelKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,62}$`)
+
+// maxLabelValue bounds a label's value; S3 limits all user metadata to 2 KiB.
+const maxLabelValue = 256
+
+// CheckLabels rejects labels that cannot be stored as object metadata.
+func CheckLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid label key %q: use lower-case letters, digits, '.', '_' and '-'", key)
+		}
+		if len(value) > maxLabelValue {
+			return fmt.Errorf("label %s is longer than %d bytes", key, maxLabelValue)
+		}
+		if strings.ContainsFunc(value, func(r rune) bool { return r > unicode.MaxASCII || unicode.IsControl(r) }) {
+			return fmt.Errorf("label %s: value must be printable ASCII", key)
+		}
+	}
+	return nil
+}
+
+// backupMetadata is the object metadata of a backup's stored parts: the backup
+// marker and one entry per label. Labels are left to the manifest when sidecars
+// are encrypted, since object metadata is always readable.
+func (a *App) backupMetadata(labels map[string]string) map[string]string {
+	metadata := map[string]string{"dbu-backup": "true"}
+	if a.sealsSidecars() {
+		return metadata
+	}
+	for key, value := range labels {
+		metadata[metaLabelPrefix+key] = value
+	}
+	return metadata
+}
+
+// FormatLabels renders labels as key=value pairs sorted by key.
+func FormatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// MatchLabels reports whether labels has every key in want with the same value.
+func MatchLabels(labels, want map[string]string) bool {
+	for key, value := range want {
+		if got, ok := labels[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
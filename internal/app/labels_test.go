@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestBackupLabels(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{
+		Type: "full", Compression: "gzip",
+		Labels:          map[string]string{"reason": "pre-migration"},
+		RetentionPolicy: config.Retention{KeepLast: 1, KeepLabeled: true},
+	}
+	root := filepath.Join(dir, "backups")
+	store := storage.NewLocal(root)
+	a := New(cfg, &stubAdapter{data: []byte("rows")}, store, zerolog.Nop(), nil)
+
+	old := func(day int, labels map[string]string) string {
+		when := time.Date(2000, 1, day, 0, 0, 0, 0, time.UTC)
+		key := "stub/appdb/" + when.Format("20060102T150405Z") + "_full.backup.gz"
+		if err := store.Put(ctx, key, strings.NewReader("old"), 3, nil); err != nil {
+			t.Fatal(err)
+		}
+		m := storage.Manifest{Key: key, BackupType: "full", Compression: "gzip", Labels: labels}
+		if err := a.writeManifest(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(root, key), when, when); err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	labeled := old(1, map[string]string{"ticket": "ops-12"})
+	old(2, nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Manifest.Labels, cfg.Backup.Labels) {
+		t.Fatalf("manifest labels %v, want %v", res.Manifest.Labels, cfg.Backup.Labels)
+	}
+	keys, err := a.BackupKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	if want := []string{labeled, res.Key}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("backups %v, want %v (labeled backups kept, unlabeled pruned)", keys, want)
+	}
+
+	cfg.Backup.Labels = map[string]string{"Reason": "x"}
+	if _, err := a.Backup(ctx); err == nil || !strings.Contains(err.Error(), "invalid label key") {
+		t.Fatalf("expected invalid label key error, got %v", err)
+	}
+}
+
+func TestBackupMetadata(t *testing.T) {
+	a := &App{Cfg: &config.Config{}}
+	labels := map[string]string{"reason": "pre-migration"}
+	got := a.backupMetadata(labels)
+	want := map[string]string{"dbu-backup": "true", "dbu-label-reason": "pre-migration"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("metadata %v, want %v", got, want)
+	}
+	// Encrypted backups keep their labels out of the always-readable object metadata.
+	a.Cfg.Backup.Encryption = true
+	if got := a.backupMetadata(labels); !reflect.DeepEqual(got, map[string]string{"dbu-backup": "true"}) {
+		t.Fatalf("metadata with encryption %v", got)
+	}
+	if got := FormatLabels(map[string]string{"b": "2", "a": "1"}); got != "a=1,b=2" {
+		t.Fatalf("FormatLabels = %q", got)
+	}
+	if !MatchLabels(map[string]string{"a": "1", "b": "2"}, map[string]string{"a": "1"}) || MatchLabels(nil, map[string]string{"a": "1"}) {
+		t.Fatal("MatchLabels mismatch")
+	}
+	if err := CheckLabels(map[string]string{"note": "café"}); err == nil {
+		t.Fatal("expected non-ASCII value to be rejected")
+	}
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/lock"
+)
+
+// acquireLock takes the lock guarding operations on cfg's database. With
+// global.lock_scope: database only runs against the same database type and name
+// exclude each other; the default global scope lets a single run hold lock_file.
+func (a *App) acquireLock(cfg *config.Config) (*lock.Lock, error) {
+	path, err := a.prepareLockPath(cfg)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Global.LockScope {
+	case "", "global":
+		return lock.Acquire(path)
+	case "database":
+		return lock.AcquireScoped(path, cfg.Database.Type, cfg.Database.Database)
+	}
+	return nil, fmt.Errorf("unknown global.lock_scope %q: use global or database", cfg.Global.LockScope)
+}
+
+// prepareLockPath applies global.lock_dir_missing to lock_file: create (the
+// default) creates its directory, or falls back to the temp directory on a
+// read-only filesystem; fail stops with an error naming the directory.
+func (a *App) prepareLockPath(cfg *config.Config) (string, error) {
+	var create bool
+	switch cfg.Global.LockDirMissing {
+	case "", "create":
+		create = true
+	case "fail":
+	default:
+		return "", fmt.Errorf("unknown global.lock_dir_missing %q: use create or fail", cfg.Global.LockDirMissing)
+	}
+	path, fallback, err := lock.PreparePath(cfg.Global.LockFile, create)
+	if err != nil {
+		return "", err
+	}
+	if fallback {
+		a.Log.Warn().Str("lock_file", cfg.Global.LockFile).Str("fallback", path).Msg("lock file directory is not writable; locking in the temp directory instead")
+	}
+	return path, nil
+}
+
+// lockPath names the file acquireLock locks, for messages.
+func lockPath(cfg *config.Config) string {
+	if cfg.Global.LockScope == "database" {
+		return lock.ScopedPath(cfg.Global.LockFile, cfg.Database.Type, cfg.Database.Database)
+	}
+	return cfg.Global.LockFile
+}
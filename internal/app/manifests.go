@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// maxParallelManifestReads bounds concurrent manifest fetches in ListManifests.
+const maxParallelManifestReads = 8
+
+// BackupRecord pairs a backup in storage with its decoded manifest.
+type BackupRecord struct {
+	// Object is the logical backup; chunked backups are folded into one object
+	// whose size is the sum of Parts.
+	Object   storage.ObjectInfo
+	Parts    []string
+	Manifest storage.Manifest
+	// Err is set when the manifest is missing, unreadable or cannot be decoded;
+	// Manifest is then zero and only Object and Parts are known.
+	Err error
+}
+
+// ListManifests returns the backups under the configured prefix, newest first,
+// each with its manifest. A bad manifest only marks its own record.
+func (a *App) ListManifests(ctx context.Context) ([]BackupRecord, error) {
+	objects, err := a.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	manifests := map[string]bool{}
+	for _, obj := range objects {
+		if obj.IsManifest {
+			manifests[obj.Key] = true
+		}
+	}
+	backups := groupBackups(objects)
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Modified.After(backups[j].Modified) })
+
+	records := make([]BackupRecord, len(backups))
+	var eg errgroup.Group
+	eg.SetLimit(maxParallelManifestReads)
+	for i, b := range backups {
+		records[i] = BackupRecord{Object: b.ObjectInfo, Parts: b.Parts}
+		manifestKey := storage.ManifestKey(b.Key)
+		if !manifests[manifestKey] {
+			records[i].Err = fmt.Errorf("manifest %s not found", manifestKey)
+			continue
+		}
+		eg.Go(func() error {
+			manifest, err := a.readManifest(ctx, b.Key)
+			if err != nil {
+				records[i].Err = fmt.Errorf("read manifest %s: %w", manifestKey, err)
+				return nil
+			}
+			records[i].Manifest = manifest
+			return nil
+		})
+	}
+	_ = eg.Wait()
+	return records, ctx.Err()
+}
+
+// ResolveManifestID returns the key of the backup whose manifest ID is id. It
+// fails when no manifest, or more than one, has that ID.
+func (a *App) ResolveManifestID(ctx context.Context, id string) (string, error) {
+	records, err := a.ListManifests(ctx)
+	if err != nil {
+		return "", err
+	}
+	var keys []string
+	unreadable := 0
+	for _, rec := range records {
+		switch {
+		case rec.Err != nil:
+			unreadable++
+		case rec.Manifest.ID == id:
+			keys = append(keys, rec.Object.Key)
+		}
+	}
+	switch len(keys) {
+	case 1:
+		return keys[0], nil
+	case 0:
+		if unreadable > 0 {
+			return "", fmt.Errorf("no backup has manifest ID %q (%d of %d backups have no readable manifest; restore those with --key)", id, unreadable, len(records))
+		}
+		return "", fmt.Errorf("no backup has manifest ID %q", id)
+	}
+	return "", fmt.Errorf("manifest ID %q is ambiguous; it matches %s: restore one with --key", id, strings.Join(keys, ", "))
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestListManifests(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	a := New(cfg, &stubAdapter{data: []byte("rows")}, store, zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(key, body string) {
+		if err := store.Put(ctx, key, strings.NewReader(body), int64(len(body)), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("stub/appdb/20000101T000000Z_full.backup.gz", "old")
+	put("stub/appdb/20000102T000000Z_full.backup.gz", "corrupt")
+	put(storage.ManifestKey("stub/appdb/20000102T000000Z_full.backup.gz"), "{not json")
+
+	records, err := a.ListManifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %+v", records)
+	}
+	byKey := map[string]BackupRecord{}
+	for _, r := range records {
+		byKey[r.Object.Key] = r
+	}
+	if r := byKey[res.Key]; r.Err != nil || r.Manifest.BackupType != "full" || r.Manifest.Compression != "gzip" {
+		t.Fatalf("expected the decoded manifest, got %+v", r)
+	}
+	if r := byKey["stub/appdb/20000101T000000Z_full.backup.gz"]; r.Err == nil || !strings.Contains(r.Err.Error(), "not found") {
+		t.Fatalf("expected a missing-manifest error, got %+v", r)
+	}
+	if r := byKey["stub/appdb/20000102T000000Z_full.backup.gz"]; r.Err == nil || r.Object.Size != int64(len("corrupt")) {
+		t.Fatalf("expected a partial record with a decode error, got %+v", r)
+	}
+}
+
+func TestResolveManifestID(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	a := New(cfg, &stubAdapter{data: []byte("rows")}, store, zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := a.ResolveManifestID(ctx, res.Manifest.ID); err != nil || key != res.Key {
+		t.Fatalf("resolved %q, %v; want %s", key, err, res.Key)
+	}
+	if _, err := a.ResolveManifestID(ctx, "appdb-1"); err == nil || !strings.Contains(err.Error(), `no backup has manifest ID "appdb-1"`) {
+		t.Fatalf("expected a missing ID error, got %v", err)
+	}
+
+	// A copied manifest makes the ID ambiguous.
+	copied := "stub/appdb/20000101T000000Z_full.backup.gz"
+	if err := store.Copy(ctx, res.Key, copied); err != nil {
+		t.Fatal(err)
+	}
+	manifest := res.Manifest
+	manifest.Key = copied
+	if err := a.writeManifest(ctx, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ResolveManifestID(ctx, res.Manifest.ID); err == nil || !strings.Contains(err.Error(), "ambiguous") || !strings.Contains(err.Error(), copied) {
+		t.Fatalf("expected an ambiguous ID error, got %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// meterWriter counts the bytes written through it and the time spent in Write,
+// which includes any time the underlying writer blocks. A write that would take
+// the count past a non-zero limit fails with ErrBudgetExceeded.
+type meterWriter struct {
+	w       io.Writer
+	n       int64
+	elapsed time.Duration
+	limit   int64
+}
+
+func (m *meterWriter) Write(p []byte) (int, error) {
+	if m.limit > 0 && m.n+int64(len(p)) > m.limit {
+		return 0, fmt.Errorf("%w: more than %d bytes (backup.max_size_bytes)", ErrBudgetExceeded, m.limit)
+	}
+	start := time.Now()
+	n, err := m.w.Write(p)
+	m.elapsed += time.Since(start)
+	m.n += int64(n)
+	return n, err
+}
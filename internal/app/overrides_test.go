@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/audit"
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/lock"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func overrideApp(t *testing.T) (*App, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	return New(cfg, &stubAdapter{data: []byte("rows")}, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil), dir
+}
+
+func TestNoLockSkipsLock(t *testing.T) {
+	ctx := context.Background()
+	a, _ := overrideApp(t)
+	held, err := lock.Acquire(a.Cfg.Global.LockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+
+	if _, err := a.Backup(ctx); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("expected the held lock to stop the backup, got %v", err)
+	}
+	a.NoLock = true
+	if _, err := a.Backup(ctx); err != nil {
+		t.Fatalf("expected --no-lock to run despite the held lock: %v", err)
+	}
+}
+
+func TestOverridesAudited(t *testing.T) {
+	ctx := context.Background()
+	a, dir := overrideApp(t)
+	auditFile := filepath.Join(dir, "audit.log")
+	auditLog, err := audit.Open(config.AuditConfig{File: auditFile}, "oncall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+	a.Audit = auditLog
+	// A window that closed an hour ago and opens again in an hour.
+	now := time.Now().UTC()
+	a.Cfg.Schedule = config.ScheduleConfig{WindowStart: now.Add(time.Hour).Format("15:04"), WindowEnd: now.Add(-time.Hour).Format("15:04"), Timezone: "UTC"}
+
+	if _, err := a.Backup(ctx); !errors.Is(err, ErrWindowSkipped) {
+		t.Fatalf("expected the backup to be skipped outside the window, got %v", err)
+	}
+	a.Force, a.NoLock = true, true
+	if _, err := a.Backup(ctx); err != nil {
+		t.Fatalf("expected --force to run outside the window: %v", err)
+	}
+
+	data, err := os.ReadFile(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two audit entries, got:\n%s", data)
+	}
+	var skipped, forced audit.Entry
+	if err := json.Unmarshal([]byte(lines[0]), &skipped); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &forced); err != nil {
+		t.Fatal(err)
+	}
+	if skipped.Status != "skipped" || skipped.Overrides != nil {
+		t.Fatalf("unexpected entry for the skipped run: %+v", skipped)
+	}
+	if forced.Status != "success" || !reflect.DeepEqual(forced.Overrides, []string{"force", "no-lock"}) || forced.Actor != "oncall" {
+		t.Fatalf("expected both overrides to be audited: %+v", forced)
+	}
+}
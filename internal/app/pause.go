@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rowjay/db-backup-utility/internal/storage"
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+func (a *App) pauseKey() string {
+	return storage.PauseKey(util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database))
+}
+
+// Pause holds the database's backups until Resume, or until until when it is set:
+// each backup that starts meanwhile is skipped like one outside the backup window.
+// The pause lives in storage, so it holds on every host, and it does not take the
+// lock, so a backup already running finishes.
+func (a *App) Pause(ctx context.Context, reason string, until time.Time) (storage.Pause, error) {
+	start := time.Now()
+	var opErr error
+	defer func() { a.finish("pause", start, a.pauseKey(), opErr) }()
+
+	if !until.IsZero() && !until.After(start) {
+		opErr = fmt.Errorf("pause until %s is in the past", until.Format(time.RFC3339))
+		return storage.Pause{}, opErr
+	}
+	pause := storage.Pause{Reason: reason, Since: start.UTC()}
+	if !until.IsZero() {
+		pause.Until = until.UTC()
+	}
+	pause.Host, _ = os.Hostname()
+	payload, err := json.MarshalIndent(pause, "", "  ")
+	if err != nil {
+		opErr = err
+		return storage.Pause{}, err
+	}
+	if payload, err = a.sealSidecar(payload, a.Cfg.Backup.EncryptionKey); err != nil {
+		opErr = err
+		return storage.Pause{}, err
+	}
+	// Pausing again replaces the pause, so its reason and end are the latest ones.
+	if err := a.replaceObject(ctx, a.pauseKey(), payload, map[string]string{"dbu-pause": "true"}); err != nil {
+		opErr = fmt.Errorf("write pause: %w", err)
+		return storage.Pause{}, opErr
+	}
+	return pause, nil
+}
+
+// Resume lifts the database's pause and reports whether there was one, including
+// one that had already expired.
+func (a *App) Resume(ctx context.Context) (bool, error) {
+	start := time.Now()
+	var opErr error
+	defer func() { a.finish("resume", start, a.pauseKey(), opErr) }()
+
+	exists, err := a.Storage.Exists(ctx, a.pauseKey())
+	if err != nil {
+		opErr = err
+		return false, err
+	}
+	if !exists {
+		return false, nil
+	}
+	if err := a.Storage.Delete(ctx, a.pauseKey()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		opErr = fmt.Errorf("delete pause: %w", err)
+		return false, opErr
+	}
+	return true, nil
+}
+
+// ReadPause returns the database's pause and whether it holds backups now. An
+// expired pause is returned but does not hold them.
+func (a *App) ReadPause(ctx context.Context) (storage.Pause, bool, error) {
+	reader, err := a.Storage.Get(ctx, a.pauseKey())
+	if storage.IsNotFound(err) {
+		return storage.Pause{}, false, nil
+	}
+	if err != nil {
+		return storage.Pause{}, false, err
+	}
+	defer reader.Close()
+	payload, err := io.ReadAll(reader)
+	if err != nil {
+		return storage.Pause{}, false, err
+	}
+	if payload, err = a.openSidecar("pause "+a.pauseKey(), payload); err != nil {
+		return storage.Pause{}, false, err
+	}
+	var pause storage.Pause
+	if err := json.Unmarshal(payload, &pause); err != nil {
+		return storage.Pause{}, false, fmt.Errorf("decode pause %s: %w", a.pauseKey(), err)
+	}
+	return pause, pause.Active(time.Now()), nil
+}
+
+// checkPaused returns ErrPaused while the database's backups are paused. A pause
+// that cannot be read fails the backup rather than running through it; --force
+// runs anyway.
+func (a *App) checkPaused(ctx context.Context) error {
+	pause, paused, err := a.ReadPause(ctx)
+	if err != nil {
+		return fmt.Errorf("read pause: %w", err)
+	}
+	if !paused {
+		return nil
+	}
+	if a.Force {
+		a.Log.Warn().Str("reason", pause.Reason).Time("paused_since", pause.Since).Msg("running although backups are paused (--force)")
+		return nil
+	}
+	if pause.Reason != "" {
+		return fmt.Errorf("%w (%s)", ErrPaused, pause.Reason)
+	}
+	return ErrPaused
+}
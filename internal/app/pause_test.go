@@ -0,0 +1,94 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestPausedBackupsAreSkipped(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", Encryption: true, EncryptionKey: "hex:" + strings.Repeat("ab", 32)}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	a := New(cfg, &stubAdapter{data: bytes.Repeat([]byte("row data\n"), 100)}, store, zerolog.Nop(), nil)
+
+	if _, err := a.Pause(ctx, "schema migration", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Backup(ctx); !errors.Is(err, ErrPaused) || !strings.Contains(err.Error(), "schema migration") {
+		t.Fatalf("expected the backup to be skipped while paused, got %v", err)
+	}
+	if plan, err := a.PlanBackup(ctx); err != nil || !plan.Paused || plan.Forced {
+		t.Fatalf("plan should report the pause: %+v, %v", plan, err)
+	}
+	if status, err := a.Status(ctx); err != nil || len(status.Operations) != 0 {
+		t.Fatalf("a skipped backup should not be recorded: %+v, %v", status, err)
+	}
+	if keys, err := a.BackupKeys(ctx); err != nil || len(keys) != 0 {
+		t.Fatalf("the pause is not a backup: %v, %v", keys, err)
+	}
+
+	a.Force = true
+	if plan, err := a.PlanBackup(ctx); err != nil || !plan.Paused || !plan.Forced {
+		t.Fatalf("plan should report that --force overrides the pause: %+v, %v", plan, err)
+	}
+	if _, err := a.Backup(ctx); err != nil {
+		t.Fatalf("--force should run while paused: %v", err)
+	}
+	a.Force = false
+
+	if lifted, err := a.Resume(ctx); err != nil || !lifted {
+		t.Fatalf("resume: %v, %v", lifted, err)
+	}
+	if lifted, err := a.Resume(ctx); err != nil || lifted {
+		t.Fatalf("resuming twice should report nothing to lift: %v, %v", lifted, err)
+	}
+	if _, err := a.Pause(ctx, "", time.Now().Add(-time.Minute)); err == nil {
+		t.Fatal("expected a pause ending in the past to be refused")
+	}
+
+	// A pause that has run out no longer holds backups.
+	if _, err := a.Pause(ctx, "", time.Now().Add(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	if _, paused, err := a.ReadPause(ctx); err != nil || paused {
+		t.Fatalf("expired pause still holds: %v, %v", paused, err)
+	}
+	if _, err := a.Backup(ctx); err != nil {
+		t.Fatalf("backup after the pause expired: %v", err)
+	}
+}
+
+func TestRepauseOnImmutableStorage(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Storage.Local.Immutable = true
+	a := New(cfg, &stubAdapter{}, writeOnce{storage.NewLocal(filepath.Join(dir, "backups"))}, zerolog.Nop(), nil)
+
+	if _, err := a.Pause(ctx, "schema migration", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Pause(ctx, "index rebuild", time.Time{}); err != nil {
+		t.Fatalf("pause again: %v", err)
+	}
+	if pause, paused, err := a.ReadPause(ctx); err != nil || !paused || pause.Reason != "index rebuild" {
+		t.Fatalf("expected the second pause to replace the first, got %+v, %v, %v", pause, paused, err)
+	}
+}
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestDeclaredPipeline(t *testing.T) {
+	missing := errors.New("manifest not found")
+	cases := []struct {
+		name        string
+		key         string
+		manifest    storage.Manifest
+		manifestErr error
+		compression string
+		encrypted   bool
+		source      string
+	}{
+		{"manifest wins over the key", "stub/appdb/x.backup.gz.enc", storage.Manifest{Compression: "zstd"}, nil, "zstd", false, "manifest"},
+		{"missing manifest falls back to the key", "stub/appdb/x.backup.gz.enc", storage.Manifest{}, missing, "gzip", true, "object key"},
+		{"missing manifest and no extension", "stub/appdb/x", storage.Manifest{}, missing, "", false, streamSource},
+	}
+	for _, tc := range cases {
+		compression, encrypted, source := declaredPipeline(tc.key, tc.manifest, tc.manifestErr)
+		if compression != tc.compression || encrypted != tc.encrypted || source != tc.source {
+			t.Errorf("%s: got (%q, %v, %q), want (%q, %v, %q)", tc.name, compression, encrypted, source, tc.compression, tc.encrypted, tc.source)
+		}
+	}
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encrypted(t *testing.T, data, key []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := cryptoutil.EncryptWriter(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenBackupResolvesPipelineFromHeaders(t *testing.T) {
+	dump := []byte("CREATE TABLE users (id int);\n")
+	encryptionKey := "hex:" + strings.Repeat("ab", 32)
+	keyBytes, err := cryptoutil.ParseKey(encryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Plaintext whose first bytes are a DARE 2.0 AES-GCM header.
+	lookalike := append([]byte{0x20, 0x00, 0x10, 0x00}, dump...)
+	notFound := errors.New("manifest not found")
+
+	cases := []struct {
+		name        string
+		key         string
+		stored      []byte
+		manifest    storage.Manifest
+		manifestErr error
+		configKey   string
+		want        []byte
+		format      Format
+	}{
+		{
+			name:     "manifest says plaintext, object is encrypted",
+			key:      "stub/appdb/a.backup.gz",
+			stored:   encrypted(t, gzipped(t, dump), keyBytes),
+			manifest: storage.Manifest{Compression: "gzip"}, configKey: encryptionKey,
+			want: dump, format: Format{Compression: "gzip", Encrypted: true},
+		},
+		{
+			name:     "manifest and stream disagree on compression",
+			key:      "stub/appdb/c.backup.zst",
+			stored:   gzipped(t, dump),
+			manifest: storage.Manifest{Compression: "zstd"},
+			want:     dump, format: Format{Compression: "gzip"},
+		},
+		{
+			name:   "missing manifest",
+			key:    "stub/appdb/d.backup.gz.enc",
+			stored: encrypted(t, gzipped(t, dump), keyBytes), manifestErr: notFound, configKey: encryptionKey,
+			want: dump, format: Format{Compression: "gzip", Encrypted: true},
+		},
+		{
+			name:     "plaintext that looks encrypted, with a key to check it",
+			key:      "stub/appdb/e.backup",
+			stored:   lookalike,
+			manifest: storage.Manifest{Compression: "none"}, configKey: encryptionKey,
+			want: lookalike, format: Format{Compression: "none"},
+		},
+		{
+			name:     "plaintext that looks encrypted, without a key",
+			key:      "stub/appdb/f.backup",
+			stored:   lookalike,
+			manifest: storage.Manifest{Compression: "none"},
+			want:     lookalike, format: Format{Compression: "none"},
+		},
+	}
+	for _, tc := range cases {
+		ctx := context.Background()
+		cfg := &config.Config{}
+		cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+		cfg.Backup.EncryptionKey = tc.configKey
+		store := storage.NewLocal(filepath.Join(t.TempDir(), "backups"))
+		if err := store.Put(ctx, tc.key, bytes.NewReader(tc.stored), int64(len(tc.stored)), nil); err != nil {
+			t.Fatal(err)
+		}
+		a := New(cfg, nil, store, zerolog.Nop(), nil)
+		tc.manifest.Key = tc.key
+
+		reader, err := a.openBackup(ctx, tc.key, tc.manifest, tc.manifestErr)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !bytes.Equal(got, tc.want) {
+			t.Fatalf("%s: decoded %q, want %q", tc.name, got, tc.want)
+		}
+		if format := reader.(readCloser).format; format != tc.format {
+			t.Fatalf("%s: format %+v, want %+v", tc.name, format, tc.format)
+		}
+	}
+}
+
+func TestOpenBackupRefusesPlaintextDeclaredEncrypted(t *testing.T) {
+	dump := gzipped(t, []byte("DROP TABLE users;\n"))
+	binding := &storage.EncryptionBinding{DatabaseType: "stub", Database: "appdb", Name: "b.backup.gz"}
+	cases := []struct {
+		name        string
+		key         string
+		manifest    storage.Manifest
+		manifestErr error
+	}{
+		{"manifest says encrypted", "stub/appdb/a.backup.gz", storage.Manifest{Compression: "gzip", Encryption: true}, nil},
+		{"manifest records a binding", "stub/appdb/b.backup.gz", storage.Manifest{Compression: "gzip", EncryptionBinding: binding}, nil},
+		{"key says encrypted", "stub/appdb/c.backup.gz.enc", storage.Manifest{}, errors.New("manifest not found")},
+	}
+	for _, tc := range cases {
+		ctx := context.Background()
+		cfg := &config.Config{}
+		cfg.Backup.EncryptionKey = "hex:" + strings.Repeat("ab", 32)
+		store := storage.NewLocal(filepath.Join(t.TempDir(), "backups"))
+		if err := store.Put(ctx, tc.key, bytes.NewReader(dump), int64(len(dump)), nil); err != nil {
+			t.Fatal(err)
+		}
+		a := New(cfg, nil, store, zerolog.Nop(), nil)
+		tc.manifest.Key = tc.key
+		reader, err := a.openBackup(ctx, tc.key, tc.manifest, tc.manifestErr)
+		if err == nil {
+			reader.Close()
+			t.Fatalf("%s: expected plaintext to be refused", tc.name)
+		}
+		if !strings.Contains(err.Error(), "has no encryption header") {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"io"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// restoreLogInterval is how often a running restore logs its progress.
+var restoreLogInterval = 30 * time.Second
+
+// restoreTickInterval is how often OnRestoreProgress is called.
+var restoreTickInterval = time.Second
+
+// RestoreProgress reports how much of the stored backup a restore has read.
+type RestoreProgress struct {
+	Key     string
+	Read    int64 // stored bytes read so far; dump bytes for deduplicated backups
+	Total   int64 // stored (or dump) size of the backup; 0 when unknown
+	Elapsed time.Duration
+	ETA     time.Duration // 0 until both the rate and the total are known
+	Done    bool          // the last report for Key
+}
+
+// Percent returns how far through the backup the restore is, or -1 when the
+// total is unknown.
+func (p RestoreProgress) Percent() float64 {
+	if p.Total <= 0 {
+		return -1
+	}
+	return min(100, float64(p.Read)*100/float64(p.Total))
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// storedSize returns the stored size of the backup at key: the object's own size
+// when it is a single object, otherwise the size recorded in the manifest.
+func (a *App) storedSize(ctx context.Context, key string, manifest storage.Manifest) int64 {
+	if len(manifest.Chunks) == 0 {
+		if info, err := a.Storage.Stat(ctx, key); err == nil {
+			return info.Size
+		}
+	}
+	return manifest.SizeBytes
+}
+
+// trackRestore counts the stored bytes read from reader, logging the restore's
+// progress every restoreLogInterval and passing it to OnRestoreProgress every
+// restoreTickInterval, until the returned stop is called. The rate, and with it
+// the ETA, is that of the whole pipeline, since the restore tool drains it.
+func (a *App) trackRestore(key string, reader io.ReadCloser, total int64) (io.ReadCloser, func()) {
+	counter := &countingReader{ReadCloser: reader}
+	start := time.Now()
+	snapshot := func(done bool) RestoreProgress {
+		p := RestoreProgress{Key: key, Read: counter.n.Load(), Total: total, Elapsed: time.Since(start), Done: done}
+		if p.Total > p.Read && p.Read > 0 {
+			rate := float64(p.Read) / p.Elapsed.Seconds()
+			p.ETA = time.Duration(float64(p.Total-p.Read) / rate * float64(time.Second))
+		}
+		return p
+	}
+
+	ticker := time.NewTicker(restoreTickInterval)
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		lastLog := start
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				p := snapshot(false)
+				if a.OnRestoreProgress != nil {
+					a.OnRestoreProgress(p)
+				}
+				if now.Sub(lastLog) >= restoreLogInterval {
+					lastLog = now
+					event := a.Log.Info().Str("key", key).Int64("read_bytes", p.Read)
+					if p.Total > 0 {
+						event = event.Int64("total_bytes", p.Total).Float64("percent", math.Round(p.Percent()*10)/10)
+					}
+					if p.ETA > 0 {
+						event = event.Str("eta", p.ETA.Round(time.Second).String())
+					}
+					event.Msg("restore progress")
+				}
+			}
+		}
+	}()
+	return counter, func() {
+		ticker.Stop()
+		close(stop)
+		<-finished
+		if a.OnRestoreProgress != nil {
+			a.OnRestoreProgress(snapshot(true))
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestRestoreProgress(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "mem", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	adapter := &memAdapter{dbs: map[string]map[string]string{"appdb": {"users": "ada,grace"}}}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	a := New(cfg, adapter, store, zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reports []RestoreProgress
+	a.OnRestoreProgress = func(p RestoreProgress) { reports = append(reports, p) }
+	cfg.Restore.DropExisting = true
+	if err := a.Restore(ctx, res.Key); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) == 0 {
+		t.Fatal("expected progress reports")
+	}
+	last := reports[len(reports)-1]
+	if !last.Done || last.Key != res.Key || last.Total != res.Manifest.SizeBytes || last.Read != last.Total || last.Percent() != 100 {
+		t.Fatalf("unexpected final report %+v", last)
+	}
+
+	if (RestoreProgress{Read: 50, Total: 200}).Percent() != 25 || (RestoreProgress{Read: 50}).Percent() != -1 {
+		t.Fatalf("unexpected percentages")
+	}
+}
@@ -0,0 +1,318 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+	"github.com/rowjay/db-backup-utility/internal/version"
+)
+
+// Reencrypt rewrites the backup at key under newKey without decompressing it. The
+// result is staged and verified against the original plaintext before it replaces
+// dstKey (which defaults to key).
+func (a *App) Reencrypt(ctx context.Context, key, newKey, dstKey string) (storage.Manifest, error) {
+	start := time.Now()
+	var opErr error
+	if dstKey == "" {
+		dstKey = key
+	}
+	defer func() { a.finish("reencrypt", start, dstKey, opErr) }()
+
+	guard, err := a.acquireLock(a.Cfg)
+	if err != nil {
+		opErr = err
+		return storage.Manifest{}, err
+	}
+	defer guard.Release()
+
+	manifest, _, err := a.rewriteManifest(ctx, key)
+	if err != nil {
+		opErr = err
+		return storage.Manifest{}, err
+	}
+	encrypted := manifest.Encryption
+	if len(manifest.DedupChunks) > 0 {
+		// Its chunks are shared with other backups under the old key.
+		opErr = fmt.Errorf("backup %s is deduplicated; re-encrypting deduplicated backups is not supported", key)
+		return storage.Manifest{}, opErr
+	}
+	if !encrypted {
+		opErr = fmt.Errorf("backup %s is not encrypted", key)
+		return storage.Manifest{}, opErr
+	}
+	if a.Cfg.Backup.EncryptionKey == "" {
+		opErr = fmt.Errorf("encryption key is required to re-encrypt backup")
+		return storage.Manifest{}, opErr
+	}
+	oldBytes, err := dataKey(a.Cfg.Backup.EncryptionKey, manifest.KeyDerivation)
+	if err != nil {
+		opErr = err
+		return storage.Manifest{}, err
+	}
+	// The new data key is derived the same way as the old one.
+	newBytes, err := dataKey(newKey, manifest.KeyDerivation)
+	if err != nil {
+		opErr = fmt.Errorf("new encryption key: %w", err)
+		return storage.Manifest{}, opErr
+	}
+	if manifest.KeyFingerprint != "" && manifest.KeyFingerprint != cryptoutil.Fingerprint(oldBytes) {
+		opErr = fmt.Errorf("encryption key does not match backup %s (key fingerprint %s)", key, manifest.KeyFingerprint)
+		return storage.Manifest{}, opErr
+	}
+
+	// The result is bound to where it ends up, not where it came from.
+	var binding *storage.EncryptionBinding
+	if b, ok := storage.BindingFor(dstKey); ok {
+		binding = &b
+	}
+	newStream, err := bindKey(newBytes, binding)
+	if err != nil {
+		opErr = err
+		return storage.Manifest{}, err
+	}
+
+	srcParts := []string{key}
+	if len(manifest.Chunks) > 0 {
+		srcParts = manifest.Chunks
+	}
+	staging := dstKey + ".reencrypt"
+	staged, sum, err := a.stageReencrypted(ctx, key, manifest, srcParts, staging, oldBytes, newStream, a.backupMetadata(manifest.Labels))
+	if err != nil {
+		a.deleteParts(ctx, staged)
+		opErr = err
+		return storage.Manifest{}, err
+	}
+	storedSum, err := a.verifyEncrypted(ctx, staged, newStream, sum)
+	if err != nil {
+		a.deleteParts(ctx, staged)
+		opErr = err
+		return storage.Manifest{}, err
+	}
+
+	final := []string{dstKey}
+	if a.Cfg.Backup.ChunkSize > 0 {
+		final = make([]string, len(staged))
+		for i := range staged {
+			final[i] = storage.ChunkKey(dstKey, i)
+		}
+	}
+	manifest.Key = dstKey
+	manifest.Encryption = true
+	manifest.Cipher, _ = cryptoutil.DefaultCipher()
+	manifest.KeyFingerprint = cryptoutil.Fingerprint(newBytes)
+	manifest.EncryptionBinding = binding
+	manifest.SHA256 = hex.EncodeToString(storedSum)
+
+	if dstKey == key {
+		// The manifest moves to the staged copy before the originals go, so it always
+		// points at a complete copy, and the originals' keys are free again before
+		// the copy is promoted to them, as immutable local storage needs.
+		if err := a.swapReencrypted(ctx, manifest, srcParts, staged, newKey); err != nil {
+			opErr = err
+			return storage.Manifest{}, err
+		}
+	}
+	size, err := a.promote(ctx, staged, final)
+	if err != nil {
+		a.deleteParts(ctx, final)
+		opErr = err
+		if dstKey == key {
+			opErr = fmt.Errorf("%w; the re-encrypted backup is kept at %s, which its manifest points to", err, strings.Join(staged, ", "))
+		} else {
+			a.deleteParts(ctx, staged)
+		}
+		return storage.Manifest{}, opErr
+	}
+	manifest.SizeBytes = size
+	manifest.Chunks = nil
+	if a.Cfg.Backup.ChunkSize > 0 {
+		manifest.Chunks = final
+	}
+	if err := a.replaceManifest(ctx, manifest, newKey); err != nil {
+		opErr = fmt.Errorf("write manifest: %w", err)
+		return storage.Manifest{}, opErr
+	}
+	a.deleteParts(ctx, staged)
+	return manifest, nil
+}
+
+// swapReencrypted points the manifest of the backup being rewritten in place at
+// its staged parts and then deletes the original parts, which nothing refers to
+// any more.
+func (a *App) swapReencrypted(ctx context.Context, manifest storage.Manifest, originals, staged []string, encryptionKey string) error {
+	size, err := a.statChunks(ctx, staged)
+	if err != nil {
+		return err
+	}
+	manifest.SizeBytes = size
+	manifest.Chunks = staged
+	if err := a.replaceManifest(ctx, manifest, encryptionKey); err != nil {
+		a.deleteParts(ctx, staged)
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	for _, part := range originals {
+		if err := a.Storage.Delete(ctx, part); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("delete %s: %w; the re-encrypted backup is kept at %s, which its manifest points to", part, err, strings.Join(staged, ", "))
+		}
+	}
+	return nil
+}
+
+// replaceManifest writes manifest over the one stored for its backup.
+func (a *App) replaceManifest(ctx context.Context, manifest storage.Manifest, encryptionKey string) error {
+	payload, err := a.sealManifest(manifest, encryptionKey)
+	if err != nil {
+		return err
+	}
+	return a.replaceObject(ctx, storage.ManifestKey(manifest.Key), payload, map[string]string{"dbu-manifest": "true"})
+}
+
+// promote copies the staged parts to their final keys and returns the stored size,
+// failing unless every copy matches its source in size.
+func (a *App) promote(ctx context.Context, staged, final []string) (int64, error) {
+	for i, part := range staged {
+		if err := a.Storage.Copy(ctx, part, final[i]); err != nil {
+			return 0, fmt.Errorf("promote %s: %w", part, err)
+		}
+	}
+	want, err := a.statChunks(ctx, staged)
+	if err != nil {
+		return 0, err
+	}
+	size, err := a.statChunks(ctx, final)
+	if err != nil {
+		return 0, err
+	}
+	if size != want {
+		return 0, fmt.Errorf("promote %s: stored %d bytes, staged %d", final[0], size, want)
+	}
+	return size, nil
+}
+
+// rewriteManifest returns the manifest of the backup at key for a command that
+// rewrites the backup. A backup without one gets a manifest inferred from its key,
+// returned with the read error; a manifest that exists but cannot be read fails.
+func (a *App) rewriteManifest(ctx context.Context, key string) (storage.Manifest, error, error) {
+	manifest, manifestErr := a.readManifest(ctx, key)
+	if manifestErr == nil {
+		return manifest, nil, nil
+	}
+	if exists, err := a.Storage.Exists(ctx, storage.ManifestKey(key)); err == nil && exists {
+		return storage.Manifest{}, manifestErr, fmt.Errorf("read manifest: %w", manifestErr)
+	}
+	a.Log.Warn().Err(manifestErr).Str("key", key).Msg("manifest unavailable; inferring pipeline from object key")
+	compression, encrypted, _ := parseExtension(key)
+	manifest = storage.Manifest{
+		SchemaVersion: storage.ManifestSchemaVersion,
+		Key:           key,
+		DatabaseType:  a.Cfg.Database.Type,
+		Database:      a.Cfg.Database.Database,
+		Compression:   compression,
+		Encryption:    encrypted,
+		CreatedAt:     time.Now().UTC(),
+		ToolVersion:   version.Version,
+	}
+	// Assumed to follow the config, as storedDataKey does.
+	var err error
+	if manifest.KeyDerivation, err = a.keyDerivation(); err != nil {
+		return storage.Manifest{}, manifestErr, err
+	}
+	return manifest, manifestErr, nil
+}
+
+// stageReencrypted streams the backup at key through decrypt(old) and
+// encrypt(new) into staging and returns the stored parts with a digest of the
+// plaintext. newKey is the stream key itself; oldKey is bound as streamKey finds.
+func (a *App) stageReencrypted(ctx context.Context, key string, manifest storage.Manifest, srcParts []string, staging string, oldKey, newKey []byte, metadata map[string]string) ([]string, []byte, error) {
+	src := &chunkReader{ctx: ctx, store: a.Storage, keys: srcParts}
+	defer src.Close()
+	buffered := bufio.NewReaderSize(src, cryptoutil.MaxPackageLen)
+	oldKey, err := a.streamKey(key, manifest, buffered, oldKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	plain, err := cryptoutil.DecryptReader(buffered, oldKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	digest := sha256.New()
+
+	pipeReader, pipeWriter := io.Pipe()
+	eg, egCtx := errgroup.WithContext(ctx)
+	var staged []string
+	eg.Go(func() error {
+		defer pipeReader.Close()
+		if a.Cfg.Backup.ChunkSize > 0 {
+			var err error
+			staged, err = a.putChunks(egCtx, staging, pipeReader, a.Cfg.Backup.ChunkSize, metadata)
+			return err
+		}
+		staged = []string{staging}
+		return a.Storage.Put(egCtx, staging, pipeReader, -1, metadata)
+	})
+	eg.Go(func() error {
+		encWriter, err := cryptoutil.EncryptWriter(pipeWriter, newKey)
+		if err != nil {
+			_ = pipeWriter.CloseWithError(err)
+			return err
+		}
+		if _, err := io.Copy(encWriter, io.TeeReader(plain, digest)); err != nil {
+			_ = pipeWriter.CloseWithError(err)
+			return fmt.Errorf("decrypt with current key: %w", err)
+		}
+		if err := encWriter.Close(); err != nil {
+			_ = pipeWriter.CloseWithError(err)
+			return err
+		}
+		return pipeWriter.Close()
+	})
+	if err := eg.Wait(); err != nil {
+		return staged, nil, err
+	}
+	return staged, digest.Sum(nil), nil
+}
+
+// verifyEncrypted decrypts the staged parts with key and compares the plaintext
+// digest. It returns the digest of the stored bytes.
+func (a *App) verifyEncrypted(ctx context.Context, parts []string, key, want []byte) ([]byte, error) {
+	src := &chunkReader{ctx: ctx, store: a.Storage, keys: parts}
+	defer src.Close()
+	stored := sha256.New()
+	plain, err := cryptoutil.DecryptReader(io.TeeReader(src, stored), key)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.New()
+	if _, err := io.Copy(digest, plain); err != nil {
+		return nil, fmt.Errorf("verify re-encrypted backup: %w", err)
+	}
+	if !bytes.Equal(digest.Sum(nil), want) {
+		return nil, fmt.Errorf("verify re-encrypted backup: plaintext digest mismatch")
+	}
+	// Hash any bytes the decrypter left unread so the digest covers the whole object.
+	if _, err := io.Copy(stored, src); err != nil {
+		return nil, err
+	}
+	return stored.Sum(nil), nil
+}
+
+func (a *App) deleteParts(ctx context.Context, parts []string) {
+	for _, part := range parts {
+		if err := a.Storage.Delete(context.WithoutCancel(ctx), part); err != nil && !errors.Is(err, os.ErrNotExist) {
+			a.Log.Warn().Err(err).Str("key", part).Msg("failed to delete incomplete object")
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// failingCopy refuses to copy objects, like a promote cut off by the network.
+type failingCopy struct {
+	storage.Storage
+}
+
+func (failingCopy) Copy(context.Context, string, string) error {
+	return errors.New("connection reset")
+}
+
+func reencryptApp(t *testing.T, chunkSize int64) (*App, *config.Config, *storage.Local) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", Encryption: true, EncryptionKey: "hex:" + strings.Repeat("ab", 32), ChunkSize: chunkSize}
+	local := storage.NewLocal(filepath.Join(dir, "backups"))
+	return New(cfg, &stubAdapter{data: tenantDump(1)}, local, zerolog.Nop(), nil), cfg, local
+}
+
+func restoredDump(t *testing.T, a *App, key string) []byte {
+	t.Helper()
+	ctx := context.Background()
+	manifest, err := a.readManifest(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := a.openBackup(ctx, key, manifest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestReencryptInPlace(t *testing.T) {
+	for _, chunkSize := range []int64{0, 64} {
+		ctx := context.Background()
+		a, cfg, local := reencryptApp(t, chunkSize)
+		res, err := a.Backup(ctx)
+		if err != nil {
+			t.Fatalf("chunk size %d: backup: %v", chunkSize, err)
+		}
+
+		newKey := "hex:" + strings.Repeat("cd", 32)
+		manifest, err := a.Reencrypt(ctx, res.Key, newKey, "")
+		if err != nil {
+			t.Fatalf("chunk size %d: reencrypt: %v", chunkSize, err)
+		}
+		newBytes, _ := dataKey(newKey, manifest.KeyDerivation)
+		if manifest.Key != res.Key || manifest.KeyFingerprint != cryptoutil.Fingerprint(newBytes) {
+			t.Fatalf("chunk size %d: unexpected manifest %+v", chunkSize, manifest)
+		}
+		if chunkSize > 0 && len(manifest.Chunks) < 2 {
+			t.Fatalf("chunk size %d: expected the result to stay chunked, got %v", chunkSize, manifest.Chunks)
+		}
+		objects, err := local.List(ctx, "stub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, obj := range objects {
+			if strings.Contains(obj.Key, ".reencrypt") {
+				t.Fatalf("chunk size %d: staged part %s left behind", chunkSize, obj.Key)
+			}
+		}
+		cfg.Backup.EncryptionKey = newKey
+		if got := restoredDump(t, a, res.Key); !bytes.Equal(got, tenantDump(1)) {
+			t.Fatalf("chunk size %d: re-encrypted backup does not restore the dump", chunkSize)
+		}
+	}
+}
+
+func TestReencryptFailedPromoteKeepsBackup(t *testing.T) {
+	for _, chunkSize := range []int64{0, 64} {
+		ctx := context.Background()
+		a, cfg, local := reencryptApp(t, chunkSize)
+		res, err := a.Backup(ctx)
+		if err != nil {
+			t.Fatalf("chunk size %d: backup: %v", chunkSize, err)
+		}
+
+		a.Storage = failingCopy{Storage: local}
+		newKey := "hex:" + strings.Repeat("cd", 32)
+		if _, err := a.Reencrypt(ctx, res.Key, newKey, ""); err == nil || !strings.Contains(err.Error(), "kept at") {
+			t.Fatalf("chunk size %d: expected the promote to fail, got %v", chunkSize, err)
+		}
+
+		// The manifest points at the staged copy, which restores under the new key.
+		a.Storage = local
+		cfg.Backup.EncryptionKey = newKey
+		manifest, err := a.readManifest(ctx, res.Key)
+		if err != nil {
+			t.Fatalf("chunk size %d: read manifest: %v", chunkSize, err)
+		}
+		for _, part := range manifest.Chunks {
+			if !strings.Contains(part, ".reencrypt") {
+				t.Fatalf("chunk size %d: manifest points at %v, want the staged parts", chunkSize, manifest.Chunks)
+			}
+		}
+		if got := restoredDump(t, a, res.Key); !bytes.Equal(got, tenantDump(1)) {
+			t.Fatalf("chunk size %d: staged backup does not restore the dump", chunkSize)
+		}
+	}
+}
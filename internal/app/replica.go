@@ -0,0 +1,47 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+)
+
+// readSource returns the connection dumps are read from: database.read_host and
+// read_port when set, otherwise the database itself. Only the connection moves;
+// the database name, and with it keys and manifests, stay the primary's. A replica
+// is reached over TCP, never through the primary's socket.
+func (a *App) readSource() (config.DatabaseConfig, bool) {
+	source := a.Cfg.Database
+	if source.ReadHost == "" {
+		return source, false
+	}
+	source.Host = source.ReadHost
+	source.Socket = ""
+	if source.ReadPort != 0 {
+		source.Port = source.ReadPort
+	}
+	return source, true
+}
+
+// replicaAddr names the read replica in messages and manifests.
+func replicaAddr(source config.DatabaseConfig) string {
+	if source.Port == 0 {
+		return source.Host
+	}
+	return net.JoinHostPort(source.Host, strconv.Itoa(source.Port))
+}
+
+// replicaError explains a dump that failed on a read replica, where the usual
+// cause is replication rather than the data.
+func replicaError(source config.DatabaseConfig, err error) error {
+	if err == nil {
+		return nil
+	}
+	hint := "check that the replica is reachable and replicating"
+	if source.Type == "postgres" {
+		hint = "a hot standby cancels queries that conflict with WAL replay; raise max_standby_streaming_delay or enable hot_standby_feedback on the replica"
+	}
+	return fmt.Errorf("dump from read replica %s (%s): %w", replicaAddr(source), hint, err)
+}
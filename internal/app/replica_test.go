@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/db"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// hostRecorder notes which host each connection went to.
+type hostRecorder struct {
+	stubAdapter
+	validated, dumped []string
+}
+
+func (h *hostRecorder) Validate(ctx context.Context, cfg config.DatabaseConfig) error {
+	h.validated = append(h.validated, replicaAddr(cfg))
+	return h.stubAdapter.Validate(ctx, cfg)
+}
+
+func (h *hostRecorder) Dump(ctx context.Context, cfg config.DatabaseConfig, backup config.BackupConfig) (*db.DumpStream, error) {
+	h.dumped = append(h.dumped, replicaAddr(cfg))
+	return h.stubAdapter.Dump(ctx, cfg, backup)
+}
+
+func TestBackupFromReadReplica(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "postgres", Host: "primary", Port: 5432, ReadHost: "replica", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	adapter := &hostRecorder{stubAdapter: stubAdapter{data: []byte("rows")}}
+	a := New(cfg, adapter, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(adapter.dumped) != 1 || adapter.dumped[0] != "replica:5432" {
+		t.Fatalf("dumped from %v, want the replica on the primary's port", adapter.dumped)
+	}
+	if !strings.HasPrefix(res.Key, "postgres/appdb/") || res.Manifest.Database != "appdb" || res.Manifest.ReadReplica != "replica:5432" {
+		t.Fatalf("unexpected backup %s, manifest %+v", res.Key, res.Manifest)
+	}
+
+	adapter.validated = nil
+	cfg.Database.ReadPort = 5433
+	if err := a.Validate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(adapter.validated, ",") != "primary:5432,replica:5433" {
+		t.Fatalf("validated %v, want primary and replica", adapter.validated)
+	}
+
+	adapter.waitErr = errors.New("canceling statement due to conflict with recovery")
+	_, err = a.Backup(ctx)
+	if !errors.Is(err, ErrDump) || !strings.Contains(err.Error(), "read replica replica:5433") || !strings.Contains(err.Error(), "hot_standby_feedback") {
+		t.Fatalf("expected a dump error naming the replica, got %v", err)
+	}
+}
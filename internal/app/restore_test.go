@@ -0,0 +1,360 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/compress"
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+	"github.com/rowjay/db-backup-utility/internal/db"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestRestoreIgnoresConfigCompression(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "mem", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	adapter := &memAdapter{dbs: map[string]map[string]string{"appdb": {"users": "ada,grace"}}}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	a := New(cfg, adapter, store, zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The config moved to zstd since the backup was taken.
+	cfg.Backup.Compression = "zstd"
+	cfg.Restore.DropExisting = true
+	restore := func(key string) {
+		t.Helper()
+		adapter.dbs["appdb"] = map[string]string{}
+		if err := a.Restore(ctx, key); err != nil {
+			t.Fatalf("restore %s: %v", key, err)
+		}
+		if adapter.dbs["appdb"]["users"] != "ada,grace" {
+			t.Fatalf("restore %s got %v", key, adapter.dbs["appdb"])
+		}
+	}
+	restore(res.Key)
+
+	// Without a manifest, the key names the codec.
+	if err := store.Delete(ctx, storage.ManifestKey(res.Key)); err != nil {
+		t.Fatal(err)
+	}
+	restore(res.Key)
+
+	// With neither, the stream header does; the config is never used.
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(map[string]string{"users": "ada,grace"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	plain := []byte(`{"users":"ada,grace"}`)
+	for key, data := range map[string][]byte{"mem/appdb/imported.gz": buf.Bytes(), "mem/appdb/imported.json": plain} {
+		if err := store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), nil); err != nil {
+			t.Fatal(err)
+		}
+		restore(key)
+	}
+}
+
+// schemaLister dumps schema.table lines and lists them as tables of their schema.
+type schemaLister struct {
+	stubAdapter
+}
+
+func (s *schemaLister) Capabilities() db.Capabilities { return db.Capabilities{Schemas: true} }
+
+func (s *schemaLister) ListContents(ctx context.Context, r io.Reader) ([]db.DumpObject, error) {
+	data, err := io.ReadAll(r)
+	var objects []db.DumpObject
+	for _, line := range strings.Fields(string(data)) {
+		schema, name, _ := strings.Cut(line, ".")
+		objects = append(objects, db.DumpObject{Kind: "TABLE", Schema: schema, Name: name})
+	}
+	return objects, err
+}
+
+func TestRestoreChecksSchemas(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "postgres", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", Schemas: []string{"tenant_*"}, ExcludeSchemas: []string{"tenant_test"}}
+	adapter := &schemaLister{stubAdapter{data: []byte("tenant_a.users\ntenant_b.users\n")}}
+	a := New(cfg, adapter, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(res.Manifest.Schemas, []string{"tenant_*"}) || !slices.Equal(res.Manifest.ExcludeSchemas, []string{"tenant_test"}) {
+		t.Fatalf("schemas not recorded in the manifest: %+v", res.Manifest)
+	}
+
+	for _, tc := range []struct{ schema, want string }{
+		{"tenant_test", "schema tenant_test was excluded from backup"},
+		{"tenant_c", "schema tenant_c not found in backup " + res.Key + ", which holds schemas tenant_*"},
+		{"tenant_b", "not implemented"}, // passed the check and reached the adapter
+	} {
+		a.Cfg.Restore.Schemas = []string{tc.schema}
+		if err := a.Restore(ctx, res.Key); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("restore of schema %s: expected %q, got %v", tc.schema, tc.want, err)
+		}
+	}
+
+	a.Adapter = &adapter.stubAdapter
+	if err := a.Restore(ctx, res.Key); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("expected schemas to be unsupported, got %v", err)
+	}
+}
+
+func TestRestoreRefusesNonEmptyDatabase(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "mem", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	cfg.Restore.RefuseIfNonempty = 1
+	adapter := &memAdapter{dbs: map[string]map[string]string{"appdb": {"users": "ada,grace"}}}
+	a := New(cfg, adapter, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter.dbs["appdb"] = map[string]string{"users": "prod", "orders": "prod"}
+	if err := a.Restore(ctx, res.Key); err == nil || !strings.Contains(err.Error(), "already holds 2 tables") {
+		t.Fatalf("expected the restore to be refused, got %v", err)
+	}
+	if adapter.dbs["appdb"]["users"] != "prod" {
+		t.Fatal("refused restore changed the database")
+	}
+
+	cfg.Restore.RefuseIfNonempty = 3
+	if err := a.Restore(ctx, res.Key); err != nil {
+		t.Fatalf("restore below the threshold: %v", err)
+	}
+
+	cfg.Restore.RefuseIfNonempty = 1
+	a.Force = true
+	if err := a.Restore(ctx, res.Key); err != nil {
+		t.Fatalf("restore with force: %v", err)
+	}
+	a.Force = false
+	cfg.Restore.DropExisting = true
+	if err := a.Restore(ctx, res.Key); err != nil {
+		t.Fatalf("restore with drop_existing: %v", err)
+	}
+
+	// An empty database needs neither.
+	cfg.Restore.DropExisting = false
+	adapter.dbs["appdb"] = map[string]string{}
+	if err := a.Restore(ctx, res.Key); err != nil {
+		t.Fatalf("restore into an empty database: %v", err)
+	}
+}
+
+func TestRestoreRefusesUndecodableBackups(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "mem", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "zstd", Encryption: true, EncryptionKey: "hex:" + strings.Repeat("ab", 32)}
+	cfg.Restore.DropExisting = true
+	adapter := &memAdapter{dbs: map[string]map[string]string{"appdb": {"users": "ada,grace"}}}
+	a := New(cfg, adapter, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Manifest.ZstdWindowLog != compress.ZstdWindowLog || !slices.Contains(cryptoutil.Ciphers, res.Manifest.Cipher) {
+		t.Fatalf("expected the window and cipher to be recorded, got %d and %q", res.Manifest.ZstdWindowLog, res.Manifest.Cipher)
+	}
+
+	cases := []struct {
+		name   string
+		change func(*storage.Manifest)
+		want   string
+	}{
+		{"window", func(m *storage.Manifest) { m.ZstdWindowLog = 30 }, "uses zstd window log 30"},
+		{"cipher", func(m *storage.Manifest) { m.Cipher = "aes-256-gcm-siv" }, "encrypted with aes-256-gcm-siv"},
+		{"compression", func(m *storage.Manifest) { m.Compression = "lz5" }, "uses lz5 compression"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			manifest := res.Manifest
+			tc.change(&manifest)
+			if err := a.writeManifest(ctx, manifest); err != nil {
+				t.Fatal(err)
+			}
+			adapter.dbs["appdb"] = map[string]string{}
+			err := a.Restore(ctx, res.Key)
+			if err == nil || !strings.Contains(err.Error(), tc.want) || !strings.Contains(err.Error(), "upgrade dbu") {
+				t.Fatalf("expected %q, got %v", tc.want, err)
+			}
+			if len(adapter.dbs["appdb"]) != 0 {
+				t.Fatal("expected nothing to be restored")
+			}
+		})
+	}
+
+	if err := a.writeManifest(ctx, res.Manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Restore(ctx, res.Key); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+}
+
+func TestRestoreMarker(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", Encryption: true, EncryptionKey: "hex:" + strings.Repeat("ab", 32)}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	a := New(cfg, &stubAdapter{data: tenantDump(1)}, store, zerolog.Nop(), nil)
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	marker := storage.RestoreMarkerKey("stub/appdb")
+
+	// The backup cannot be decrypted, so nothing reached the database.
+	cfg.Backup.EncryptionKey = "hex:" + strings.Repeat("cd", 32)
+	if err := a.Restore(ctx, res.Key); err == nil {
+		t.Fatal("expected the wrong key to fail the restore")
+	}
+	if exists, _ := store.Exists(ctx, marker); exists {
+		t.Fatal("a restore that failed before loading left a marker")
+	}
+
+	// The stub adapter cannot load, so the database may be half restored.
+	cfg.Backup.EncryptionKey = "hex:" + strings.Repeat("ab", 32)
+	if err := a.Restore(ctx, res.Key); err == nil || !strings.Contains(err.Error(), "not implemented") {
+		t.Fatalf("expected the load to fail, got %v", err)
+	}
+	if got := a.readRestoreMarker(ctx, marker); got.Key != res.Key {
+		t.Fatalf("restore marker key = %q, want %q", got.Key, res.Key)
+	}
+	if err := a.Restore(ctx, res.Key); err == nil || !strings.Contains(err.Error(), "did not complete") {
+		t.Fatalf("expected the next restore to be refused, got %v", err)
+	}
+}
+
+// strictValidator fails to validate databases that do not exist, as psql does.
+type strictValidator struct{ *memAdapter }
+
+func (s strictValidator) Validate(_ context.Context, cfg config.DatabaseConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.dbs[cfg.Database]; !ok && cfg.Database != "postgres" {
+		return errors.New(`FATAL: database "` + cfg.Database + `" does not exist`)
+	}
+	return nil
+}
+
+func TestCreateDatabaseBeforeValidating(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "mem", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	adapter := strictValidator{&memAdapter{dbs: map[string]map[string]string{"appdb": {"users": "ada,grace"}}}}
+	a := New(cfg, adapter, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restoreCfg := *cfg
+	restoreCfg.Database.Database = "restored"
+	restoreCfg.Restore.CreateDatabase = true
+	if err := New(&restoreCfg, adapter, a.Storage, zerolog.Nop(), nil).Restore(ctx, res.Key); err != nil {
+		t.Fatalf("restore into a new database: %v", err)
+	}
+	if adapter.dbs["restored"]["users"] != "ada,grace" {
+		t.Fatalf("restored %v", adapter.dbs["restored"])
+	}
+
+	target := *cfg
+	target.Database.Database = "cloned"
+	target.Restore.CreateDatabase = true
+	if err := a.Clone(ctx, &target, adapter); err != nil {
+		t.Fatalf("clone into a new database: %v", err)
+	}
+	if adapter.dbs["cloned"]["users"] != "ada,grace" {
+		t.Fatalf("cloned %v", adapter.dbs["cloned"])
+	}
+}
+
+// failingDump cannot dump, as when the source tool exits at once.
+type failingDump struct{ *memAdapter }
+
+func (failingDump) Dump(context.Context, config.DatabaseConfig, config.BackupConfig) (*db.DumpStream, error) {
+	return nil, errors.New("pg_dump: connection refused")
+}
+
+func TestDropExistingWaitsForReadableBackup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "mem", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", Encryption: true, EncryptionKey: "hex:" + strings.Repeat("ab", 32)}
+	adapter := &memAdapter{dbs: map[string]map[string]string{
+		"appdb":    {"users": "ada,grace"},
+		"restored": {"users": "keep"},
+	}}
+	a := New(cfg, adapter, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restoreCfg := *cfg
+	restoreCfg.Database.Database = "restored"
+	restoreCfg.Backup.EncryptionKey = "hex:" + strings.Repeat("cd", 32)
+	restoreCfg.Restore = config.RestoreConfig{CreateDatabase: true, DropExisting: true}
+	if err := New(&restoreCfg, adapter, a.Storage, zerolog.Nop(), nil).Restore(ctx, res.Key); err == nil {
+		t.Fatal("expected a restore with the wrong key to fail")
+	}
+	if adapter.dbs["restored"]["users"] != "keep" {
+		t.Fatalf("database was replaced by a restore that could not read its backup: %v", adapter.dbs["restored"])
+	}
+
+	target := *cfg
+	target.Database.Database = "restored"
+	target.Restore = config.RestoreConfig{CreateDatabase: true, DropExisting: true}
+	if err := New(cfg, failingDump{adapter}, a.Storage, zerolog.Nop(), nil).Clone(ctx, &target, adapter); err == nil {
+		t.Fatal("expected a clone whose source cannot dump to fail")
+	}
+	if adapter.dbs["restored"]["users"] != "keep" {
+		t.Fatalf("clone target was replaced though the source never dumped: %v", adapter.dbs["restored"])
+	}
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestRetentionKeepsLatestFullChains(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	root := filepath.Join(dir, "backups")
+	store := storage.NewLocal(root)
+	a := New(cfg, &stubAdapter{data: []byte("rows")}, store, zerolog.Nop(), nil)
+
+	put := func(day int, backupType, base string) string {
+		when := time.Date(2000, 1, day, 0, 0, 0, 0, time.UTC)
+		key := "stub/appdb/" + when.Format("20060102T150405Z") + "_" + backupType + ".backup.gz"
+		if err := store.Put(ctx, key, strings.NewReader("old"), 3, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.writeManifest(ctx, storage.Manifest{Key: key, BackupType: backupType, Compression: "gzip", BaseKey: base}); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(root, key), when, when); err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	full1 := put(1, "full", "")
+	diff2 := put(2, "differential", full1)
+	full3 := put(3, "full", "")
+	diff4 := put(4, "differential", full3)
+	diff5 := put(5, "differential", full3)
+
+	cases := []struct {
+		policy config.Retention
+		want   []string
+	}{
+		// Every backup is past keep_days; without keep_full nothing restorable is left.
+		{config.Retention{KeepDays: 1}, []string{diff5, diff4, full3, diff2, full1}},
+		{config.Retention{KeepDays: 1, KeepFull: 1}, []string{diff2, full1}},
+		{config.Retention{KeepDays: 1, KeepFull: 2}, nil},
+		// keep_last keeps the newest differential and so its base; keep_full also
+		// keeps the older differential on that base.
+		{config.Retention{KeepLast: 1}, []string{diff4, diff2, full1}},
+		{config.Retention{KeepLast: 1, KeepFull: 1}, []string{diff2, full1}},
+	}
+	for _, tc := range cases {
+		cfg.Backup.RetentionPolicy = tc.policy
+		candidates, err := a.retentionCandidates(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, obj := range candidates {
+			got = append(got, obj.Key)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%+v: candidates %v, want %v", tc.policy, got, tc.want)
+		}
+	}
+}
+
+// listCounter counts the listings that reach the backend.
+type listCounter struct {
+	storage.Storage
+	lists int
+}
+
+func (l *listCounter) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	l.lists++
+	return l.Storage.List(ctx, prefix)
+}
+
+func TestListingCacheSharedAcrossRuns(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", RetentionPolicy: config.Retention{KeepLast: 1}}
+	run := func(ttl time.Duration) (*listCounter, []storage.ObjectInfo) {
+		backend := &listCounter{Storage: storage.NewLocal(filepath.Join(dir, ttl.String()))}
+		cfg.Storage.ListingCacheTTL = ttl
+		a := New(cfg, &stubAdapter{data: []byte("rows")}, backend, zerolog.Nop(), nil)
+		for range 2 {
+			if _, err := a.Backup(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		objects, err := backend.Storage.List(ctx, "stub/appdb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return backend, objects
+	}
+
+	perRun, perRunObjects := run(0)
+	shared, sharedObjects := run(time.Hour)
+	if perRun.lists != 2 || shared.lists != 1 {
+		t.Fatalf("expected one listing per run without the cache (%d) and one in all with it (%d)", perRun.lists, shared.lists)
+	}
+	// What the runs left behind is the same either way.
+	if len(sharedObjects) != len(perRunObjects) {
+		t.Fatalf("expected the same objects to be kept: %v with the cache, %v without", sharedObjects, perRunObjects)
+	}
+}
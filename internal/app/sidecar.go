@@ -0,0 +1,57 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+)
+
+// Sidecars are the objects stored next to the backups that describe them:
+// manifests, restore markers and zstd dictionaries. They name databases and
+// tables, and a dictionary is trained from dump contents, so they are encrypted
+// along with the backups. Reads accept both forms, so turning sealing on or off
+// never strands objects written before.
+
+// sealsSidecars reports whether sidecars are written encrypted: as set by
+// backup.encrypt_manifest, otherwise whenever backups are encrypted.
+func (a *App) sealsSidecars() bool {
+	if a.Cfg.Backup.EncryptManifest != nil {
+		return *a.Cfg.Backup.EncryptManifest
+	}
+	return a.Cfg.Backup.Encryption
+}
+
+// sealSidecar encrypts payload with encryptionKey when sidecars are sealed.
+func (a *App) sealSidecar(payload []byte, encryptionKey string) ([]byte, error) {
+	if !a.sealsSidecars() {
+		return payload, nil
+	}
+	if encryptionKey == "" {
+		return nil, fmt.Errorf("encrypting metadata requires encryption_key")
+	}
+	keyBytes, err := cryptoutil.ParseKey(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cryptoutil.EncryptConfig(payload, keyBytes)
+}
+
+// openSidecar decrypts a sealed sidecar with the backup key and returns a plain
+// one as is.
+func (a *App) openSidecar(name string, payload []byte) ([]byte, error) {
+	if !cryptoutil.IsEncryptedConfig(payload) {
+		return payload, nil
+	}
+	if a.Cfg.Backup.EncryptionKey == "" {
+		return nil, fmt.Errorf("%s is encrypted but encryption_key is empty", name)
+	}
+	keyBytes, err := cryptoutil.ParseKey(a.Cfg.Backup.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := cryptoutil.DecryptConfig(payload, keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", name, err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestEncryptedBackupsSealSidecars(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{
+		Type: "full", Compression: "zstd", Tables: []string{"tenants"},
+		Encryption: true, EncryptionKey: "hex:" + strings.Repeat("ab", 32),
+	}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("stub/appdb/202401%02dT000000Z_full.backup", i+1)
+		data := tenantDump(i)
+		if err := store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := New(cfg, &stubAdapter{data: tenantDump(99)}, store, zerolog.Nop(), nil)
+
+	raw := func(key string) []byte {
+		t.Helper()
+		r, err := store.Get(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	assertSealed := func(key string) {
+		t.Helper()
+		data := raw(key)
+		if !cryptoutil.IsEncryptedConfig(data) || bytes.Contains(data, []byte("tenant")) {
+			t.Fatalf("%s is stored in plaintext", key)
+		}
+	}
+
+	dict, err := a.TrainDictionary(ctx, 0, 4096, false)
+	if err != nil {
+		t.Fatalf("train: %v", err)
+	}
+	assertSealed(dict.Key)
+
+	cfg.Backup.ZstdDictionary = fmt.Sprintf("%08x", dict.ID)
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	assertSealed(storage.ManifestKey(res.Key))
+
+	marker := storage.RestoreMarkerKey("stub/appdb")
+	if err := a.markRestore(ctx, marker, res.Key); err != nil {
+		t.Fatal(err)
+	}
+	assertSealed(marker)
+	if got := a.readRestoreMarker(ctx, marker); got.Key != res.Key {
+		t.Fatalf("restore marker key = %q, want %q", got.Key, res.Key)
+	}
+
+	records, err := a.ListManifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 || records[0].Object.Key != res.Key || records[0].Err != nil || records[0].Manifest.Tables[0] != "tenants" {
+		t.Fatalf("expected the decrypted manifest first, got %+v", records)
+	}
+	if _, err := a.Verify(ctx, VerifyOptions{Keys: []string{res.Key}, Deep: true}); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	// Sealing can be turned off explicitly; sealed objects still read.
+	off := false
+	cfg.Backup.EncryptManifest = &off
+	plain, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if data := raw(storage.ManifestKey(plain.Key)); cryptoutil.IsEncryptedConfig(data) {
+		t.Fatal("expected a plaintext manifest with encrypt_manifest: false")
+	}
+}
+
+func TestEncryptedBackupsAreBoundToTheirKey(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "zstd", Encryption: true, EncryptionKey: "hex:" + strings.Repeat("ab", 32)}
+	store := storage.NewLocal(filepath.Join(dir, "backups"))
+	a := New(cfg, &stubAdapter{data: tenantDump(1)}, store, zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	want := storage.EncryptionBinding{DatabaseType: "stub", Database: "appdb", Name: path.Base(res.Key)}
+	if b := res.Manifest.EncryptionBinding; b == nil || *b != want {
+		t.Fatalf("manifest binding = %+v, want %+v", b, want)
+	}
+	read := func(key string, manifest storage.Manifest) error {
+		t.Helper()
+		r, err := a.openBackup(ctx, key, manifest, nil)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = io.Copy(io.Discard, r)
+		return err
+	}
+	if err := read(res.Key, res.Manifest); err != nil {
+		t.Fatalf("read own backup: %v", err)
+	}
+
+	// The same object under another backup's key, with that backup's manifest.
+	other := strings.Replace(res.Key, path.Base(res.Key)[:16], "20240101T000000Z", 1)
+	if err := store.Copy(ctx, res.Key, other); err != nil {
+		t.Fatal(err)
+	}
+	otherManifest := res.Manifest
+	otherManifest.Key = other
+	otherManifest.EncryptionBinding = &storage.EncryptionBinding{DatabaseType: "stub", Database: "appdb", Name: path.Base(other)}
+	if err := read(other, otherManifest); err == nil || !strings.Contains(err.Error(), "belongs to another backup") {
+		t.Fatalf("expected a swapped object to be refused, got %v", err)
+	}
+
+	// Re-encrypting binds the result to its destination.
+	newKey := "hex:" + strings.Repeat("cd", 32)
+	moved, err := a.Reencrypt(ctx, res.Key, newKey, other)
+	if err != nil {
+		t.Fatalf("reencrypt: %v", err)
+	}
+	if moved.EncryptionBinding == nil || moved.EncryptionBinding.Name != path.Base(other) {
+		t.Fatalf("re-encrypted binding = %+v", moved.EncryptionBinding)
+	}
+	cfg.Backup.EncryptionKey = newKey
+	if err := read(other, moved); err != nil {
+		t.Fatalf("read re-encrypted backup: %v", err)
+	}
+}
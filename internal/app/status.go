@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rowjay/db-backup-utility/internal/storage"
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+// statusTimeout bounds recording an operation's outcome, which runs after the
+// operation's own context may have expired.
+const statusTimeout = 30 * time.Second
+
+func (a *App) statusKey() string {
+	return storage.StatusKey(util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database))
+}
+
+// Status reads the database's status object. A database no operation has been
+// recorded for yet has a status without operations.
+func (a *App) Status(ctx context.Context) (storage.Status, error) {
+	payload, err := a.readStatus(ctx)
+	if err != nil {
+		return a.emptyStatus(), err
+	}
+	return a.decodeStatus(payload)
+}
+
+func (a *App) emptyStatus() storage.Status {
+	return storage.Status{DatabaseType: a.Cfg.Database.Type, Database: a.Cfg.Database.Database}
+}
+
+// readStatus returns the stored status object, or nil when there is none.
+func (a *App) readStatus(ctx context.Context) ([]byte, error) {
+	reader, err := a.Storage.Get(ctx, a.statusKey())
+	if storage.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func (a *App) decodeStatus(payload []byte) (storage.Status, error) {
+	status := a.emptyStatus()
+	if payload == nil {
+		return status, nil
+	}
+	payload, err := a.openSidecar("status "+a.statusKey(), payload)
+	if err != nil {
+		return status, err
+	}
+	if err := json.Unmarshal(payload, &status); err != nil {
+		return a.emptyStatus(), fmt.Errorf("decode status %s: %w", a.statusKey(), err)
+	}
+	return status, nil
+}
+
+// recordStatus updates the status object with an operation's outcome. Skipped
+// runs change nothing, and failing to record only logs: the operation itself has
+// already succeeded or failed. Runs that overlap across hosts may lose one
+// update; the status is a summary, the manifests stay authoritative.
+func (a *App) recordStatus(opType, key string, size int64, opErr error) {
+	result := statusFromErr(opErr)
+	if result == "skipped" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+	if err := a.writeStatus(ctx, opType, key, size, opErr); err != nil {
+		a.Log.Warn().Err(err).Str("operation", opType).Msg("failed to record status")
+	}
+}
+
+func (a *App) writeStatus(ctx context.Context, opType, key string, size int64, opErr error) error {
+	payload, err := a.readStatus(ctx)
+	if err != nil {
+		return err
+	}
+	status, err := a.decodeStatus(payload)
+	if err != nil {
+		// A status that cannot be decoded, e.g. sealed with a retired key, is replaced.
+		a.Log.Warn().Err(err).Msg("replacing unreadable status")
+	}
+	if status.Operations == nil {
+		status.Operations = map[string]storage.OperationStatus{}
+	}
+	now := time.Now().UTC()
+	op := status.Operations[opType]
+	op.Host, _ = os.Hostname()
+	if opErr == nil {
+		op.LastSuccess, op.LastSuccessKey, op.LastSuccessSize = now, key, size
+	} else {
+		op.LastFailure, op.LastFailureKey, op.LastError = now, key, opErr.Error()
+	}
+	status.Operations[opType] = op
+	status.UpdatedAt = now
+
+	if payload, err = json.MarshalIndent(status, "", "  "); err != nil {
+		return err
+	}
+	if payload, err = a.sealSidecar(payload, a.Cfg.Backup.EncryptionKey); err != nil {
+		return err
+	}
+	return a.replaceObject(ctx, a.statusKey(), payload, map[string]string{"dbu-status": "true"})
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestStatusRecordsLastOutcomes(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", Encryption: true, EncryptionKey: "hex:" + strings.Repeat("cd", 32)}
+	root := filepath.Join(dir, "backups")
+	a := New(cfg, &stubAdapter{data: bytes.Repeat([]byte("row data\n"), 100)}, storage.NewLocal(root), zerolog.Nop(), nil)
+
+	status, err := a.Status(ctx)
+	if err != nil || len(status.Operations) != 0 || status.Database != "appdb" {
+		t.Fatalf("expected an empty status, got %+v, %v", status, err)
+	}
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Restore(ctx, "stub/appdb/missing.backup"); err == nil {
+		t.Fatal("expected restoring a missing backup to fail")
+	}
+
+	// The status is sealed like the other sidecars, so the raw object is not JSON.
+	raw, err := os.ReadFile(filepath.Join(root, "stub", "appdb", "_status.json"))
+	if err != nil || bytes.Contains(raw, []byte("appdb")) {
+		t.Fatalf("expected a sealed status object, got %q, %v", raw, err)
+	}
+	status, err = a.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup := status.Operations["backup"]
+	if backup.LastSuccessKey != res.Key || backup.LastSuccessSize != res.Manifest.SizeBytes || backup.LastSuccess.IsZero() || !backup.LastFailure.IsZero() {
+		t.Fatalf("unexpected backup status %+v", backup)
+	}
+	restore := status.Operations["restore"]
+	if !restore.LastSuccess.IsZero() || restore.LastFailureKey != "stub/appdb/missing.backup" || restore.LastError == "" {
+		t.Fatalf("unexpected restore status %+v", restore)
+	}
+
+	keys, err := a.BackupKeys(ctx)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected the status object not to be listed as a backup, got %v, %v", keys, err)
+	}
+}
+
+// writeOnce refuses to overwrite a stored object, as immutable local storage does
+// for users the read-only mode and chattr +i apply to.
+type writeOnce struct{ storage.Storage }
+
+func (w writeOnce) Put(ctx context.Context, key string, r io.Reader, size int64, metadata map[string]string) error {
+	if exists, err := w.Exists(ctx, key); err != nil || exists {
+		return errors.Join(fmt.Errorf("%s: %w", key, os.ErrPermission), err)
+	}
+	return w.Storage.Put(ctx, key, r, size, metadata)
+}
+
+func TestStatusOnImmutableStorage(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	cfg.Storage.Local.Immutable = true
+	a := New(cfg, &stubAdapter{data: []byte("rows")}, writeOnce{storage.NewLocal(filepath.Join(dir, "backups"))}, zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Restore(ctx, "stub/appdb/missing.backup"); err == nil {
+		t.Fatal("expected restoring a missing backup to fail")
+	}
+	status, err := a.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Operations["backup"].LastSuccessKey != res.Key || status.Operations["restore"].LastFailureKey != "stub/appdb/missing.backup" {
+		t.Fatalf("expected the status to be rewritten after each operation, got %+v", status.Operations)
+	}
+}
+
+func TestDryRunRestoreLeavesStatus(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	a := New(cfg, &stubAdapter{data: []byte("rows")}, storage.NewLocal(filepath.Join(dir, "backups")), zerolog.Nop(), nil)
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Restore.DryRun = true
+	if err := a.Restore(ctx, res.Key); err != nil {
+		t.Fatal(err)
+	}
+	status, err := a.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restore, ok := status.Operations["restore"]; ok {
+		t.Fatalf("a dry run should not be recorded as a restore: %+v", restore)
+	}
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+// coldTier returns a copy of a that works on the cold tier, with the cold tier's
+// retention policy, or nil when storage.tiers.cold is not configured. Storage
+// routes the cold prefix to the cold backend.
+func (a *App) coldTier() *App {
+	tier := a.Cfg.Storage.Tiers.Cold
+	if tier.Prefix == "" {
+		return nil
+	}
+	cfg := *a.Cfg
+	cfg.Storage.Prefix = tier.Prefix
+	cfg.Storage.Tiers = config.StorageTiers{}
+	cfg.Backup.RetentionPolicy = tier.Retention
+	cold := *a
+	cold.Cfg = &cfg
+	return &cold
+}
+
+// moveToCold copies a backup's parts to the cold tier, writes its manifest there
+// last, and only then deletes the hot copy. A differential's base key is rewritten
+// to the cold key; Tiered storage finds the base in either tier.
+func (a *App) moveToCold(ctx context.Context, obj backupObject) error {
+	hot, cold := a.Cfg.Storage.Prefix, a.Cfg.Storage.Tiers.Cold.Prefix
+	// Backups without a manifest are moved as they are.
+	manifest, err := a.readManifest(ctx, obj.Key)
+	hasManifest := err == nil
+	if err != nil && !storage.IsNotFound(err) {
+		return fmt.Errorf("move %s to cold tier: read manifest: %w", obj.Key, err)
+	}
+	if len(manifest.DedupChunks) > 0 {
+		return fmt.Errorf("move %s to cold tier: deduplicated backups stay in the hot tier", obj.Key)
+	}
+	var parts []string
+	for _, part := range obj.Parts {
+		dst := storage.TierKey(part, hot, cold)
+		if err := a.Storage.Copy(ctx, part, dst); err != nil {
+			return fmt.Errorf("move %s to cold tier: %w", part, err)
+		}
+		src, err := a.Storage.Stat(ctx, part)
+		if err != nil {
+			return fmt.Errorf("move %s to cold tier: %w", part, err)
+		}
+		copied, err := a.Storage.Stat(ctx, dst)
+		if err != nil {
+			return fmt.Errorf("move %s to cold tier: %w", part, err)
+		}
+		if copied.Size != src.Size {
+			return fmt.Errorf("move %s to cold tier: copied %d of %d bytes", part, copied.Size, src.Size)
+		}
+		parts = append(parts, dst)
+	}
+	coldKey := storage.TierKey(obj.Key, hot, cold)
+	if hasManifest {
+		manifest.Key = coldKey
+		manifest.Tier = storage.TierCold
+		if len(manifest.Chunks) > 0 {
+			manifest.Chunks = parts
+		}
+		if manifest.BaseKey != "" {
+			manifest.BaseKey = storage.TierKey(manifest.BaseKey, hot, cold)
+		}
+		if err := a.writeManifest(ctx, manifest); err != nil {
+			return fmt.Errorf("move %s to cold tier: write manifest: %w", obj.Key, err)
+		}
+	}
+	if _, err := a.deleteBackup(ctx, obj); err != nil {
+		return fmt.Errorf("move %s to cold tier: %w", obj.Key, err)
+	}
+	a.Log.Info().Str("key", obj.Key).Str("cold_key", coldKey).Msg("moved backup to cold tier")
+	return nil
+}
+
+// ListCold lists this database's backups in the cold tier.
+func (a *App) ListCold(ctx context.Context) ([]storage.ObjectInfo, error) {
+	cold := a.coldTier()
+	if cold == nil {
+		return nil, fmt.Errorf("storage.tiers.cold is not configured")
+	}
+	return cold.Storage.List(ctx, util.BuildPrefix(cold.Cfg.Storage.Prefix, cold.Cfg.Backup.OutputPrefix, cold.Cfg.Database.Type, cold.Cfg.Database.Database))
+}
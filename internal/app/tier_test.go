@@ -0,0 +1,92 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestRetentionMovesToColdTier(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", RetentionPolicy: config.Retention{KeepLast: 1}}
+	cfg.Storage.Prefix = "backups"
+	cfg.Storage.Tiers.Cold.Prefix = "archive"
+	hotRoot := filepath.Join(dir, "hot")
+	hot, cold := storage.NewLocal(hotRoot), storage.NewLocal(filepath.Join(dir, "cold"))
+	store, err := storage.NewTiered(hot, cold, cfg.Storage.Prefix, cfg.Storage.Tiers.Cold.Prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(cfg, &stubAdapter{}, store, zerolog.Nop(), nil)
+
+	var keys []string
+	for day := 1; day <= 3; day++ {
+		when := time.Date(2000, 1, day, 0, 0, 0, 0, time.UTC)
+		key := "backups/stub/appdb/" + when.Format("20060102T150405Z") + "_full.backup.gz"
+		if err := store.Put(ctx, key, strings.NewReader("data"), 4, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.writeManifest(ctx, storage.Manifest{Key: key, BackupType: "full", Compression: "gzip", SizeBytes: 4}); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(hotRoot, key), when, when); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	stats, err := a.applyRetention(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Moved != 2 || stats.Deleted != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if ok, _ := hot.Exists(ctx, keys[0]); ok {
+		t.Fatal("moved backup is still in the hot tier")
+	}
+	if ok, _ := hot.Exists(ctx, keys[2]); !ok {
+		t.Fatal("newest backup left the hot tier")
+	}
+	coldObjects, err := a.ListCold(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backups := groupBackups(coldObjects); len(backups) != 2 {
+		t.Fatalf("expected 2 cold backups, got %+v", coldObjects)
+	}
+	// The manifest moved too, and the old key still finds it.
+	m, err := a.readManifest(ctx, keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Tier != storage.TierCold || m.Key != "archive/stub/appdb/20000101T000000Z_full.backup.gz" {
+		t.Fatalf("unexpected cold manifest %+v", m)
+	}
+
+	// The cold tier's own policy is the final threshold.
+	cfg.Storage.Tiers.Cold.Retention = config.Retention{KeepLast: 1}
+	stats, err = a.applyRetention(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Moved != 0 || stats.Deleted != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	coldObjects, _ = a.ListCold(ctx)
+	if backups := groupBackups(coldObjects); len(backups) != 1 {
+		t.Fatalf("expected 1 cold backup, got %+v", coldObjects)
+	}
+}
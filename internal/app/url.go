@@ -0,0 +1,130 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// WithURL returns a copy of the app that reads the backup served at rawURL, e.g.
+// a shared link or another host's dbu serve, and the key to restore it by: the
+// URL without credentials or query. The manifest is fetched from beside the
+// backup when the server has one; otherwise the pipeline is inferred from the
+// URL's file name and the object's headers. Everything else, such as the restore
+// marker, stays in the configured storage.
+func (a *App) WithURL(rawURL string) (*App, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("backup URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", fmt.Errorf("backup URL %s must be an http:// or https:// URL with a host", u.Redacted())
+	}
+	key := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = a.Cfg.Restore.URLTimeout
+	op := *a
+	op.Storage = &remoteBackup{
+		Storage: a.Storage,
+		client:  &http.Client{Transport: transport},
+		token:   a.Cfg.Restore.URLToken,
+		key:     key,
+		backup:  u,
+	}
+	return &op, key, nil
+}
+
+// remoteBackup reads the backup at one URL, and its manifest beside it, over
+// HTTP. The restore marker is passed to the configured storage; any other read,
+// such as the chunks of a chunked backup, is refused, since those are not at
+// the URL.
+type remoteBackup struct {
+	storage.Storage
+	client *http.Client
+	token  string
+	key    string
+	backup *url.URL
+}
+
+func (r *remoteBackup) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if storage.IsRestoreMarker(key) {
+		return r.Storage.Get(ctx, key)
+	}
+	target, err := r.target(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.do(ctx, http.MethodGet, target)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (r *remoteBackup) Stat(ctx context.Context, key string) (storage.ObjectInfo, error) {
+	if storage.IsRestoreMarker(key) {
+		return r.Storage.Stat(ctx, key)
+	}
+	target, err := r.target(key)
+	if err != nil {
+		return storage.ObjectInfo{}, err
+	}
+	resp, err := r.do(ctx, http.MethodHead, target)
+	if err != nil {
+		return storage.ObjectInfo{}, err
+	}
+	resp.Body.Close()
+	modified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return storage.ObjectInfo{Key: key, Size: resp.ContentLength, Modified: modified, ETag: resp.Header.Get("ETag")}, nil
+}
+
+// target returns the URL key is read from.
+func (r *remoteBackup) target(key string) (*url.URL, error) {
+	switch key {
+	case r.key:
+		return r.backup, nil
+	case storage.ManifestKey(r.key):
+		// A query usually signs the backup's URL alone, so it is not carried over.
+		manifest := *r.backup
+		manifest.Path += storage.ManifestSuffix
+		manifest.RawPath, manifest.RawQuery = "", ""
+		return &manifest, nil
+	}
+	return nil, fmt.Errorf("%s is not served at %s; chunked, deduplicated and differential backups must be restored from storage", key, r.key)
+}
+
+// do sends the request and returns the response if it succeeded. Errors name the
+// URL without its credentials or query, which may carry a signature.
+func (r *remoteBackup) do(ctx context.Context, method string, target *url.URL) (*http.Response, error) {
+	name := (&url.URL{Scheme: target.Scheme, Host: target.Host, Path: target.Path}).String()
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, name, err)
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("%s %s: %w", method, name, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %w", method, name, os.ErrNotExist)
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("%s %s: %s", method, name, resp.Status)
+}
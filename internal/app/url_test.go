@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/serve"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestRestoreFromURL(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "mem", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip", Encryption: true, EncryptionKey: "hex:" + strings.Repeat("ab", 32)}
+	adapter := &memAdapter{dbs: map[string]map[string]string{"appdb": {"users": "ada,grace"}}}
+	remote := storage.NewLocal(filepath.Join(dir, "remote"))
+	res, err := New(cfg, adapter, remote, zerolog.Nop(), nil).Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(&serve.Handler{Storage: remote, Token: "s3cret", Log: zerolog.Nop()})
+	defer srv.Close()
+
+	// The restoring host has storage of its own, which never sees the backup.
+	local := storage.NewLocal(filepath.Join(dir, "local"))
+	a := New(cfg, adapter, local, zerolog.Nop(), nil)
+	restore := func(rawURL string) error {
+		t.Helper()
+		op, key, err := a.WithURL(rawURL)
+		if err != nil {
+			return err
+		}
+		return op.Restore(ctx, key)
+	}
+
+	if err := restore(srv.URL + "/backups/" + res.Key); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected the server to refuse a restore without its token, got %v", err)
+	}
+	cfg.Restore.URLToken = "s3cret"
+	cfg.Restore.DropExisting = true
+	adapter.dbs["appdb"] = map[string]string{}
+	if err := restore(srv.URL + "/backups/" + res.Key + "?download=1"); err != nil {
+		t.Fatal(err)
+	}
+	if adapter.dbs["appdb"]["users"] != "ada,grace" {
+		t.Fatalf("restore from URL got %v", adapter.dbs["appdb"])
+	}
+	objects, err := local.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range objects {
+		if !storage.IsStatus(obj.Key) {
+			t.Fatalf("restore from URL left %s in storage", obj.Key)
+		}
+	}
+
+	if err := restore(srv.URL + "/backups/mem/appdb/missing_full.backup.gz.enc"); !storage.IsNotFound(err) {
+		t.Fatalf("expected a missing backup to be reported as not found, got %v", err)
+	}
+	if _, _, err := a.WithURL("ftp://example.com/backup.gz"); err == nil {
+		t.Fatal("expected a non-HTTP URL to be refused")
+	}
+}
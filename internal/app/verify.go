@@ -0,0 +1,187 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+// VerifyOptions select what Verify checks.
+type VerifyOptions struct {
+	// Keys limits verification to these backups; empty verifies every backup.
+	Keys []string
+	// Since skips backups older than this when verifying every backup; 0 keeps all.
+	Since time.Duration
+	// Deep reads each backup end to end, decrypting and decompressing it.
+	Deep bool
+	// Parallel is how many backups are checked at once; 0 checks one at a time.
+	Parallel int
+	// MaxTime stops starting checks once this long has passed; the backups not
+	// reached are reported as skipped. 0 checks every backup.
+	MaxTime time.Duration
+	// Progress, when set, is called after each backup is checked or skipped, one
+	// call at a time.
+	Progress func(VerifyResult)
+}
+
+// VerifyResult is the outcome for one backup.
+type VerifyResult struct {
+	Key        string
+	StoredSize int64
+	// PlainSize is the size after decryption and decompression; deep checks only.
+	PlainSize int64
+	// Checksummed is set when the stored bytes were compared with the manifest's
+	// SHA-256; manifests written before checksums were recorded have none.
+	Checksummed bool
+	// Skipped is set when MaxTime ran out before the backup was checked.
+	Skipped bool
+	Err     error
+}
+
+// Verify checks backups without restoring them. Every backup needs a readable
+// manifest and stored parts of the recorded total size. A deep check also streams
+// the backup through decryption and decompression to io.Discard, so every
+// encrypted package is authenticated and the compressed stream must be complete,
+// and compares the stored bytes with the manifest's SHA-256. Failures are reported
+// per backup and do not stop the others; the returned error says how many failed
+// or were skipped. Results are in key order.
+func (a *App) Verify(ctx context.Context, opts VerifyOptions) ([]VerifyResult, error) {
+	start := time.Now()
+	var opErr error
+	defer func() { a.finish("verify", start, "", opErr) }()
+	defer func() { a.recordStatus("verify", "", 0, opErr) }()
+
+	keys := opts.Keys
+	if len(keys) == 0 {
+		prefix := util.BuildPrefix(a.Cfg.Storage.Prefix, a.Cfg.Backup.OutputPrefix, a.Cfg.Database.Type, a.Cfg.Database.Database)
+		objects, err := a.Storage.List(ctx, prefix)
+		if err != nil {
+			opErr = err
+			return nil, err
+		}
+		cutoff := time.Now().Add(-opts.Since)
+		for _, obj := range groupBackups(objects) {
+			if opts.Since > 0 && obj.Modified.Before(cutoff) {
+				continue
+			}
+			keys = append(keys, obj.Key)
+		}
+		sort.Strings(keys)
+	}
+
+	results := make([]VerifyResult, len(keys))
+	var mu sync.Mutex
+	var failed, skipped int
+	report := func(i int, res VerifyResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[i] = res
+		switch {
+		case res.Skipped:
+			skipped++
+		case res.Err != nil:
+			failed++
+		}
+		if opts.Progress != nil {
+			opts.Progress(res)
+		}
+	}
+	var eg errgroup.Group
+	eg.SetLimit(max(opts.Parallel, 1))
+	for i, key := range keys {
+		if err := ctx.Err(); err != nil {
+			_ = eg.Wait()
+			opErr = err
+			return results, err
+		}
+		if opts.MaxTime > 0 && time.Since(start) >= opts.MaxTime {
+			report(i, VerifyResult{Key: key, Skipped: true})
+			continue
+		}
+		eg.Go(func() error {
+			report(i, a.verifyBackup(ctx, key, opts.Deep))
+			return nil
+		})
+	}
+	_ = eg.Wait()
+	switch {
+	case failed > 0 && skipped > 0:
+		opErr = fmt.Errorf("%d of %d backups failed verification and %d were not checked within %s", failed, len(keys), skipped, opts.MaxTime)
+	case failed > 0:
+		opErr = fmt.Errorf("%d of %d backups failed verification", failed, len(keys))
+	case skipped > 0:
+		opErr = fmt.Errorf("%d of %d backups were not checked within %s", skipped, len(keys), opts.MaxTime)
+	}
+	return results, opErr
+}
+
+func (a *App) verifyBackup(ctx context.Context, key string, deep bool) VerifyResult {
+	res := VerifyResult{Key: key}
+	manifest, err := a.readManifest(ctx, key)
+	if err != nil {
+		res.Err = fmt.Errorf("read manifest: %w", err)
+		return res
+	}
+	parts := manifest.Chunks
+	if len(parts) == 0 {
+		parts = []string{key}
+	}
+	if res.StoredSize, err = a.statChunks(ctx, parts); err != nil {
+		res.Err = fmt.Errorf("stat: %w", err)
+		return res
+	}
+	if manifest.SizeBytes > 0 && res.StoredSize != manifest.SizeBytes {
+		res.Err = fmt.Errorf("stored size %d does not match manifest size %d", res.StoredSize, manifest.SizeBytes)
+		return res
+	}
+	if err := a.checkDedupChunks(ctx, manifest); err != nil {
+		res.Err = fmt.Errorf("stat: %w", err)
+		return res
+	}
+	if !deep {
+		return res
+	}
+
+	raw, err := a.openStored(ctx, key, manifest)
+	if err != nil {
+		res.Err = fmt.Errorf("read: %w", err)
+		return res
+	}
+	hash := sha256.New()
+	stored := &meterWriter{w: hash}
+	tee := readCloser{Reader: io.TeeReader(raw, stored), closers: []io.Closer{raw}}
+	payload, err := a.decodeStored(ctx, key, tee, manifest, nil)
+	if err != nil {
+		res.Err = fmt.Errorf("decode: %w", err)
+		return res
+	}
+	defer payload.Close()
+	if res.PlainSize, err = io.Copy(io.Discard, payload); err != nil {
+		res.Err = fmt.Errorf("decode: %w", err)
+		return res
+	}
+	// Bytes after the end of the compressed stream still count towards the digest.
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		res.Err = fmt.Errorf("read: %w", err)
+		return res
+	}
+	res.Checksummed = manifest.SHA256 != ""
+	switch sum := hex.EncodeToString(hash.Sum(nil)); {
+	case stored.n != res.StoredSize:
+		res.Err = fmt.Errorf("read %d bytes, but %d are stored", stored.n, res.StoredSize)
+	case manifest.SHA256 != "" && sum != manifest.SHA256:
+		res.Err = fmt.Errorf("checksum mismatch: stored bytes hash to %s, manifest records %s", sum, manifest.SHA256)
+	case manifest.UncompressedBytes > 0 && res.PlainSize != manifest.UncompressedBytes:
+		res.Err = fmt.Errorf("decoded %d bytes, manifest records %d", res.PlainSize, manifest.UncompressedBytes)
+	}
+	return res
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "zstd", Encryption: true, EncryptionKey: "hex:" + strings.Repeat("ab", 32)}
+	root := filepath.Join(dir, "backups")
+	a := New(cfg, &stubAdapter{data: bytes.Repeat([]byte("row data\n"), 5000)}, storage.NewLocal(root), zerolog.Nop(), nil)
+
+	res, err := a.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Manifest.SHA256) != 64 {
+		t.Fatalf("manifest has no checksum: %+v", res.Manifest)
+	}
+	results, err := a.Verify(ctx, VerifyOptions{Deep: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Key != res.Key || !results[0].Checksummed || results[0].PlainSize != 45000 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	// Flip one byte in the middle: the size still matches, so only a deep check notices.
+	path := filepath.Join(root, filepath.FromSlash(res.Key))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Verify(ctx, VerifyOptions{Keys: []string{res.Key}}); err != nil {
+		t.Fatalf("shallow verify should only check sizes: %v", err)
+	}
+	results, err = a.Verify(ctx, VerifyOptions{Keys: []string{res.Key}, Deep: true})
+	if err == nil || results[0].Err == nil {
+		t.Fatalf("expected deep verify to fail, got %+v", results)
+	}
+
+	if err := os.WriteFile(path, data[:len(data)-10], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	results, err = a.Verify(ctx, VerifyOptions{Keys: []string{res.Key}})
+	if err == nil || !strings.Contains(results[0].Err.Error(), "does not match manifest size") {
+		t.Fatalf("expected a size mismatch, got %+v", results)
+	}
+}
+
+func TestVerifyContinuesPastFailures(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Global.LockFile = filepath.Join(dir, "dbu.lock")
+	cfg.Database = config.DatabaseConfig{Type: "stub", Database: "appdb"}
+	cfg.Backup = config.BackupConfig{Type: "full", Compression: "gzip"}
+	root := filepath.Join(dir, "backups")
+	a := New(cfg, &stubAdapter{data: bytes.Repeat([]byte("row data\n"), 500)}, storage.NewLocal(root), zerolog.Nop(), nil)
+
+	var keys []string
+	for i := 0; i < 3; i++ {
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+		res, err := a.Backup(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, res.Key)
+	}
+	if err := os.Truncate(filepath.Join(root, filepath.FromSlash(keys[0])), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	var seen int
+	results, err := a.Verify(ctx, VerifyOptions{Deep: true, Parallel: 2, Progress: func(VerifyResult) { seen++ }})
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 backups failed") {
+		t.Fatalf("expected one failure, got %v", err)
+	}
+	if seen != 3 || len(results) != 3 || results[0].Key != keys[0] || results[0].Err == nil || results[1].Err != nil || results[2].Err != nil {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	results, err = a.Verify(ctx, VerifyOptions{Keys: keys[1:], MaxTime: time.Nanosecond})
+	if err == nil || !strings.Contains(err.Error(), "2 of 2 backups were not checked") {
+		t.Fatalf("expected every backup to be skipped, got %v", err)
+	}
+	if !results[0].Skipped || !results[1].Skipped {
+		t.Fatalf("unexpected results %+v", results)
+	}
+}
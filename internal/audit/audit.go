@@ -0,0 +1,145 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+)
+
+// Entry is one audit record, written as a single JSON line.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Operation  string    `json:"operation"`
+	DBType     string    `json:"db_type"`
+	Database   string    `json:"database"`
+	Key        string    `json:"key,omitempty"`
+	Status     string    `json:"status"`
+	DurationMS int64     `json:"duration_ms"`
+	Actor      string    `json:"actor"`
+	Host       string    `json:"host,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	// Overrides lists emergency overrides used for the run, e.g. force, no-lock.
+	Overrides []string `json:"overrides,omitempty"`
+}
+
+type sink interface {
+	write(line []byte) error
+	Close() error
+}
+
+// Logger appends audit entries to every configured sink. A nil Logger discards entries.
+type Logger struct {
+	mu    sync.Mutex
+	sinks []sink
+	actor string
+	host  string
+}
+
+// Open builds a Logger from config. It returns nil when no sink is configured.
+func Open(cfg config.AuditConfig, actor string) (*Logger, error) {
+	var sinks []sink
+	if cfg.File != "" {
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open audit file: %w", err)
+		}
+		sinks = append(sinks, fileSink{f})
+	}
+	if cfg.Syslog {
+		tag := cfg.SyslogTag
+		if tag == "" {
+			tag = "dbu"
+		}
+		s, err := newSyslogSink(tag)
+		if err != nil {
+			for _, existing := range sinks {
+				_ = existing.Close()
+			}
+			return nil, fmt.Errorf("open audit syslog: %w", err)
+		}
+		sinks = append(sinks, s)
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	host, _ := os.Hostname()
+	return &Logger{sinks: sinks, actor: actor, host: host}, nil
+}
+
+// Record writes e to all sinks, filling in time, actor and host when unset.
+func (l *Logger) Record(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.Actor == "" {
+		e.Actor = l.actor
+	}
+	if e.Host == "" {
+		e.Host = l.host
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var errs []error
+	for _, s := range l.sinks {
+		errs = append(errs, s.write(line))
+	}
+	return errors.Join(errs...)
+}
+
+// Close releases all sinks.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	var errs []error
+	for _, s := range l.sinks {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// ResolveActor picks the actor recorded in audit entries: the explicit value,
+// then DBU_ACTOR, then the OS user.
+func ResolveActor(explicit string) string {
+	if explicit != "" {
+		return explicit
+	}
+	if env := os.Getenv("DBU_ACTOR"); env != "" {
+		return env
+	}
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return "unknown"
+}
+
+type fileSink struct {
+	f *os.File
+}
+
+// write appends the line and fsyncs so each event is durable on its own.
+func (s fileSink) write(line []byte) error {
+	if _, err := s.f.Write(line); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s fileSink) Close() error {
+	return s.f.Close()
+}
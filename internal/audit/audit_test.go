@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+)
+
+func TestFileSinkAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := os.WriteFile(path, []byte("{\"existing\":true}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	logger, err := Open(config.AuditConfig{File: path}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := logger.Record(Entry{Operation: "backup", Database: "app", Status: "success"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	var entry Entry
+	if err := json.Unmarshal(lines[1], &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Actor != "alice" || entry.Operation != "backup" || entry.Time.IsZero() {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestOpenWithoutSinks(t *testing.T) {
+	logger, err := Open(config.AuditConfig{}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logger != nil {
+		t.Fatal("expected nil logger")
+	}
+	if err := logger.Record(Entry{Operation: "backup"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package audit
+
+import "errors"
+
+func newSyslogSink(string) (sink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
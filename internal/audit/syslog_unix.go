@@ -0,0 +1,25 @@
+//go:build !windows && !plan9
+
+package audit
+
+import "log/syslog"
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink(tag string) (sink, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTHPRIV, tag)
+	if err != nil {
+		return nil, err
+	}
+	return syslogSink{w: w}, nil
+}
+
+func (s syslogSink) write(line []byte) error {
+	return s.w.Info(string(line))
+}
+
+func (s syslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,142 @@
+// Package bench measures the compression codecs and cipher suites on this host
+// (dbu bench), so settings can be chosen from data rather than by rule of thumb.
+package bench
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	mrand "math/rand/v2"
+	"time"
+
+	"github.com/rowjay/db-backup-utility/internal/compress"
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+)
+
+// Result is the measurement of one codec or cipher suite over the dataset.
+type Result struct {
+	Kind string `json:"kind"` // compression or encryption
+	Name string `json:"name"`
+	// Default marks the cipher suite backups are encrypted with on this host.
+	Default     bool    `json:"default,omitempty"`
+	InputBytes  int64   `json:"input_bytes"`
+	OutputBytes int64   `json:"output_bytes"`
+	Ratio       float64 `json:"ratio"` // input over output
+	// Write is the time to compress or encrypt the dataset, Read the time to
+	// decompress or decrypt it again; the throughputs are of the input bytes.
+	Write     time.Duration `json:"write_ns"`
+	Read      time.Duration `json:"read_ns"`
+	WriteMiBs float64       `json:"write_mib_s"`
+	ReadMiBs  float64       `json:"read_mib_s"`
+}
+
+// Run compresses data with each of codecs and encrypts it with each of ciphers,
+// timing both directions. Each round trip is checked against data, so a result
+// is never reported for output that would not restore.
+func Run(ctx context.Context, data []byte, codecs, ciphers []string) ([]Result, error) {
+	defaultCipher, err := cryptoutil.DefaultCipher()
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	var results []Result
+	for _, codec := range codecs {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		res, err := measure(data,
+			func(w io.Writer) (io.WriteCloser, error) { return compress.WrapWriter(codec, w) },
+			func(r io.Reader) (io.Reader, error) { return compress.WrapReader(codec, r) })
+		if err != nil {
+			return results, fmt.Errorf("compression %s: %w", codec, err)
+		}
+		res.Kind, res.Name = "compression", codec
+		results = append(results, res)
+	}
+	for _, cipher := range ciphers {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		res, err := measure(data,
+			func(w io.Writer) (io.WriteCloser, error) { return cryptoutil.EncryptWriterCipher(w, key, cipher) },
+			func(r io.Reader) (io.Reader, error) { return cryptoutil.DecryptReader(r, key) })
+		if err != nil {
+			return results, fmt.Errorf("cipher %s: %w", cipher, err)
+		}
+		res.Kind, res.Name, res.Default = "encryption", cipher, cipher == defaultCipher
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func measure(data []byte, wrap func(io.Writer) (io.WriteCloser, error), unwrap func(io.Reader) (io.Reader, error)) (Result, error) {
+	var out bytes.Buffer
+	out.Grow(len(data))
+	start := time.Now()
+	w, err := wrap(&out)
+	if err != nil {
+		return Result{}, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return Result{}, err
+	}
+	if err := w.Close(); err != nil {
+		return Result{}, err
+	}
+	res := Result{InputBytes: int64(len(data)), OutputBytes: int64(out.Len()), Write: time.Since(start)}
+
+	start = time.Now()
+	r, err := unwrap(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		return Result{}, err
+	}
+	got, err := io.ReadAll(r)
+	if c, ok := r.(io.Closer); ok {
+		c.Close()
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	res.Read = time.Since(start)
+	if !bytes.Equal(got, data) {
+		return Result{}, fmt.Errorf("round trip does not reproduce the input")
+	}
+
+	if res.OutputBytes > 0 {
+		res.Ratio = float64(res.InputBytes) / float64(res.OutputBytes)
+	}
+	res.WriteMiBs = mibPerSecond(res.InputBytes, res.Write)
+	res.ReadMiBs = mibPerSecond(res.InputBytes, res.Read)
+	return res, nil
+}
+
+func mibPerSecond(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / (1 << 20) / d.Seconds()
+}
+
+// Synthetic returns size bytes resembling a SQL dump: INSERT statements over a
+// small vocabulary with random keys, amounts and timestamps, which compress
+// about as well as real table data. The same size always gives the same bytes.
+func Synthetic(size int64) []byte {
+	rng := mrand.New(mrand.NewPCG(1, 2))
+	statuses := []string{"pending", "paid", "shipped", "delivered", "refunded", "cancelled"}
+	cities := []string{"Lagos", "Berlin", "Austin", "Osaka", "Lima", "Nairobi", "Porto", "Hanoi"}
+	epoch := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	buf.Grow(int(size) + 256)
+	for id := 1; int64(buf.Len()) < size; id++ {
+		fmt.Fprintf(&buf, "INSERT INTO orders VALUES (%d, 'customer_%05d', '%s', '%s', %d.%02d, '%s');\n",
+			id, rng.IntN(20000), statuses[rng.IntN(len(statuses))], cities[rng.IntN(len(cities))],
+			rng.IntN(5000), rng.IntN(100), epoch.Add(time.Duration(rng.Int64N(int64(365*24*time.Hour)))).Format(time.DateTime))
+	}
+	return buf.Bytes()[:size]
+}
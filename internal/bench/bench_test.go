@@ -0,0 +1,71 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/rowjay/db-backup-utility/internal/compress"
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+)
+
+func TestSyntheticIsDeterministic(t *testing.T) {
+	data := Synthetic(1 << 16)
+	if len(data) != 1<<16 {
+		t.Fatalf("got %d bytes, want %d", len(data), 1<<16)
+	}
+	if !bytes.Equal(data, Synthetic(1<<16)) {
+		t.Fatal("synthetic data differs between runs")
+	}
+	if !bytes.HasPrefix(data, []byte("INSERT INTO orders VALUES (1, ")) {
+		t.Fatalf("unexpected synthetic data %q", data[:40])
+	}
+}
+
+func TestRun(t *testing.T) {
+	data := Synthetic(1 << 18)
+	results, err := Run(context.Background(), data, compress.Types, cryptoutil.Ciphers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(compress.Types)+len(cryptoutil.Ciphers) {
+		t.Fatalf("got %d results: %+v", len(results), results)
+	}
+	defaults := 0
+	for _, res := range results {
+		if res.InputBytes != int64(len(data)) || res.OutputBytes == 0 || res.Write <= 0 || res.WriteMiBs <= 0 {
+			t.Errorf("incomplete result %+v", res)
+		}
+		switch {
+		case res.Kind == "compression" && res.Name == compress.TypeNone:
+			if res.Ratio != 1 {
+				t.Errorf("uncompressed ratio %v, want 1", res.Ratio)
+			}
+		case res.Kind == "compression":
+			if res.Ratio < 2 {
+				t.Errorf("%s compressed the synthetic dump only %.2fx", res.Name, res.Ratio)
+			}
+		case res.Kind == "encryption":
+			if res.Ratio >= 1 || res.Ratio < 0.99 {
+				t.Errorf("%s ratio %v, want just under 1", res.Name, res.Ratio)
+			}
+			if res.Default {
+				defaults++
+			}
+		}
+	}
+	if defaults != 1 {
+		t.Errorf("want exactly one default cipher, got %d", defaults)
+	}
+
+	if _, err := Run(context.Background(), data, []string{"lz4"}, nil); err == nil {
+		t.Error("expected an unknown codec to fail")
+	}
+	if _, err := Run(context.Background(), data, nil, []string{"rot13"}); err == nil {
+		t.Error("expected an unknown cipher to fail")
+	}
+	if name, err := cryptoutil.DefaultCipher(); err != nil || !slices.Contains(cryptoutil.Ciphers, name) {
+		t.Errorf("DefaultCipher() = %q, %v", name, err)
+	}
+}
@@ -1,19 +1,36 @@
 package compress
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
 
+	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/zstd"
 )
 
 const (
-	TypeNone = "none"
-	TypeGzip = "gzip"
-	TypeZstd = "zstd"
+	TypeNone   = "none"
+	TypeGzip   = "gzip"
+	TypeZstd   = "zstd"
+	TypeBrotli = "br"
 )
 
+// Types lists the supported compression codecs.
+var Types = []string{TypeNone, TypeGzip, TypeZstd, TypeBrotli}
+
+// ZstdWindowLog is the log2 of the window zstd streams are written with, recorded
+// in manifests; MaxZstdWindowLog is the largest window this build decodes.
+const (
+	ZstdWindowLog    = 23
+	MaxZstdWindowLog = 29
+)
+
+// brotliLevel trades some of Brotli's ratio for a throughput usable on large dumps.
+const brotliLevel = brotli.DefaultCompression
+
 func WrapWriter(kind string, w io.Writer) (io.WriteCloser, error) {
 	switch kind {
 	case "", TypeNone:
@@ -21,7 +38,9 @@ func WrapWriter(kind string, w io.Writer) (io.WriteCloser, error) {
 	case TypeGzip:
 		return gzip.NewWriter(w), nil
 	case TypeZstd:
-		return zstd.NewWriter(w)
+		return zstd.NewWriter(w, zstd.WithWindowSize(1<<ZstdWindowLog))
+	case TypeBrotli:
+		return newBrotliWriter(w, brotliLevel), nil
 	default:
 		return nil, fmt.Errorf("unsupported compression: %s", kind)
 	}
@@ -39,15 +58,51 @@ func WrapReader(kind string, r io.Reader) (io.ReadCloser, error) {
 			return nil, err
 		}
 		return zstdReadCloser{Decoder: dec}, nil
+	case TypeBrotli:
+		return io.NopCloser(brotli.NewReader(r)), nil
 	default:
 		return nil, fmt.Errorf("unsupported compression: %s", kind)
 	}
 }
 
+// Detect sniffs the stream's magic bytes and returns the compression type along
+// with a reader that still yields the sniffed bytes.
+func Detect(r io.Reader) (string, io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return "", br, err
+	}
+	return Sniff(head), br, nil
+}
+
+// Sniff identifies the compression of a stream from its leading bytes. Brotli
+// streams have no magic bytes and sniff as TypeNone.
+func Sniff(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return TypeGzip
+	case bytes.HasPrefix(head, zstdMagic):
+		return TypeZstd
+	default:
+		return TypeNone
+	}
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
 type nopWriteCloser struct{ io.Writer }
 
 func (n nopWriteCloser) Close() error { return nil }
 
+// newBrotliWriter compresses at the given level, from brotli.BestSpeed to brotli.BestCompression.
+func newBrotliWriter(w io.Writer, level int) io.WriteCloser {
+	return brotli.NewWriterLevel(w, level)
+}
+
 type zstdReadCloser struct{ *zstd.Decoder }
 
 func (z zstdReadCloser) Close() error {
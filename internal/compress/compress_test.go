@@ -0,0 +1,94 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestDetect(t *testing.T) {
+	for _, kind := range []string{TypeNone, TypeGzip, TypeZstd} {
+		buf := &bytes.Buffer{}
+		w, err := WrapWriter(kind, buf)
+		if err != nil {
+			t.Fatalf("wrap writer %s: %v", kind, err)
+		}
+		if _, err := w.Write([]byte("hello world")); err != nil {
+			t.Fatalf("write %s: %v", kind, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("close %s: %v", kind, err)
+		}
+
+		detected, r, err := Detect(buf)
+		if err != nil {
+			t.Fatalf("detect %s: %v", kind, err)
+		}
+		if detected != kind {
+			t.Fatalf("expected %s, got %s", kind, detected)
+		}
+		rc, err := WrapReader(detected, r)
+		if err != nil {
+			t.Fatalf("wrap reader %s: %v", kind, err)
+		}
+		out, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("read %s: %v", kind, err)
+		}
+		if string(out) != "hello world" {
+			t.Fatalf("unexpected payload for %s: %q", kind, out)
+		}
+	}
+}
+
+func TestBrotliLevels(t *testing.T) {
+	payload := bytes.Repeat([]byte("INSERT INTO users VALUES (1, 'ada');\n"), 500)
+	for _, level := range []int{brotli.BestSpeed, brotliLevel, brotli.BestCompression} {
+		buf := &bytes.Buffer{}
+		w := newBrotliWriter(buf, level)
+		if _, err := w.Write(payload); err != nil {
+			t.Fatalf("write level %d: %v", level, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("close level %d: %v", level, err)
+		}
+		if buf.Len() >= len(payload) {
+			t.Fatalf("level %d did not compress: %d bytes", level, buf.Len())
+		}
+		rc, err := WrapReader(TypeBrotli, buf)
+		if err != nil {
+			t.Fatalf("wrap reader level %d: %v", level, err)
+		}
+		out, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("read level %d: %v", level, err)
+		}
+		if !bytes.Equal(out, payload) {
+			t.Fatalf("level %d did not round-trip", level)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	w, err := WrapWriter(TypeBrotli, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if kind := Sniff(buf.Bytes()); kind != TypeNone {
+		t.Fatalf("brotli sniffed as %s", kind)
+	}
+	rc, err := WrapReader(TypeBrotli, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := io.ReadAll(rc); err != nil || !bytes.Equal(out, payload) {
+		t.Fatalf("brotli did not round-trip: %v", err)
+	}
+}
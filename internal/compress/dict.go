@@ -0,0 +1,80 @@
+package compress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZstdHeaderLen is enough of a zstd stream to read its frame's dictionary ID.
+const ZstdHeaderLen = 14
+
+// TrainDict builds a zstd dictionary of at most maxSize bytes from samples.
+func TrainDict(samples [][]byte, maxSize int) (d []byte, err error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no samples to train a dictionary from")
+	}
+	// The builder panics when no substring is more common than average, e.g. when
+	// every sample is identical.
+	defer func() {
+		if r := recover(); r != nil {
+			d, err = nil, fmt.Errorf("samples have no common content to train a dictionary from")
+		}
+	}()
+	return dict.BuildZstdDict(samples, dict.Options{MaxDictSize: maxSize, HashBytes: 6})
+}
+
+// DictID returns the ID of a zstd dictionary.
+func DictID(d []byte) (uint32, error) {
+	header, err := zstd.InspectDictionary(d)
+	if err != nil {
+		return 0, fmt.Errorf("invalid zstd dictionary: %w", err)
+	}
+	return header.ID(), nil
+}
+
+// FrameDictID returns the dictionary ID declared by the zstd frame that head
+// starts, or 0 when the frame does not need a dictionary.
+func FrameDictID(head []byte) uint32 {
+	if !bytes.HasPrefix(head, zstdMagic) || len(head) < 5 {
+		return 0
+	}
+	fhd := head[4]
+	size := [4]int{0, 1, 2, 4}[fhd&3]
+	pos := 5
+	if fhd&0x20 == 0 {
+		// Not single-segment: a window descriptor precedes the ID.
+		pos++
+	}
+	if size == 0 || len(head) < pos+size {
+		return 0
+	}
+	var id uint32
+	for i := 0; i < size; i++ {
+		id |= uint32(head[pos+i]) << (8 * i)
+	}
+	return id
+}
+
+// WrapWriterDict is WrapWriter for zstd with a shared dictionary.
+func WrapWriterDict(kind string, w io.Writer, d []byte) (io.WriteCloser, error) {
+	if kind != TypeZstd {
+		return nil, fmt.Errorf("compression dictionaries require zstd, not %s", kind)
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderDict(d), zstd.WithWindowSize(1<<ZstdWindowLog))
+}
+
+// WrapReaderDict is WrapReader for zstd streams compressed with dictionary d.
+func WrapReaderDict(kind string, r io.Reader, d []byte) (io.ReadCloser, error) {
+	if kind != TypeZstd {
+		return nil, fmt.Errorf("compression dictionaries require zstd, not %s", kind)
+	}
+	dec, err := zstd.NewReader(r, zstd.WithDecoderDicts(d))
+	if err != nil {
+		return nil, err
+	}
+	return zstdReadCloser{Decoder: dec}, nil
+}
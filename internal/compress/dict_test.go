@@ -0,0 +1,87 @@
+package compress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestDictRoundTrip(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 50; i++ {
+		var b bytes.Buffer
+		for row := 0; row < 40; row++ {
+			fmt.Fprintf(&b, "INSERT INTO tenants (id, name, plan, created_at) VALUES (%d, 'tenant-%d', 'starter', '2024-01-%02d');\n", i*100+row, i, row%28+1)
+		}
+		samples = append(samples, b.Bytes())
+	}
+	d, err := TrainDict(samples, 16<<10)
+	if err != nil {
+		t.Fatalf("train: %v", err)
+	}
+	id, err := DictID(d)
+	if err != nil || id == 0 {
+		t.Fatalf("dict id = %d, %v", id, err)
+	}
+
+	payload := samples[7]
+	buf := &bytes.Buffer{}
+	w, err := WrapWriterDict(TypeZstd, buf, d)
+	if err != nil {
+		t.Fatalf("wrap writer: %v", err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if got := FrameDictID(buf.Bytes()); got != id {
+		t.Fatalf("frame dict id = %d, want %d", got, id)
+	}
+
+	if _, err := io.ReadAll(mustReader(t, TypeZstd, bytes.NewReader(buf.Bytes()), nil)); err == nil {
+		t.Fatalf("expected decoding without the dictionary to fail")
+	}
+	out, err := io.ReadAll(mustReader(t, TypeZstd, bytes.NewReader(buf.Bytes()), d))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(out, payload) {
+		t.Fatalf("payload mismatch")
+	}
+}
+
+func TestTrainDictIdenticalSamples(t *testing.T) {
+	sample := []byte("the same dump, over and over again")
+	if _, err := TrainDict([][]byte{sample, sample, sample}, 4096); err == nil {
+		t.Fatalf("expected an error for samples with nothing in common to learn")
+	}
+}
+
+func TestFrameDictIDWithoutDict(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, _ := WrapWriter(TypeZstd, buf)
+	w.Write([]byte("hello world"))
+	w.Close()
+	if id := FrameDictID(buf.Bytes()); id != 0 {
+		t.Fatalf("expected no dictionary, got %d", id)
+	}
+}
+
+func mustReader(t *testing.T, kind string, r io.Reader, d []byte) io.Reader {
+	t.Helper()
+	var rc io.ReadCloser
+	var err error
+	if d == nil {
+		rc, err = WrapReader(kind, r)
+	} else {
+		rc, err = WrapReaderDict(kind, r, d)
+	}
+	if err != nil {
+		t.Fatalf("wrap reader: %v", err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	return rc
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+	"github.com/rowjay/db-backup-utility/internal/util"
 )
 
 const (
@@ -70,6 +71,19 @@ func Load(path string) (*Config, error) {
 
 	expandEnv(&cfg)
 	applyPostLoadDefaults(&cfg)
+	// Rendered once so every key and listing in this run uses the same prefix.
+	now := time.Now()
+	prefix, err := util.RenderPrefix(cfg.Storage.Prefix, now)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Storage.Prefix = prefix
+	if cfg.Backup.OutputPrefix, err = util.RenderPrefix(cfg.Backup.OutputPrefix, now); err != nil {
+		return nil, err
+	}
+	if cfg.Storage.Tiers.Cold.Prefix, err = util.RenderPrefix(cfg.Storage.Tiers.Cold.Prefix, now); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
 
@@ -131,6 +145,11 @@ func configTypeFromPath(path string) string {
 func setDefaults(vp *viper.Viper) {
 	vp.SetDefault("global.log_level", "info")
 	vp.SetDefault("global.log_format", "json")
+	vp.SetDefault("global.log_stdout", true)
+	vp.SetDefault("global.log_file", "")
+	vp.SetDefault("global.log_max_size_mb", 100)
+	vp.SetDefault("global.log_max_age_days", 30)
+	vp.SetDefault("global.log_max_backups", 5)
 	vp.SetDefault("global.operation_timeout", "2h")
 	vp.SetDefault("backup.type", "full")
 	vp.SetDefault("backup.compression", "zstd")
@@ -141,7 +160,15 @@ func setDefaults(vp *viper.Viper) {
 	vp.SetDefault("backup.include_data", true)
 	vp.SetDefault("storage.backend", "local")
 	vp.SetDefault("storage.local.path", "./backups")
+	vp.SetDefault("storage.s3.resume_attempts", 5)
+	vp.SetDefault("storage.s3.profile", "") // so DBU_STORAGE_S3_PROFILE is read
+	vp.SetDefault("storage.listing_cache_ttl", "0s")
 	vp.SetDefault("schedule.timezone", "")
+	vp.SetDefault("serve.listen", "127.0.0.1:8089")
+	vp.SetDefault("serve.token", "")       // so DBU_SERVE_TOKEN is read
+	vp.SetDefault("restore.url_token", "") // so DBU_RESTORE_URL_TOKEN is read
+	vp.SetDefault("restore.url_timeout", "30s")
+	vp.SetDefault("restore.refuse_if_nonempty", 1)
 }
 
 func applyPostLoadDefaults(cfg *Config) {
@@ -156,14 +183,23 @@ func applyPostLoadDefaults(cfg *Config) {
 func expandEnv(cfg *Config) {
 	cfg.Database.Password = os.ExpandEnv(cfg.Database.Password)
 	cfg.Database.Username = os.ExpandEnv(cfg.Database.Username)
+	for name, profile := range cfg.Profiles {
+		profile.Database.Password = os.ExpandEnv(profile.Database.Password)
+		profile.Database.Username = os.ExpandEnv(profile.Database.Username)
+		cfg.Profiles[name] = profile
+	}
 	cfg.Backup.EncryptionKey = os.ExpandEnv(cfg.Backup.EncryptionKey)
 	cfg.Storage.S3.AccessKey = os.ExpandEnv(cfg.Storage.S3.AccessKey)
 	cfg.Storage.S3.SecretKey = os.ExpandEnv(cfg.Storage.S3.SecretKey)
 	cfg.Storage.S3.SessionToken = os.ExpandEnv(cfg.Storage.S3.SessionToken)
+	cfg.Storage.S3.Proxy = os.ExpandEnv(cfg.Storage.S3.Proxy)
 	cfg.Notifications = expandNotificationEnv(cfg.Notifications)
+	cfg.Serve.Token = os.ExpandEnv(cfg.Serve.Token)
+	cfg.Restore.URLToken = os.ExpandEnv(cfg.Restore.URLToken)
 }
 
 func expandNotificationEnv(cfg NotificationsConfig) NotificationsConfig {
+	cfg.Proxy = os.ExpandEnv(cfg.Proxy)
 	for i := range cfg.Webhooks {
 		cfg.Webhooks[i].URL = os.ExpandEnv(cfg.Webhooks[i].URL)
 	}
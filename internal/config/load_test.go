@@ -0,0 +1,43 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestS3ProfileFromConfigAndEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dbu.yaml")
+	if err := os.WriteFile(path, []byte("storage:\n  s3:\n    profile: from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty.yaml")
+	if err := os.WriteFile(empty, []byte("storage:\n  backend: s3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		path string
+		env  string
+		want string
+	}{
+		{"config file", path, "", "from-file"},
+		{"environment wins over the config file", path, "from-env", "from-env"},
+		{"environment alone", empty, "from-env", "from-env"},
+		{"neither", empty, "", ""},
+	}
+	for _, tc := range cases {
+		t.Setenv("DBU_STORAGE_S3_PROFILE", tc.env)
+		if tc.env == "" {
+			os.Unsetenv("DBU_STORAGE_S3_PROFILE")
+		}
+		cfg, err := Load(tc.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if cfg.Storage.S3.Profile != tc.want {
+			t.Errorf("%s: profile %q, want %q", tc.name, cfg.Storage.S3.Profile, tc.want)
+		}
+	}
+}
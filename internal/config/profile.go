@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ProfileNames returns the profiles in the order they run: by Order, then by name.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		oi, oj := c.Profiles[names[i]].Order, c.Profiles[names[j]].Order
+		if oi != oj {
+			return oi < oj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// ForProfile returns a copy of c that backs up the named profile's database.
+func (c *Config) ForProfile(name string) (*Config, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	cfg := *c
+	cfg.Database = profile.Database
+	cfg.Profiles = nil
+	return &cfg, nil
+}
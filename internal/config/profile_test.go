@@ -0,0 +1,19 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProfileNamesOrder(t *testing.T) {
+	cfg := &Config{Profiles: map[string]Profile{
+		"reports": {Order: 2},
+		"billing": {},
+		"auth":    {},
+		"events":  {Order: -1},
+	}}
+	want := []string{"events", "auth", "billing", "reports"}
+	if got := cfg.ProfileNames(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ProfileNames() = %v, want %v", got, want)
+	}
+}
@@ -12,58 +12,158 @@ type Config struct {
 	Notifications NotificationsConfig `mapstructure:"notifications"`
 	Security      SecurityConfig      `mapstructure:"security"`
 	Schedule      ScheduleConfig      `mapstructure:"schedule"`
+	Audit         AuditConfig         `mapstructure:"audit"`
+	Serve         ServeConfig         `mapstructure:"serve"`
+	// Profiles name the databases "dbu backup --all" backs up, each with the rest
+	// of this config in place of Database.
+	Profiles map[string]Profile `mapstructure:"profiles"`
+}
+
+// Profile is one database backed up by "dbu backup --all".
+type Profile struct {
+	Database DatabaseConfig `mapstructure:"database"`
+	// Order runs profiles with a lower value first; ties run in name order.
+	Order int `mapstructure:"order"`
 }
 
 type GlobalConfig struct {
 	LogLevel          string        `mapstructure:"log_level"`
 	LogFormat         string        `mapstructure:"log_format"` // json or console
+	LogStdout         bool          `mapstructure:"log_stdout"`
+	LogFile           string        `mapstructure:"log_file"` // rotated by size/age when set
+	LogMaxSizeMB      int           `mapstructure:"log_max_size_mb"`
+	LogMaxAgeDays     int           `mapstructure:"log_max_age_days"`
+	LogMaxBackups     int           `mapstructure:"log_max_backups"`
 	LockFile          string        `mapstructure:"lock_file"`
+	LockScope         string        `mapstructure:"lock_scope"`       // global (default) or database
+	LockDirMissing    string        `mapstructure:"lock_dir_missing"` // create (default) or fail
 	OperationTimeout  time.Duration `mapstructure:"operation_timeout"`
 	ConfigPassphrase  string        `mapstructure:"config_passphrase"` // optional; may come from env
 	DisableTelemetry  bool          `mapstructure:"disable_telemetry"`
 	UserAgent         string        `mapstructure:"user_agent"`
 	AllowMissingTools bool          `mapstructure:"allow_missing_tools"`
+	DryRun            bool          `mapstructure:"-"`       // set by backup and restore --dry-run only
+	Verbose           bool          `mapstructure:"verbose"` // stream tool stderr live
 }
 
 type DatabaseConfig struct {
-	Type              string            `mapstructure:"type"` // postgres, mysql, mongodb, sqlite
-	Host              string            `mapstructure:"host"`
-	Port              int               `mapstructure:"port"`
-	Username          string            `mapstructure:"username"`
-	Password          string            `mapstructure:"password"`
-	Database          string            `mapstructure:"database"`
-	Params            map[string]string `mapstructure:"params"`
-	SSLMode           string            `mapstructure:"ssl_mode"`
-	SSLCA             string            `mapstructure:"ssl_ca"`
-	SSLCert           string            `mapstructure:"ssl_cert"`
-	SSLKey            string            `mapstructure:"ssl_key"`
-	ConnectionTimeout time.Duration     `mapstructure:"connection_timeout"`
-	SQLitePath        string            `mapstructure:"sqlite_path"`
+	Type string `mapstructure:"type"` // postgres, mysql, mongodb, sqlite
+	Host string `mapstructure:"host"`
+	Port int    `mapstructure:"port"`
+	// Socket connects over a Unix socket instead of host: the socket directory for
+	// PostgreSQL (port still picks .s.PGSQL.<port> in it), the socket file for MySQL.
+	Socket              string            `mapstructure:"socket"`
+	ReadHost            string            `mapstructure:"read_host"` // read replica that backups dump from; empty uses host
+	ReadPort            int               `mapstructure:"read_port"` // defaults to port
+	Username            string            `mapstructure:"username"`
+	Password            string            `mapstructure:"password"`
+	AuthMethod          string            `mapstructure:"auth_method"` // password (default) or iam
+	AWSRegion           string            `mapstructure:"aws_region"`  // region for iam auth tokens
+	AWSProfile          string            `mapstructure:"aws_profile"` // shared-credentials profile for iam auth
+	Database            string            `mapstructure:"database"`
+	Params              map[string]string `mapstructure:"params"`
+	SSLMode             string            `mapstructure:"ssl_mode"`
+	SSLCA               string            `mapstructure:"ssl_ca"`
+	SSLCert             string            `mapstructure:"ssl_cert"`
+	SSLKey              string            `mapstructure:"ssl_key"`
+	ConnectionTimeout   time.Duration     `mapstructure:"connection_timeout"`
+	ConnectRetries      int               `mapstructure:"connect_retries"` // extra connectivity checks before giving up
+	ConnectRetryBackoff time.Duration     `mapstructure:"connect_retry_backoff"`
+	SQLitePath          string            `mapstructure:"sqlite_path"`
 }
 
 type BackupConfig struct {
-	Type            string        `mapstructure:"type"`        // full, incremental, differential
-	Compression     string        `mapstructure:"compression"` // none, gzip, zstd
-	Encryption      bool          `mapstructure:"encryption"`
-	EncryptionKey   string        `mapstructure:"encryption_key"`
+	Type           string        `mapstructure:"type"`            // full, incremental, differential
+	Compression    string        `mapstructure:"compression"`     // none, gzip, zstd, br
+	ZstdDictionary string        `mapstructure:"zstd_dictionary"` // hex ID of a dictionary trained with "dbu dict train"
+	LegalHold      bool          `mapstructure:"legal_hold"`      // place new backups under legal hold
+	RetainFor      time.Duration `mapstructure:"retain_for"`      // keep new backups at least this long, whatever the retention policy
+	// Labels annotate new backups, e.g. reason: pre-migration; stored in the manifest
+	// and as dbu-label-<key> object metadata.
+	Labels        map[string]string `mapstructure:"labels"`
+	Encryption    bool              `mapstructure:"encryption"`
+	EncryptionKey string            `mapstructure:"encryption_key"`
+	// EncryptManifest encrypts manifests and the other metadata stored next to
+	// backups; unset, it follows Encryption.
+	EncryptManifest *bool `mapstructure:"encrypt_manifest"`
+	// KeyDerivation "database" encrypts each database's backups with a key derived
+	// from EncryptionKey and the database; empty or "none" uses EncryptionKey.
+	KeyDerivation   string        `mapstructure:"key_derivation"`
 	OutputPrefix    string        `mapstructure:"output_prefix"`
 	RetryCount      int           `mapstructure:"retry_count"`
 	RetryBackoff    time.Duration `mapstructure:"retry_backoff"`
+	RetryJitter     time.Duration `mapstructure:"retry_jitter"`      // random extra wait of up to this long per retry
+	RetryMaxElapsed time.Duration `mapstructure:"retry_max_elapsed"` // no retry starts after this long; 0: retry_count only
 	Idempotent      bool          `mapstructure:"idempotent"`
-	MaxParallelism  int           `mapstructure:"max_parallelism"`
+	MaxSizeBytes    int64         `mapstructure:"max_size_bytes"`   // abort a backup storing more than this; 0: no limit
+	MaxDuration     time.Duration `mapstructure:"max_duration"`     // abort a backup running longer than this; 0: no limit
+	MaxParallelism  int           `mapstructure:"max_parallelism"`  // mydumper --threads
+	DumpTool        string        `mapstructure:"dump_tool"`        // MySQL: mysqldump (default) or mydumper
+	ChunkSize       int64         `mapstructure:"chunk_size"`       // bytes per stored part; 0 disables splitting
+	Dedup           bool          `mapstructure:"dedup"`            // store the dump as content-addressed chunks shared between backups
+	DedupChunkSize  int64         `mapstructure:"dedup_chunk_size"` // dump bytes per dedup chunk; 0 uses 16 MiB
+	NoBlobs         bool          `mapstructure:"no_blobs"`         // PostgreSQL: leave large objects out
+	BlobsOnly       bool          `mapstructure:"blobs_only"`       // PostgreSQL: dump only large objects
 	Tables          []string      `mapstructure:"tables"`
+	Schemas         []string      `mapstructure:"schemas"`         // PostgreSQL: dump only these schemas (pg_dump patterns)
+	ExcludeSchemas  []string      `mapstructure:"exclude_schemas"` // PostgreSQL: leave these schemas out
 	Collections     []string      `mapstructure:"collections"`
 	IncludeSchema   bool          `mapstructure:"include_schema"`
 	IncludeData     bool          `mapstructure:"include_data"`
+	TableChecksums  bool          `mapstructure:"table_checksums"` // record per-table checksums on full backups as a differential base
 	RetentionPolicy Retention     `mapstructure:"retention"`
+	PreHook         string        `mapstructure:"pre_hook"`  // shell command run before the dump; failure aborts
+	PostHook        string        `mapstructure:"post_hook"` // shell command run after the dump, even on failure
+	// RequireToolVersion lists constraints such as "pg_dump >= 15" checked before each backup.
+	RequireToolVersion []string `mapstructure:"require_tool_version"`
+	// Overrides replace settings for one backup type, keyed by type.
+	Overrides map[string]BackupOverride `mapstructure:"overrides"`
+}
+
+// BackupOverride holds per-type settings; unset fields keep the base value.
+type BackupOverride struct {
+	Compression    string `mapstructure:"compression"`
+	ZstdDictionary string `mapstructure:"zstd_dictionary"`
+	Encryption     *bool  `mapstructure:"encryption"`
 }
 
 type RestoreConfig struct {
-	DryRun       bool     `mapstructure:"dry_run"`
-	Tables       []string `mapstructure:"tables"`
-	Collections  []string `mapstructure:"collections"`
-	StopOnError  bool     `mapstructure:"stop_on_error"`
-	DropExisting bool     `mapstructure:"drop_existing"`
+	DryRun      bool     `mapstructure:"dry_run"`
+	Tables      []string `mapstructure:"tables"`
+	Schemas     []string `mapstructure:"schemas"` // PostgreSQL: restore only these schemas
+	Collections []string `mapstructure:"collections"`
+	StopOnError bool     `mapstructure:"stop_on_error"`
+	// SingleTransaction restores in one transaction that is rolled back if any
+	// statement fails (PostgreSQL); it implies StopOnError.
+	SingleTransaction bool `mapstructure:"single_transaction"`
+	// RefuseIfNonempty refuses a restore into a database that already holds at
+	// least this many tables or collections, unless DropExisting or --force is
+	// given; 0 turns the check off.
+	RefuseIfNonempty int    `mapstructure:"refuse_if_nonempty"`
+	DropExisting     bool   `mapstructure:"drop_existing"`
+	PreHook          string `mapstructure:"pre_hook"`
+	PostHook         string `mapstructure:"post_hook"`
+	// CreateDatabase creates the target database before restoring; an existing one is
+	// only dropped and recreated when DropExisting is also set.
+	CreateDatabase bool              `mapstructure:"create_database"`
+	TableMap       map[string]string `mapstructure:"table_map"`      // restore only these tables, under new names (PostgreSQL)
+	DatabaseOwner  string            `mapstructure:"database_owner"` // PostgreSQL only
+	Charset        string            `mapstructure:"charset"`        // encoding (PostgreSQL) or character set (MySQL)
+	Collation      string            `mapstructure:"collation"`
+	// Assertions are checked against the restored database; the restore fails if any does not hold.
+	Assertions []Assertion `mapstructure:"assertions"`
+	// URLToken is sent as a bearer token when restoring from a URL (--url).
+	// URLTimeout bounds the wait for the server to answer, not the download.
+	URLToken   string        `mapstructure:"url_token"`
+	URLTimeout time.Duration `mapstructure:"url_timeout"`
+}
+
+// Assertion is a query run after a restore (restore.assertions). Its result, the
+// first column of the first row, must satisfy Expect.
+type Assertion struct {
+	Name   string `mapstructure:"name"`
+	Query  string `mapstructure:"query"`  // SQL, or a mongosh expression for MongoDB
+	Expect string `mapstructure:"expect"` // e.g. "> 0" or "= 42"; empty requires a true or non-zero result
 }
 
 type Retention struct {
@@ -71,6 +171,11 @@ type Retention struct {
 	KeepDays int           `mapstructure:"keep_days"`
 	MaxBytes int64         `mapstructure:"max_bytes"`
 	Schedule time.Duration `mapstructure:"schedule"`
+	// KeepLabeled keeps every backup that carries labels, like a hold.
+	KeepLabeled bool `mapstructure:"keep_labeled"`
+	// KeepFull keeps the latest KeepFull full backups, and the differentials built
+	// on them, whatever the other settings say.
+	KeepFull int `mapstructure:"keep_full"`
 }
 
 type StorageConfig struct {
@@ -79,10 +184,32 @@ type StorageConfig struct {
 	S3      S3Store    `mapstructure:"s3"`
 	Prefix  string     `mapstructure:"prefix"`
 	Tags    []string   `mapstructure:"tags"`
+	// Tiers moves backups that retention expires to a cold location instead of deleting them.
+	Tiers StorageTiers `mapstructure:"tiers"`
+	// ListingCacheTTL shares storage listings across the runs of one process for
+	// this long; 0 lists afresh on every run.
+	ListingCacheTTL time.Duration `mapstructure:"listing_cache_ttl"`
+}
+
+type StorageTiers struct {
+	Cold ColdTier `mapstructure:"cold"`
+}
+
+// ColdTier is where retention moves expired backups. Backend, Local and S3 describe a
+// separate store; when Backend is empty the primary store is used under Prefix.
+type ColdTier struct {
+	Prefix    string     `mapstructure:"prefix"` // enables tiering
+	Backend   string     `mapstructure:"backend"`
+	Local     LocalStore `mapstructure:"local"`
+	S3        S3Store    `mapstructure:"s3"`
+	Retention Retention  `mapstructure:"retention"` // deletes from the cold tier; unset keeps backups forever
 }
 
 type LocalStore struct {
-	Path string `mapstructure:"path"`
+	Path      string `mapstructure:"path"`
+	Immutable bool   `mapstructure:"immutable"` // read-only files, chattr +i where available
+	FileMode  string `mapstructure:"file_mode"` // octal, e.g. "0640"; default 0600
+	DirMode   string `mapstructure:"dir_mode"`  // octal, e.g. "0750"; default 0750
 }
 
 type S3Store struct {
@@ -95,36 +222,74 @@ type S3Store struct {
 	ForcePathStyle  bool   `mapstructure:"force_path_style"`
 	SessionToken    string `mapstructure:"session_token"`
 	TLSInsecureSkip bool   `mapstructure:"tls_insecure_skip"`
+	CACert          string `mapstructure:"ca_cert"`         // PEM bundle trusted in addition to the system roots
+	Profile         string `mapstructure:"profile"`         // shared AWS config/SSO profile; overrides static keys
+	ResumeAttempts  int    `mapstructure:"resume_attempts"` // reconnects with a range request when a download drops
+	Proxy           string `mapstructure:"proxy"`           // proxy URL, or "none"; empty uses HTTPS_PROXY/NO_PROXY
 }
 
 type NotificationsConfig struct {
 	Webhooks   []WebhookConfig  `mapstructure:"webhooks"`
 	Mattermost []MattermostHook `mapstructure:"mattermost"`
 	Matrix     []MatrixConfig   `mapstructure:"matrix"`
+	Throttle   ThrottleConfig   `mapstructure:"throttle"`
+	Proxy      string           `mapstructure:"proxy"` // proxy URL, or "none"; empty uses HTTPS_PROXY/NO_PROXY
+}
+
+// ThrottleConfig limits repeated failure alerts for the same database and error.
+type ThrottleConfig struct {
+	Interval  time.Duration `mapstructure:"interval"`   // 0 sends every alert
+	StateFile string        `mapstructure:"state_file"` // shares counters across runs, e.g. from cron
+}
+
+// NotifierFilter restricts which events a notifier receives. Empty lists match everything.
+type NotifierFilter struct {
+	Events []string `mapstructure:"events"` // backup, restore, clone
+	On     []string `mapstructure:"on"`     // success, failure
 }
 
 type WebhookConfig struct {
-	Name    string            `mapstructure:"name"`
-	URL     string            `mapstructure:"url"`
-	Headers map[string]string `mapstructure:"headers"`
+	Name           string            `mapstructure:"name"`
+	URL            string            `mapstructure:"url"`
+	Headers        map[string]string `mapstructure:"headers"`
+	NotifierFilter `mapstructure:",squash"`
 }
 
 type MattermostHook struct {
-	Name string `mapstructure:"name"`
-	URL  string `mapstructure:"url"`
+	Name           string `mapstructure:"name"`
+	URL            string `mapstructure:"url"`
+	NotifierFilter `mapstructure:",squash"`
 }
 
 type MatrixConfig struct {
-	Name        string `mapstructure:"name"`
-	ServerURL   string `mapstructure:"server_url"`
-	AccessToken string `mapstructure:"access_token"`
-	RoomID      string `mapstructure:"room_id"`
+	Name           string `mapstructure:"name"`
+	ServerURL      string `mapstructure:"server_url"`
+	AccessToken    string `mapstructure:"access_token"`
+	RoomID         string `mapstructure:"room_id"`
+	NotifierFilter `mapstructure:",squash"`
+}
+
+// AuditConfig controls the append-only audit trail, kept separate from operational logs.
+type AuditConfig struct {
+	File      string `mapstructure:"file"`
+	Syslog    bool   `mapstructure:"syslog"`
+	SyslogTag string `mapstructure:"syslog_tag"`
+	Actor     string `mapstructure:"actor"` // defaults to DBU_ACTOR, then the OS user
 }
 
 type SecurityConfig struct {
 	MinTLSVersion string `mapstructure:"min_tls_version"`
 }
 
+// ServeConfig configures dbu serve, the read-only HTTP download server.
+type ServeConfig struct {
+	Listen string `mapstructure:"listen"` // host:port; defaults to 127.0.0.1:8089
+	Token  string `mapstructure:"token"`  // required bearer token
+	// TLSCert and TLSKey serve HTTPS when both are set.
+	TLSCert string `mapstructure:"tls_cert"`
+	TLSKey  string `mapstructure:"tls_key"`
+}
+
 type ScheduleConfig struct {
 	WindowStart string `mapstructure:"window_start"` // HH:MM local time
 	WindowEnd   string `mapstructure:"window_end"`
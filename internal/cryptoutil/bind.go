@@ -0,0 +1,49 @@
+package cryptoutil
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"github.com/minio/sio"
+)
+
+// MaxPackageLen is the size of the largest DARE package. A bufio.Reader passed to
+// OpensWith must be at least this large.
+const MaxPackageLen = 16 + 1<<16 + 16
+
+// bindInfo prefixes the HKDF info so bound keys never collide with other uses.
+const bindInfo = "dbu stream binding v1\x00"
+
+// BindKey derives the key for a stream bound to binding, such as the identity of
+// the backup it holds. DARE has no associated data, so the binding goes into the
+// key: a stream sealed with BindKey(key, b) fails authentication under any other
+// binding, which serves as associated data would.
+func BindKey(key []byte, binding string) ([]byte, error) {
+	return hkdf.Key(sha256.New, key, nil, bindInfo+binding, len(key))
+}
+
+// OpensWith reports whether the first DARE package buffered in r authenticates
+// under key, without consuming it. r must be at least MaxPackageLen in size.
+func OpensWith(r *bufio.Reader, key []byte) bool {
+	header, err := r.Peek(4)
+	if err != nil {
+		return false
+	}
+	// Both DARE versions keep the payload length, minus one, in bytes 2 and 3.
+	n := 16 + int(binary.LittleEndian.Uint16(header[2:4])) + 1 + 16
+	first, err := r.Peek(n)
+	if err != nil {
+		return false
+	}
+	plain, err := sio.DecryptReader(bytes.NewReader(first), sio.Config{Key: key})
+	if err != nil {
+		return false
+	}
+	var b [1]byte
+	_, err = io.ReadFull(plain, b[:])
+	return err == nil
+}
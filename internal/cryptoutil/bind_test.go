@@ -0,0 +1,49 @@
+package cryptoutil
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestBindKeyOpensOnlyItsBinding(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	bound, err := BindKey(key, "postgres\x00appdb\x0020240101T000000Z_full.backup.enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := BindKey(key, "postgres\x00appdb\x0020240102T000000Z_full.backup.enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Several packages, so the probe sees a first package that is not final.
+	plain := bytes.Repeat([]byte("row data\n"), 20000)
+	var sealed bytes.Buffer
+	w, err := EncryptWriter(&sealed, bound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReaderSize(bytes.NewReader(sealed.Bytes()), MaxPackageLen)
+	if OpensWith(r, key) || OpensWith(r, other) {
+		t.Fatal("stream opened under another binding")
+	}
+	if !OpensWith(r, bound) {
+		t.Fatal("stream did not open under its own binding")
+	}
+	dec, err := DecryptReader(r, bound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(dec)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("probing consumed the stream: %d bytes, %v", len(got), err)
+	}
+}
@@ -1,6 +1,8 @@
 package cryptoutil
 
 import (
+	"crypto/hkdf"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
@@ -36,3 +38,25 @@ func ParseKey(key string) ([]byte, error) {
 	}
 	return data, nil
 }
+
+// Fingerprint identifies a key without revealing it, for recording in manifests.
+func Fingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// KeyDerivationHKDF names HKDF-SHA256 without a salt, which the already uniformly
+// random master key does not need. Manifests record it with the info used.
+const KeyDerivationHKDF = "hkdf-sha256"
+
+// DatabaseKeyInfo is the HKDF info of a database's key. The type and name are
+// separated so that no two databases share an info string.
+func DatabaseKeyInfo(dbType, database string) string {
+	return "dbu database key v1\x00" + dbType + "\x00" + database
+}
+
+// DeriveKey derives a key of master's length for info from master. The same
+// inputs always give the same key, so derived keys need no storage.
+func DeriveKey(master []byte, info string) ([]byte, error) {
+	return hkdf.Key(sha256.New, master, nil, info, len(master))
+}
@@ -1,7 +1,9 @@
 package cryptoutil
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/hex"
 	"testing"
 )
 
@@ -16,3 +18,56 @@ func TestParseKeyBase64(t *testing.T) {
 		t.Fatalf("unexpected key length: %d", len(parsed))
 	}
 }
+
+func TestFingerprint(t *testing.T) {
+	a := make([]byte, 32)
+	b := make([]byte, 32)
+	b[0] = 1
+	if Fingerprint(a) != Fingerprint(a) {
+		t.Fatal("fingerprint is not stable")
+	}
+	if Fingerprint(a) == Fingerprint(b) {
+		t.Fatal("different keys share a fingerprint")
+	}
+	if len(Fingerprint(a)) != 16 {
+		t.Fatalf("unexpected fingerprint length: %d", len(Fingerprint(a)))
+	}
+}
+
+// goldenAppdbKey is HKDF-SHA256 of 32 bytes of 7 for postgres/appdb, computed independently.
+const goldenAppdbKey = "106bd45132dba258c272f03f0442c8f3cdcbcd1e4fff4eea8e12829d94de6b9b"
+
+func TestDeriveKeyIsDeterministic(t *testing.T) {
+	master := bytes.Repeat([]byte{7}, 32)
+	derive := func(master []byte, dbType, database string) []byte {
+		t.Helper()
+		key, err := DeriveKey(master, DatabaseKeyInfo(dbType, database))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(key) != 32 {
+			t.Fatalf("unexpected key length: %d", len(key))
+		}
+		return key
+	}
+
+	appdb := derive(master, "postgres", "appdb")
+	if !bytes.Equal(appdb, derive(master, "postgres", "appdb")) {
+		t.Fatal("derivation is not deterministic")
+	}
+	// Golden value: a change here would strand every backup taken with derived keys.
+	if got := hex.EncodeToString(appdb); got != goldenAppdbKey {
+		t.Fatalf("derived key = %s, want %s", got, goldenAppdbKey)
+	}
+	for name, other := range map[string][]byte{
+		"master":         master,
+		"other database": derive(master, "postgres", "billing"),
+		"other type":     derive(master, "mysql", "appdb"),
+		"shifted names":  derive(master, "postgres\x00app", "db"),
+		"other master":   derive(bytes.Repeat([]byte{8}, 32), "postgres", "appdb"),
+	} {
+		if bytes.Equal(appdb, other) {
+			t.Fatalf("derived key equals the key of %s", name)
+		}
+	}
+}
@@ -17,16 +17,70 @@ const (
 	configVer   = uint16(1)
 )
 
+// Cipher suites of the DARE stream. EncryptWriter uses AES-256-GCM where the CPU
+// accelerates AES and ChaCha20-Poly1305 elsewhere; DecryptReader reads either.
+const (
+	CipherAES256GCM        = "aes-256-gcm"
+	CipherChaCha20Poly1305 = "chacha20-poly1305"
+)
+
+// Ciphers lists the supported cipher suites.
+var Ciphers = []string{CipherAES256GCM, CipherChaCha20Poly1305}
+
+var cipherSuites = map[string]byte{
+	CipherAES256GCM:        sio.AES_256_GCM,
+	CipherChaCha20Poly1305: sio.CHACHA20_POLY1305,
+}
+
 // EncryptWriter returns a streaming encrypting writer using DARE (sio).
 func EncryptWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
 	return sio.EncryptWriter(w, sio.Config{Key: key})
 }
 
+// EncryptWriterCipher is EncryptWriter with the cipher suite named by cipher.
+func EncryptWriterCipher(w io.Writer, key []byte, cipher string) (io.WriteCloser, error) {
+	suite, ok := cipherSuites[cipher]
+	if !ok {
+		return nil, fmt.Errorf("unsupported cipher: %s", cipher)
+	}
+	return sio.EncryptWriter(w, sio.Config{Key: key, CipherSuites: []byte{suite}})
+}
+
+// DefaultCipher names the cipher suite EncryptWriter uses on this host, as the
+// header of a stream it writes shows.
+func DefaultCipher() (string, error) {
+	var buf bytes.Buffer
+	w, err := EncryptWriter(&buf, make([]byte, 32))
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write([]byte{0}); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	for name, suite := range cipherSuites {
+		if buf.Len() > 1 && buf.Bytes()[1] == suite {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown cipher suite in stream header")
+}
+
 // DecryptReader returns a streaming decrypting reader using DARE (sio).
 func DecryptReader(r io.Reader, key []byte) (io.Reader, error) {
 	return sio.DecryptReader(r, sio.Config{Key: key})
 }
 
+// IsEncryptedStream reports whether head starts with a DARE package header.
+func IsEncryptedStream(head []byte) bool {
+	if len(head) < 2 {
+		return false
+	}
+	return (head[0] == sio.Version20 || head[0] == sio.Version10) && head[1] <= sio.CHACHA20_POLY1305
+}
+
 // EncryptConfig encrypts a config payload with a small header.
 func EncryptConfig(plain []byte, key []byte) ([]byte, error) {
 	buf := &bytes.Buffer{}
@@ -58,6 +112,11 @@ func EncryptConfig(plain []byte, key []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// IsEncryptedConfig reports whether data carries the EncryptConfig header.
+func IsEncryptedConfig(data []byte) bool {
+	return len(data) >= 4 && string(data[:4]) == configMagic
+}
+
 // DecryptConfig decrypts a config payload.
 func DecryptConfig(ciphertext []byte, key []byte) ([]byte, error) {
 	if len(ciphertext) < 4+2+12 {
@@ -0,0 +1,39 @@
+package cryptoutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIsEncryptedStream(t *testing.T) {
+	var sealed bytes.Buffer
+	w, err := EncryptWriter(&sealed, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("dump")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		head []byte
+		want bool
+	}{
+		{"DARE stream", sealed.Bytes()[:4], true},
+		{"gzip", []byte{0x1f, 0x8b, 0x08, 0x00}, false},
+		{"SQL text", []byte("-- P"), false},
+		{"too short", sealed.Bytes()[:1], false},
+		// Only the version and cipher bytes are checked, so plaintext can match;
+		// restore confirms a match by decrypting.
+		{"plaintext lookalike", []byte{0x20, 0x00, 'a', 'b'}, true},
+	}
+	for _, tc := range cases {
+		if got := IsEncryptedStream(tc.head); got != tc.want {
+			t.Errorf("%s: IsEncryptedStream(%x) = %v, want %v", tc.name, tc.head, got, tc.want)
+		}
+	}
+}
@@ -12,21 +12,112 @@ import (
 type Adapter interface {
 	Name() string
 	Validate(ctx context.Context, cfg config.DatabaseConfig) error
+	// PreflightRestore checks the privileges the restore needs before it starts. A
+	// *PreflightWarning reports a check it could not settle from cfg and restore.
+	PreflightRestore(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig) error
 	Dump(ctx context.Context, cfg config.DatabaseConfig, backup config.BackupConfig) (*DumpStream, error)
 	Restore(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig, manifest storage.Manifest) (*RestoreStream, error)
 	Capabilities() Capabilities
 }
 
+// PreflightWarning is returned by PreflightRestore for a missing privilege the
+// restore may not need, e.g. CREATE on a schema the dump might not touch. Callers
+// log it and go on.
+type PreflightWarning struct{ Err error }
+
+func (w *PreflightWarning) Error() string { return w.Err.Error() }
+func (w *PreflightWarning) Unwrap() error { return w.Err }
+
 type Capabilities struct {
 	Incremental       bool
 	Differential      bool
 	TableRestore      bool
 	CollectionRestore bool
+	TableRename       bool // restore.table_map
+	LargeObjects      bool // backup.no_blobs and backup.blobs_only
+	Schemas           bool // backup.schemas, backup.exclude_schemas and restore.schemas
+	SingleTransaction bool // restore.single_transaction
+}
+
+// ContentLister is implemented by adapters that can enumerate the objects inside a dump stream.
+type ContentLister interface {
+	ListContents(ctx context.Context, r io.Reader) ([]DumpObject, error)
+}
+
+// TableChecksummer is implemented by adapters that can fingerprint table contents.
+// Differential backups compare these against the base and dump only changed tables.
+type TableChecksummer interface {
+	// TableChecksums returns a checksum per table; with no tables it covers every table.
+	TableChecksums(ctx context.Context, cfg config.DatabaseConfig, tables []string) (map[string]string, error)
+}
+
+// DatabaseCreator is implemented by adapters that can create the target database
+// before a restore (restore.create_database).
+type DatabaseCreator interface {
+	CreateDatabase(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig) error
+	// MaintenanceDatabase returns cfg pointed at the database CreateDatabase
+	// connects to, which exists before the target does.
+	MaintenanceDatabase(cfg config.DatabaseConfig) config.DatabaseConfig
+}
+
+// SizeEstimator is implemented by adapters that can report a database's approximate
+// size without dumping it (dbu backup --estimate).
+type SizeEstimator interface {
+	EstimateSize(ctx context.Context, cfg config.DatabaseConfig) (int64, error)
+}
+
+// Querier is implemented by adapters that can evaluate a query with the engine's
+// client: SQL, or a mongosh expression for MongoDB (restore.assertions).
+type Querier interface {
+	// Query returns the first column of the first row the client printed.
+	Query(ctx context.Context, cfg config.DatabaseConfig, query string) (string, error)
+}
+
+// ObjectCounter is implemented by adapters that can count the user tables, or
+// collections for MongoDB, in a database (restore.refuse_if_nonempty).
+type ObjectCounter interface {
+	CountObjects(ctx context.Context, cfg config.DatabaseConfig) (int, error)
+}
+
+// DumpObject is one entry in a dump's table of contents. Size is the bytes the
+// entry takes up in the dump where the format shows it, otherwise 0.
+type DumpObject struct {
+	Kind   string
+	Schema string
+	Name   string
+	Size   int64
+}
+
+// FindTable reports whether the table, optionally schema-qualified, is present in objects.
+func FindTable(objects []DumpObject, table string) bool {
+	for _, obj := range objects {
+		if obj.Kind != "TABLE" {
+			continue
+		}
+		if obj.Name == table || (obj.Schema != "" && obj.Schema+"."+obj.Name == table) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindSchema reports whether the schema, or any object in it, is present in objects.
+func FindSchema(objects []DumpObject, schema string) bool {
+	for _, obj := range objects {
+		if obj.Schema == schema || (obj.Kind == "SCHEMA" && obj.Name == schema) {
+			return true
+		}
+	}
+	return false
 }
 
 type DumpStream struct {
 	Reader io.ReadCloser
 	Wait   func() error
+	// Container names the framing of Reader when it bundles several files (ContainerTar).
+	Container string
+	// Tool names the dump program when the adapter supports several (backup.dump_tool).
+	Tool string
 }
 
 type RestoreStream struct {
@@ -34,16 +125,19 @@ type RestoreStream struct {
 	Wait   func() error
 }
 
-func NewAdapter(dbType string, allowMissingTools bool) (Adapter, error) {
+// Types lists the database types NewAdapter accepts, without aliases.
+var Types = []string{"postgres", "mysql", "mariadb", "mongodb", "sqlite"}
+
+func NewAdapter(dbType string, opts Options) (Adapter, error) {
 	switch dbType {
 	case "postgres", "postgresql":
-		return NewPostgresAdapter(allowMissingTools), nil
+		return NewPostgresAdapter(opts), nil
 	case "mysql", "mariadb":
-		return NewMySQLAdapter(allowMissingTools), nil
+		return NewMySQLAdapter(opts), nil
 	case "mongodb", "mongo":
-		return NewMongoAdapter(allowMissingTools), nil
+		return NewMongoAdapter(opts), nil
 	case "sqlite", "sqlite3":
-		return NewSQLiteAdapter(), nil
+		return NewSQLiteAdapter(opts), nil
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", dbType)
 	}
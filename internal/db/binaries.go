@@ -0,0 +1,42 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+// Install hints for the client tools the adapters run, by binary name.
+const (
+	postgresHint = "install the PostgreSQL client tools: apt install postgresql-client, yum install postgresql, or brew install libpq (then add $(brew --prefix libpq)/bin to PATH)"
+	mysqlHint    = "install the MySQL client tools: apt install default-mysql-client (or mariadb-client), yum install mysql, or brew install mysql-client (then add $(brew --prefix mysql-client)/bin to PATH)"
+	mydumperHint = "install mydumper, which includes myloader: apt install mydumper, yum install the RPM from github.com/mydumper/mydumper/releases, or brew install mydumper"
+	mongoHint    = "install the MongoDB Database Tools: apt or yum install mongodb-database-tools from the MongoDB repository, or brew install mongodb/brew/mongodb-database-tools"
+)
+
+var installHints = map[string]string{
+	"pg_dump":      postgresHint,
+	"pg_restore":   postgresHint,
+	"pg_isready":   postgresHint,
+	"psql":         postgresHint,
+	"mysqldump":    mysqlHint,
+	"mysql":        mysqlHint,
+	"mysqladmin":   mysqlHint,
+	"mydumper":     mydumperHint,
+	"myloader":     mydumperHint,
+	"mongodump":    mongoHint,
+	"mongorestore": mongoHint,
+	"mongosh":      "install mongosh: apt or yum install mongodb-mongosh from the MongoDB repository, or brew install mongosh",
+	"sqlite3":      "install the SQLite shell: apt install sqlite3, yum install sqlite, or brew install sqlite",
+}
+
+// requireBinary is util.RequireBinary with a hint on installing the tools dbu
+// knows. The error is still a *util.MissingBinaryError.
+func requireBinary(name string) error {
+	err := util.RequireBinary(name)
+	var missing *util.MissingBinaryError
+	if errors.As(err, &missing) {
+		missing.Hint = installHints[name]
+	}
+	return err
+}
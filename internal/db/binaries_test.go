@@ -0,0 +1,38 @@
+package db
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+func TestRequireBinaryHints(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+
+	err := requireBinary("pg_dump")
+	var missing *util.MissingBinaryError
+	if !errors.As(err, &missing) || !errors.Is(err, exec.ErrNotFound) {
+		t.Fatalf("expected a missing binary error, got %v", err)
+	}
+	if missing.Name != "pg_dump" || missing.Path != dir || missing.Hint != postgresHint {
+		t.Fatalf("unexpected error %+v", missing)
+	}
+	for _, want := range []string{"required binary not found: pg_dump", dir, "apt install postgresql-client"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	if err := requireBinary("dbu-no-such-tool"); !errors.As(err, &missing) || missing.Hint != "" {
+		t.Fatalf("expected an unknown tool to have no hint, got %v", err)
+	}
+	for _, tool := range []string{"pg_dump", "pg_restore", "psql", "mysqldump", "mysql", "mydumper", "mongodump", "mongorestore", "mongosh", "sqlite3", "myloader"} {
+		if installHints[tool] == "" {
+			t.Errorf("no install hint for %s", tool)
+		}
+	}
+}
@@ -1,7 +1,141 @@
 package db
 
-import "os"
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-func stderrSink() *os.File {
-	return os.Stderr
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+// Options tune how adapters run the vendor tools.
+type Options struct {
+	AllowMissingTools bool
+	// Verbose mirrors tool stderr to the console as it is written.
+	Verbose bool
+}
+
+const defaultConnectRetryBackoff = 2 * time.Second
+
+// pingWithRetry runs a fresh connectivity check from build up to cfg.ConnectRetries
+// extra times, so a database that is briefly failing over does not fail the run.
+func pingWithRetry(ctx context.Context, cfg config.DatabaseConfig, build func() *exec.Cmd) error {
+	backoff := cfg.ConnectRetryBackoff
+	if backoff <= 0 {
+		backoff = defaultConnectRetryBackoff
+	}
+	return util.Retry(ctx, cfg.ConnectRetries+1, backoff, func() error {
+		cmd := build()
+		annotate := captureStderr(cmd, false)
+		return annotate(cmd.Run())
+	})
+}
+
+// stderrTail is the amount of tool stderr kept to explain a failure.
+const stderrTail = 4096
+
+// toolWaitDelay bounds how long Wait waits for a cancelled tool to exit, and for
+// its stderr to close when a child it spawned still holds it open.
+const toolWaitDelay = 5 * time.Second
+
+// captureStderr keeps the tail of cmd's stderr (mirroring it live when verbose) and
+// returns a function that appends that tail to a non-nil error from the command.
+func captureStderr(cmd *exec.Cmd, verbose bool) func(error) error {
+	tail := &tailBuffer{max: stderrTail}
+	cmd.Stderr = tail
+	cmd.WaitDelay = toolWaitDelay
+	if verbose {
+		cmd.Stderr = io.MultiWriter(tail, os.Stderr)
+	}
+	return func(err error) error {
+		if err == nil {
+			return nil
+		}
+		if msg := strings.TrimSpace(tail.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, msg)
+		}
+		return fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+}
+
+// tailBuffer retains only the last max bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.max:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
+
+// parseChecksumRows reads "table<sep>checksum" lines, dropping prefix from table names.
+// A NULL checksum means the table does not exist.
+func parseChecksumRows(out, sep, prefix string) (map[string]string, error) {
+	sums := map[string]string{}
+	for _, line := range nonEmptyLines(out) {
+		i := strings.LastIndex(line, sep)
+		if i < 0 {
+			return nil, fmt.Errorf("unexpected checksum output %q", line)
+		}
+		name, sum := strings.TrimPrefix(line[:i], prefix), line[i+len(sep):]
+		if sum == "" || sum == "NULL" {
+			return nil, fmt.Errorf("table %s not found", name)
+		}
+		sums[name] = sum
+	}
+	return sums, nil
+}
+
+// parseSize reads a single numeric value printed by a client tool. Engines may
+// report sizes as floating point.
+func parseSize(out string) (int64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected size output %q", strings.TrimSpace(out))
+	}
+	return int64(value), nil
+}
+
+// firstValue returns the first column of the first line a client printed; an
+// empty sep keeps the whole line.
+func firstValue(out, sep string) string {
+	lines := nonEmptyLines(out)
+	if len(lines) == 0 {
+		return ""
+	}
+	if sep == "" {
+		return lines[0]
+	}
+	value, _, _ := strings.Cut(lines[0], sep)
+	return strings.TrimSpace(value)
+}
+
+func nonEmptyLines(out string) []string {
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
 }
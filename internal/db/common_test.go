@@ -0,0 +1,67 @@
+package db
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestCaptureStderrAnnotatesFailure(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "echo first >&2; echo boom >&2; exit 3")
+	annotate := captureStderr(cmd, false)
+	err := annotate(cmd.Run())
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected stderr in error, got %v", err)
+	}
+	if annotate(nil) != nil {
+		t.Fatal("expected nil for success")
+	}
+}
+
+func TestTailBufferKeepsTail(t *testing.T) {
+	tail := &tailBuffer{max: 4}
+	_, _ = tail.Write([]byte("abc"))
+	_, _ = tail.Write([]byte("defg"))
+	if got := tail.String(); got != "defg" {
+		t.Fatalf("unexpected tail: %q", got)
+	}
+}
+
+func TestParseChecksumRows(t *testing.T) {
+	sums, err := parseChecksumRows("appdb.users\t123\nappdb.orders\t456\n\n", "\t", "appdb.")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if sums["users"] != "123" || sums["orders"] != "456" || len(sums) != 2 {
+		t.Fatalf("unexpected sums: %v", sums)
+	}
+	if _, err := parseChecksumRows("appdb.gone\tNULL\n", "\t", "appdb."); err == nil {
+		t.Fatal("expected error for missing table")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for out, want := range map[string]int64{"8192\n": 8192, " 1.5e+06 ": 1500000, "0": 0} {
+		got, err := parseSize(out)
+		if err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", out, got, err, want)
+		}
+	}
+	if _, err := parseSize("ERROR"); err == nil {
+		t.Error("expected an error for non-numeric output")
+	}
+}
+
+func TestFirstValue(t *testing.T) {
+	cases := []struct{ out, sep, want string }{
+		{"42|ada\n7|grace\n", "|", "42"},
+		{"\n 3\tusers \n", "\t", "3"},
+		{"{ ok: 1 }\n", "", "{ ok: 1 }"},
+		{"", "|", ""},
+	}
+	for _, c := range cases {
+		if got := firstValue(c.out, c.sep); got != c.want {
+			t.Errorf("firstValue(%q, %q) = %q, want %q", c.out, c.sep, got, c.want)
+		}
+	}
+}
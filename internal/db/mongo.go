@@ -1,8 +1,11 @@
 package db
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os/exec"
 	"strings"
 
@@ -13,10 +16,11 @@ import (
 
 type MongoAdapter struct {
 	allowMissingTools bool
+	verbose           bool
 }
 
-func NewMongoAdapter(allowMissingTools bool) *MongoAdapter {
-	return &MongoAdapter{allowMissingTools: allowMissingTools}
+func NewMongoAdapter(opts Options) *MongoAdapter {
+	return &MongoAdapter{allowMissingTools: opts.AllowMissingTools, verbose: opts.Verbose}
 }
 
 func (m *MongoAdapter) Name() string { return "mongodb" }
@@ -26,35 +30,85 @@ func (m *MongoAdapter) Capabilities() Capabilities {
 }
 
 func (m *MongoAdapter) Validate(ctx context.Context, cfg config.DatabaseConfig) error {
+	if cfg.Socket != "" {
+		return fmt.Errorf("database.socket is not supported for MongoDB")
+	}
 	if !m.allowMissingTools {
-		if err := util.RequireBinary("mongodump"); err != nil {
+		if err := requireBinary("mongodump"); err != nil {
 			return err
 		}
-		if err := util.RequireBinary("mongorestore"); err != nil {
+		if err := requireBinary("mongorestore"); err != nil {
 			return err
 		}
 	}
-	if err := util.RequireBinary("mongosh"); err == nil {
-		cmd := exec.CommandContext(ctx, "mongosh", "--quiet", "--eval", "db.runCommand({ ping: 1 })")
-		cmd.Env = util.MergeEnv(buildMongoEnv(cfg))
-		return cmd.Run()
+	if err := requireBinary("mongosh"); err == nil {
+		return pingWithRetry(ctx, cfg, func() *exec.Cmd {
+			cmd := exec.CommandContext(ctx, "mongosh", "--quiet", "--eval", "db.runCommand({ ping: 1 })")
+			cmd.Env = util.MergeEnv(buildMongoEnv(cfg))
+			return cmd
+		})
 	}
 	return nil
 }
 
+func (m *MongoAdapter) PreflightRestore(ctx context.Context, cfg config.DatabaseConfig, _ config.RestoreConfig) error {
+	if err := requireBinary("mongosh"); err != nil {
+		if m.allowMissingTools {
+			return nil
+		}
+		return fmt.Errorf("restore preflight checks roles with mongosh: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, "mongosh", append(mongoshArgs(cfg), "--quiet", "--eval", "JSON.stringify(db.runCommand({ connectionStatus: 1 }).authInfo)")...)
+	cmd.Env = util.MergeEnv(buildMongoEnv(cfg))
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("restore preflight: %w", err)
+	}
+	return checkMongoRoles(out, cfg.Database)
+}
+
+// checkMongoRoles requires a role that can write database in the authInfo of a
+// connectionStatus command.
+func checkMongoRoles(authInfo []byte, database string) error {
+	var info struct {
+		Users []struct {
+			User string `json:"user"`
+		} `json:"authenticatedUsers"`
+		Roles []struct {
+			Role string `json:"role"`
+			DB   string `json:"db"`
+		} `json:"authenticatedUserRoles"`
+	}
+	if err := json.Unmarshal(authInfo, &info); err != nil {
+		return fmt.Errorf("restore preflight: decode connection status: %w", err)
+	}
+	if len(info.Users) == 0 {
+		// Authentication is disabled; nothing to check.
+		return nil
+	}
+	for _, r := range info.Roles {
+		switch {
+		case r.DB == database && (r.Role == "readWrite" || r.Role == "dbOwner"):
+			return nil
+		case r.DB == "admin" && (r.Role == "root" || r.Role == "restore" || r.Role == "readWriteAnyDatabase"):
+			return nil
+		}
+	}
+	return fmt.Errorf("user %s lacks readWrite on database %s", info.Users[0].User, database)
+}
+
 func (m *MongoAdapter) Dump(ctx context.Context, cfg config.DatabaseConfig, backup config.BackupConfig) (*DumpStream, error) {
 	if !m.allowMissingTools {
-		if err := util.RequireBinary("mongodump"); err != nil {
+		if err := requireBinary("mongodump"); err != nil {
 			return nil, err
 		}
 	}
 	if backup.Type != "" && backup.Type != "full" {
 		return nil, fmt.Errorf("mongodb does not support %s backups in this version", backup.Type)
 	}
-	args := []string{"--archive", "--db", cfg.Database}
-	args = append(args, mongoConnArgs(cfg)...)
-	for _, coll := range backup.Collections {
-		args = append(args, "--collection", coll)
+	args, err := mongoDumpArgs(cfg, backup)
+	if err != nil {
+		return nil, err
 	}
 	cmd := exec.CommandContext(ctx, "mongodump", args...)
 	cmd.Env = util.MergeEnv(buildMongoEnv(cfg))
@@ -62,19 +116,55 @@ func (m *MongoAdapter) Dump(ctx context.Context, cfg config.DatabaseConfig, back
 	if err != nil {
 		return nil, err
 	}
-	cmd.Stderr = stderrSink()
+	annotate := captureStderr(cmd, m.verbose)
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
-	return &DumpStream{Reader: stdout, Wait: cmd.Wait}, nil
+	return &DumpStream{Reader: stdout, Wait: func() error { return annotate(cmd.Wait()) }}, nil
+}
+
+// mongoDumpArgs rejects schema-only and data-only backups: mongodump always writes
+// documents together with index metadata, so the two cannot be separated.
+func mongoDumpArgs(cfg config.DatabaseConfig, backup config.BackupConfig) ([]string, error) {
+	if backup.IncludeSchema != backup.IncludeData {
+		return nil, fmt.Errorf("mongodb cannot separate schema and data; include_schema and include_data must both be enabled")
+	}
+	args := []string{"--archive", "--db", cfg.Database}
+	args = append(args, mongoConnArgs(cfg)...)
+	for _, coll := range backup.Collections {
+		args = append(args, "--collection", coll)
+	}
+	return args, nil
 }
 
 func (m *MongoAdapter) Restore(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig, manifest storage.Manifest) (*RestoreStream, error) {
 	if !m.allowMissingTools {
-		if err := util.RequireBinary("mongorestore"); err != nil {
+		if err := requireBinary("mongorestore"); err != nil {
 			return nil, err
 		}
 	}
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := m.restore(ctx, cfg, restore, manifest, pr)
+		_ = pr.CloseWithError(err)
+		done <- err
+	}()
+	return &RestoreStream{Writer: pw, Wait: func() error { return <-done }}, nil
+}
+
+// restore feeds r to mongorestore. dbu's own backups are --archive streams; a tar
+// (by manifest or magic) is a mongodump directory from other tooling.
+func (m *MongoAdapter) restore(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig, manifest storage.Manifest, r io.Reader) error {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(tarMagicEnd)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if manifest.Container == ContainerTar || isTarHeader(head) {
+		return m.restoreDir(ctx, cfg, restore, br)
+	}
+
 	args := []string{"--archive", "--db", cfg.Database}
 	args = append(args, mongoConnArgs(cfg)...)
 	if restore.DropExisting {
@@ -85,25 +175,72 @@ func (m *MongoAdapter) Restore(ctx context.Context, cfg config.DatabaseConfig, r
 	}
 	cmd := exec.CommandContext(ctx, "mongorestore", args...)
 	cmd.Env = util.MergeEnv(buildMongoEnv(cfg))
-	stdin, err := cmd.StdinPipe()
+	cmd.Stdin = br
+	annotate := captureStderr(cmd, m.verbose)
+	return annotate(cmd.Run())
+}
+
+// EstimateSize returns dbStats.dataSize, the uncompressed size of the documents,
+// which is close to what mongodump writes.
+func (m *MongoAdapter) EstimateSize(ctx context.Context, cfg config.DatabaseConfig) (int64, error) {
+	if err := requireBinary("mongosh"); err != nil {
+		return 0, err
+	}
+	cmd := exec.CommandContext(ctx, "mongosh", append(mongoshArgs(cfg), "--quiet", "--eval", "Number(db.stats().dataSize)")...)
+	cmd.Env = util.MergeEnv(buildMongoEnv(cfg))
+	annotate := captureStderr(cmd, m.verbose)
+	out, err := cmd.Output()
 	if err != nil {
-		return nil, err
+		return 0, annotate(err)
 	}
-	cmd.Stderr = stderrSink()
-	if err := cmd.Start(); err != nil {
-		return nil, err
+	return parseSize(string(out))
+}
+
+// CountObjects returns the number of collections, leaving out system.* ones.
+func (m *MongoAdapter) CountObjects(ctx context.Context, cfg config.DatabaseConfig) (int, error) {
+	out, err := m.Query(ctx, cfg, `db.getCollectionNames().filter(name => !name.startsWith("system.")).length`)
+	if err != nil {
+		return 0, err
+	}
+	n, err := parseSize(out)
+	return int(n), err
+}
+
+// Query evaluates a JavaScript expression with mongosh against the database.
+func (m *MongoAdapter) Query(ctx context.Context, cfg config.DatabaseConfig, query string) (string, error) {
+	if err := requireBinary("mongosh"); err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, "mongosh", append(mongoshArgs(cfg), "--quiet", "--eval", query)...)
+	cmd.Env = util.MergeEnv(buildMongoEnv(cfg))
+	annotate := captureStderr(cmd, m.verbose)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", annotate(err)
 	}
-	return &RestoreStream{Writer: stdin, Wait: cmd.Wait}, nil
+	return firstValue(string(out), ""), nil
 }
 
+// mongoConnArgs returns the connection flags for mongodump and mongorestore. A
+// connection string (params.uri, or URI options in params) replaces host and port.
 func mongoConnArgs(cfg config.DatabaseConfig) []string {
 	args := []string{}
-	if cfg.Host != "" {
-		args = append(args, "--host", cfg.Host)
-	}
-	if cfg.Port != 0 {
-		args = append(args, "--port", fmt.Sprintf("%d", cfg.Port))
+	if uri := mongoURI(cfg, ""); uri != "" {
+		args = append(args, "--uri", uri)
+	} else {
+		if cfg.Host != "" {
+			args = append(args, "--host", cfg.Host)
+		}
+		if cfg.Port != 0 {
+			args = append(args, "--port", fmt.Sprintf("%d", cfg.Port))
+		}
 	}
+	return append(args, mongoAuthArgs(cfg)...)
+}
+
+// mongoAuthArgs returns the credential and TLS flags shared by the mongo tools.
+func mongoAuthArgs(cfg config.DatabaseConfig) []string {
+	args := []string{}
 	if cfg.Username != "" {
 		args = append(args, "--username", cfg.Username)
 	}
@@ -123,17 +260,26 @@ func mongoConnArgs(cfg config.DatabaseConfig) []string {
 	if cfg.SSLCert != "" {
 		args = append(args, "--tlsCertificateKeyFile", cfg.SSLCert)
 	}
-	if cfg.Params != nil {
-		if authSource, ok := cfg.Params["authSource"]; ok {
-			args = append(args, "--authenticationDatabase", authSource)
-		}
+	if authSource := paramValue(cfg.Params, "authSource"); authSource != "" {
+		args = append(args, "--authenticationDatabase", authSource)
 	}
 	return args
 }
 
+func mongoshArgs(cfg config.DatabaseConfig) []string {
+	if paramValue(cfg.Params, "uri") != "" {
+		return []string{mongoURI(cfg, "")}
+	}
+	if uri := mongoURI(cfg, cfg.Database); uri != "" {
+		// URI options need a connection string; credentials stay flags.
+		return append([]string{uri}, mongoAuthArgs(cfg)...)
+	}
+	return append(mongoConnArgs(cfg), cfg.Database)
+}
+
 func buildMongoEnv(cfg config.DatabaseConfig) []string {
 	env := []string{}
-	if uri, ok := cfg.Params["uri"]; ok && uri != "" {
+	if uri := mongoURI(cfg, ""); uri != "" {
 		env = append(env, "MONGODB_URI="+uri)
 	}
 	return env
@@ -0,0 +1,228 @@
+package db
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// mongoArchiveMagic starts every mongodump --archive stream, little-endian.
+const mongoArchiveMagic = 0x8199e26d
+
+// mongoArchiveTerminator ends the prelude and each namespace's block of documents.
+const mongoArchiveTerminator = 0xffffffff
+
+// maxBSONDocument bounds the documents read whole; MongoDB caps documents at 16 MiB.
+const maxBSONDocument = 48 << 20
+
+// ListContents lists the collections in a mongodump archive, or in a tar of a
+// mongodump directory, with the bytes of their documents.
+func (m *MongoAdapter) ListContents(ctx context.Context, r io.Reader) ([]DumpObject, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(tarMagicEnd)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if isTarHeader(head) {
+		return listMongoDir(br)
+	}
+	return listMongoArchive(br)
+}
+
+// listMongoArchive reads the collections from the archive's prelude, then adds
+// up each collection's documents from the body.
+func listMongoArchive(r io.Reader) ([]DumpObject, error) {
+	var magic uint32
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil || magic != mongoArchiveMagic {
+		return nil, fmt.Errorf("not a mongodump archive")
+	}
+	if _, _, err := readBSON(r); err != nil {
+		return nil, fmt.Errorf("read archive header: %w", err)
+	}
+	var objects []DumpObject
+	index := map[string]int{}
+	for {
+		doc, terminator, err := readBSON(r)
+		if err != nil {
+			return objects, fmt.Errorf("read archive prelude: %w", err)
+		}
+		if terminator {
+			break
+		}
+		fields := bsonStrings(doc, "db", "collection", "type")
+		kind := "COLLECTION"
+		if fields["type"] == "view" {
+			kind = "VIEW"
+		}
+		index[fields["db"]+"."+fields["collection"]] = len(objects)
+		objects = append(objects, DumpObject{Kind: kind, Schema: fields["db"], Name: fields["collection"]})
+	}
+	for {
+		header, terminator, err := readBSON(r)
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return objects, fmt.Errorf("read archive body: %w", err)
+		}
+		if terminator {
+			continue
+		}
+		fields := bsonStrings(header, "db", "collection")
+		i, known := index[fields["db"]+"."+fields["collection"]]
+		for {
+			size, err := skipBSON(r)
+			if err != nil {
+				return objects, fmt.Errorf("read archive body: %w", err)
+			}
+			if size < 0 {
+				break
+			}
+			if known {
+				objects[i].Size += size
+			}
+		}
+	}
+}
+
+// listMongoDir lists the <db>/<collection>.bson[.gz] files of a tar'd dump directory.
+func listMongoDir(r io.Reader) ([]DumpObject, error) {
+	var objects []DumpObject
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return objects, err
+		}
+		name := strings.TrimSuffix(path.Base(hdr.Name), ".gz")
+		collection, ok := strings.CutSuffix(name, ".bson")
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		database := path.Base(path.Dir(hdr.Name))
+		objects = append(objects, DumpObject{Kind: "COLLECTION", Schema: database, Name: collection, Size: hdr.Size})
+	}
+}
+
+// readBSON reads one BSON document, or reports the archive terminator.
+func readBSON(r io.Reader) ([]byte, bool, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, false, err
+	}
+	if size == mongoArchiveTerminator {
+		return nil, true, nil
+	}
+	if size < 5 || size > maxBSONDocument {
+		return nil, false, fmt.Errorf("invalid BSON document size %d", size)
+	}
+	doc := make([]byte, size)
+	binary.LittleEndian.PutUint32(doc, size)
+	if _, err := io.ReadFull(r, doc[4:]); err != nil {
+		return nil, false, err
+	}
+	return doc, false, nil
+}
+
+// skipBSON skips one BSON document and returns its size, or -1 at a terminator.
+func skipBSON(r io.Reader) (int64, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return 0, err
+	}
+	if size == mongoArchiveTerminator {
+		return -1, nil
+	}
+	if size < 5 || size > maxBSONDocument {
+		return 0, fmt.Errorf("invalid BSON document size %d", size)
+	}
+	if _, err := io.CopyN(io.Discard, r, int64(size)-4); err != nil {
+		return 0, err
+	}
+	return int64(size), nil
+}
+
+// bsonStrings returns the top-level string fields of doc named in keys. It stops
+// at the first element type it cannot skip.
+func bsonStrings(doc []byte, keys ...string) map[string]string {
+	found := map[string]string{}
+	if len(doc) < 5 {
+		return found
+	}
+	b := doc[4 : len(doc)-1]
+	for len(b) > 0 {
+		kind := b[0]
+		end := bytes.IndexByte(b[1:], 0)
+		if end < 0 {
+			return found
+		}
+		name := string(b[1 : 1+end])
+		b = b[2+end:]
+		n := bsonValueSize(kind, b)
+		if n < 0 || n > len(b) {
+			return found
+		}
+		if kind == 0x02 && n >= 5 {
+			for _, key := range keys {
+				if key == name {
+					found[name] = string(b[4 : n-1])
+				}
+			}
+		}
+		b = b[n:]
+	}
+	return found
+}
+
+// bsonValueSize returns the encoded size of a value of the given element type at
+// the start of b, or -1 when it cannot tell.
+func bsonValueSize(kind byte, b []byte) int {
+	lenAt := func(extra int) int {
+		if len(b) < 4 {
+			return -1
+		}
+		return int(int32(binary.LittleEndian.Uint32(b))) + extra
+	}
+	switch kind {
+	case 0x01, 0x09, 0x11, 0x12: // double, datetime, timestamp, int64
+		return 8
+	case 0x02, 0x0D, 0x0E: // string, JavaScript, symbol
+		return lenAt(4)
+	case 0x03, 0x04, 0x0F: // document, array, code with scope
+		return lenAt(0)
+	case 0x05: // binary: length, subtype, data
+		return lenAt(5)
+	case 0x06, 0x0A, 0x7F, 0xFF: // undefined, null, max key, min key
+		return 0
+	case 0x07: // ObjectId
+		return 12
+	case 0x08: // bool
+		return 1
+	case 0x10: // int32
+		return 4
+	case 0x13: // decimal128
+		return 16
+	case 0x0B: // regex: two C strings
+		first := bytes.IndexByte(b, 0)
+		if first < 0 {
+			return -1
+		}
+		second := bytes.IndexByte(b[first+1:], 0)
+		if second < 0 {
+			return -1
+		}
+		return first + second + 2
+	case 0x0C: // DBPointer: string and ObjectId
+		return lenAt(4 + 12)
+	}
+	return -1
+}
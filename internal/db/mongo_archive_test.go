@@ -0,0 +1,61 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+)
+
+// bsonDoc encodes a flat BSON document of string fields and an int32 "n".
+func bsonDoc(n int32, fields ...string) []byte {
+	var body bytes.Buffer
+	for i := 0; i+1 < len(fields); i += 2 {
+		body.WriteByte(0x02)
+		body.WriteString(fields[i] + "\x00")
+		_ = binary.Write(&body, binary.LittleEndian, int32(len(fields[i+1])+1))
+		body.WriteString(fields[i+1] + "\x00")
+	}
+	body.WriteByte(0x10)
+	body.WriteString("n\x00")
+	_ = binary.Write(&body, binary.LittleEndian, n)
+	doc := binary.LittleEndian.AppendUint32(nil, uint32(body.Len()+5))
+	return append(append(doc, body.Bytes()...), 0)
+}
+
+func TestMongoListContentsArchive(t *testing.T) {
+	terminator := []byte{0xff, 0xff, 0xff, 0xff}
+	var archive bytes.Buffer
+	_ = binary.Write(&archive, binary.LittleEndian, uint32(mongoArchiveMagic))
+	archive.Write(bsonDoc(0, "toolVersion", "100.9.4"))
+	archive.Write(bsonDoc(0, "db", "appdb", "collection", "users", "type", "collection"))
+	archive.Write(bsonDoc(0, "db", "appdb", "collection", "recent", "type", "view"))
+	archive.Write(terminator)
+	user := bsonDoc(7, "name", "ada")
+	for _, eof := range []bool{false, true} {
+		archive.Write(bsonDoc(0, "db", "appdb", "collection", "users"))
+		if !eof {
+			archive.Write(user)
+			archive.Write(user)
+		}
+		archive.Write(terminator)
+	}
+
+	objects, err := (&MongoAdapter{}).ListContents(context.Background(), &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("unexpected objects %+v", objects)
+	}
+	if got := objects[0]; got.Kind != "COLLECTION" || got.Schema != "appdb" || got.Name != "users" || got.Size != int64(2*len(user)) {
+		t.Fatalf("unexpected collection %+v", got)
+	}
+	if got := objects[1]; got.Kind != "VIEW" || got.Name != "recent" || got.Size != 0 {
+		t.Fatalf("unexpected view %+v", got)
+	}
+
+	if _, err := (&MongoAdapter{}).ListContents(context.Background(), bytes.NewReader([]byte("not an archive"))); err == nil {
+		t.Fatal("expected an error for a foreign stream")
+	}
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+// tarMagicEnd is the length of a tar header prefix that includes the ustar magic.
+const tarMagicEnd = 262
+
+// isTarHeader reports whether head starts a POSIX or GNU tar archive.
+func isTarHeader(head []byte) bool {
+	return len(head) >= tarMagicEnd && bytes.Equal(head[257:262], []byte("ustar"))
+}
+
+// mongoSystemDatabases are skipped when picking the database out of a full dump.
+var mongoSystemDatabases = []string{"admin", "config", "local"}
+
+// restoreDir restores a tar of a mongodump output directory (not --archive), as
+// produced by other tooling. The archive is unpacked to a temporary directory and
+// its database is restored under cfg.Database with mongorestore --dir.
+func (m *MongoAdapter) restoreDir(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig, r io.Reader) error {
+	tmp, err := os.MkdirTemp("", "dbu-mongodump-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	root := filepath.Join(tmp, "dump")
+	gzipped, err := extractTar(r, root)
+	if err != nil {
+		return fmt.Errorf("read mongodump archive: %w", err)
+	}
+	dbDir, err := findMongoDumpDB(root, cfg.Database)
+	if err != nil {
+		return err
+	}
+	args := mongoDirArgs(cfg, restore, dbDir, gzipped)
+	cmd := exec.CommandContext(ctx, "mongorestore", args...)
+	cmd.Env = util.MergeEnv(buildMongoEnv(cfg))
+	annotate := captureStderr(cmd, m.verbose)
+	return annotate(cmd.Run())
+}
+
+// mongoDirArgs restores the database dumped in dbDir into cfg.Database.
+func mongoDirArgs(cfg config.DatabaseConfig, restore config.RestoreConfig, dbDir string, gzipped bool) []string {
+	src := filepath.Base(dbDir)
+	args := []string{"--dir", filepath.Dir(dbDir), "--nsFrom", src + ".*", "--nsTo", cfg.Database + ".*"}
+	args = append(args, mongoConnArgs(cfg)...)
+	if gzipped {
+		args = append(args, "--gzip")
+	}
+	if restore.DropExisting {
+		args = append(args, "--drop")
+	}
+	if len(restore.Collections) == 0 {
+		args = append(args, "--nsInclude", src+".*")
+	}
+	for _, coll := range restore.Collections {
+		args = append(args, "--nsInclude", fmt.Sprintf("%s.%s", src, coll))
+	}
+	return args
+}
+
+// extractTar unpacks regular files and directories into dir. Entries that would
+// land outside dir, links and devices are rejected. It reports whether any file
+// was gzip-compressed (mongodump --gzip).
+func extractTar(r io.Reader, dir string) (bool, error) {
+	gzipped := false
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return false, fmt.Errorf("unsafe path %q in archive", hdr.Name)
+		}
+		target := filepath.Join(dir, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o700); err != nil {
+				return false, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+				return false, err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+			if err != nil {
+				return false, err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return false, err
+			}
+			gzipped = gzipped || strings.HasSuffix(name, ".gz")
+		default:
+			return false, fmt.Errorf("unsupported entry %q (type %c) in archive", hdr.Name, hdr.Typeflag)
+		}
+	}
+	// Drain tar padding so the writer side sees a clean close.
+	_, err := io.Copy(io.Discard, r)
+	return gzipped, err
+}
+
+// findMongoDumpDB returns the directory holding the dumped collections. A dump of
+// several databases must contain want or exactly one non-system database.
+func findMongoDumpDB(root, want string) (string, error) {
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := d.Name()
+		if strings.HasSuffix(name, ".bson") || strings.HasSuffix(name, ".bson.gz") {
+			if dir := filepath.Dir(path); !slices.Contains(dirs, dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(dirs) == 0 {
+		return "", fmt.Errorf("mongodump archive contains no .bson files")
+	}
+	var user []string
+	for _, dir := range dirs {
+		if !slices.Contains(mongoSystemDatabases, filepath.Base(dir)) {
+			user = append(user, dir)
+		}
+	}
+	if len(user) == 0 {
+		user = dirs
+	}
+	if len(user) == 1 {
+		return user[0], nil
+	}
+	names := make([]string, 0, len(user))
+	for _, dir := range user {
+		if filepath.Base(dir) == want {
+			return dir, nil
+		}
+		names = append(names, filepath.Base(dir))
+	}
+	return "", fmt.Errorf("mongodump archive holds several databases (%s) and none is named %s", strings.Join(names, ", "), want)
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"archive/tar"
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+)
+
+func TestMongoDumpArgs(t *testing.T) {
+	cfg := config.DatabaseConfig{Host: "db", Database: "appdb"}
+	args, err := mongoDumpArgs(cfg, config.BackupConfig{IncludeSchema: true, IncludeData: true, Collections: []string{"users"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	joined := strings.Join(args, " ")
+	if !strings.HasPrefix(joined, "--archive --db appdb") || !strings.Contains(joined, "--collection users") {
+		t.Fatalf("unexpected args: %q", joined)
+	}
+
+	for _, backup := range []config.BackupConfig{{IncludeSchema: true}, {IncludeData: true}} {
+		if _, err := mongoDumpArgs(cfg, backup); err == nil {
+			t.Fatalf("expected error for %+v", backup)
+		}
+	}
+}
+
+func buildTar(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractMongoDumpDirectory(t *testing.T) {
+	archive := buildTar(t, map[string]string{
+		"dump/admin/system.version.bson": "x",
+		"dump/shop/orders.bson.gz":       "x",
+		"dump/shop/orders.metadata.json": "{}",
+	})
+	if !isTarHeader(archive) {
+		t.Fatal("expected tar magic to be detected")
+	}
+	root := filepath.Join(t.TempDir(), "dump")
+	gzipped, err := extractTar(bytes.NewReader(archive), root)
+	if err != nil || !gzipped {
+		t.Fatalf("extract: gzipped=%v err=%v", gzipped, err)
+	}
+	dbDir, err := findMongoDumpDB(root, "restored")
+	if err != nil || filepath.Base(dbDir) != "shop" {
+		t.Fatalf("expected the shop database, got %q, %v", dbDir, err)
+	}
+
+	cfg := config.DatabaseConfig{Database: "restored"}
+	args := strings.Join(mongoDirArgs(cfg, config.RestoreConfig{Collections: []string{"orders"}}, dbDir, gzipped), " ")
+	for _, want := range []string{"--nsFrom shop.* --nsTo restored.*", "--gzip", "--nsInclude shop.orders"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("expected %q in %q", want, args)
+		}
+	}
+}
+
+func TestFindMongoDumpDBAmbiguous(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "dump")
+	if _, err := extractTar(bytes.NewReader(buildTar(t, map[string]string{"a/c.bson": "x", "b/c.bson": "x"})), root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findMongoDumpDB(root, "other"); err == nil {
+		t.Fatal("expected an error for several databases")
+	}
+	if dir, err := findMongoDumpDB(root, "b"); err != nil || filepath.Base(dir) != "b" {
+		t.Fatalf("expected the named database, got %q, %v", dir, err)
+	}
+}
+
+func TestExtractTarRejectsTraversal(t *testing.T) {
+	archive := buildTar(t, map[string]string{"../escape.bson": "x"})
+	if _, err := extractTar(bytes.NewReader(archive), t.TempDir()); err == nil {
+		t.Fatal("expected unsafe path to be rejected")
+	}
+}
+
+func TestCheckMongoRoles(t *testing.T) {
+	cases := []struct {
+		authInfo string
+		want     string
+	}{
+		{`{"authenticatedUsers":[],"authenticatedUserRoles":[]}`, ""},
+		{`{"authenticatedUsers":[{"user":"app"}],"authenticatedUserRoles":[{"role":"readWrite","db":"appdb"}]}`, ""},
+		{`{"authenticatedUsers":[{"user":"ops"}],"authenticatedUserRoles":[{"role":"restore","db":"admin"}]}`, ""},
+		{`{"authenticatedUsers":[{"user":"app"}],"authenticatedUserRoles":[{"role":"read","db":"appdb"}]}`, "lacks readWrite"},
+		{`{"authenticatedUsers":[{"user":"app"}],"authenticatedUserRoles":[{"role":"readWrite","db":"otherdb"}]}`, "lacks readWrite"},
+		{`MongoServerError: not authorized`, "decode connection status"},
+	}
+	for _, tc := range cases {
+		err := checkMongoRoles([]byte(tc.authInfo), "appdb")
+		if tc.want == "" && err != nil || tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("checkMongoRoles(%s) = %v, want %q", tc.authInfo, err, tc.want)
+		}
+	}
+}
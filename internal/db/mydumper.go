@@ -0,0 +1,226 @@
+package db
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+)
+
+// Dump tools for backup.dump_tool on MySQL. The tool is recorded in the manifest
+// so restore picks the matching loader.
+const (
+	ToolMysqldump = "mysqldump"
+	ToolMydumper  = "mydumper"
+)
+
+// dumpMydumper runs mydumper into a temporary directory and streams the files it
+// wrote as a tar. mydumper must finish before archiving starts, so the first bytes
+// only reach the pipeline once every table has been dumped.
+func (m *MySQLAdapter) dumpMydumper(ctx context.Context, cfg config.DatabaseConfig, backup config.BackupConfig) (*DumpStream, error) {
+	if !m.allowMissingTools {
+		if err := requireBinary("mydumper"); err != nil {
+			return nil, err
+		}
+	}
+	tmp, err := os.MkdirTemp("", "dbu-mydumper-*")
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := writeMySQLDefaults(tmp, cfg)
+	if err != nil {
+		_ = os.RemoveAll(tmp)
+		return nil, err
+	}
+	outDir := filepath.Join(tmp, "dump")
+	cmd := exec.CommandContext(ctx, "mydumper", mydumperArgs(cfg, backup, defaults, outDir)...)
+	annotate := captureStderr(cmd, m.verbose)
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		defer os.RemoveAll(tmp)
+		err := annotate(cmd.Run())
+		if err == nil {
+			var paths []string
+			paths, err = dumpFiles(outDir)
+			if err == nil {
+				err = writeTar(ctx, pw, paths)
+			}
+		}
+		_ = pw.CloseWithError(err)
+		done <- err
+	}()
+	return &DumpStream{Reader: pr, Wait: func() error { return <-done }, Container: ContainerTar, Tool: ToolMydumper}, nil
+}
+
+func mydumperArgs(cfg config.DatabaseConfig, backup config.BackupConfig, defaults, outDir string) []string {
+	args := []string{"--defaults-file", defaults}
+	args = append(args, mydumperConnArgs(cfg)...)
+	args = append(args, "--database", cfg.Database, "--outputdir", outDir)
+	if backup.MaxParallelism > 0 {
+		args = append(args, "--threads", strconv.Itoa(backup.MaxParallelism))
+	}
+	schemaOnly := backup.IncludeSchema && !backup.IncludeData
+	dataOnly := backup.IncludeData && !backup.IncludeSchema
+	switch {
+	case schemaOnly:
+		args = append(args, "--no-data", "--routines", "--events", "--triggers")
+	case dataOnly:
+		args = append(args, "--no-schemas")
+	default:
+		args = append(args, "--routines", "--events", "--triggers")
+	}
+	if len(backup.Tables) > 0 {
+		args = append(args, "--tables-list", qualifyTables(cfg.Database, backup.Tables))
+	}
+	return args
+}
+
+// restoreMyloader unpacks a mydumper archive and loads it into cfg.Database.
+func (m *MySQLAdapter) restoreMyloader(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig, source string, r io.Reader) error {
+	tmp, err := os.MkdirTemp("", "dbu-myloader-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := filepath.Join(tmp, "dump")
+	if _, err := extractTar(r, dir); err != nil {
+		return fmt.Errorf("read mydumper archive: %w", err)
+	}
+	defaults, err := writeMySQLDefaults(tmp, cfg)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "myloader", myloaderArgs(cfg, restore, source, defaults, dir)...)
+	annotate := captureStderr(cmd, m.verbose)
+	return annotate(cmd.Run())
+}
+
+// myloaderArgs loads the dump of the source database into cfg.Database.
+func myloaderArgs(cfg config.DatabaseConfig, restore config.RestoreConfig, source, defaults, dir string) []string {
+	args := []string{"--defaults-file", defaults}
+	args = append(args, mydumperConnArgs(cfg)...)
+	args = append(args, "--directory", dir, "--database", cfg.Database)
+	if restore.DropExisting {
+		args = append(args, "--overwrite-tables")
+	}
+	if len(restore.Tables) > 0 {
+		// Files are named after the source database, which may differ from the target.
+		args = append(args, "--tables-list", qualifyTables(source, restore.Tables))
+	}
+	return args
+}
+
+// mydumperConnArgs returns the connection and TLS flags shared by mydumper and
+// myloader. The password is passed in a defaults file (writeMySQLDefaults).
+func mydumperConnArgs(cfg config.DatabaseConfig) []string {
+	args := []string{"--host", cfg.Host, "--port", portOrDefault(cfg.Port, 3306), "--user", cfg.Username}
+	if cfg.Socket != "" {
+		args = []string{"--socket", cfg.Socket, "--user", cfg.Username}
+	}
+	if cfg.SSLMode != "" {
+		args = append(args, "--ssl-mode", cfg.SSLMode)
+	}
+	if cfg.SSLCA != "" {
+		args = append(args, "--ca", cfg.SSLCA)
+	}
+	if cfg.SSLCert != "" {
+		args = append(args, "--cert", cfg.SSLCert)
+	}
+	if cfg.SSLKey != "" {
+		args = append(args, "--key", cfg.SSLKey)
+	}
+	return args
+}
+
+// writeMySQLDefaults writes a private option file holding the password, which
+// mydumper and myloader would otherwise only take on the command line.
+func writeMySQLDefaults(dir string, cfg config.DatabaseConfig) (string, error) {
+	var b strings.Builder
+	b.WriteString("[client]\n")
+	if password, _ := databasePassword(cfg, 3306); password != "" {
+		fmt.Fprintf(&b, "password=%q\n", password)
+	}
+	if usesIAM(cfg) {
+		b.WriteString("enable-cleartext-plugin\n")
+	}
+	path := filepath.Join(dir, "client.cnf")
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		return "", fmt.Errorf("write mysql defaults file: %w", err)
+	}
+	return path, nil
+}
+
+func qualifyTables(database string, tables []string) string {
+	qualified := make([]string, len(tables))
+	for i, tbl := range tables {
+		if !strings.Contains(tbl, ".") {
+			tbl = database + "." + tbl
+		}
+		qualified[i] = tbl
+	}
+	return strings.Join(qualified, ",")
+}
+
+// dumpFiles lists the regular files mydumper wrote, sorted so archives are stable.
+func dumpFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// listMydumperTables reads table names from the db.table-schema.sql entries of a
+// mydumper archive, sizing each table by its schema and db.table.*.sql data files.
+func listMydumperTables(r io.Reader) ([]DumpObject, error) {
+	var objects []DumpObject
+	sizes := map[string]int64{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return objects, err
+		}
+		sizes[hdr.Name] = hdr.Size
+		name, ok := strings.CutSuffix(hdr.Name, "-schema.sql")
+		if !ok {
+			continue
+		}
+		schema, table, ok := strings.Cut(name, ".")
+		if !ok {
+			continue
+		}
+		objects = append(objects, DumpObject{Kind: "TABLE", Schema: schema, Name: table})
+	}
+	for i, obj := range objects {
+		prefix := obj.Schema + "." + obj.Name
+		for name, size := range sizes {
+			rest, ok := strings.CutPrefix(name, prefix)
+			if ok && (rest == "-schema.sql" || (strings.HasPrefix(rest, ".") && strings.Contains(rest, ".sql"))) {
+				objects[i].Size += size
+			}
+		}
+	}
+	return objects, nil
+}
@@ -1,9 +1,13 @@
 package db
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os/exec"
+	"strings"
 
 	"github.com/rowjay/db-backup-utility/internal/config"
 	"github.com/rowjay/db-backup-utility/internal/storage"
@@ -12,54 +16,168 @@ import (
 
 type MySQLAdapter struct {
 	allowMissingTools bool
+	verbose           bool
 }
 
-func NewMySQLAdapter(allowMissingTools bool) *MySQLAdapter {
-	return &MySQLAdapter{allowMissingTools: allowMissingTools}
+func NewMySQLAdapter(opts Options) *MySQLAdapter {
+	return &MySQLAdapter{allowMissingTools: opts.AllowMissingTools, verbose: opts.Verbose}
 }
 
 func (m *MySQLAdapter) Name() string { return "mysql" }
 
 func (m *MySQLAdapter) Capabilities() Capabilities {
-	return Capabilities{Incremental: false, Differential: false, TableRestore: true}
+	return Capabilities{Incremental: false, Differential: true, TableRestore: true}
 }
 
 func (m *MySQLAdapter) Validate(ctx context.Context, cfg config.DatabaseConfig) error {
+	if _, err := databasePassword(cfg, 3306); err != nil {
+		return err
+	}
 	if !m.allowMissingTools {
-		if err := util.RequireBinary("mysqldump"); err != nil {
+		if err := requireBinary("mysqldump"); err != nil {
 			return err
 		}
-		if err := util.RequireBinary("mysql"); err != nil {
+		if err := requireBinary("mysql"); err != nil {
 			return err
 		}
 	}
 
-	if err := util.RequireBinary("mysqladmin"); err == nil {
-		args := []string{"ping", "-h", cfg.Host, "-P", portOrDefault(cfg.Port, 3306), "-u", cfg.Username}
-		if cfg.ConnectionTimeout > 0 {
-			args = append(args, fmt.Sprintf("--connect-timeout=%d", int(cfg.ConnectionTimeout.Seconds())))
+	if err := requireBinary("mysqladmin"); err == nil {
+		args := append([]string{"ping"}, mysqlConnArgs(cfg)...)
+		return pingWithRetry(ctx, cfg, func() *exec.Cmd {
+			cmd := exec.CommandContext(ctx, "mysqladmin", args...)
+			cmd.Env = util.MergeEnv(buildMySQLEnv(cfg))
+			return cmd
+		})
+	}
+	return nil
+}
+
+func (m *MySQLAdapter) PreflightRestore(ctx context.Context, cfg config.DatabaseConfig, _ config.RestoreConfig) error {
+	if err := requireBinary("mysql"); err != nil {
+		if m.allowMissingTools {
+			return nil
+		}
+		return fmt.Errorf("restore preflight checks privileges with mysql: %w", err)
+	}
+	args := append(mysqlConnArgs(cfg), "-N", "-B", "-e", "SHOW GRANTS")
+	cmd := exec.CommandContext(ctx, "mysql", args...)
+	cmd.Env = util.MergeEnv(buildMySQLEnv(cfg))
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("restore preflight: %w", err)
+	}
+	return checkMySQLGrants(string(out), cfg.Username, cfg.Database)
+}
+
+// checkMySQLGrants requires the privileges a restore uses in SHOW GRANTS output.
+func checkMySQLGrants(grants, user, database string) error {
+	granted := mysqlGrantedPrivileges(grants, database)
+	if _, ok := granted["ALL PRIVILEGES"]; ok {
+		return nil
+	}
+	for _, priv := range []string{"CREATE", "DROP", "INSERT"} {
+		if _, ok := granted[priv]; !ok {
+			return fmt.Errorf("user %s lacks %s on database %s", user, priv, database)
 		}
-		cmd := exec.CommandContext(ctx, "mysqladmin", args...)
-		cmd.Env = util.MergeEnv(buildMySQLEnv(cfg))
-		return cmd.Run()
 	}
 	return nil
 }
 
+func mysqlGrantedPrivileges(grants, database string) map[string]struct{} {
+	granted := map[string]struct{}{}
+	for _, line := range strings.Split(grants, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "GRANT ") {
+			continue
+		}
+		onIdx := strings.Index(line, " ON ")
+		toIdx := strings.Index(line, " TO ")
+		if onIdx < 0 || toIdx < onIdx {
+			continue
+		}
+		target := strings.ReplaceAll(strings.TrimSpace(line[onIdx+4:toIdx]), "`", "")
+		if target != "*.*" && target != database+".*" {
+			continue
+		}
+		for _, priv := range strings.Split(line[len("GRANT "):onIdx], ",") {
+			granted[strings.ToUpper(strings.TrimSpace(priv))] = struct{}{}
+		}
+	}
+	return granted
+}
+
 func (m *MySQLAdapter) Dump(ctx context.Context, cfg config.DatabaseConfig, backup config.BackupConfig) (*DumpStream, error) {
+	if backup.Type == "incremental" {
+		return nil, fmt.Errorf("mysql does not support %s backups in this version", backup.Type)
+	}
+	switch backup.DumpTool {
+	case "", ToolMysqldump:
+	case ToolMydumper:
+		return m.dumpMydumper(ctx, cfg, backup)
+	default:
+		return nil, fmt.Errorf("unsupported backup.dump_tool %q (use %s or %s)", backup.DumpTool, ToolMysqldump, ToolMydumper)
+	}
 	if !m.allowMissingTools {
-		if err := util.RequireBinary("mysqldump"); err != nil {
+		if err := requireBinary("mysqldump"); err != nil {
 			return nil, err
 		}
 	}
-	if backup.Type != "" && backup.Type != "full" {
-		return nil, fmt.Errorf("mysql does not support %s backups in this version", backup.Type)
+
+	args := mysqlDumpArgs(cfg, backup)
+	cmd := exec.CommandContext(ctx, "mysqldump", args...)
+	cmd.Env = util.MergeEnv(buildMySQLEnv(cfg))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
 	}
+	annotate := captureStderr(cmd, m.verbose)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &DumpStream{Reader: stdout, Wait: func() error { return annotate(cmd.Wait()) }}, nil
+}
+
+func mysqlDumpArgs(cfg config.DatabaseConfig, backup config.BackupConfig) []string {
+	args := []string{"--single-transaction"}
+	schemaOnly := backup.IncludeSchema && !backup.IncludeData
+	dataOnly := backup.IncludeData && !backup.IncludeSchema
+	switch {
+	case schemaOnly:
+		args = append(args, "--no-data", "--routines", "--events", "--triggers")
+	case dataOnly:
+		// Routines, events and triggers are schema objects.
+		args = append(args, "--no-create-info", "--skip-triggers")
+	default:
+		args = append(args, "--routines", "--events", "--triggers")
+	}
+	args = append(args, mysqlConnArgs(cfg)...)
+
+	if len(backup.Tables) > 0 {
+		args = append(args, cfg.Database)
+		args = append(args, backup.Tables...)
+	} else {
+		args = append(args, "--databases", cfg.Database)
+	}
+	return args
+}
 
-	args := []string{"--single-transaction", "--routines", "--events", "--triggers", "-h", cfg.Host, "-P", portOrDefault(cfg.Port, 3306), "-u", cfg.Username}
+// mysqlConnArgs returns the connection and TLS flags shared by the mysql client
+// tools, after the options from database.params.
+func mysqlConnArgs(cfg config.DatabaseConfig) []string {
+	args := mysqlParamArgs(cfg.Params)
+	if cfg.Socket != "" {
+		args = append(args, "--socket", cfg.Socket, "-u", cfg.Username)
+	} else {
+		args = append(args, "-h", cfg.Host, "-P", portOrDefault(cfg.Port, 3306), "-u", cfg.Username)
+	}
 	if cfg.ConnectionTimeout > 0 {
 		args = append(args, fmt.Sprintf("--connect-timeout=%d", int(cfg.ConnectionTimeout.Seconds())))
 	}
+	if usesIAM(cfg) {
+		// RDS IAM auth uses the AWSAuthenticationPlugin, which takes the token in cleartext.
+		args = append(args, "--enable-cleartext-plugin")
+	}
 	if cfg.SSLMode != "" {
 		args = append(args, "--ssl-mode="+cfg.SSLMode)
 	}
@@ -72,30 +190,155 @@ func (m *MySQLAdapter) Dump(ctx context.Context, cfg config.DatabaseConfig, back
 	if cfg.SSLKey != "" {
 		args = append(args, "--ssl-key="+cfg.SSLKey)
 	}
+	return args
+}
 
-	if len(backup.Tables) > 0 {
-		args = append(args, cfg.Database)
-		args = append(args, backup.Tables...)
-	} else {
-		args = append(args, "--databases", cfg.Database)
+const mysqlListTablesSQL = "SELECT table_name FROM information_schema.tables " +
+	"WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' ORDER BY table_name"
+
+func (m *MySQLAdapter) TableChecksums(ctx context.Context, cfg config.DatabaseConfig, tables []string) (map[string]string, error) {
+	if err := requireBinary("mysql"); err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		out, err := m.query(ctx, cfg, mysqlListTablesSQL)
+		if err != nil {
+			return nil, fmt.Errorf("list tables: %w", err)
+		}
+		tables = nonEmptyLines(out)
+	}
+	if len(tables) == 0 {
+		return map[string]string{}, nil
 	}
+	out, err := m.query(ctx, cfg, mysqlChecksumSQL(tables))
+	if err != nil {
+		return nil, fmt.Errorf("checksum tables: %w", err)
+	}
+	return parseChecksumRows(out, "\t", cfg.Database+".")
+}
 
-	cmd := exec.CommandContext(ctx, "mysqldump", args...)
-	cmd.Env = util.MergeEnv(buildMySQLEnv(cfg))
-	stdout, err := cmd.StdoutPipe()
+const mysqlSizeSQL = "SELECT COALESCE(SUM(data_length + index_length), 0) FROM information_schema.tables " +
+	"WHERE table_schema = DATABASE()"
+
+// EstimateSize returns the data and index size reported by information_schema.
+func (m *MySQLAdapter) EstimateSize(ctx context.Context, cfg config.DatabaseConfig) (int64, error) {
+	if err := requireBinary("mysql"); err != nil {
+		return 0, err
+	}
+	out, err := m.query(ctx, cfg, mysqlSizeSQL)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	cmd.Stderr = stderrSink()
-	if err := cmd.Start(); err != nil {
-		return nil, err
+	return parseSize(out)
+}
+
+const mysqlCountTablesSQL = "SELECT count(*) FROM information_schema.tables " +
+	"WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'"
+
+// CountObjects returns the number of base tables in the database.
+func (m *MySQLAdapter) CountObjects(ctx context.Context, cfg config.DatabaseConfig) (int, error) {
+	if err := requireBinary("mysql"); err != nil {
+		return 0, err
+	}
+	out, err := m.query(ctx, cfg, mysqlCountTablesSQL)
+	if err != nil {
+		return 0, err
 	}
-	return &DumpStream{Reader: stdout, Wait: cmd.Wait}, nil
+	n, err := parseSize(out)
+	return int(n), err
 }
 
+// Query runs an SQL query with the mysql client.
+func (m *MySQLAdapter) Query(ctx context.Context, cfg config.DatabaseConfig, query string) (string, error) {
+	if err := requireBinary("mysql"); err != nil {
+		return "", err
+	}
+	out, err := m.query(ctx, cfg, query)
+	if err != nil {
+		return "", err
+	}
+	return firstValue(out, "\t"), nil
+}
+
+func mysqlChecksumSQL(tables []string) string {
+	quoted := make([]string, len(tables))
+	for i, tbl := range tables {
+		quoted[i] = mysqlQuoteIdent(tbl)
+	}
+	return "CHECKSUM TABLE " + strings.Join(quoted, ", ") + " EXTENDED"
+}
+
+// MaintenanceDatabase connects without selecting a database, as CreateDatabase does.
+func (m *MySQLAdapter) MaintenanceDatabase(cfg config.DatabaseConfig) config.DatabaseConfig {
+	cfg.Database = ""
+	return cfg
+}
+
+func (m *MySQLAdapter) CreateDatabase(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig) error {
+	if err := requireBinary("mysql"); err != nil {
+		return err
+	}
+	admin := cfg
+	admin.Database = ""
+	out, err := m.query(ctx, admin, "SELECT COUNT(*) FROM information_schema.schemata WHERE schema_name = "+mysqlQuoteLiteral(cfg.Database))
+	if err != nil {
+		return fmt.Errorf("check database: %w", err)
+	}
+	var stmts []string
+	if strings.TrimSpace(out) != "0" {
+		if !restore.DropExisting {
+			return fmt.Errorf("database %s already exists; pass --drop-existing to recreate it", cfg.Database)
+		}
+		stmts = append(stmts, "DROP DATABASE "+mysqlQuoteIdent(cfg.Database))
+	}
+	stmts = append(stmts, mysqlCreateDatabaseSQL(cfg.Database, restore))
+	if _, err := m.query(ctx, admin, strings.Join(stmts, "; ")); err != nil {
+		return fmt.Errorf("create database %s: %w", cfg.Database, err)
+	}
+	return nil
+}
+
+func mysqlCreateDatabaseSQL(name string, restore config.RestoreConfig) string {
+	stmt := "CREATE DATABASE " + mysqlQuoteIdent(name)
+	if restore.Charset != "" {
+		stmt += " CHARACTER SET " + mysqlQuoteLiteral(restore.Charset)
+	}
+	if restore.Collation != "" {
+		stmt += " COLLATE " + mysqlQuoteLiteral(restore.Collation)
+	}
+	return stmt
+}
+
+func mysqlQuoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func mysqlQuoteLiteral(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func (m *MySQLAdapter) query(ctx context.Context, cfg config.DatabaseConfig, query string) (string, error) {
+	args := append(mysqlConnArgs(cfg), "-N", "-B", "-e", query)
+	if cfg.Database != "" {
+		args = append(args, cfg.Database)
+	}
+	cmd := exec.CommandContext(ctx, "mysql", args...)
+	cmd.Env = util.MergeEnv(buildMySQLEnv(cfg))
+	annotate := captureStderr(cmd, m.verbose)
+	out, err := cmd.Output()
+	return string(out), annotate(err)
+}
+
+// Restore loads mysqldump output with the mysql client and mydumper archives,
+// as recorded in the manifest, with myloader.
 func (m *MySQLAdapter) Restore(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig, manifest storage.Manifest) (*RestoreStream, error) {
+	loader := "mysql"
+	if manifest.DumpTool == ToolMydumper {
+		loader = "myloader"
+	}
 	if !m.allowMissingTools {
-		if err := util.RequireBinary("mysql"); err != nil {
+		if err := requireBinary(loader); err != nil {
 			return nil, err
 		}
 	}
@@ -113,27 +356,88 @@ func (m *MySQLAdapter) Restore(ctx context.Context, cfg config.DatabaseConfig, r
 			}
 		}
 	}
-	args := []string{"-h", cfg.Host, "-P", portOrDefault(cfg.Port, 3306), "-u", cfg.Username, cfg.Database}
-	if cfg.ConnectionTimeout > 0 {
-		args = append(args, fmt.Sprintf("--connect-timeout=%d", int(cfg.ConnectionTimeout.Seconds())))
+	if loader == "myloader" {
+		pr, pw := io.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			err := m.restoreMyloader(ctx, cfg, restore, manifest.Database, pr)
+			_ = pr.CloseWithError(err)
+			done <- err
+		}()
+		return &RestoreStream{Writer: pw, Wait: func() error { return <-done }}, nil
 	}
+	args := append(mysqlConnArgs(cfg), cfg.Database)
 	cmd := exec.CommandContext(ctx, "mysql", args...)
 	cmd.Env = util.MergeEnv(buildMySQLEnv(cfg))
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return nil, err
 	}
-	cmd.Stderr = stderrSink()
+	annotate := captureStderr(cmd, m.verbose)
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
-	return &RestoreStream{Writer: stdin, Wait: cmd.Wait}, nil
+	return &RestoreStream{Writer: stdin, Wait: func() error { return annotate(cmd.Wait()) }}, nil
+}
+
+// ListContents accepts both mysqldump output and mydumper archives.
+func (m *MySQLAdapter) ListContents(ctx context.Context, r io.Reader) ([]DumpObject, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(tarMagicEnd)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if isTarHeader(head) {
+		return listMydumperTables(br)
+	}
+	return scanSQLTables(br, "`")
+}
+
+// scanSQLTables finds CREATE TABLE statements in a plain SQL dump. Only the start of
+// each line is inspected so multi-megabyte INSERT lines are never buffered whole.
+// Each table is sized by the bytes from its CREATE TABLE to the next one, which in
+// mysqldump output holds that table's data.
+func scanSQLTables(r io.Reader, quote string) ([]DumpObject, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var objects []DumpObject
+	atLineStart := true
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if atLineStart && bytes.HasPrefix(chunk, []byte("CREATE TABLE ")) {
+			rest := strings.TrimPrefix(string(chunk), "CREATE TABLE ")
+			rest = strings.TrimPrefix(rest, "IF NOT EXISTS ")
+			name := strings.Fields(rest)
+			if len(name) > 0 {
+				qualified := strings.ReplaceAll(name[0], quote, "")
+				obj := DumpObject{Kind: "TABLE", Name: qualified}
+				if dot := strings.LastIndex(qualified, "."); dot >= 0 {
+					obj.Schema, obj.Name = qualified[:dot], qualified[dot+1:]
+				}
+				objects = append(objects, obj)
+			}
+		}
+		if len(objects) > 0 {
+			objects[len(objects)-1].Size += int64(len(chunk))
+		}
+		switch err {
+		case nil:
+			atLineStart = true
+		case bufio.ErrBufferFull:
+			atLineStart = false
+		case io.EOF:
+			return objects, nil
+		default:
+			return objects, err
+		}
+	}
 }
 
 func buildMySQLEnv(cfg config.DatabaseConfig) []string {
 	env := []string{}
-	if cfg.Password != "" {
-		env = append(env, "MYSQL_PWD="+cfg.Password)
+	// Validate reports a token that cannot be generated; here the tool just
+	// fails to authenticate.
+	if password, _ := databasePassword(cfg, 3306); password != "" {
+		env = append(env, "MYSQL_PWD="+password)
 	}
 	return env
 }
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+)
+
+func TestScanSQLTables(t *testing.T) {
+	dump := "-- MySQL dump\nDROP TABLE IF EXISTS `users`;\nCREATE TABLE `users` (\n  `id` int\n);\nINSERT INTO `users` VALUES (1),(2);\nCREATE TABLE IF NOT EXISTS `appdb`.`orders` (\n  `id` int\n);\n"
+	objects, err := scanSQLTables(strings.NewReader(dump), "`")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("expected 2 tables, got %+v", objects)
+	}
+	if !FindTable(objects, "users") || !FindTable(objects, "appdb.orders") {
+		t.Fatalf("unexpected tables: %+v", objects)
+	}
+	orders := strings.Index(dump, "CREATE TABLE IF NOT EXISTS")
+	users := int64(orders - strings.Index(dump, "CREATE TABLE `users`"))
+	if objects[0].Size != users || objects[1].Size != int64(len(dump)-orders) {
+		t.Fatalf("unexpected sizes: %+v", objects)
+	}
+}
+
+func TestMySQLDumpArgsSchemaData(t *testing.T) {
+	cfg := config.DatabaseConfig{Host: "db", Username: "app", Database: "appdb"}
+	cases := []struct {
+		name    string
+		backup  config.BackupConfig
+		want    []string
+		notWant []string
+	}{
+		{"full", config.BackupConfig{IncludeSchema: true, IncludeData: true}, []string{"--routines", "--triggers"}, []string{"--no-data", "--no-create-info"}},
+		{"schema only", config.BackupConfig{IncludeSchema: true}, []string{"--no-data", "--routines"}, []string{"--no-create-info"}},
+		{"data only", config.BackupConfig{IncludeData: true}, []string{"--no-create-info", "--skip-triggers"}, []string{"--no-data", "--routines", "--triggers"}},
+	}
+	for _, tc := range cases {
+		args := strings.Join(mysqlDumpArgs(cfg, tc.backup), " ")
+		for _, w := range tc.want {
+			if !strings.Contains(args, w) {
+				t.Errorf("%s: expected %s in %q", tc.name, w, args)
+			}
+		}
+		for _, nw := range tc.notWant {
+			if strings.Contains(args, nw+" ") {
+				t.Errorf("%s: unexpected %s in %q", tc.name, nw, args)
+			}
+		}
+		if !strings.HasSuffix(args, "--databases appdb") {
+			t.Errorf("%s: expected database last in %q", tc.name, args)
+		}
+	}
+}
+
+func TestMySQLChecksumSQL(t *testing.T) {
+	got := mysqlChecksumSQL([]string{"users", "we`ird"})
+	if want := "CHECKSUM TABLE `users`, `we``ird` EXTENDED"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestMySQLCreateDatabaseSQL(t *testing.T) {
+	got := mysqlCreateDatabaseSQL("appdb", config.RestoreConfig{Charset: "utf8mb4", Collation: "utf8mb4_0900_ai_ci"})
+	if want := "CREATE DATABASE `appdb` CHARACTER SET 'utf8mb4' COLLATE 'utf8mb4_0900_ai_ci'"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestMySQLConnArgsTLS(t *testing.T) {
+	cfg := config.DatabaseConfig{Host: "db", Username: "app", SSLMode: "VERIFY_CA", SSLCA: "/etc/dbu/ca.pem"}
+	args := strings.Join(mysqlConnArgs(cfg), " ")
+	for _, w := range []string{"-h db", "-P 3306", "--ssl-mode=VERIFY_CA", "--ssl-ca=/etc/dbu/ca.pem"} {
+		if !strings.Contains(args, w) {
+			t.Errorf("expected %s in %q", w, args)
+		}
+	}
+}
+
+func TestMySQLConnArgsSocket(t *testing.T) {
+	cfg := config.DatabaseConfig{Host: "db", Port: 3307, Socket: "/run/mysqld/mysqld.sock", Username: "app"}
+	args := strings.Join(mysqlConnArgs(cfg), " ")
+	if !strings.Contains(args, "--socket /run/mysqld/mysqld.sock -u app") {
+		t.Errorf("expected the socket in %q", args)
+	}
+	if strings.Contains(args, "-h ") || strings.Contains(args, "-P ") {
+		t.Errorf("expected host and port to be ignored in %q", args)
+	}
+	args = strings.Join(mydumperConnArgs(cfg), " ")
+	if args != "--socket /run/mysqld/mysqld.sock --user app" {
+		t.Errorf("unexpected mydumper args %q", args)
+	}
+}
+
+func TestMydumperArgs(t *testing.T) {
+	cfg := config.DatabaseConfig{Host: "db", Username: "app", Database: "appdb", Password: "secret"}
+	backup := config.BackupConfig{IncludeSchema: true, IncludeData: true, MaxParallelism: 8, Tables: []string{"users", "other.orders"}}
+	args := strings.Join(mydumperArgs(cfg, backup, "/tmp/x/client.cnf", "/tmp/x/dump"), " ")
+	for _, w := range []string{"--defaults-file /tmp/x/client.cnf", "--host db", "--port 3306", "--database appdb", "--outputdir /tmp/x/dump", "--threads 8", "--routines", "--tables-list appdb.users,other.orders"} {
+		if !strings.Contains(args, w) {
+			t.Errorf("expected %s in %q", w, args)
+		}
+	}
+	if strings.Contains(args, "secret") {
+		t.Errorf("password leaked into args: %q", args)
+	}
+	dataOnly := strings.Join(mydumperArgs(cfg, config.BackupConfig{IncludeData: true}, "d", "o"), " ")
+	if !strings.Contains(dataOnly, "--no-schemas") || strings.Contains(dataOnly, "--routines") {
+		t.Errorf("unexpected data-only args %q", dataOnly)
+	}
+}
+
+func TestMyloaderArgs(t *testing.T) {
+	cfg := config.DatabaseConfig{Host: "db", Username: "app", Database: "restored"}
+	restore := config.RestoreConfig{DropExisting: true, Tables: []string{"users"}}
+	args := strings.Join(myloaderArgs(cfg, restore, "appdb", "d", "/tmp/x/dump"), " ")
+	for _, w := range []string{"--directory /tmp/x/dump", "--database restored", "--overwrite-tables", "--tables-list appdb.users"} {
+		if !strings.Contains(args, w) {
+			t.Errorf("expected %s in %q", w, args)
+		}
+	}
+}
+
+func TestMySQLListContentsMydumper(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"metadata", "appdb-schema-create.sql", "appdb.users-schema.sql", "appdb.users.00000.sql", "appdb.orders-schema.sql"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("--\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	var buf bytes.Buffer
+	if err := writeTar(context.Background(), &buf, paths); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := NewMySQLAdapter(Options{}).ListContents(context.Background(), &buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(objects) != 2 || !FindTable(objects, "appdb.users") || !FindTable(objects, "orders") {
+		t.Fatalf("unexpected tables: %+v", objects)
+	}
+	for _, obj := range objects {
+		if want := map[string]int64{"users": 6, "orders": 3}[obj.Name]; obj.Size != want {
+			t.Errorf("%s size = %d, want %d", obj.Name, obj.Size, want)
+		}
+	}
+}
+
+func TestCheckMySQLGrants(t *testing.T) {
+	cases := []struct {
+		grants string
+		want   string
+	}{
+		{"GRANT ALL PRIVILEGES ON *.* TO `root`@`%`\n", ""},
+		{"GRANT USAGE ON *.* TO `app`@`%`\nGRANT CREATE, DROP, INSERT, SELECT ON `appdb`.* TO `app`@`%`\n", ""},
+		{"GRANT SELECT, INSERT ON `appdb`.* TO `app`@`%`\n", "lacks CREATE"},
+		{"GRANT ALL PRIVILEGES ON `otherdb`.* TO `app`@`%`\n", "lacks CREATE"},
+		{"", "lacks CREATE"},
+	}
+	for _, tc := range cases {
+		err := checkMySQLGrants(tc.grants, "app", "appdb")
+		if tc.want == "" && err != nil || tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("checkMySQLGrants(%q) = %v, want %q", tc.grants, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+)
+
+// connParam is one database.params entry passed through to the client tools.
+type connParam struct {
+	Key   string
+	Value string
+}
+
+// connParams returns database.params sorted by key, leaving out the keys in skip.
+// Keys compare case-insensitively, since config keys are lower-cased when loaded.
+func connParams(params map[string]string, skip ...string) []connParam {
+	var out []connParam
+	for key, value := range params {
+		skipped := false
+		for _, s := range skip {
+			if strings.EqualFold(key, s) {
+				skipped = true
+				break
+			}
+		}
+		if !skipped {
+			out = append(out, connParam{Key: key, Value: value})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// paramValue looks up a database.params entry case-insensitively.
+func paramValue(params map[string]string, key string) string {
+	for k, v := range params {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// reservedConnParams are always taken from the dedicated database fields.
+var reservedConnParams = []string{"host", "port", "user", "username", "password", "database", "dbname"}
+
+// libpqEnv maps libpq connection keywords to the environment variables that set
+// them for pg_dump, pg_restore and psql.
+var libpqEnv = map[string]string{
+	"application_name":         "PGAPPNAME",
+	"channel_binding":          "PGCHANNELBINDING",
+	"client_encoding":          "PGCLIENTENCODING",
+	"connect_timeout":          "PGCONNECT_TIMEOUT",
+	"gssdelegation":            "PGGSSDELEGATION",
+	"gssencmode":               "PGGSSENCMODE",
+	"gsslib":                   "PGGSSLIB",
+	"hostaddr":                 "PGHOSTADDR",
+	"krbsrvname":               "PGKRBSRVNAME",
+	"load_balance_hosts":       "PGLOADBALANCEHOSTS",
+	"passfile":                 "PGPASSFILE",
+	"require_auth":             "PGREQUIREAUTH",
+	"requirepeer":              "PGREQUIREPEER",
+	"service":                  "PGSERVICE",
+	"ssl_max_protocol_version": "PGSSLMAXPROTOCOLVERSION",
+	"ssl_min_protocol_version": "PGSSLMINPROTOCOLVERSION",
+	"sslcert":                  "PGSSLCERT",
+	"sslcompression":           "PGSSLCOMPRESSION",
+	"sslcrl":                   "PGSSLCRL",
+	"sslcrldir":                "PGSSLCRLDIR",
+	"sslkey":                   "PGSSLKEY",
+	"sslmode":                  "PGSSLMODE",
+	"sslnegotiation":           "PGSSLNEGOTIATION",
+	"sslrootcert":              "PGSSLROOTCERT",
+	"sslsni":                   "PGSSLSNI",
+	"target_session_attrs":     "PGTARGETSESSIONATTRS",
+}
+
+// withPostgresParams adds database.params to env. libpq keywords such as
+// application_name become their PG* variable unless a dedicated field already set
+// it; "options" and any other key, taken as a server setting (statement_timeout,
+// search_path), go into PGOPTIONS.
+func withPostgresParams(env []string, params map[string]string) []string {
+	set := map[string]bool{}
+	for _, kv := range env {
+		if name, value, _ := strings.Cut(kv, "="); value != "" {
+			set[name] = true
+		}
+	}
+	var options []string
+	for _, p := range connParams(params, reservedConnParams...) {
+		key := strings.ToLower(p.Key)
+		if key == "options" {
+			options = append(options, p.Value)
+			continue
+		}
+		if name, ok := libpqEnv[key]; ok {
+			if !set[name] {
+				env = append(env, name+"="+p.Value)
+			}
+			continue
+		}
+		options = append(options, "-c "+key+"="+pgOptionEscape(p.Value))
+	}
+	if len(options) > 0 {
+		env = append(env, "PGOPTIONS="+strings.Join(options, " "))
+	}
+	return env
+}
+
+// pgOptionEscape escapes a PGOPTIONS value, where spaces separate arguments.
+func pgOptionEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, " ", `\ `).Replace(value)
+}
+
+// mysqlParamArgs turns database.params into --key=value options for the mysql
+// client and mysqldump; an empty value gives a bare --key. They come before the
+// flags of the dedicated fields, which win since the last occurrence counts.
+func mysqlParamArgs(params map[string]string) []string {
+	var args []string
+	for _, p := range connParams(params, reservedConnParams...) {
+		flag := "--" + strings.TrimLeft(p.Key, "-")
+		if p.Value != "" {
+			flag += "=" + p.Value
+		}
+		args = append(args, flag)
+	}
+	return args
+}
+
+// mongoURI returns params.uri with the other database.params added as URI
+// options it does not already set, e.g. readPreference. With options but no uri,
+// it builds one from host, port and database, which may be empty. It is empty
+// when neither is given.
+func mongoURI(cfg config.DatabaseConfig, database string) string {
+	options := connParams(cfg.Params, append([]string{"uri", "authSource"}, reservedConnParams...)...)
+	uri := paramValue(cfg.Params, "uri")
+	if uri == "" {
+		if len(options) == 0 {
+			return ""
+		}
+		host := cfg.Host
+		if host == "" {
+			host = "localhost"
+		}
+		uri = "mongodb://" + net.JoinHostPort(host, portOrDefault(cfg.Port, 27017)) + "/" + url.PathEscape(database)
+	}
+	if len(options) == 0 {
+		return uri
+	}
+	// Multi-host URIs do not parse as URLs, so only the query is handled here.
+	base, rawQuery, _ := strings.Cut(uri, "?")
+	if scheme, rest, ok := strings.Cut(base, "://"); ok && !strings.Contains(rest, "/") {
+		base = scheme + "://" + rest + "/"
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return uri
+	}
+	for _, p := range options {
+		if !hasKeyFold(query, p.Key) {
+			query.Set(p.Key, p.Value)
+		}
+	}
+	return base + "?" + query.Encode()
+}
+
+func hasKeyFold(query url.Values, key string) bool {
+	for k := range query {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
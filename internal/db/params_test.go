@@ -0,0 +1,82 @@
+package db
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+)
+
+func TestPostgresParams(t *testing.T) {
+	cfg := config.DatabaseConfig{
+		Host: "db", Username: "app", Database: "appdb", SSLMode: "verify-full",
+		Params: map[string]string{
+			"application_name":  "dbu",
+			"sslmode":           "disable", // the dedicated field wins
+			"sslnegotiation":    "direct",
+			"host":              "elsewhere",
+			"statement_timeout": "0",
+			"search_path":       "app, public",
+		},
+	}
+	env := buildPostgresEnv(cfg)
+	for _, want := range []string{"PGAPPNAME=dbu", "PGSSLNEGOTIATION=direct", "PGSSLMODE=verify-full", "PGHOST=db",
+		`PGOPTIONS=-c search_path=app,\ public -c statement_timeout=0`} {
+		if !slices.Contains(env, want) {
+			t.Errorf("expected %s in %q", want, env)
+		}
+	}
+	for _, unwanted := range []string{"PGSSLMODE=disable", "PGHOST=elsewhere"} {
+		if slices.Contains(env, unwanted) {
+			t.Errorf("unexpected %s in %q", unwanted, env)
+		}
+	}
+}
+
+func TestMySQLParams(t *testing.T) {
+	cfg := config.DatabaseConfig{Host: "db", Username: "app", SSLMode: "REQUIRED", Params: map[string]string{
+		"default-character-set": "utf8mb4",
+		"compress":              "",
+		"ssl-mode":              "DISABLED",
+		"user":                  "root",
+	}}
+	args := mysqlConnArgs(cfg)
+	want := []string{"--compress", "--default-character-set=utf8mb4", "--ssl-mode=DISABLED", "-h", "db"}
+	if !reflect.DeepEqual(args[:5], want) {
+		t.Fatalf("args %q, want params first: %q", args, want)
+	}
+	// The dedicated field comes later and so wins.
+	if args[len(args)-1] != "--ssl-mode=REQUIRED" || slices.Contains(args, "--user=root") {
+		t.Fatalf("unexpected args %q", args)
+	}
+}
+
+func TestMongoParams(t *testing.T) {
+	cfg := config.DatabaseConfig{Host: "db", Port: 27018, Username: "app", Database: "appdb", Params: map[string]string{
+		"readpreference": "secondary",
+		"authSource":     "admin",
+	}}
+	args := strings.Join(mongoConnArgs(cfg), " ")
+	for _, w := range []string{"--uri mongodb://db:27018/?readpreference=secondary", "--username app", "--authenticationDatabase admin"} {
+		if !strings.Contains(args, w) {
+			t.Errorf("expected %s in %q", w, args)
+		}
+	}
+	if strings.Contains(args, "--host") {
+		t.Errorf("expected the uri to replace --host in %q", args)
+	}
+	if got := mongoshArgs(cfg)[0]; got != "mongodb://db:27018/appdb?readpreference=secondary" {
+		t.Errorf("mongosh uri = %q", got)
+	}
+
+	cfg.Params = map[string]string{"uri": "mongodb://a:1,b:2/appdb?readPreference=primary&replicaSet=rs0", "readpreference": "secondary", "w": "majority"}
+	if got := mongoshArgs(cfg); !reflect.DeepEqual(got, []string{"mongodb://a:1,b:2/appdb?readPreference=primary&replicaSet=rs0&w=majority"}) {
+		t.Errorf("mongosh args = %q", got)
+	}
+	cfg.Params = nil
+	if args := mongoConnArgs(cfg); !slices.Contains(args, "--host") {
+		t.Errorf("expected host flags without params, got %q", args)
+	}
+}
@@ -2,9 +2,12 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os/exec"
 	"strconv"
+	"strings"
 
 	"github.com/rowjay/db-backup-utility/internal/config"
 	"github.com/rowjay/db-backup-utility/internal/storage"
@@ -13,52 +16,156 @@ import (
 
 type PostgresAdapter struct {
 	allowMissingTools bool
+	verbose           bool
 }
 
-func NewPostgresAdapter(allowMissingTools bool) *PostgresAdapter {
-	return &PostgresAdapter{allowMissingTools: allowMissingTools}
+func NewPostgresAdapter(opts Options) *PostgresAdapter {
+	return &PostgresAdapter{allowMissingTools: opts.AllowMissingTools, verbose: opts.Verbose}
 }
 
 func (p *PostgresAdapter) Name() string { return "postgres" }
 
 func (p *PostgresAdapter) Capabilities() Capabilities {
-	return Capabilities{Incremental: false, Differential: false, TableRestore: true}
+	return Capabilities{Incremental: false, Differential: true, TableRestore: true, TableRename: true, LargeObjects: true, Schemas: true, SingleTransaction: true}
 }
 
 func (p *PostgresAdapter) Validate(ctx context.Context, cfg config.DatabaseConfig) error {
+	if _, err := databasePassword(cfg, 5432); err != nil {
+		return err
+	}
 	if !p.allowMissingTools {
-		if err := util.RequireBinary("pg_dump"); err != nil {
+		if err := requireBinary("pg_dump"); err != nil {
 			return err
 		}
-		if err := util.RequireBinary("pg_restore"); err != nil {
+		if err := requireBinary("pg_restore"); err != nil {
 			return err
 		}
 	}
 
-	if err := util.RequireBinary("pg_isready"); err == nil {
-		cmd := exec.CommandContext(ctx, "pg_isready", "-h", cfg.Host, "-p", portOrDefault(cfg.Port, 5432), "-U", cfg.Username, "-d", cfg.Database)
-		cmd.Env = util.MergeEnv(buildPostgresEnv(cfg))
-		return cmd.Run()
+	if err := requireBinary("pg_isready"); err == nil {
+		return pingWithRetry(ctx, cfg, func() *exec.Cmd {
+			cmd := exec.CommandContext(ctx, "pg_isready", "-h", postgresHost(cfg), "-p", portOrDefault(cfg.Port, 5432), "-U", cfg.Username, "-d", cfg.Database)
+			cmd.Env = util.MergeEnv(buildPostgresEnv(cfg))
+			return cmd
+		})
 	}
 
-	if err := util.RequireBinary("psql"); err != nil {
+	if err := requireBinary("psql"); err != nil {
 		return nil
 	}
-	cmd := exec.CommandContext(ctx, "psql", "-c", "SELECT 1")
+	return pingWithRetry(ctx, cfg, func() *exec.Cmd {
+		cmd := exec.CommandContext(ctx, "psql", "-c", "SELECT 1")
+		cmd.Env = util.MergeEnv(buildPostgresEnv(cfg))
+		return cmd
+	})
+}
+
+func (p *PostgresAdapter) PreflightRestore(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig) error {
+	if err := requireBinary("psql"); err != nil {
+		if p.allowMissingTools {
+			return nil
+		}
+		return fmt.Errorf("restore preflight checks privileges with psql: %w", err)
+	}
+	schemas := restore.Schemas
+	if len(schemas) == 0 {
+		schemas = []string{"public"}
+	}
+	query := "SELECT current_user, has_database_privilege(current_database(), 'CREATE')"
+	for _, schema := range schemas {
+		// Empty when the schema does not exist.
+		query += ", (SELECT has_schema_privilege(oid, 'CREATE') FROM pg_namespace WHERE nspname = " + pgQuoteLiteral(schema) + ")"
+	}
+	cmd := exec.CommandContext(ctx, "psql", "-X", "-A", "-t", "-c", query)
 	cmd.Env = util.MergeEnv(buildPostgresEnv(cfg))
-	return cmd.Run()
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("restore preflight: %w", err)
+	}
+	return checkPostgresPrivileges(string(out), cfg.Database, restore.Schemas)
+}
+
+// checkPostgresPrivileges reads the preflight query's user|database CREATE row,
+// followed by CREATE on each schema the restore targets, or on public when it
+// targets none. psql prints privileges as t or f, and nothing for a schema that
+// does not exist. Without targeted schemas it cannot tell which schemas the dump
+// creates or loads into, so missing privileges there are only warnings.
+func checkPostgresPrivileges(out, database string, targeted []string) error {
+	schemas := targeted
+	if len(schemas) == 0 {
+		schemas = []string{"public"}
+	}
+	unexpected := fmt.Errorf("restore preflight: unexpected psql output %q", strings.TrimSpace(out))
+	fields := strings.Split(strings.TrimRight(out, "\r\n"), "|")
+	if len(fields) != 2+len(schemas) || fields[1] != "t" && fields[1] != "f" {
+		return unexpected
+	}
+	user, createDatabase := fields[0], fields[1] == "t"
+	var warnings []error
+	for i, schema := range schemas {
+		switch field := fields[2+i]; {
+		case field == "t":
+		case field == "f" && len(targeted) > 0:
+			return fmt.Errorf("user %s lacks CREATE on schema %s in database %s", user, schema, database)
+		case field == "f":
+			warnings = append(warnings, fmt.Errorf("user %s lacks CREATE on schema %s in database %s; restoring objects into it will fail", user, schema, database))
+		case field == "" && len(targeted) > 0 && !createDatabase:
+			return fmt.Errorf("schema %s does not exist in database %s and user %s lacks CREATE on the database to create it", schema, database, user)
+		case field == "":
+		default:
+			return unexpected
+		}
+	}
+	if !createDatabase && len(targeted) == 0 {
+		warnings = append(warnings, fmt.Errorf("user %s lacks CREATE on database %s; restoring schemas that do not exist yet will fail", user, database))
+	}
+	if len(warnings) > 0 {
+		return &PreflightWarning{Err: errors.Join(warnings...)}
+	}
+	return nil
 }
 
 func (p *PostgresAdapter) Dump(ctx context.Context, cfg config.DatabaseConfig, backup config.BackupConfig) (*DumpStream, error) {
 	if !p.allowMissingTools {
-		if err := util.RequireBinary("pg_dump"); err != nil {
+		if err := requireBinary("pg_dump"); err != nil {
 			return nil, err
 		}
 	}
-	if backup.Type != "" && backup.Type != "full" {
+	if backup.Type == "incremental" {
 		return nil, fmt.Errorf("postgres does not support %s backups in this version", backup.Type)
 	}
 
+	args, err := postgresDumpArgs(cfg, backup)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, "pg_dump", args...)
+	cmd.Env = util.MergeEnv(buildPostgresEnv(cfg))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	annotate := captureStderr(cmd, p.verbose)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &DumpStream{Reader: stdout, Wait: func() error { return annotate(cmd.Wait()) }}, nil
+}
+
+func postgresDumpArgs(cfg config.DatabaseConfig, backup config.BackupConfig) ([]string, error) {
+	if backup.NoBlobs && backup.BlobsOnly {
+		return nil, fmt.Errorf("no_blobs and blobs_only cannot both be set")
+	}
+	if backup.BlobsOnly && len(backup.Tables) > 0 {
+		return nil, fmt.Errorf("blobs_only cannot be combined with tables")
+	}
+	if backup.BlobsOnly && (len(backup.Schemas) > 0 || len(backup.ExcludeSchemas) > 0) {
+		return nil, fmt.Errorf("blobs_only cannot be combined with schemas or exclude_schemas")
+	}
+	// pg_dump ignores --schema and --exclude-schema once --table is given.
+	if len(backup.Tables) > 0 && (len(backup.Schemas) > 0 || len(backup.ExcludeSchemas) > 0) {
+		return nil, fmt.Errorf("tables cannot be combined with schemas or exclude_schemas; qualify the tables with their schema instead")
+	}
 	args := []string{"--format=custom", "--no-owner", "--no-privileges"}
 	if backup.IncludeSchema && !backup.IncludeData {
 		args = append(args, "--schema-only")
@@ -66,65 +173,347 @@ func (p *PostgresAdapter) Dump(ctx context.Context, cfg config.DatabaseConfig, b
 	if backup.IncludeData && !backup.IncludeSchema {
 		args = append(args, "--data-only")
 	}
+	switch {
+	case backup.NoBlobs:
+		args = append(args, "--no-blobs")
+	case backup.BlobsOnly:
+		// pg_dump has no large-objects-only mode. Large objects belong to no schema,
+		// so excluding every schema leaves just them and their metadata.
+		args = append(args, "--blobs", "--exclude-schema=*")
+	}
+	for _, schema := range backup.Schemas {
+		args = append(args, "--schema", schema)
+	}
+	for _, schema := range backup.ExcludeSchemas {
+		args = append(args, "--exclude-schema", schema)
+	}
 	for _, tbl := range backup.Tables {
 		args = append(args, "--table", tbl)
 	}
-	args = append(args, cfg.Database)
+	return append(args, cfg.Database), nil
+}
 
-	cmd := exec.CommandContext(ctx, "pg_dump", args...)
+func (p *PostgresAdapter) Restore(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig, manifest storage.Manifest) (*RestoreStream, error) {
+	if !p.allowMissingTools {
+		if err := requireBinary("pg_restore"); err != nil {
+			return nil, err
+		}
+	}
+	if len(restore.TableMap) > 0 {
+		return p.restoreRenamed(ctx, cfg, restore)
+	}
+	cmd := exec.CommandContext(ctx, "pg_restore", postgresRestoreArgs(cfg, restore)...)
 	cmd.Env = util.MergeEnv(buildPostgresEnv(cfg))
-	stdout, err := cmd.StdoutPipe()
+	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return nil, err
 	}
-	cmd.Stderr = stderrSink()
+	annotate := captureStderr(cmd, p.verbose)
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
-	return &DumpStream{Reader: stdout, Wait: cmd.Wait}, nil
+	return &RestoreStream{Writer: stdin, Wait: func() error { return annotate(cmd.Wait()) }}, nil
 }
 
-func (p *PostgresAdapter) Restore(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig, manifest storage.Manifest) (*RestoreStream, error) {
-	if !p.allowMissingTools {
-		if err := util.RequireBinary("pg_restore"); err != nil {
-			return nil, err
-		}
-	}
+// postgresRestoreArgs returns the pg_restore arguments for restore. A single
+// transaction stops at the first error, so it implies --exit-on-error: the whole
+// restore is rolled back rather than left half applied.
+func postgresRestoreArgs(cfg config.DatabaseConfig, restore config.RestoreConfig) []string {
 	args := []string{"--dbname", cfg.Database, "--no-owner", "--no-privileges"}
 	if restore.DropExisting {
 		args = append(args, "--clean", "--if-exists")
 	}
-	if restore.StopOnError {
+	if restore.SingleTransaction {
+		args = append(args, "--single-transaction")
+	}
+	if restore.StopOnError || restore.SingleTransaction {
 		args = append(args, "--exit-on-error")
 	}
+	for _, schema := range restore.Schemas {
+		args = append(args, "--schema", schema)
+	}
 	for _, tbl := range restore.Tables {
 		args = append(args, "--table", tbl)
 	}
-	cmd := exec.CommandContext(ctx, "pg_restore", args...)
-	cmd.Env = util.MergeEnv(buildPostgresEnv(cfg))
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
+	return args
+}
+
+func (p *PostgresAdapter) ListContents(ctx context.Context, r io.Reader) ([]DumpObject, error) {
+	if err := requireBinary("pg_restore"); err != nil {
 		return nil, err
 	}
-	cmd.Stderr = stderrSink()
-	if err := cmd.Start(); err != nil {
+	cmd := exec.CommandContext(ctx, "pg_restore", "--list")
+	cmd.Stdin = r
+	annotate := captureStderr(cmd, p.verbose)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, annotate(err)
+	}
+	return parsePostgresTOC(string(out)), nil
+}
+
+// multiWordDescs are pg_restore TOC descriptors containing spaces, longest first.
+var multiWordDescs = []string{
+	"MATERIALIZED VIEW DATA",
+	"SEQUENCE OWNED BY",
+	"MATERIALIZED VIEW",
+	"DEFAULT ACL",
+	"FK CONSTRAINT",
+	"LARGE OBJECT",
+	"SEQUENCE SET",
+	"TABLE DATA",
+	"BLOB DATA",
+}
+
+// parsePostgresTOC parses `pg_restore --list` output lines of the form
+// "ID; CATALOG_OID OID DESC SCHEMA NAME OWNER".
+func parsePostgresTOC(toc string) []DumpObject {
+	var objects []DumpObject
+	for _, line := range strings.Split(toc, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		semi := strings.Index(line, ";")
+		if semi < 0 {
+			continue
+		}
+		fields := strings.Fields(line[semi+1:])
+		if len(fields) < 3 {
+			continue
+		}
+		rest := strings.Join(fields[2:], " ")
+		desc := fields[2]
+		for _, d := range multiWordDescs {
+			if strings.HasPrefix(rest, d+" ") {
+				desc = d
+				break
+			}
+		}
+		parts := strings.Fields(strings.TrimPrefix(rest, desc))
+		obj := DumpObject{Kind: desc}
+		if len(parts) >= 2 {
+			obj.Schema, obj.Name = parts[0], parts[1]
+		} else if len(parts) == 1 {
+			obj.Name = parts[0]
+		}
+		if obj.Schema == "-" {
+			obj.Schema = ""
+		}
+		objects = append(objects, obj)
+	}
+	return objects
+}
+
+const postgresListTablesSQL = "SELECT format('%I.%I', schemaname, tablename) FROM pg_tables " +
+	"WHERE schemaname NOT IN ('pg_catalog', 'information_schema') ORDER BY 1"
+
+func (p *PostgresAdapter) TableChecksums(ctx context.Context, cfg config.DatabaseConfig, tables []string) (map[string]string, error) {
+	if err := requireBinary("psql"); err != nil {
 		return nil, err
 	}
-	return &RestoreStream{Writer: stdin, Wait: cmd.Wait}, nil
+	if len(tables) == 0 {
+		out, err := p.psql(ctx, cfg, postgresListTablesSQL+";")
+		if err != nil {
+			return nil, fmt.Errorf("list tables: %w", err)
+		}
+		tables = nonEmptyLines(out)
+	}
+	if len(tables) == 0 {
+		return map[string]string{}, nil
+	}
+	out, err := p.psql(ctx, cfg, postgresChecksumSQL(tables))
+	if err != nil {
+		return nil, fmt.Errorf("checksum tables: %w", err)
+	}
+	return parseChecksumRows(out, "|", "")
+}
+
+const postgresSizeSQL = "SELECT pg_database_size(current_database());"
+
+// EstimateSize returns the on-disk size of the database, including indexes.
+func (p *PostgresAdapter) EstimateSize(ctx context.Context, cfg config.DatabaseConfig) (int64, error) {
+	if err := requireBinary("psql"); err != nil {
+		return 0, err
+	}
+	out, err := p.psql(ctx, cfg, postgresSizeSQL)
+	if err != nil {
+		return 0, err
+	}
+	return parseSize(out)
+}
+
+const postgresCountTablesSQL = "SELECT count(*) FROM pg_tables WHERE schemaname NOT IN ('pg_catalog', 'information_schema');"
+
+// CountObjects returns the number of tables outside the system schemas.
+func (p *PostgresAdapter) CountObjects(ctx context.Context, cfg config.DatabaseConfig) (int, error) {
+	if err := requireBinary("psql"); err != nil {
+		return 0, err
+	}
+	out, err := p.psql(ctx, cfg, postgresCountTablesSQL)
+	if err != nil {
+		return 0, err
+	}
+	n, err := parseSize(out)
+	return int(n), err
+}
+
+// Query runs an SQL query with psql.
+func (p *PostgresAdapter) Query(ctx context.Context, cfg config.DatabaseConfig, query string) (string, error) {
+	if err := requireBinary("psql"); err != nil {
+		return "", err
+	}
+	out, err := p.psql(ctx, cfg, strings.TrimSuffix(strings.TrimSpace(query), ";")+";")
+	if err != nil {
+		return "", err
+	}
+	return firstValue(out, "|"), nil
+}
+
+// postgresChecksumSQL sums the first 64 bits of every row's md5 next to the row
+// count. The sum does not depend on physical order, so nothing is sorted, and
+// stays one value however large the table. Tables are named as in SQL or pg_dump
+// --table, quoted or not, and are quoted again part by part.
+func postgresChecksumSQL(tables []string) string {
+	var b strings.Builder
+	for _, tbl := range tables {
+		fmt.Fprintf(&b, "SELECT %s, count(*) || ':' || coalesce(sum(('x' || substr(md5(t::text), 1, 16))::bit(64)::bigint), 0) FROM %s t;\n",
+			pgQuoteLiteral(tbl), pgQualifiedIdent(tbl))
+	}
+	return b.String()
+}
+
+// pgQualifiedIdent quotes every part of a possibly schema-qualified name as
+// PostgreSQL reads it: unquoted parts fold to lower case and quoted ones are
+// taken as written.
+func pgQualifiedIdent(name string) string {
+	var parts []string
+	for rest := strings.TrimSpace(name); ; {
+		var part string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest); i++ {
+				if rest[i] == '"' {
+					if i+1 < len(rest) && rest[i+1] == '"' {
+						b.WriteByte('"')
+						i++
+						continue
+					}
+					break
+				}
+				b.WriteByte(rest[i])
+			}
+			part = b.String()
+			rest = strings.TrimSpace(rest[min(i+1, len(rest)):])
+		} else {
+			end := strings.IndexByte(rest, '.')
+			if end < 0 {
+				end = len(rest)
+			}
+			part = strings.ToLower(strings.TrimSpace(rest[:end]))
+			rest = rest[end:]
+		}
+		parts = append(parts, pgQuoteIdent(part))
+		if !strings.HasPrefix(rest, ".") {
+			return strings.Join(parts, ".")
+		}
+		rest = strings.TrimSpace(rest[1:])
+	}
+}
+
+// postgresMaintenanceDBs are tried in order to connect when creating a database.
+var postgresMaintenanceDBs = []string{"postgres", "template1"}
+
+// MaintenanceDatabase points cfg at the first maintenance database CreateDatabase tries.
+func (p *PostgresAdapter) MaintenanceDatabase(cfg config.DatabaseConfig) config.DatabaseConfig {
+	cfg.Database = postgresMaintenanceDBs[0]
+	return cfg
+}
+
+func (p *PostgresAdapter) CreateDatabase(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig) error {
+	if err := requireBinary("psql"); err != nil {
+		return err
+	}
+	admin := cfg
+	var out string
+	var err error
+	for _, name := range postgresMaintenanceDBs {
+		admin.Database = name
+		out, err = p.psql(ctx, admin, "SELECT count(*) FROM pg_database WHERE datname = "+pgQuoteLiteral(cfg.Database)+";")
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("connect to maintenance database: %w", err)
+	}
+	var script strings.Builder
+	if strings.TrimSpace(out) != "0" {
+		if !restore.DropExisting {
+			return fmt.Errorf("database %s already exists; pass --drop-existing to recreate it", cfg.Database)
+		}
+		fmt.Fprintf(&script, "DROP DATABASE %s;\n", pgQuoteIdent(cfg.Database))
+	}
+	script.WriteString(postgresCreateDatabaseSQL(cfg.Database, restore) + ";\n")
+	if _, err := p.psql(ctx, admin, script.String()); err != nil {
+		return fmt.Errorf("create database %s: %w", cfg.Database, err)
+	}
+	return nil
+}
+
+func postgresCreateDatabaseSQL(name string, restore config.RestoreConfig) string {
+	stmt := "CREATE DATABASE " + pgQuoteIdent(name)
+	if restore.DatabaseOwner != "" {
+		stmt += " OWNER " + pgQuoteIdent(restore.DatabaseOwner)
+	}
+	if restore.Charset != "" || restore.Collation != "" {
+		// template1 may use a different encoding or locale.
+		stmt += " TEMPLATE template0"
+	}
+	if restore.Charset != "" {
+		stmt += " ENCODING " + pgQuoteLiteral(restore.Charset)
+	}
+	if restore.Collation != "" {
+		stmt += " LC_COLLATE " + pgQuoteLiteral(restore.Collation)
+	}
+	return stmt
+}
+
+func pgQuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func pgQuoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func (p *PostgresAdapter) psql(ctx context.Context, cfg config.DatabaseConfig, script string) (string, error) {
+	cmd := exec.CommandContext(ctx, "psql", "-X", "-A", "-t", "-q", "-v", "ON_ERROR_STOP=1", "-f", "-")
+	cmd.Env = util.MergeEnv(buildPostgresEnv(cfg))
+	cmd.Stdin = strings.NewReader(script)
+	annotate := captureStderr(cmd, p.verbose)
+	out, err := cmd.Output()
+	return string(out), annotate(err)
 }
 
 func buildPostgresEnv(cfg config.DatabaseConfig) []string {
 	env := []string{
-		"PGHOST=" + cfg.Host,
+		"PGHOST=" + postgresHost(cfg),
 		"PGPORT=" + portOrDefault(cfg.Port, 5432),
 		"PGUSER=" + cfg.Username,
 		"PGDATABASE=" + cfg.Database,
 	}
-	if cfg.Password != "" {
-		env = append(env, "PGPASSWORD="+cfg.Password)
+	// Validate reports a token that cannot be generated; here the tool just
+	// fails to authenticate.
+	if password, _ := databasePassword(cfg, 5432); password != "" {
+		env = append(env, "PGPASSWORD="+password)
 	}
 	if cfg.SSLMode != "" {
 		env = append(env, "PGSSLMODE="+cfg.SSLMode)
+	} else if usesIAM(cfg) {
+		// RDS only accepts IAM tokens over TLS.
+		env = append(env, "PGSSLMODE=require")
 	}
 	if cfg.SSLCA != "" {
 		env = append(env, "PGSSLROOTCERT="+cfg.SSLCA)
@@ -138,7 +527,16 @@ func buildPostgresEnv(cfg config.DatabaseConfig) []string {
 	if cfg.ConnectionTimeout > 0 {
 		env = append(env, "PGCONNECT_TIMEOUT="+strconv.Itoa(int(cfg.ConnectionTimeout.Seconds())))
 	}
-	return env
+	return withPostgresParams(env, cfg.Params)
+}
+
+// postgresHost is what libpq connects to: the socket directory when
+// database.socket is set, which libpq tells from a host by its leading slash.
+func postgresHost(cfg config.DatabaseConfig) string {
+	if cfg.Socket != "" {
+		return cfg.Socket
+	}
+	return cfg.Host
 }
 
 func portOrDefault(port int, def int) string {
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+// tableRename maps a table in the dump to the name it is restored under.
+type tableRename struct {
+	from, to string // schema-qualified, quoted as pg_restore prints them
+	pattern  *regexp.Regexp
+}
+
+// parseTableMap turns "table" or "schema.table" pairs into renames; unqualified
+// names are in public and targets default to the source schema.
+func parseTableMap(tableMap map[string]string) ([]tableRename, []string) {
+	sources := make([]string, 0, len(tableMap))
+	for src := range tableMap {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+	var renames []tableRename
+	var names []string
+	for _, src := range sources {
+		schema, name := splitQualified(src, "public")
+		toSchema, toName := splitQualified(tableMap[src], schema)
+		from := pgIdent(schema) + "." + pgIdent(name)
+		renames = append(renames, tableRename{
+			from:    from,
+			to:      pgIdent(toSchema) + "." + pgIdent(toName),
+			pattern: regexp.MustCompile(`(^|[^A-Za-z0-9_$".])` + regexp.QuoteMeta(from) + `([^A-Za-z0-9_$"]|$)`),
+		})
+		names = append(names, name)
+	}
+	return renames, names
+}
+
+func splitQualified(name, defaultSchema string) (string, string) {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return schema, table
+	}
+	return defaultSchema, name
+}
+
+var plainIdent = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// pgIdent quotes name the way pg_dump does for anything but plain lowercase names.
+func pgIdent(name string) string {
+	if plainIdent.MatchString(name) {
+		return name
+	}
+	return pgQuoteIdent(name)
+}
+
+// restoreRenamed restores only the mapped tables under their new names. pg_restore
+// renders them as SQL, table names are rewritten outside COPY data, and psql applies
+// the script in one transaction so a failure leaves nothing behind. Like any
+// pg_restore --table, indexes and constraints are not restored.
+func (p *PostgresAdapter) restoreRenamed(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig) (*RestoreStream, error) {
+	if err := requireBinary("psql"); err != nil {
+		return nil, err
+	}
+	renames, names := parseTableMap(restore.TableMap)
+	args := []string{"--file", "-", "--no-owner", "--no-privileges"}
+	if restore.DropExisting {
+		args = append(args, "--clean", "--if-exists")
+	}
+	for _, name := range names {
+		args = append(args, "--table", name)
+	}
+	render := exec.CommandContext(ctx, "pg_restore", args...)
+	stdin, err := render.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	script, err := render.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	annotateRender := captureStderr(render, p.verbose)
+
+	apply := exec.CommandContext(ctx, "psql", "-X", "-q", "--single-transaction", "-v", "ON_ERROR_STOP=1", "-f", "-")
+	apply.Env = util.MergeEnv(buildPostgresEnv(cfg))
+	applyIn, err := apply.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	annotateApply := captureStderr(apply, p.verbose)
+
+	if err := apply.Start(); err != nil {
+		return nil, err
+	}
+	if err := render.Start(); err != nil {
+		_ = applyIn.Close()
+		_ = apply.Wait()
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		err := rewriteTableNames(applyIn, script, renames)
+		if err != nil {
+			// Keep pg_restore from blocking on a full pipe once psql is gone.
+			_, _ = io.Copy(io.Discard, script)
+		}
+		_ = applyIn.Close()
+		done <- err
+	}()
+	return &RestoreStream{Writer: stdin, Wait: func() error {
+		rewriteErr := <-done
+		renderErr := annotateRender(render.Wait())
+		applyErr := annotateApply(apply.Wait())
+		switch {
+		case renderErr != nil:
+			return renderErr
+		case applyErr != nil:
+			return applyErr
+		case rewriteErr != nil:
+			return fmt.Errorf("rewrite table names: %w", rewriteErr)
+		}
+		return nil
+	}}, nil
+}
+
+// rewriteTableNames copies a pg_restore SQL script, renaming tables in statements
+// but never inside COPY data blocks.
+func rewriteTableNames(w io.Writer, r io.Reader, renames []tableRename) error {
+	br := bufio.NewReader(r)
+	inCopy := false
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			if inCopy {
+				inCopy = strings.TrimRight(line, "\r\n") != `\.`
+			} else {
+				for _, rn := range renames {
+					line = rn.pattern.ReplaceAllString(line, "${1}"+strings.ReplaceAll(rn.to, "$", "$$")+"${2}")
+				}
+				inCopy = strings.HasPrefix(line, "COPY ") && strings.HasSuffix(strings.TrimRight(line, "\r\n"), "FROM stdin;")
+			}
+			if _, werr := io.WriteString(w, line); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
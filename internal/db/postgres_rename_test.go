@@ -0,0 +1,48 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRewriteTableNames(t *testing.T) {
+	script := strings.Join([]string{
+		"DROP TABLE IF EXISTS public.users;",
+		"CREATE TABLE public.users (",
+		"    id integer DEFAULT nextval('public.users_id_seq'::regclass)",
+		");",
+		"CREATE TABLE public.users_archive (id integer);",
+		`CREATE TABLE sales."Orders" (id integer);`,
+		"COPY public.users (id) FROM stdin;",
+		"1\tpublic.users",
+		`\.`,
+		`COPY sales."Orders" (id) FROM stdin;`,
+		`\.`,
+		"",
+	}, "\n")
+	renames, names := parseTableMap(map[string]string{"users": "users_recovered", "sales.Orders": "recovery.Orders"})
+	if strings.Join(names, ",") != "Orders,users" {
+		t.Fatalf("unexpected table names: %v", names)
+	}
+	var out strings.Builder
+	if err := rewriteTableNames(&out, strings.NewReader(script), renames); err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	want := strings.Join([]string{
+		"DROP TABLE IF EXISTS public.users_recovered;",
+		"CREATE TABLE public.users_recovered (",
+		"    id integer DEFAULT nextval('public.users_id_seq'::regclass)",
+		");",
+		"CREATE TABLE public.users_archive (id integer);",
+		`CREATE TABLE recovery."Orders" (id integer);`,
+		"COPY public.users_recovered (id) FROM stdin;",
+		"1\tpublic.users",
+		`\.`,
+		`COPY recovery."Orders" (id) FROM stdin;`,
+		`\.`,
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
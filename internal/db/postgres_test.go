@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+)
+
+const sampleTOC = `;
+; Archive created at 2024-01-01 10:00:00 UTC
+;     dbname: appdb
+;
+; Selected TOC Entries:
+;
+215; 1259 16386 TABLE public users postgres
+216; 1259 16392 TABLE billing invoices postgres
+217; 1259 16390 SEQUENCE public users_id_seq postgres
+3320; 0 16386 TABLE DATA public users postgres
+3170; 2606 16398 CONSTRAINT public users users_pkey postgres
+`
+
+func TestParsePostgresTOC(t *testing.T) {
+	objects := parsePostgresTOC(sampleTOC)
+	if len(objects) != 5 {
+		t.Fatalf("expected 5 entries, got %d", len(objects))
+	}
+	if objects[3].Kind != "TABLE DATA" || objects[3].Name != "users" {
+		t.Fatalf("unexpected multi-word entry: %+v", objects[3])
+	}
+	for _, table := range []string{"users", "public.users", "billing.invoices"} {
+		if !FindTable(objects, table) {
+			t.Fatalf("expected %s to be found", table)
+		}
+	}
+	if FindTable(objects, "users_id_seq") {
+		t.Fatalf("sequence must not match a table lookup")
+	}
+}
+
+func TestPostgresChecksumSQLQuotesIdentifiers(t *testing.T) {
+	sql := postgresChecksumSQL([]string{`public."it's"`, "Sales.Order", `"Mixed".user`})
+	for _, want := range []string{
+		`SELECT 'public."it''s"', `, `FROM "public"."it's" t;`,
+		`FROM "sales"."order" t;`,
+		`SELECT '"Mixed".user', `, `FROM "Mixed"."user" t;`,
+	} {
+		if !strings.Contains(sql, want) {
+			t.Fatalf("expected %s in sql:\n%s", want, sql)
+		}
+	}
+	if strings.Contains(sql, "ORDER BY") || strings.Contains(sql, "string_agg") {
+		t.Fatalf("checksum must not sort or concatenate rows:\n%s", sql)
+	}
+}
+
+func TestPgQualifiedIdent(t *testing.T) {
+	cases := map[string]string{
+		"users":             `"users"`,
+		"public.Users":      `"public"."users"`,
+		`"My Schema"."T.1"`: `"My Schema"."T.1"`,
+		`public."a""b"`:     `"public"."a""b"`,
+	}
+	for in, want := range cases {
+		if got := pgQualifiedIdent(in); got != want {
+			t.Errorf("pgQualifiedIdent(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestPostgresCreateDatabaseSQL(t *testing.T) {
+	got := postgresCreateDatabaseSQL(`app"db`, config.RestoreConfig{DatabaseOwner: "app", Charset: "UTF8", Collation: "en_US.UTF-8"})
+	want := `CREATE DATABASE "app""db" OWNER "app" TEMPLATE template0 ENCODING 'UTF8' LC_COLLATE 'en_US.UTF-8'`
+	if got != want {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+	if got := postgresCreateDatabaseSQL("appdb", config.RestoreConfig{}); got != `CREATE DATABASE "appdb"` {
+		t.Fatalf("unexpected plain statement: %s", got)
+	}
+}
+
+func TestPostgresDumpArgs(t *testing.T) {
+	cfg := config.DatabaseConfig{Database: "appdb"}
+	base := config.BackupConfig{IncludeSchema: true, IncludeData: true}
+	cases := []struct {
+		name    string
+		backup  func(*config.BackupConfig)
+		want    string
+		wantErr bool
+	}{
+		{name: "default", backup: func(*config.BackupConfig) {}, want: "--format=custom --no-owner --no-privileges appdb"},
+		{name: "no blobs", backup: func(b *config.BackupConfig) { b.NoBlobs = true }, want: "--format=custom --no-owner --no-privileges --no-blobs appdb"},
+		{name: "blobs only", backup: func(b *config.BackupConfig) { b.BlobsOnly = true }, want: "--format=custom --no-owner --no-privileges --blobs --exclude-schema=* appdb"},
+		{name: "both", backup: func(b *config.BackupConfig) { b.NoBlobs, b.BlobsOnly = true, true }, wantErr: true},
+		{name: "blobs only with tables", backup: func(b *config.BackupConfig) { b.BlobsOnly, b.Tables = true, []string{"users"} }, wantErr: true},
+		{name: "schemas", backup: func(b *config.BackupConfig) {
+			b.Schemas, b.ExcludeSchemas = []string{"tenant_*"}, []string{"tenant_test"}
+		}, want: "--format=custom --no-owner --no-privileges --schema tenant_* --exclude-schema tenant_test appdb"},
+		{name: "blobs only with schemas", backup: func(b *config.BackupConfig) { b.BlobsOnly, b.Schemas = true, []string{"tenant_a"} }, wantErr: true},
+		{name: "tables with schemas", backup: func(b *config.BackupConfig) { b.Tables, b.ExcludeSchemas = []string{"users"}, []string{"audit"} }, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			backup := base
+			tc.backup(&backup)
+			args, err := postgresDumpArgs(cfg, backup)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(args, " "); got != tc.want {
+				t.Fatalf("args %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPostgresRestoreArgs(t *testing.T) {
+	cfg := config.DatabaseConfig{Database: "appdb"}
+	cases := []struct {
+		name    string
+		restore config.RestoreConfig
+		want    string
+	}{
+		{name: "default", want: "--dbname appdb --no-owner --no-privileges"},
+		{name: "stop on error", restore: config.RestoreConfig{StopOnError: true}, want: "--dbname appdb --no-owner --no-privileges --exit-on-error"},
+		{name: "single transaction", restore: config.RestoreConfig{SingleTransaction: true, DropExisting: true},
+			want: "--dbname appdb --no-owner --no-privileges --clean --if-exists --single-transaction --exit-on-error"},
+		{name: "both", restore: config.RestoreConfig{SingleTransaction: true, StopOnError: true, Tables: []string{"users"}},
+			want: "--dbname appdb --no-owner --no-privileges --single-transaction --exit-on-error --table users"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := strings.Join(postgresRestoreArgs(cfg, tc.restore), " "); got != tc.want {
+				t.Fatalf("args %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPostgresSocket(t *testing.T) {
+	cfg := config.DatabaseConfig{Host: "db", Port: 5433, Socket: "/var/run/postgresql", Username: "app", Database: "appdb"}
+	env := buildPostgresEnv(cfg)
+	for _, want := range []string{"PGHOST=/var/run/postgresql", "PGPORT=5433"} {
+		if !slices.Contains(env, want) {
+			t.Errorf("expected %s in %q", want, env)
+		}
+	}
+	cfg.Socket = ""
+	if env := buildPostgresEnv(cfg); !slices.Contains(env, "PGHOST=db") {
+		t.Errorf("expected the host without a socket, got %q", env)
+	}
+}
+
+func TestCheckPostgresPrivileges(t *testing.T) {
+	cases := []struct {
+		out     string
+		schemas []string
+		want    string // substring of the error; empty for none
+		warning bool
+	}{
+		{out: "restorer|t|t\n"},
+		{out: "restorer|f|t\n", want: "lacks CREATE on database appdb", warning: true},
+		{out: "restorer|t|f\n", want: "lacks CREATE on schema public", warning: true},
+		// public was dropped; the dump may recreate it.
+		{out: "restorer|t|\n"},
+		{out: "restorer|t|t|f\n", schemas: []string{"tenant_a", "tenant_b"}, want: "lacks CREATE on schema tenant_b"},
+		// PG15 revokes CREATE on public, which a tenant restore never touches.
+		{out: "restorer|f|t\n", schemas: []string{"tenant_a"}},
+		{out: "restorer|t|\n", schemas: []string{"tenant_a"}},
+		{out: "restorer|f|\n", schemas: []string{"tenant_a"}, want: "schema tenant_a does not exist"},
+		{out: "restorer|t\n", want: "unexpected psql output"},
+		{out: "restorer|true|true\n", want: "unexpected psql output"},
+		{out: "", want: "unexpected psql output"},
+	}
+	for _, tc := range cases {
+		err := checkPostgresPrivileges(tc.out, "appdb", tc.schemas)
+		if tc.want == "" && err != nil || tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("checkPostgresPrivileges(%q, %q) = %v, want %q", tc.out, tc.schemas, err, tc.want)
+		}
+		var warning *PreflightWarning
+		if err != nil && errors.As(err, &warning) != tc.warning {
+			t.Errorf("checkPostgresPrivileges(%q, %q) = %v, warning %v", tc.out, tc.schemas, err, tc.warning)
+		}
+	}
+}
+
+func TestPreflightRestoreNeedsClient(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	ctx := context.Background()
+	cfg := config.DatabaseConfig{Database: "appdb"}
+	for _, opts := range []Options{{}, {AllowMissingTools: true}} {
+		for _, adapter := range []Adapter{NewPostgresAdapter(opts), NewMySQLAdapter(opts), NewMongoAdapter(opts)} {
+			err := adapter.PreflightRestore(ctx, cfg, config.RestoreConfig{})
+			if opts.AllowMissingTools && err != nil {
+				t.Errorf("%s: expected allow_missing_tools to skip the preflight, got %v", adapter.Name(), err)
+			}
+			if !opts.AllowMissingTools && (err == nil || !strings.Contains(err.Error(), "restore preflight")) {
+				t.Errorf("%s: expected a missing client to fail the preflight, got %v", adapter.Name(), err)
+			}
+		}
+	}
+}
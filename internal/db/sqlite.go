@@ -1,18 +1,29 @@
 package db
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/rowjay/db-backup-utility/internal/config"
 	"github.com/rowjay/db-backup-utility/internal/storage"
 )
 
-type SQLiteAdapter struct{}
+type SQLiteAdapter struct {
+	allowMissingTools bool
+}
 
-func NewSQLiteAdapter() *SQLiteAdapter { return &SQLiteAdapter{} }
+func NewSQLiteAdapter(opts Options) *SQLiteAdapter {
+	return &SQLiteAdapter{allowMissingTools: opts.AllowMissingTools}
+}
 
 func (s *SQLiteAdapter) Name() string { return "sqlite" }
 
@@ -27,20 +38,107 @@ func (s *SQLiteAdapter) Validate(ctx context.Context, cfg config.DatabaseConfig)
 	if _, err := os.Stat(cfg.SQLitePath); err != nil {
 		return err
 	}
+	// Backups snapshot the database with the sqlite3 shell.
+	if !s.allowMissingTools {
+		if err := requireBinary("sqlite3"); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (s *SQLiteAdapter) PreflightRestore(ctx context.Context, cfg config.DatabaseConfig, _ config.RestoreConfig) error {
+	if cfg.SQLitePath == "" {
+		return fmt.Errorf("sqlite_path is required")
+	}
+	probe, err := os.CreateTemp(filepath.Dir(cfg.SQLitePath), ".dbu-preflight-*")
+	if err != nil {
+		return fmt.Errorf("cannot write to %s: %w", filepath.Dir(cfg.SQLitePath), err)
+	}
+	name := probe.Name()
+	_ = probe.Close()
+	return os.Remove(name)
+}
+
+// sqliteSidecars are the files SQLite keeps next to the database in WAL mode.
+// Backups hold neither, but those written by older versions may.
+var sqliteSidecars = []string{"-wal", "-shm"}
+
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// EstimateSize returns the size of the database file and its WAL sidecars.
+func (s *SQLiteAdapter) EstimateSize(ctx context.Context, cfg config.DatabaseConfig) (int64, error) {
+	info, err := os.Stat(cfg.SQLitePath)
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	for _, suffix := range sqliteSidecars {
+		if info, err := os.Stat(cfg.SQLitePath + suffix); err == nil {
+			size += info.Size()
+		}
+	}
+	return size, nil
+}
+
+// Query runs an SQL query with the sqlite3 shell, opening the database read-only.
+func (s *SQLiteAdapter) Query(ctx context.Context, cfg config.DatabaseConfig, query string) (string, error) {
+	if err := requireBinary("sqlite3"); err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, "sqlite3", "-readonly", "-batch", "-noheader", "-list", cfg.SQLitePath, query)
+	annotate := captureStderr(cmd, false)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", annotate(err)
+	}
+	return firstValue(string(out), "|"), nil
+}
+
+// Dump snapshots the database with VACUUM INTO, which reads it in one transaction
+// and so includes committed WAL data while other connections keep writing, and
+// streams the snapshot as a tar archive.
 func (s *SQLiteAdapter) Dump(ctx context.Context, cfg config.DatabaseConfig, backup config.BackupConfig) (*DumpStream, error) {
 	if cfg.SQLitePath == "" {
 		return nil, fmt.Errorf("sqlite_path is required")
 	}
-	file, err := os.Open(cfg.SQLitePath)
+	if _, err := os.Stat(cfg.SQLitePath); err != nil {
+		return nil, err
+	}
+	if err := requireBinary("sqlite3"); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp("", "dbu-sqlite-*")
 	if err != nil {
 		return nil, err
 	}
-	return &DumpStream{Reader: file, Wait: file.Close}, nil
+	// Named like the database, which is how the archive names its file.
+	snapshot := filepath.Join(tmp, filepath.Base(cfg.SQLitePath))
+	cmd := exec.CommandContext(ctx, "sqlite3", "-readonly", "-batch", cfg.SQLitePath, sqliteSnapshotSQL(snapshot))
+	annotate := captureStderr(cmd, false)
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		defer os.RemoveAll(tmp)
+		err := annotate(cmd.Run())
+		if err == nil {
+			err = writeTar(ctx, pw, []string{snapshot})
+		}
+		_ = pw.CloseWithError(err)
+		done <- err
+	}()
+	return &DumpStream{Reader: pr, Wait: func() error { return <-done }, Container: ContainerTar}, nil
 }
 
+// sqliteSnapshotSQL returns the statement that writes a consistent copy of the
+// database to path.
+func sqliteSnapshotSQL(path string) string {
+	return "VACUUM INTO '" + strings.ReplaceAll(path, "'", "''") + "'"
+}
+
+// Restore accepts both tar containers and plain database files from older backups.
+// Files are staged next to the target and only renamed into place once complete.
 func (s *SQLiteAdapter) Restore(ctx context.Context, cfg config.DatabaseConfig, restore config.RestoreConfig, manifest storage.Manifest) (*RestoreStream, error) {
 	if cfg.SQLitePath == "" {
 		return nil, fmt.Errorf("sqlite_path is required")
@@ -50,25 +148,115 @@ func (s *SQLiteAdapter) Restore(ctx context.Context, cfg config.DatabaseConfig,
 			return nil, fmt.Errorf("sqlite file already exists; enable drop_existing to overwrite")
 		}
 	}
-	file, err := os.OpenFile(cfg.SQLitePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
-	if err != nil {
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := restoreSQLite(pr, cfg.SQLitePath)
+		_ = pr.CloseWithError(err)
+		done <- err
+	}()
+	return &RestoreStream{Writer: pw, Wait: func() error { return <-done }}, nil
+}
+
+// ListContents lists the files of a SQLite backup: the database and any WAL
+// sidecars, or the single database file of an older, untarred backup.
+func (s *SQLiteAdapter) ListContents(ctx context.Context, r io.Reader) ([]DumpObject, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(sqliteMagic))
+	if err != nil && err != io.EOF {
 		return nil, err
 	}
-	writer := &flushWriter{writer: file}
-	return &RestoreStream{Writer: writer, Wait: writer.Close}, nil
+	if bytes.Equal(head, sqliteMagic) {
+		size, err := io.Copy(io.Discard, br)
+		return []DumpObject{{Kind: "FILE", Name: "(database)", Size: size}}, err
+	}
+	var objects []DumpObject
+	tr := tar.NewReader(br)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return objects, fmt.Errorf("read sqlite archive: %w", err)
+		}
+		objects = append(objects, DumpObject{Kind: "FILE", Name: hdr.Name, Size: hdr.Size})
+	}
 }
 
-type flushWriter struct {
-	writer *os.File
-}
+func restoreSQLite(r io.Reader, target string) error {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(sqliteMagic))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	staged := map[string]string{}
+	defer func() {
+		for _, tmp := range staged {
+			_ = os.Remove(tmp)
+		}
+	}()
 
-func (f *flushWriter) Write(p []byte) (int, error) { return f.writer.Write(p) }
+	if bytes.Equal(head, sqliteMagic) {
+		tmp, err := stageFile(target, br)
+		if err != nil {
+			return err
+		}
+		staged[""] = tmp
+	} else {
+		tr := tar.NewReader(br)
+		main := ""
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("read sqlite archive: %w", err)
+			}
+			if main == "" {
+				main = hdr.Name
+			}
+			suffix := strings.TrimPrefix(hdr.Name, main)
+			if hdr.Name != main+suffix || (suffix != "" && !slices.Contains(sqliteSidecars, suffix)) {
+				return fmt.Errorf("unexpected file %q in sqlite archive", hdr.Name)
+			}
+			if suffix == "-shm" {
+				// Older backups archived the shared-memory index, which SQLite rebuilds.
+				continue
+			}
+			tmp, err := stageFile(target, tr)
+			if err != nil {
+				return err
+			}
+			staged[suffix] = tmp
+		}
+		// Drain tar padding so the writer side sees a clean close.
+		if _, err := io.Copy(io.Discard, br); err != nil {
+			return err
+		}
+	}
+	if _, ok := staged[""]; !ok {
+		return fmt.Errorf("sqlite backup contains no database file")
+	}
 
-func (f *flushWriter) Close() error {
-	if err := f.writer.Sync(); err != nil {
+	// The target's sidecars go first, so the database being replaced never pairs
+	// with the restored WAL, which only follows the restored database into place.
+	for _, suffix := range sqliteSidecars {
+		if err := os.Remove(target + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(staged[""], target); err != nil {
 		return err
 	}
-	return f.writer.Close()
+	delete(staged, "")
+	if tmp, ok := staged["-wal"]; ok {
+		if err := os.Rename(tmp, target+"-wal"); err != nil {
+			return err
+		}
+		delete(staged, "-wal")
+	}
+	return nil
 }
-
-var _ io.WriteCloser = (*flushWriter)(nil)
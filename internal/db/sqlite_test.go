@@ -0,0 +1,138 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
+
+func TestSQLiteTarRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	main := filepath.Join(src, "app.db")
+	mustWrite(t, main, append(append([]byte{}, sqliteMagic...), "pages"...))
+	mustWrite(t, main+"-wal", []byte("wal frames"))
+
+	mustWrite(t, main+"-shm", []byte("index"))
+
+	// Older backups archived the sidecars next to the database.
+	var archive bytes.Buffer
+	if err := writeTar(context.Background(), &archive, []string{main, main + "-wal", main + "-shm"}); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := (&SQLiteAdapter{}).ListContents(context.Background(), bytes.NewReader(archive.Bytes()))
+	if err != nil || len(objects) != 3 || objects[0].Name != "app.db" || objects[1].Size != int64(len("wal frames")) {
+		t.Fatalf("unexpected contents %+v: %v", objects, err)
+	}
+
+	dst := t.TempDir()
+	target := filepath.Join(dst, "restored.db")
+	mustWrite(t, target, []byte("old database"))
+	mustWrite(t, target+"-wal", []byte("old wal"))
+	mustWrite(t, target+"-shm", []byte("stale"))
+	if err := restoreSQLite(&archive, target); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(target); !bytes.HasSuffix(got, []byte("pages")) {
+		t.Fatalf("unexpected database: %q", got)
+	}
+	if got, _ := os.ReadFile(target + "-wal"); string(got) != "wal frames" {
+		t.Fatalf("unexpected wal: %q", got)
+	}
+	if _, err := os.Stat(target + "-shm"); !os.IsNotExist(err) {
+		t.Fatalf("stale shm not removed or archived shm restored: %v", err)
+	}
+	entries, _ := os.ReadDir(dst)
+	if len(entries) != 2 {
+		t.Fatalf("unexpected files left: %v", entries)
+	}
+}
+
+func TestSQLiteDumpSnapshot(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not available")
+	}
+	path := filepath.Join(t.TempDir(), "it's.db")
+	create := exec.Command("sqlite3", path)
+	create.Stdin = strings.NewReader("PRAGMA journal_mode=WAL;\nCREATE TABLE t(x);\nINSERT INTO t VALUES (42);\n")
+	if out, err := create.CombinedOutput(); err != nil {
+		t.Fatalf("create database: %v: %s", err, out)
+	}
+
+	ctx := context.Background()
+	cfg := config.DatabaseConfig{SQLitePath: path}
+	stream, err := (&SQLiteAdapter{}).Dump(ctx, cfg, config.BackupConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := io.ReadAll(stream.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := (&SQLiteAdapter{}).ListContents(ctx, bytes.NewReader(archive))
+	if err != nil || len(objects) != 1 || objects[0].Name != "it's.db" {
+		t.Fatalf("expected only the database snapshot, got %+v: %v", objects, err)
+	}
+
+	restored := config.DatabaseConfig{SQLitePath: filepath.Join(t.TempDir(), "restored.db")}
+	rs, err := (&SQLiteAdapter{}).Restore(ctx, restored, config.RestoreConfig{}, storage.Manifest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.Writer.Write(archive); err != nil {
+		t.Fatal(err)
+	}
+	_ = rs.Writer.Close()
+	if err := rs.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("sqlite3", restored.SQLitePath, "SELECT x FROM t").Output()
+	if err != nil || strings.TrimSpace(string(out)) != "42" {
+		t.Fatalf("restored snapshot holds %q: %v", out, err)
+	}
+}
+
+func TestSQLiteRestorePlainFile(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "restored.db")
+	payload := append(append([]byte{}, sqliteMagic...), "pages"...)
+	if err := restoreSQLite(bytes.NewReader(payload), target); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(target); !bytes.Equal(got, payload) {
+		t.Fatalf("unexpected content: %q", got)
+	}
+}
+
+func mustWrite(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteValidateNeedsShell(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+	mustWrite(t, path, sqliteMagic)
+	t.Setenv("PATH", t.TempDir())
+	cfg := config.DatabaseConfig{SQLitePath: path}
+
+	var missing *util.MissingBinaryError
+	if err := NewSQLiteAdapter(Options{}).Validate(context.Background(), cfg); !errors.As(err, &missing) || missing.Name != "sqlite3" {
+		t.Fatalf("expected a missing sqlite3 to fail validation, got %v", err)
+	}
+	if err := NewSQLiteAdapter(Options{AllowMissingTools: true}).Validate(context.Background(), cfg); err != nil {
+		t.Fatalf("expected allow_missing_tools to skip the check, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ToolConstraint requires a version of a client tool, e.g. "pg_dump >= 15".
+type ToolConstraint struct {
+	Tool    string
+	Op      string
+	Version string
+}
+
+var (
+	constraintPattern = regexp.MustCompile(`^\s*([A-Za-z0-9_.\-]+)\s*(>=|<=|==|=|>|<)\s*v?(\d+(?:\.\d+)*)\s*$`)
+	// MariaDB's mysqldump prints its client protocol version before the server
+	// release ("Ver 10.19 Distrib 10.6.12-MariaDB"); the release is what matters.
+	distribPattern = regexp.MustCompile(`Distrib\s+(\d+(?:\.\d+)*)`)
+	versionPattern = regexp.MustCompile(`\d+(?:\.\d+)+|\d+`)
+)
+
+// ParseToolConstraint reads "<tool> <op> <version>" with op one of >=, >, <=, <, = or ==.
+func ParseToolConstraint(s string) (ToolConstraint, error) {
+	m := constraintPattern.FindStringSubmatch(s)
+	if m == nil {
+		return ToolConstraint{}, fmt.Errorf("invalid tool version constraint %q (want e.g. \"pg_dump >= 15\")", s)
+	}
+	return ToolConstraint{Tool: m[1], Op: m[2], Version: m[3]}, nil
+}
+
+func (c ToolConstraint) String() string { return c.Tool + " " + c.Op + " " + c.Version }
+
+// Allows reports whether version satisfies the constraint. Missing components
+// count as zero, so "15" equals "15.0".
+func (c ToolConstraint) Allows(version string) bool {
+	cmp := compareVersions(version, c.Version)
+	switch c.Op {
+	case ">=":
+		return cmp >= 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case "<":
+		return cmp < 0
+	default:
+		return cmp == 0
+	}
+}
+
+// ToolVersion runs "tool --version" and returns the first version number printed.
+func ToolVersion(ctx context.Context, tool string) (string, error) {
+	if err := requireBinary(tool); err != nil {
+		return "", err
+	}
+	out, err := exec.CommandContext(ctx, tool, "--version").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s --version: %w", tool, err)
+	}
+	return parseToolVersion(string(out))
+}
+
+func parseToolVersion(out string) (string, error) {
+	if m := distribPattern.FindStringSubmatch(out); m != nil {
+		return m[1], nil
+	}
+	if v := versionPattern.FindString(out); v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("no version in %q", strings.TrimSpace(out))
+}
+
+// CheckToolVersions fails unless every installed tool satisfies its constraints
+// (backup.require_tool_version).
+func CheckToolVersions(ctx context.Context, constraints []string) error {
+	versions := map[string]string{}
+	for _, s := range constraints {
+		c, err := ParseToolConstraint(s)
+		if err != nil {
+			return err
+		}
+		version, ok := versions[c.Tool]
+		if !ok {
+			if version, err = ToolVersion(ctx, c.Tool); err != nil {
+				return fmt.Errorf("check %s: %w", c, err)
+			}
+			versions[c.Tool] = version
+		}
+		if !c.Allows(version) {
+			return fmt.Errorf("%s %s does not satisfy %s", c.Tool, version, c)
+		}
+	}
+	return nil
+}
+
+// compareVersions compares dotted numeric versions, returning -1, 0 or 1.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseToolVersion(t *testing.T) {
+	cases := map[string]string{
+		"pg_dump (PostgreSQL) 15.4 (Debian 15.4-2.pgdg120+1)":                                         "15.4",
+		"mysqldump  Ver 8.0.35 for Linux on x86_64 (MySQL Community Server - GPL)":                    "8.0.35",
+		"mysqldump  Ver 10.19 Distrib 10.6.12-MariaDB, for debian-linux-gnu (x86_64)":                 "10.6.12",
+		"mongodump version: 100.9.4\ngit version: 2b1bc7a":                                            "100.9.4",
+		"3.45.1 2024-01-30 16:01:20 e876e51a0ed5c5b3126f52e532044363a014bc594cfefa87ffb5b82257cc467a": "3.45.1",
+	}
+	for out, want := range cases {
+		got, err := parseToolVersion(out)
+		if err != nil || got != want {
+			t.Fatalf("parseToolVersion(%q) = %q, %v; want %q", out, got, err, want)
+		}
+	}
+}
+
+func TestToolConstraintAllows(t *testing.T) {
+	cases := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"pg_dump >= 15", "15.4", true},
+		{"pg_dump >= 15", "14.9", false},
+		{"pg_dump>=15.4", "15.4.0", true},
+		{"mongodump > 100.9", "100.9", false},
+		{"mongodump < 101", "100.9.4", true},
+		{"mysqldump <= 8.0", "8.0.35", false},
+		{"sqlite3 = 3.45.1", "3.45.1", true},
+		{"sqlite3 == v3.45", "3.45.0", true},
+		{"pg_dump >= 9.10", "9.9", false},
+	}
+	for _, tc := range cases {
+		c, err := ParseToolConstraint(tc.constraint)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.constraint, err)
+		}
+		if got := c.Allows(tc.version); got != tc.want {
+			t.Fatalf("%q allows %s = %v, want %v", tc.constraint, tc.version, got, tc.want)
+		}
+	}
+	for _, bad := range []string{"pg_dump", "pg_dump ~> 15", ">= 15", "pg_dump >= latest"} {
+		if _, err := ParseToolConstraint(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestCheckToolVersions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script stand-in for the tool")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'pg_dump (PostgreSQL) 14.11'\n"
+	if err := os.WriteFile(filepath.Join(dir, "pg_dump"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	ctx := context.Background()
+	if err := CheckToolVersions(ctx, []string{"pg_dump >= 14", "pg_dump < 15"}); err != nil {
+		t.Fatalf("expected 14.11 to pass: %v", err)
+	}
+	err := CheckToolVersions(ctx, []string{"pg_dump >= 15"})
+	if err == nil || !strings.Contains(err.Error(), "pg_dump 14.11 does not satisfy pg_dump >= 15") {
+		t.Fatalf("expected an unmet constraint, got %v", err)
+	}
+	if err := CheckToolVersions(ctx, []string{"pg_restore >= 15"}); err == nil {
+		t.Fatalf("expected a missing tool to fail")
+	}
+}
@@ -0,0 +1,65 @@
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	gokeyring "github.com/zalando/go-keyring"
+)
+
+const (
+	// Prefix marks a config value that names a keychain entry instead of holding a key.
+	Prefix         = "keyring:"
+	service        = "dbu"
+	DefaultAccount = "default"
+)
+
+// IsRef reports whether value refers to the OS keychain.
+func IsRef(value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(value), Prefix)
+}
+
+// Expand returns value unchanged unless it is a keyring reference ("keyring:" or
+// "keyring:<account>"), in which case the stored key is returned.
+func Expand(value string) (string, error) {
+	if !IsRef(value) {
+		return value, nil
+	}
+	account := strings.TrimPrefix(strings.TrimSpace(value), Prefix)
+	return Get(account)
+}
+
+// Get reads the key stored for account.
+func Get(account string) (string, error) {
+	account = accountName(account)
+	secret, err := gokeyring.Get(service, account)
+	if err != nil {
+		return "", wrap(account, err)
+	}
+	return secret, nil
+}
+
+// Set stores key for account, replacing any previous value.
+func Set(account, key string) error {
+	account = accountName(account)
+	if err := gokeyring.Set(service, account, key); err != nil {
+		return wrap(account, err)
+	}
+	return nil
+}
+
+func accountName(account string) string {
+	if account == "" {
+		return DefaultAccount
+	}
+	return account
+}
+
+func wrap(account string, err error) error {
+	if errors.Is(err, gokeyring.ErrNotFound) {
+		return fmt.Errorf("no key stored in OS keychain for account %q; run `dbu config set-key --account %s`", account, account)
+	}
+	// Headless systems usually have no Secret Service (D-Bus) or keychain to talk to.
+	return fmt.Errorf("OS keychain unavailable (%v); on headless systems set backup.encryption_key or DBU_BACKUP_ENCRYPTION_KEY instead", err)
+}
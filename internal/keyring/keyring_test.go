@@ -0,0 +1,41 @@
+package keyring
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	gokeyring "github.com/zalando/go-keyring"
+)
+
+func TestExpand(t *testing.T) {
+	gokeyring.MockInit()
+	if err := Set("", "base64:default"); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := Set("laptop", "hex:laptop"); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	cases := map[string]string{
+		"base64:plain":   "base64:plain",
+		"keyring:":       "base64:default",
+		"keyring:laptop": "hex:laptop",
+	}
+	for in, want := range cases {
+		got, err := Expand(in)
+		if err != nil || got != want {
+			t.Errorf("Expand(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := Expand("keyring:missing"); err == nil || !strings.Contains(err.Error(), "set-key") {
+		t.Fatalf("expected set-key hint, got %v", err)
+	}
+}
+
+func TestUnavailableKeychain(t *testing.T) {
+	gokeyring.MockInitWithError(errors.New("dbus: no session bus"))
+	_, err := Get("")
+	if err == nil || !strings.Contains(err.Error(), "headless") {
+		t.Fatalf("expected headless hint, got %v", err)
+	}
+}
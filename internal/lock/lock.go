@@ -1,22 +1,25 @@
 package lock
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/gofrs/flock"
 )
 
 type Lock struct {
-	file *flock.Flock
+	file   *flock.Flock
+	shared *flock.Flock // the global lock file, held shared by scoped locks
 }
 
 // Acquire obtains a filesystem lock to prevent overlapping operations.
 func Acquire(path string) (*Lock, error) {
-	if path == "" {
-		path = filepath.Join(os.TempDir(), "dbu.lock")
-	}
+	path = defaultPath(path)
 	lock := flock.New(path)
 	ok, err := lock.TryLock()
 	if err != nil {
@@ -28,10 +31,102 @@ func Acquire(path string) (*Lock, error) {
 	return &Lock{file: lock}, nil
 }
 
+// AcquireScoped obtains the lock for one scope, such as a database, so operations
+// in different scopes can run at the same time. It also holds path itself shared,
+// so it still excludes, and is excluded by, a run holding path through Acquire.
+func AcquireScoped(path string, scope ...string) (*Lock, error) {
+	path = defaultPath(path)
+	shared := flock.New(path)
+	ok, err := shared.TryRLock()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("another backup/restore is already running (lock: %s)", path)
+	}
+	scoped := ScopedPath(path, scope...)
+	lock := flock.New(scoped)
+	ok, err = lock.TryLock()
+	if err != nil || !ok {
+		_ = shared.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("another backup/restore of %s is already running (lock: %s)", strings.Join(scope, "/"), scoped)
+	}
+	return &Lock{file: lock, shared: shared}, nil
+}
+
+// ScopedPath derives the lock file for a scope from path, e.g. dbu.lock with
+// postgres and appdb gives dbu-postgres-appdb.lock in the same directory.
+func ScopedPath(path string, scope ...string) string {
+	path = defaultPath(path)
+	ext := filepath.Ext(path)
+	name := strings.TrimSuffix(path, ext)
+	for _, part := range scope {
+		name += "-" + strings.Map(func(r rune) rune {
+			if r < 0x80 && (r == '.' || r == '_' || r == '-' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+				return r
+			}
+			return '_'
+		}, part)
+	}
+	return name + ext
+}
+
+// PreparePath makes sure the lock file at path can be created. With create, a
+// missing directory is created; when the directory cannot be created or written
+// because the filesystem is read-only or not writable, the lock moves to a file
+// of the same name in os.TempDir() and fallback is true. Without create, a
+// missing directory is an error.
+func PreparePath(path string, create bool) (resolved string, fallback bool, err error) {
+	path = defaultPath(path)
+	dir := filepath.Dir(path)
+	if !create {
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			return "", false, fmt.Errorf("lock file directory %s does not exist; create it or set global.lock_dir_missing: create", dir)
+		}
+		return path, false, nil
+	}
+	err = os.MkdirAll(dir, 0o750)
+	if err == nil {
+		var f *os.File
+		if f, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600); err == nil {
+			return path, false, f.Close()
+		}
+	}
+	if !unwritable(err) {
+		return "", false, fmt.Errorf("prepare lock file %s: %w", path, err)
+	}
+	temp := filepath.Join(os.TempDir(), filepath.Base(path))
+	if temp == path {
+		return "", false, fmt.Errorf("prepare lock file %s: %w", path, err)
+	}
+	return temp, true, nil
+}
+
+// unwritable reports whether err means the filesystem refuses writes.
+func unwritable(err error) bool {
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS)
+}
+
+func defaultPath(path string) string {
+	if path == "" {
+		return filepath.Join(os.TempDir(), "dbu.lock")
+	}
+	return path
+}
+
 // Release frees the lock.
 func (l *Lock) Release() error {
 	if l == nil || l.file == nil {
 		return nil
 	}
-	return l.file.Unlock()
+	err := l.file.Unlock()
+	if l.shared != nil {
+		if sharedErr := l.shared.Unlock(); err == nil {
+			err = sharedErr
+		}
+	}
+	return err
 }
@@ -0,0 +1,72 @@
+package lock
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAcquireScoped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dbu.lock")
+	if got := ScopedPath(path, "postgres", "app/db"); got != filepath.Join(filepath.Dir(path), "dbu-postgres-app_db.lock") {
+		t.Fatalf("unexpected scoped path %s", got)
+	}
+
+	appdb, err := AcquireScoped(path, "postgres", "appdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := AcquireScoped(path, "mysql", "shop")
+	if err != nil {
+		t.Fatalf("a different database should not be blocked: %v", err)
+	}
+	if _, err := AcquireScoped(path, "postgres", "appdb"); err == nil {
+		t.Fatal("expected the same database to be locked")
+	}
+	if _, err := Acquire(path); err == nil {
+		t.Fatal("expected the global lock to wait for scoped runs")
+	}
+	_ = appdb.Release()
+	_ = other.Release()
+
+	global, err := Acquire(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer global.Release()
+	if _, err := AcquireScoped(path, "mysql", "shop"); err == nil {
+		t.Fatal("expected scoped runs to wait for the global lock")
+	}
+}
+
+func TestPreparePath(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "run", "dbu", "dbu.lock")
+	if _, _, err := PreparePath(missing, false); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("expected a missing directory error, got %v", err)
+	}
+	path, fallback, err := PreparePath(missing, true)
+	if err != nil || fallback || path != missing {
+		t.Fatalf("PreparePath = %s, %v, %v; want the directory created", path, fallback, err)
+	}
+	lock, err := Acquire(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = lock.Release()
+
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	readOnly := filepath.Join(dir, "ro")
+	if err := os.Mkdir(readOnly, 0o500); err != nil {
+		t.Fatal(err)
+	}
+	temp := t.TempDir()
+	t.Setenv("TMPDIR", temp)
+	path, fallback, err = PreparePath(filepath.Join(readOnly, "sub", "dbu.lock"), true)
+	if err != nil || !fallback || path != filepath.Join(temp, "dbu.lock") {
+		t.Fatalf("PreparePath = %s, %v, %v; want a fallback to %s", path, fallback, err, temp)
+	}
+}
@@ -7,21 +7,53 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// Options selects the log level, format and destinations.
+type Options struct {
+	Level  string
+	Format string // json or console
+	Stdout bool
+	// File enables a size/age rotated log file alongside (or instead of) stdout.
+	File       string
+	MaxSizeMB  int
+	MaxAgeDays int
+	MaxBackups int
+}
+
 // Configure builds a zerolog logger from config values.
-func Configure(level, format string) zerolog.Logger {
+func Configure(opts Options) zerolog.Logger {
 	zerolog.TimeFieldFormat = time.RFC3339Nano
 
-	var output io.Writer = os.Stdout
-	if strings.EqualFold(format, "console") {
-		output = zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
+	var outputs []io.Writer
+	if opts.File != "" {
+		outputs = append(outputs, formatWriter(opts.Format, &lumberjack.Logger{
+			Filename:   opts.File,
+			MaxSize:    opts.MaxSizeMB,
+			MaxAge:     opts.MaxAgeDays,
+			MaxBackups: opts.MaxBackups,
+		}, true))
+	}
+	if opts.Stdout || len(outputs) == 0 {
+		outputs = append(outputs, formatWriter(opts.Format, os.Stdout, false))
+	}
+	output := outputs[0]
+	if len(outputs) > 1 {
+		output = zerolog.MultiLevelWriter(outputs...)
 	}
 
-	lvl, err := zerolog.ParseLevel(strings.ToLower(level))
+	lvl, err := zerolog.ParseLevel(strings.ToLower(opts.Level))
 	if err != nil {
 		lvl = zerolog.InfoLevel
 	}
 
 	return zerolog.New(output).Level(lvl).With().Timestamp().Logger()
 }
+
+func formatWriter(format string, w io.Writer, noColor bool) io.Writer {
+	if strings.EqualFold(format, "console") {
+		return zerolog.ConsoleWriter{Out: w, TimeFormat: time.RFC3339, NoColor: noColor}
+	}
+	return w
+}
@@ -4,11 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
+	"golang.org/x/sync/errgroup"
+
 	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/util"
 )
 
 type Event struct {
@@ -32,23 +38,33 @@ type Multi struct {
 	Targets []Notifier
 }
 
+// maxParallelNotify bounds how many targets are notified at once.
+const maxParallelNotify = 8
+
+// Notify sends to every target concurrently. A failing target does not stop the
+// others; all failures are returned joined.
 func (m Multi) Notify(ctx context.Context, event Event) error {
-	var err error
-	for _, target := range m.Targets {
+	errs := make([]error, len(m.Targets))
+	var eg errgroup.Group
+	eg.SetLimit(maxParallelNotify)
+	for i, target := range m.Targets {
 		if target == nil {
 			continue
 		}
-		if nerr := target.Notify(ctx, event); nerr != nil {
-			err = nerr
-		}
+		eg.Go(func() error {
+			errs[i] = target.Notify(ctx, event)
+			return nil
+		})
 	}
-	return err
+	_ = eg.Wait()
+	return errors.Join(errs...)
 }
 
 type Webhook struct {
 	Name    string
 	URL     string
 	Headers map[string]string
+	Client  *http.Client // nil uses the environment's proxy settings
 }
 
 func (w Webhook) Notify(ctx context.Context, event Event) error {
@@ -61,9 +77,9 @@ func (w Webhook) Notify(ctx context.Context, event Event) error {
 	for k, v := range w.Headers {
 		req.Header.Set(k, v)
 	}
-	resp, err := httpClient().Do(req)
+	resp, err := httpClient(w.Client).Do(req)
 	if err != nil {
-		return err
+		return fmt.Errorf("webhook %s: %w", w.Name, err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
@@ -73,8 +89,9 @@ func (w Webhook) Notify(ctx context.Context, event Event) error {
 }
 
 type Mattermost struct {
-	Name string
-	URL  string
+	Name   string
+	URL    string
+	Client *http.Client // nil uses the environment's proxy settings
 }
 
 func (m Mattermost) Notify(ctx context.Context, event Event) error {
@@ -85,9 +102,9 @@ func (m Mattermost) Notify(ctx context.Context, event Event) error {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := httpClient().Do(req)
+	resp, err := httpClient(m.Client).Do(req)
 	if err != nil {
-		return err
+		return fmt.Errorf("mattermost %s: %w", m.Name, err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
@@ -101,6 +118,7 @@ type Matrix struct {
 	ServerURL   string
 	AccessToken string
 	RoomID      string
+	Client      *http.Client // nil uses the environment's proxy settings
 }
 
 func (m Matrix) Notify(ctx context.Context, event Event) error {
@@ -115,9 +133,14 @@ func (m Matrix) Notify(ctx context.Context, event Event) error {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := httpClient().Do(req)
+	resp, err := httpClient(m.Client).Do(req)
 	if err != nil {
-		return err
+		// The URL carries the access token; keep it out of the error.
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("matrix %s: %w", m.Name, err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
@@ -126,20 +149,175 @@ func (m Matrix) Notify(ctx context.Context, event Event) error {
 	return nil
 }
 
-func FromConfig(cfg config.NotificationsConfig) Multi {
+// Filtered forwards only events whose type and status match the configured lists.
+type Filtered struct {
+	Next     Notifier
+	Events   []string
+	Statuses []string
+}
+
+func (f Filtered) Notify(ctx context.Context, event Event) error {
+	if !matchesAny(f.Events, event.Type) || !matchesAny(f.Statuses, event.Status) {
+		return nil
+	}
+	return f.Next.Notify(ctx, event)
+}
+
+func matchesAny(allowed []string, value string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(normalizeStatus(a), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeStatus maps config spellings onto Event.Status values.
+func normalizeStatus(v string) string {
+	switch strings.ToLower(v) {
+	case "failure", "fail", "error":
+		return "failed"
+	default:
+		return v
+	}
+}
+
+func withFilter(n Notifier, f config.NotifierFilter) Notifier {
+	if len(f.Events) == 0 && len(f.On) == 0 {
+		return n
+	}
+	return Filtered{Next: n, Events: f.Events, Statuses: f.On}
+}
+
+// Targets lists the configured channels ("kind:name") that would receive an event
+// of the given type and status. Channels FromConfig skips are left out.
+func Targets(cfg config.NotificationsConfig, eventType, status string) []string {
+	var names []string
+	for _, ch := range channels(cfg) {
+		if ch.err == nil && matchesAny(ch.filter.Events, eventType) && matchesAny(ch.filter.On, status) {
+			names = append(names, ch.kind+":"+ch.name)
+		}
+	}
+	return names
+}
+
+// Check returns a problem for every configured channel that cannot work, such as
+// a malformed URL or a Matrix channel without an access token.
+func Check(cfg config.NotificationsConfig) []error {
+	var errs []error
+	for _, ch := range channels(cfg) {
+		if ch.err != nil {
+			errs = append(errs, ch.err)
+		}
+	}
+	return errs
+}
+
+// FromConfig builds the configured channels, throttled when notifications.throttle
+// sets an interval. Channels that cannot work are skipped rather than failing on
+// every event; the returned warnings say which and why.
+func FromConfig(cfg config.NotificationsConfig) (Notifier, []error) {
 	var targets []Notifier
-	for _, w := range cfg.Webhooks {
-		targets = append(targets, Webhook{Name: w.Name, URL: w.URL, Headers: w.Headers})
+	var warnings []error
+	for _, ch := range channels(cfg) {
+		if ch.err != nil {
+			warnings = append(warnings, ch.err)
+			continue
+		}
+		targets = append(targets, withFilter(ch.notifier, ch.filter))
 	}
-	for _, mm := range cfg.Mattermost {
-		targets = append(targets, Mattermost{Name: mm.Name, URL: mm.URL})
+	multi := Multi{Targets: targets}
+	if cfg.Throttle.Interval <= 0 {
+		return multi, warnings
 	}
-	for _, mx := range cfg.Matrix {
-		targets = append(targets, Matrix{Name: mx.Name, ServerURL: mx.ServerURL, AccessToken: mx.AccessToken, RoomID: mx.RoomID})
+	return &Throttled{Next: multi, Interval: cfg.Throttle.Interval, StateFile: cfg.Throttle.StateFile}, warnings
+}
+
+// channel is one configured notifier, with the reason it cannot work if any.
+type channel struct {
+	kind, name string
+	notifier   Notifier
+	filter     config.NotifierFilter
+	err        error
+}
+
+func channels(cfg config.NotificationsConfig) []channel {
+	var out []channel
+	client, proxyErr := newHTTPClient(cfg.Proxy)
+	add := func(kind, name string, i int, n Notifier, f config.NotifierFilter, err error) {
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if err == nil {
+			err = proxyErr
+		}
+		if err != nil {
+			err = fmt.Errorf("notifications: %s %s: %w", kind, name, err)
+		}
+		out = append(out, channel{kind: kind, name: name, notifier: n, filter: f, err: err})
+	}
+	for i, w := range cfg.Webhooks {
+		add("webhook", w.Name, i, Webhook{Name: w.Name, URL: w.URL, Headers: w.Headers, Client: client}, w.NotifierFilter, checkURL("url", w.URL))
+	}
+	for i, mm := range cfg.Mattermost {
+		add("mattermost", mm.Name, i, Mattermost{Name: mm.Name, URL: mm.URL, Client: client}, mm.NotifierFilter, checkURL("url", mm.URL))
 	}
-	return Multi{Targets: targets}
+	for i, mx := range cfg.Matrix {
+		err := checkURL("server_url", mx.ServerURL)
+		switch {
+		case err != nil:
+		case mx.AccessToken == "":
+			err = errors.New("access_token is empty")
+		case mx.RoomID == "":
+			err = errors.New("room_id is empty")
+		}
+		add("matrix", mx.Name, i, Matrix{Name: mx.Name, ServerURL: mx.ServerURL, AccessToken: mx.AccessToken, RoomID: mx.RoomID, Client: client}, mx.NotifierFilter, err)
+	}
+	return out
 }
 
-func httpClient() *http.Client {
-	return &http.Client{Timeout: 10 * time.Second}
+// checkURL reports why raw is not an http or https URL a request can be sent to.
+func checkURL(field, raw string) error {
+	if raw == "" {
+		return fmt.Errorf("%s is empty", field)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid URL: %w", field, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%s %q must start with http:// or https://", field, raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%s %q has no host", field, raw)
+	}
+	return nil
+}
+
+// notifyTimeout bounds each notification request.
+const notifyTimeout = 10 * time.Second
+
+func httpClient(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return &http.Client{Timeout: notifyTimeout}
+}
+
+// newHTTPClient builds the client for notifications.proxy; an empty proxy keeps
+// the default transport, which reads HTTPS_PROXY and NO_PROXY.
+func newHTTPClient(proxy string) (*http.Client, error) {
+	if proxy == "" {
+		return nil, nil
+	}
+	proxyFunc, err := util.ProxyFunc(proxy)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc
+	return &http.Client{Timeout: notifyTimeout, Transport: transport}, nil
 }
@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+)
+
+type recorder struct{ events []Event }
+
+func (r *recorder) Notify(_ context.Context, event Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestFilteredMatchesEventsAndStatuses(t *testing.T) {
+	rec := &recorder{}
+	f := Filtered{Next: rec, Events: []string{"restore"}, Statuses: []string{"failure"}}
+
+	_ = f.Notify(context.Background(), Event{Type: "backup", Status: "failed"})
+	_ = f.Notify(context.Background(), Event{Type: "restore", Status: "success"})
+	_ = f.Notify(context.Background(), Event{Type: "restore", Status: "failed"})
+
+	if len(rec.events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(rec.events))
+	}
+	if rec.events[0].Type != "restore" || rec.events[0].Status != "failed" {
+		t.Fatalf("unexpected event: %+v", rec.events[0])
+	}
+}
+
+func TestFilteredEmptyMatchesAll(t *testing.T) {
+	rec := &recorder{}
+	f := Filtered{Next: rec}
+	_ = f.Notify(context.Background(), Event{Type: "backup", Status: "success"})
+	if len(rec.events) != 1 {
+		t.Fatalf("expected event to pass through")
+	}
+}
+
+type failing struct{ name string }
+
+func (f failing) Notify(context.Context, Event) error { return errors.New(f.name + " down") }
+
+type slow struct{ done chan struct{} }
+
+func (s slow) Notify(ctx context.Context, _ Event) error {
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+func TestMultiJoinsErrorsAndRunsConcurrently(t *testing.T) {
+	rec := &recorder{}
+	done := make(chan struct{})
+	m := Multi{Targets: []Notifier{failing{"a"}, slow{done}, rec, failing{"b"}, nil}}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(done)
+	}()
+	err := m.Notify(context.Background(), Event{Type: "backup"})
+	if err == nil || !strings.Contains(err.Error(), "a down") || !strings.Contains(err.Error(), "b down") {
+		t.Fatalf("expected both failures, got %v", err)
+	}
+	if len(rec.events) != 1 {
+		t.Fatalf("expected the healthy target to be notified, got %d events", len(rec.events))
+	}
+}
+
+func TestFromConfigSkipsInvalidChannels(t *testing.T) {
+	cfg := config.NotificationsConfig{
+		Webhooks: []config.WebhookConfig{
+			{Name: "ok", URL: "https://hooks.example.com/dbu"},
+			{Name: "typo", URL: "hooks.example.com/dbu"},
+		},
+		Matrix: []config.MatrixConfig{{ServerURL: "https://matrix.example.com", RoomID: "!room:example.com"}},
+	}
+	n, warnings := FromConfig(cfg)
+	if len(warnings) != 2 || !strings.Contains(warnings[0].Error(), "webhook typo") || !strings.Contains(warnings[1].Error(), "matrix #1: access_token is empty") {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+	if targets := n.(Multi).Targets; len(targets) != 1 || targets[0].(Webhook).Name != "ok" {
+		t.Fatalf("unexpected targets %+v", targets)
+	}
+	if got := Targets(cfg, "backup", "failed"); len(got) != 1 || got[0] != "webhook:ok" {
+		t.Fatalf("unexpected target names %v", got)
+	}
+	if errs := Check(cfg); len(errs) != 2 {
+		t.Fatalf("expected Check to report both channels, got %v", errs)
+	}
+}
+
+func TestFromConfigUsesProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	cfg := config.NotificationsConfig{
+		Webhooks: []config.WebhookConfig{{Name: "ops", URL: "http://hooks.example.invalid/dbu"}},
+		Proxy:    proxy.URL,
+	}
+	n, warnings := FromConfig(cfg)
+	if len(warnings) != 0 {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+	if err := n.Notify(context.Background(), Event{Type: "backup", Status: "success"}); err != nil {
+		t.Fatal(err)
+	}
+	if proxied != "http://hooks.example.invalid/dbu" {
+		t.Fatalf("expected the webhook to go through the proxy, got %q", proxied)
+	}
+
+	cfg.Proxy = "proxy.example.com:3128"
+	if errs := Check(cfg); len(errs) != 1 || !strings.Contains(errs[0].Error(), "webhook ops: proxy") {
+		t.Fatalf("expected a proxy error, got %v", errs)
+	}
+}
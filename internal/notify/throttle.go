@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Throttled stops a failure that keeps repeating from flooding the channels. A
+// failure is sent at most once per Interval for the same operation, database and
+// error class; repeats in between are counted. The count is reported on the next
+// failure that is sent, and on the success that ends the storm.
+type Throttled struct {
+	Next     Notifier
+	Interval time.Duration
+	// StateFile persists the counters so separate runs (e.g. from cron) share them.
+	// Without it, throttling only spans one process.
+	StateFile string
+
+	mu    sync.Mutex
+	state map[string]throttleEntry
+	now   func() time.Time
+}
+
+type throttleEntry struct {
+	LastSent   time.Time `json:"last_sent"`
+	Suppressed int       `json:"suppressed"`
+}
+
+func (t *Throttled) Notify(ctx context.Context, event Event) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if t.now != nil {
+		now = t.now()
+	}
+	state, err := t.load()
+	if err != nil {
+		// A broken state file must not silence alerts.
+		state = map[string]throttleEntry{}
+	}
+
+	scope := event.Type + "|" + event.DBType + "|" + event.Database + "|"
+	switch event.Status {
+	case "failed":
+		key := scope + errorClass(event.Error)
+		entry := state[key]
+		if !entry.LastSent.IsZero() && now.Sub(entry.LastSent) < t.Interval {
+			entry.Suppressed++
+			state[key] = entry
+			return t.save(state)
+		}
+		if entry.Suppressed > 0 {
+			event.Message += fmt.Sprintf(" (suppressed %d duplicate alerts since %s)", entry.Suppressed, entry.LastSent.UTC().Format(time.RFC3339))
+		}
+		state[key] = throttleEntry{LastSent: now}
+	case "success":
+		suppressed := 0
+		for key, entry := range state {
+			if strings.HasPrefix(key, scope) {
+				suppressed += entry.Suppressed
+				delete(state, key)
+			}
+		}
+		if suppressed > 0 {
+			event.Message += fmt.Sprintf(" (recovered; suppressed %d duplicate alerts)", suppressed)
+		}
+	}
+	return errors.Join(t.save(state), t.Next.Notify(ctx, event))
+}
+
+// errorClass groups failures by the leading phrase of their message, e.g.
+// "database unreachable" or "upload failed", ignoring details that vary per run.
+func errorClass(msg string) string {
+	class, _, _ := strings.Cut(msg, ":")
+	return strings.TrimSpace(class)
+}
+
+func (t *Throttled) load() (map[string]throttleEntry, error) {
+	if t.StateFile == "" {
+		if t.state == nil {
+			t.state = map[string]throttleEntry{}
+		}
+		return t.state, nil
+	}
+	state := map[string]throttleEntry{}
+	data, err := os.ReadFile(t.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("notification throttle state %s: %w", t.StateFile, err)
+	}
+	return state, nil
+}
+
+func (t *Throttled) save(state map[string]throttleEntry) error {
+	if t.StateFile == "" {
+		t.state = state
+		return nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(t.StateFile), ".dbu-throttle-*")
+	if err != nil {
+		return fmt.Errorf("notification throttle state: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), t.StateFile)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("notification throttle state: %w", err)
+	}
+	return nil
+}
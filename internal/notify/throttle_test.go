@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottledSuppressesRepeatedFailures(t *testing.T) {
+	ctx := context.Background()
+	clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	rec := &recorder{}
+	state := filepath.Join(t.TempDir(), "throttle.json")
+	newThrottle := func() *Throttled {
+		// A fresh value per event mimics one process per scheduled run.
+		return &Throttled{Next: rec, Interval: time.Hour, StateFile: state, now: func() time.Time { return clock }}
+	}
+	fail := Event{Type: "backup", Status: "failed", DBType: "postgres", Database: "app", Message: "backup app", Error: "database unreachable: pg_isready: exit status 2"}
+
+	for i := 0; i < 5; i++ {
+		if err := newThrottle().Notify(ctx, fail); err != nil {
+			t.Fatal(err)
+		}
+		clock = clock.Add(time.Minute)
+	}
+	if len(rec.events) != 1 {
+		t.Fatalf("expected 1 alert during the storm, got %d", len(rec.events))
+	}
+
+	other := fail
+	other.Error = "upload failed: connection reset"
+	_ = newThrottle().Notify(ctx, other)
+	if len(rec.events) != 2 {
+		t.Fatalf("a different error class should not be throttled")
+	}
+
+	clock = clock.Add(time.Hour)
+	_ = newThrottle().Notify(ctx, fail)
+	if len(rec.events) != 3 || !strings.Contains(rec.events[2].Message, "suppressed 4 duplicate alerts") {
+		t.Fatalf("expected the next alert to carry the count, got %+v", rec.events[len(rec.events)-1])
+	}
+
+	_ = newThrottle().Notify(ctx, fail)
+	_ = newThrottle().Notify(ctx, Event{Type: "backup", Status: "success", DBType: "postgres", Database: "app", Message: "backup app"})
+	if len(rec.events) != 4 || !strings.Contains(rec.events[3].Message, "recovered; suppressed 1 duplicate alerts") {
+		t.Fatalf("expected a recovery summary, got %+v", rec.events[len(rec.events)-1])
+	}
+
+	_ = newThrottle().Notify(ctx, fail)
+	if len(rec.events) != 5 || strings.Contains(rec.events[4].Message, "suppressed") {
+		t.Fatalf("expected recovery to reset the throttle, got %+v", rec.events[len(rec.events)-1])
+	}
+}
+
+func TestThrottledInMemory(t *testing.T) {
+	rec := &recorder{}
+	th := &Throttled{Next: rec, Interval: time.Hour}
+	fail := Event{Type: "backup", Status: "failed", Database: "app", Error: "dump failed: boom"}
+	for i := 0; i < 3; i++ {
+		_ = th.Notify(context.Background(), fail)
+	}
+	if len(rec.events) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(rec.events))
+	}
+}
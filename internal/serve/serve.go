@@ -0,0 +1,244 @@
+// Package serve exposes stored backups for download over read-only HTTP, so
+// another system can pull a backup without storage credentials (dbu serve).
+package serve
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/cryptoutil"
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+// objectsPath lists objects, and serves one when followed by its key.
+const objectsPath = "/backups/"
+
+// Handler serves GET /backups/ (a JSON listing) and GET /backups/<key> (the
+// object, with range support) for keys under Prefix. Every request needs the
+// bearer token; nothing is ever written.
+type Handler struct {
+	Storage storage.Storage
+	// Prefix limits what is listed and served; empty allows the whole store.
+	Prefix string
+	Token  string
+	Log    zerolog.Logger
+}
+
+// Object is one entry of the listing.
+type Object struct {
+	Key      string    `json:"key"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Manifest bool      `json:"manifest,omitempty"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="dbu"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, objectsPath)
+	switch {
+	case !ok && r.URL.Path+"/" != objectsPath:
+		http.NotFound(w, r)
+	case key == "":
+		h.list(w, r)
+	default:
+		h.get(w, r, key)
+	}
+}
+
+// authorized compares the bearer token in constant time. Tokens are only read
+// from the header, never the URL, which ends up in logs.
+func (h *Handler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && h.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.Token)) == 1
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	prefix := h.Prefix
+	if sub := r.URL.Query().Get("prefix"); sub != "" {
+		if !h.servable(sub) {
+			http.NotFound(w, r)
+			return
+		}
+		prefix = sub
+	}
+	objects, err := h.Storage.List(r.Context(), prefix)
+	if err != nil {
+		h.fail(w, r, "", err)
+		return
+	}
+	listing := make([]Object, 0, len(objects))
+	for _, obj := range objects {
+		if !h.servable(obj.Key) {
+			continue
+		}
+		listing = append(listing, Object{Key: obj.Key, Size: obj.Size, Modified: obj.Modified, Manifest: obj.IsManifest})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(listing)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, key string) {
+	if !h.servable(key) {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := h.Storage.Stat(r.Context(), key)
+	if err != nil {
+		h.fail(w, r, key, err)
+		return
+	}
+	object := &objectReader{ctx: r.Context(), store: h.Storage, key: key, size: info.Size}
+	defer object.Close()
+	contentType, err := object.contentType()
+	if err != nil {
+		h.fail(w, r, key, err)
+		return
+	}
+	// Compressed backups are served as files, never with Content-Encoding, so
+	// clients save the bytes as stored instead of decompressing them on the fly.
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(key)}))
+	w.Header().Set("Cache-Control", "no-store")
+	if info.ETag != "" {
+		w.Header().Set("ETag", `"`+strings.Trim(info.ETag, `"`)+`"`)
+	}
+	h.Log.Info().Str("key", key).Str("remote", r.RemoteAddr).Str("range", r.Header.Get("Range")).Msg("serving backup")
+	http.ServeContent(w, r, "", info.Modified, object)
+}
+
+// servable reports whether key may be listed or served: under Prefix, in clean
+// form, and not one of dbu's own state objects.
+func (h *Handler) servable(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." || part == "." {
+			return false
+		}
+	}
+	if h.Prefix != "" && key != h.Prefix && !strings.HasPrefix(key, strings.TrimSuffix(h.Prefix, "/")+"/") {
+		return false
+	}
+	return !storage.IsRestoreMarker(key) && !storage.IsStatus(key) && !storage.IsPause(key)
+}
+
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, key string, err error) {
+	if storage.IsNotFound(err) {
+		http.NotFound(w, r)
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	h.Log.Error().Err(err).Str("key", key).Msg("serve failed")
+	http.Error(w, "storage error", http.StatusBadGateway)
+}
+
+// contentType names what the object holds by its key. Manifests and other
+// sidecars are JSON unless they were sealed with the encryption key; parts of a
+// chunked backup are opaque on their own.
+func (o *objectReader) contentType() (string, error) {
+	switch {
+	case strings.HasSuffix(o.key, ".json"):
+		reader, err := storage.GetRange(o.ctx, o.store, o.key, 0, 4)
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+		head, err := io.ReadAll(reader)
+		if err != nil {
+			return "", err
+		}
+		if cryptoutil.IsEncryptedConfig(head) {
+			return "application/octet-stream", nil
+		}
+		return "application/json", nil
+	case storage.IsChunkKey(o.key), strings.HasSuffix(o.key, ".enc"):
+		return "application/octet-stream", nil
+	}
+	switch path.Ext(o.key) {
+	case ".gz":
+		return "application/gzip", nil
+	case ".zst":
+		return "application/zstd", nil
+	case ".br":
+		return "application/x-brotli", nil
+	case ".tar":
+		return "application/x-tar", nil
+	}
+	return "application/octet-stream", nil
+}
+
+// objectReader reads a stored object as an io.ReadSeeker for http.ServeContent:
+// each seek drops the open body and the next read fetches from the new offset.
+type objectReader struct {
+	ctx    context.Context
+	store  storage.Storage
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (o *objectReader) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		body, err := storage.GetFrom(o.ctx, o.store, o.key, o.offset)
+		if err != nil {
+			return 0, err
+		}
+		o.body = body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *objectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of object")
+	}
+	if offset != o.offset {
+		o.Close()
+		o.offset = offset
+	}
+	return offset, nil
+}
+
+func (o *objectReader) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
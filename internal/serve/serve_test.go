@@ -0,0 +1,100 @@
+package serve
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/rowjay/db-backup-utility/internal/storage"
+)
+
+func TestHandlerServesBackups(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocal(filepath.Join(t.TempDir(), "backups"))
+	backup := bytes.Repeat([]byte("0123456789"), 100)
+	for key, data := range map[string][]byte{
+		"prod/postgres/appdb/20240101T000000Z_full.backup.gz":               backup,
+		"prod/postgres/appdb/20240101T000000Z_full.backup.gz.manifest.json": []byte(`{"key":"x"}`),
+		storage.StatusKey("prod/postgres/appdb"):                            []byte(`{}`),
+		"other/postgres/appdb/20240101T000000Z_full.backup.gz":              backup,
+	} {
+		if err := store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(&Handler{Storage: store, Prefix: "prod", Token: "s3cret", Log: zerolog.Nop()})
+	defer server.Close()
+
+	get := func(path, token string, header http.Header) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if resp := get("/backups/", token, nil); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("token %q: status %d, want 401", token, resp.StatusCode)
+		}
+	}
+
+	resp := get("/backups/", "s3cret", nil)
+	var listing []Object
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		t.Fatal(err)
+	}
+	if len(listing) != 2 || listing[0].Key != "prod/postgres/appdb/20240101T000000Z_full.backup.gz" || !listing[1].Manifest {
+		t.Fatalf("listing should hold the backup and its manifest only: %+v", listing)
+	}
+
+	key := "/backups/prod/postgres/appdb/20240101T000000Z_full.backup.gz"
+	resp = get(key, "s3cret", http.Header{"Accept-Encoding": {"gzip"}})
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, backup) {
+		t.Fatalf("download: status %d, %d bytes", resp.StatusCode, len(body))
+	}
+	if ct, ce := resp.Header.Get("Content-Type"), resp.Header.Get("Content-Encoding"); ct != "application/gzip" || ce != "" {
+		t.Fatalf("Content-Type %q, Content-Encoding %q", ct, ce)
+	}
+
+	resp = get(key, "s3cret", http.Header{"Range": {"bytes=995-"}})
+	body, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "56789" {
+		t.Fatalf("range: status %d, body %q", resp.StatusCode, body)
+	}
+
+	if resp := get(key+".manifest.json", "s3cret", nil); resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("manifest Content-Type %q", resp.Header.Get("Content-Type"))
+	}
+
+	for _, path := range []string{
+		"/backups/" + storage.StatusKey("prod/postgres/appdb"),
+		"/backups/other/postgres/appdb/20240101T000000Z_full.backup.gz",
+		"/backups/prod/../other/postgres/appdb/20240101T000000Z_full.backup.gz",
+		"/backups/prod/postgres/appdb/missing.backup",
+	} {
+		if resp := get(path, "s3cret", nil); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("%s: status %d, want 404", path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cached remembers List and Stat results so Exists, Stat and repeated listings
+// avoid round trips. Writes made through it keep the remembered listings accurate.
+// Writes made elsewhere, such as by another host, are not seen until a result
+// expires: NewCached results never do, so that cache is built per operation, while
+// NewCachedTTL results expire after the TTL and the cache can be shared by runs.
+type Cached struct {
+	Storage
+
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	listings map[string]*listing
+	stats    map[string]cachedStat
+}
+
+// listing is a remembered List result. Keys written with an unknown size are
+// pending until a Stat fills them in; a listing with pending keys is not served.
+type listing struct {
+	objects map[string]ObjectInfo
+	pending map[string]struct{}
+	at      time.Time
+}
+
+type cachedStat struct {
+	info ObjectInfo
+	at   time.Time
+}
+
+// NewCached wraps s with an operation-scoped cache.
+func NewCached(s Storage) *Cached {
+	return NewCachedTTL(s, 0)
+}
+
+// NewCachedTTL wraps s with a cache whose results expire ttl after they were
+// fetched; 0 keeps them for the cache's lifetime.
+func NewCachedTTL(s Storage, ttl time.Duration) *Cached {
+	return &Cached{Storage: s, ttl: ttl, now: time.Now, listings: map[string]*listing{}, stats: map[string]cachedStat{}}
+}
+
+// fresh reports whether a result fetched at at may still be served. The caller
+// holds c.mu.
+func (c *Cached) fresh(at time.Time) bool {
+	return c.ttl <= 0 || c.now().Sub(at) < c.ttl
+}
+
+func (c *Cached) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	c.mu.Lock()
+	if l, ok := c.listings[prefix]; ok && len(l.pending) == 0 && c.fresh(l.at) {
+		infos := l.infos()
+		c.mu.Unlock()
+		return infos, nil
+	}
+	c.mu.Unlock()
+
+	infos, err := c.Storage.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	l := &listing{objects: make(map[string]ObjectInfo, len(infos)), pending: map[string]struct{}{}, at: c.now()}
+	for _, info := range infos {
+		l.objects[info.Key] = info
+	}
+	c.listings[prefix] = l
+	c.mu.Unlock()
+	return infos, nil
+}
+
+func (c *Cached) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	c.mu.Lock()
+	stat, ok := c.stats[key]
+	ok = ok && c.fresh(stat.at)
+	c.mu.Unlock()
+	if ok {
+		return stat.info, nil
+	}
+	info, err := c.Storage.Stat(ctx, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	c.mu.Lock()
+	c.stats[key] = cachedStat{info: info, at: c.now()}
+	c.update(key, func(l *listing) {
+		l.objects[key] = info
+		delete(l.pending, key)
+	})
+	c.mu.Unlock()
+	return info, nil
+}
+
+// Exists answers from a remembered Stat or a listing that covers key, and asks
+// the backend otherwise.
+func (c *Cached) Exists(ctx context.Context, key string) (bool, error) {
+	c.mu.Lock()
+	if stat, ok := c.stats[key]; ok && c.fresh(stat.at) {
+		c.mu.Unlock()
+		return true, nil
+	}
+	for prefix, l := range c.listings {
+		if _, pending := l.pending[key]; covers(prefix, key) && !pending && c.fresh(l.at) {
+			_, ok := l.objects[key]
+			c.mu.Unlock()
+			return ok, nil
+		}
+	}
+	c.mu.Unlock()
+	return c.Storage.Exists(ctx, key)
+}
+
+func (c *Cached) Put(ctx context.Context, key string, reader io.Reader, size int64, metadata map[string]string) error {
+	c.written(key)
+	if err := c.Storage.Put(ctx, key, reader, size, metadata); err != nil {
+		return err
+	}
+	if size >= 0 {
+		// The backend's modification time is not known without a Stat; the local
+		// clock is close enough for ordering within one operation.
+		info := ObjectInfo{Key: key, Size: size, Modified: c.now(), Metadata: metadata, IsManifest: strings.HasSuffix(key, ManifestSuffix)}
+		c.mu.Lock()
+		c.update(key, func(l *listing) {
+			l.objects[key] = info
+			delete(l.pending, key)
+		})
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+func (c *Cached) Delete(ctx context.Context, key string) error {
+	c.written(key)
+	err := c.Storage.Delete(ctx, key)
+	c.mu.Lock()
+	c.update(key, func(l *listing) {
+		if err == nil {
+			delete(l.objects, key)
+			delete(l.pending, key)
+		}
+	})
+	c.mu.Unlock()
+	return err
+}
+
+func (c *Cached) Copy(ctx context.Context, srcKey, dstKey string) error {
+	c.written(dstKey)
+	return c.Storage.Copy(ctx, srcKey, dstKey)
+}
+
+// written forgets what is known about key before it changes. Listings that cover
+// key mark it pending; listings that would include it without covering it (a bare
+// S3 prefix match such as "db" for "db2/x") are dropped.
+func (c *Cached) written(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.stats, key)
+	c.update(key, func(l *listing) { l.pending[key] = struct{}{} })
+}
+
+// update applies fn to every listing covering key and drops listings that
+// only partially match it. The caller holds c.mu.
+func (c *Cached) update(key string, fn func(*listing)) {
+	for prefix, l := range c.listings {
+		switch {
+		case covers(prefix, key):
+			fn(l)
+		case strings.HasPrefix(key, prefix):
+			delete(c.listings, prefix)
+		}
+	}
+}
+
+func (l *listing) infos() []ObjectInfo {
+	infos := make([]ObjectInfo, 0, len(l.objects))
+	for _, info := range l.objects {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos
+}
+
+// covers reports whether a listing of prefix is authoritative for key.
+func covers(prefix, key string) bool {
+	return prefix == "" || strings.HasPrefix(key, strings.TrimSuffix(prefix, "/")+"/")
+}
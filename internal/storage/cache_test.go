@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingStore records how many backend calls each method received.
+type countingStore struct {
+	Storage
+	calls map[string]int
+}
+
+func (s *countingStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	s.calls["list"]++
+	return s.Storage.List(ctx, prefix)
+}
+
+func (s *countingStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	s.calls["stat"]++
+	return s.Storage.Stat(ctx, key)
+}
+
+func (s *countingStore) Exists(ctx context.Context, key string) (bool, error) {
+	s.calls["exists"]++
+	return s.Storage.Exists(ctx, key)
+}
+
+func TestCachedServesListingsUntilWritten(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStore{Storage: NewLocal(t.TempDir()), calls: map[string]int{}}
+	if err := backend.Put(ctx, "db/a.backup", strings.NewReader("a"), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	c := NewCached(backend)
+
+	if _, err := c.List(ctx, "db"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.Exists(ctx, "db/b.backup"); err != nil || ok {
+		t.Fatalf("expected a cached miss, got %v, %v", ok, err)
+	}
+	if ok, _ := c.Exists(ctx, "db/a.backup"); !ok {
+		t.Fatal("expected a cached hit")
+	}
+	if backend.calls["exists"] != 0 {
+		t.Fatalf("Exists should be answered from the listing, got %d backend calls", backend.calls["exists"])
+	}
+
+	// An upload of unknown size is pending until a Stat fills it in.
+	if err := c.Put(ctx, "db/b.backup", strings.NewReader("bb"), -1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := c.Exists(ctx, "db/b.backup"); !ok {
+		t.Fatal("expected the new object to exist")
+	}
+	if _, err := c.Stat(ctx, "db/b.backup"); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := c.List(ctx, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[1].Key != "db/b.backup" || infos[1].Size != 2 {
+		t.Fatalf("unexpected listing: %+v", infos)
+	}
+	if backend.calls["list"] != 1 {
+		t.Fatalf("expected one backend listing, got %d", backend.calls["list"])
+	}
+
+	if err := c.Delete(ctx, "db/a.backup"); err != nil {
+		t.Fatal(err)
+	}
+	infos, _ = c.List(ctx, "db")
+	if len(infos) != 1 || backend.calls["list"] != 1 {
+		t.Fatalf("expected the delete to be reflected without relisting: %+v (%d lists)", infos, backend.calls["list"])
+	}
+}
+
+func TestCachedDropsListingOnBarePrefixMatch(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStore{Storage: NewLocal(t.TempDir()), calls: map[string]int{}}
+	c := NewCached(backend)
+	if _, err := c.List(ctx, "db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(ctx, "db2/x", strings.NewReader("x"), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.List(ctx, "db"); err != nil {
+		t.Fatal(err)
+	}
+	if backend.calls["list"] != 2 {
+		t.Fatalf("expected the listing to be refreshed, got %d lists", backend.calls["list"])
+	}
+}
+
+func TestCachedTTLExpiresResults(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStore{Storage: NewLocal(t.TempDir()), calls: map[string]int{}}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewCachedTTL(backend, time.Hour)
+	c.now = func() time.Time { return now }
+
+	if _, err := c.List(ctx, "db"); err != nil {
+		t.Fatal(err)
+	}
+	// Another host writes behind the cache's back.
+	if err := backend.Put(ctx, "db/a.backup", strings.NewReader("a"), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(59 * time.Minute)
+	if infos, _ := c.List(ctx, "db"); len(infos) != 0 || backend.calls["list"] != 1 {
+		t.Fatalf("expected the listing to be served until it expires: %+v (%d lists)", infos, backend.calls["list"])
+	}
+	if ok, _ := c.Exists(ctx, "db/a.backup"); ok || backend.calls["exists"] != 0 {
+		t.Fatalf("expected Exists to be answered from the listing, got %v (%d calls)", ok, backend.calls["exists"])
+	}
+
+	now = now.Add(time.Minute)
+	if ok, _ := c.Exists(ctx, "db/a.backup"); !ok || backend.calls["exists"] != 1 {
+		t.Fatalf("expected an expired listing to be skipped, got %v (%d calls)", ok, backend.calls["exists"])
+	}
+	if _, err := c.Stat(ctx, "db/a.backup"); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := c.List(ctx, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || backend.calls["list"] != 2 {
+		t.Fatalf("expected an expired listing to be refreshed: %+v (%d lists)", infos, backend.calls["list"])
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := c.Stat(ctx, "db/a.backup"); err != nil {
+		t.Fatal(err)
+	}
+	if backend.calls["stat"] != 2 {
+		t.Fatalf("expected an expired Stat to be refetched, got %d stats", backend.calls["stat"])
+	}
+}
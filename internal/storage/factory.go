@@ -6,15 +6,43 @@ import (
 	"github.com/rowjay/db-backup-utility/internal/config"
 )
 
+// New builds the configured backend, wrapped in Tiered when storage.tiers.cold is set.
 func New(cfg config.StorageConfig) (Storage, error) {
+	hot, err := newBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cold := cfg.Tiers.Cold
+	if cold.Prefix == "" {
+		return hot, nil
+	}
+	coldStore := hot
+	if cold.Backend != "" {
+		if coldStore, err = newBackend(config.StorageConfig{Backend: cold.Backend, Local: cold.Local, S3: cold.S3}); err != nil {
+			return nil, fmt.Errorf("storage.tiers.cold: %w", err)
+		}
+	}
+	return NewTiered(hot, coldStore, cfg.Prefix, cold.Prefix)
+}
+
+func newBackend(cfg config.StorageConfig) (Storage, error) {
 	switch cfg.Backend {
 	case "local", "":
-		return NewLocal(cfg.Local.Path), nil
+		local := NewLocal(cfg.Local.Path)
+		local.Immutable = cfg.Local.Immutable
+		var err error
+		if local.FileMode, err = ParseMode(cfg.Local.FileMode, defaultFileMode); err != nil {
+			return nil, fmt.Errorf("storage.local.file_mode: %w", err)
+		}
+		if local.DirMode, err = ParseMode(cfg.Local.DirMode, defaultDirMode); err != nil {
+			return nil, fmt.Errorf("storage.local.dir_mode: %w", err)
+		}
+		return local, nil
 	case "s3":
 		if cfg.S3.Endpoint == "" || cfg.S3.Bucket == "" {
 			return nil, fmt.Errorf("s3 endpoint and bucket are required")
 		}
-		return NewS3(cfg.S3.Endpoint, cfg.S3.Region, cfg.S3.Bucket, cfg.S3.AccessKey, cfg.S3.SecretKey, cfg.S3.SessionToken, cfg.S3.UseSSL, cfg.S3.ForcePathStyle, cfg.S3.TLSInsecureSkip)
+		return NewS3(cfg.S3)
 	default:
 		return nil, fmt.Errorf("unsupported storage backend: %s", cfg.Backend)
 	}
@@ -4,18 +4,45 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Local struct {
 	BasePath string
+	// Immutable makes stored files read-only (and chattr +i where available) so
+	// backups cannot be overwritten in place.
+	Immutable bool
+	// FileMode and DirMode are applied exactly, regardless of the process umask;
+	// Immutable files keep FileMode without its write bits.
+	FileMode os.FileMode
+	DirMode  os.FileMode
 }
 
+const (
+	defaultFileMode os.FileMode = 0o600
+	defaultDirMode  os.FileMode = 0o750
+)
+
 func NewLocal(path string) *Local {
-	return &Local{BasePath: path}
+	return &Local{BasePath: path, FileMode: defaultFileMode, DirMode: defaultDirMode}
+}
+
+// ParseMode reads an octal permission such as "0640", returning def when s is empty.
+func ParseMode(s string, def os.FileMode) (os.FileMode, error) {
+	if s == "" {
+		return def, nil
+	}
+	mode, err := strconv.ParseUint(strings.TrimPrefix(s, "0o"), 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid permission %q: want octal such as 0640", s)
+	}
+	return os.FileMode(mode), nil
 }
 
 func (l *Local) Put(ctx context.Context, key string, reader io.Reader, _ int64, _ map[string]string) error {
@@ -26,19 +53,30 @@ func (l *Local) Put(ctx context.Context, key string, reader io.Reader, _ int64,
 	}
 
 	target := filepath.Join(l.BasePath, filepath.FromSlash(key))
-	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+	if err := mkdirAll(filepath.Dir(target), l.DirMode); err != nil {
 		return fmt.Errorf("create directories: %w", err)
 	}
 
-	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, l.FileMode)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
+	if err := file.Chmod(l.FileMode); err != nil {
+		_ = file.Close()
+		return err
+	}
 	if _, err := io.Copy(file, reader); err != nil {
+		_ = file.Close()
+		_ = os.Remove(target)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(target)
 		return err
 	}
+	if l.Immutable {
+		return makeImmutable(ctx, target, l.FileMode&^0o222)
+	}
 	return nil
 }
 
@@ -51,6 +89,21 @@ func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
 	return os.Open(filepath.Join(l.BasePath, filepath.FromSlash(key)))
 }
 
+// GetRange reads the range with ReadAt, so nothing before offset is read.
+func (l *Local) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(l.BasePath, filepath.FromSlash(key)))
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		length = math.MaxInt64 - offset
+	}
+	return limitReadCloser{Reader: io.NewSectionReader(file, offset, length), Closer: file}, nil
+}
+
 func (l *Local) Stat(ctx context.Context, key string) (ObjectInfo, error) {
 	select {
 	case <-ctx.Done():
@@ -101,7 +154,11 @@ func (l *Local) Delete(ctx context.Context, key string) error {
 		return ctx.Err()
 	default:
 	}
-	return os.Remove(filepath.Join(l.BasePath, filepath.FromSlash(key)))
+	target := filepath.Join(l.BasePath, filepath.FromSlash(key))
+	if l.Immutable {
+		clearImmutable(ctx, target)
+	}
+	return os.Remove(target)
 }
 
 func (l *Local) Exists(ctx context.Context, key string) (bool, error) {
@@ -120,6 +177,10 @@ func (l *Local) Exists(ctx context.Context, key string) (bool, error) {
 	return false, err
 }
 
+func (l *Local) Copy(ctx context.Context, srcKey, dstKey string) error {
+	return streamCopy(ctx, l, srcKey, dstKey)
+}
+
 func (l *Local) CleanupOld(ctx context.Context, prefix string, cutoff time.Time, keep int) ([]ObjectInfo, error) {
 	objects, err := l.List(ctx, prefix)
 	if err != nil {
@@ -127,7 +188,7 @@ func (l *Local) CleanupOld(ctx context.Context, prefix string, cutoff time.Time,
 	}
 	eligible := []ObjectInfo{}
 	for _, obj := range objects {
-		if obj.Modified.Before(cutoff) && !obj.IsManifest {
+		if obj.Modified.Before(cutoff) && !obj.IsManifest && !IsRestoreMarker(obj.Key) && !IsStatus(obj.Key) && !IsPause(obj.Key) {
 			eligible = append(eligible, obj)
 		}
 	}
@@ -140,3 +201,47 @@ func (l *Local) CleanupOld(ctx context.Context, prefix string, cutoff time.Time,
 	}
 	return eligible, nil
 }
+
+// mkdirAll creates dir and any missing parents with mode, applied exactly so the
+// umask does not narrow it. Directories that already exist are left alone.
+func mkdirAll(dir string, mode os.FileMode) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+		if parent := filepath.Dir(d); parent == d {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	for _, d := range missing {
+		if err := os.Chmod(d, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeImmutable sets path to mode, the file mode without its write bits, and
+// chattr +i where available.
+func makeImmutable(ctx context.Context, path string, mode os.FileMode) error {
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("set read-only: %w", err)
+	}
+	if _, err := exec.LookPath("chattr"); err == nil {
+		// Requires CAP_LINUX_IMMUTABLE; the read-only mode still applies without it.
+		_ = exec.CommandContext(ctx, "chattr", "+i", path).Run()
+	}
+	return nil
+}
+
+func clearImmutable(ctx context.Context, path string) {
+	if _, err := exec.LookPath("chattr"); err == nil {
+		_ = exec.CommandContext(ctx, "chattr", "-i", path).Run()
+	}
+	_ = os.Chmod(path, 0o600)
+}
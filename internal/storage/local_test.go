@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestLocalPutModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX permissions")
+	}
+	base := t.TempDir()
+	l := NewLocal(base)
+	l.FileMode, l.DirMode = 0o660, 0o770
+	if err := l.Put(context.Background(), "pg/app/backup.gz", strings.NewReader("x"), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	checks := map[string]os.FileMode{
+		filepath.Join(base, "pg"):                     0o770,
+		filepath.Join(base, "pg", "app"):              0o770,
+		filepath.Join(base, "pg", "app", "backup.gz"): 0o660,
+	}
+	for path, want := range checks {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s: mode %o, want %o", path, got, want)
+		}
+	}
+}
+
+func TestLocalImmutableKeepsReadBits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX permissions")
+	}
+	ctx := context.Background()
+	base := t.TempDir()
+	l := NewLocal(base)
+	l.FileMode, l.Immutable = 0o640, true
+	if err := l.Put(ctx, "pg/app/backup.gz", strings.NewReader("x"), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Clears chattr +i, which would otherwise keep the temp dir from being removed.
+	defer l.Delete(ctx, "pg/app/backup.gz")
+	info, err := os.Stat(filepath.Join(base, "pg", "app", "backup.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0o440 {
+		t.Errorf("mode %o, want 440", got)
+	}
+}
+
+func TestLocalPutRemovesPartialFile(t *testing.T) {
+	l := NewLocal(t.TempDir())
+	r := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("boom")))
+	if err := l.Put(context.Background(), "pg/app/backup.gz", r, -1, nil); err == nil {
+		t.Fatal("expected the read error")
+	}
+	if ok, _ := l.Exists(context.Background(), "pg/app/backup.gz"); ok {
+		t.Fatal("partial file left behind")
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if mode, err := ParseMode("", 0o600); err != nil || mode != 0o600 {
+		t.Fatalf("expected the default, got %o, %v", mode, err)
+	}
+	if mode, err := ParseMode("0640", 0o600); err != nil || mode != 0o640 {
+		t.Fatalf("got %o, %v", mode, err)
+	}
+	for _, bad := range []string{"640x", "0999", "01777"} {
+		if _, err := ParseMode(bad, 0o600); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
@@ -1,24 +1,267 @@
 package storage
 
-import "time"
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rowjay/db-backup-utility/internal/util"
+)
 
 const ManifestSuffix = ".manifest.json"
 
+// ManifestSchemaVersion is written on every new manifest. Manifests without a
+// version predate versioning and are treated as version 0.
+const ManifestSchemaVersion = 1
+
+// restoreMarkerName is reserved under a database prefix; backup keys never start with "_".
+const restoreMarkerName = "_restore-in-progress.json"
+
+// statusName is reserved under a database prefix for the database's Status.
+const statusName = "_status.json"
+
+// pauseName is reserved under a database prefix for a Pause.
+const pauseName = "_paused.json"
+
+var chunkPattern = regexp.MustCompile(`\.part-\d{4,}$`)
+
 type Manifest struct {
-	ID           string    `json:"id"`
-	Key          string    `json:"key"`
-	DatabaseType string    `json:"database_type"`
-	Database     string    `json:"database"`
-	BackupType   string    `json:"backup_type"`
-	Compression  string    `json:"compression"`
-	Encryption   bool      `json:"encryption"`
-	CreatedAt    time.Time `json:"created_at"`
-	SizeBytes    int64     `json:"size_bytes"`
-	Tables       []string  `json:"tables,omitempty"`
-	Collections  []string  `json:"collections,omitempty"`
-	ToolVersion  string    `json:"tool_version"`
+	SchemaVersion int    `json:"schema_version"`
+	ID            string `json:"id"`
+	Key           string `json:"key"`
+	DatabaseType  string `json:"database_type"`
+	Database      string `json:"database"`
+	BackupType    string `json:"backup_type"`
+	Compression   string `json:"compression"`
+	// CompressionDict is the ID of the shared zstd dictionary the backup needs, if any.
+	CompressionDict uint32 `json:"compression_dict,omitempty"`
+	// ZstdWindowLog is the log2 of a zstd backup's window, and Cipher the cipher
+	// suite an encrypted one was written with, so a restore can tell up front that
+	// it cannot decode them.
+	ZstdWindowLog int    `json:"zstd_window_log,omitempty"`
+	Encryption    bool   `json:"encryption"`
+	Cipher        string `json:"cipher,omitempty"`
+	// KeyFingerprint identifies the encryption key (cryptoutil.Fingerprint), never the key itself.
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+	// KeyDerivation is how the backup's data key was derived from the encryption
+	// key; unset, the encryption key was used as is.
+	KeyDerivation *KeyDerivation `json:"key_derivation,omitempty"`
+	// EncryptionBinding is what the backup's stream is bound to; unset for backups
+	// written before binding and for unencrypted or deduplicated ones.
+	EncryptionBinding *EncryptionBinding `json:"encryption_binding,omitempty"`
+	CreatedAt         time.Time          `json:"created_at"`
+	SizeBytes         int64              `json:"size_bytes"`
+	// SHA256 is the hex digest of the stored bytes, across all chunks in order.
+	SHA256 string   `json:"sha256,omitempty"`
+	Tables []string `json:"tables,omitempty"`
+	// Schemas and ExcludeSchemas are the PostgreSQL schema selection the dump was taken with.
+	Schemas        []string `json:"schemas,omitempty"`
+	ExcludeSchemas []string `json:"exclude_schemas,omitempty"`
+	Collections    []string `json:"collections,omitempty"`
+	Container      string   `json:"container,omitempty"` // e.g. tar when the dump bundles several files
+	DumpTool       string   `json:"dump_tool,omitempty"` // set when not the adapter's default, e.g. mydumper
+	Chunks         []string `json:"chunks,omitempty"`
+	// DedupChunks is the chunk map of a deduplicated backup (backup.dedup), in dump order.
+	DedupChunks []DedupChunk `json:"dedup_chunks,omitempty"`
+	// NoBlobs and BlobsOnly record that large objects were left out or dumped alone.
+	NoBlobs   bool `json:"no_blobs,omitempty"`
+	BlobsOnly bool `json:"blobs_only,omitempty"`
+	// TableChecksums fingerprints each table's contents when the backup was taken.
+	TableChecksums map[string]string `json:"table_checksums,omitempty"`
+	// BaseKey is the full backup a differential applies on top of; a differential
+	// holds only the tables listed in Tables.
+	BaseKey string `json:"base_key,omitempty"`
+	// CompactedFrom is the differential a compacted full backup was rebuilt from.
+	CompactedFrom string `json:"compacted_from,omitempty"`
+	// ConvertedFrom is the backup a converted one was re-encoded from (dbu convert).
+	ConvertedFrom string `json:"converted_from,omitempty"`
+	// ReadReplica is the host:port the dump was read from when not the primary.
+	ReadReplica string `json:"read_replica,omitempty"`
+	// Labels are free-form key=value annotations given at backup time (--label).
+	Labels map[string]string `json:"labels,omitempty"`
+	// Tier is TierCold once retention has moved the backup to the cold tier.
+	Tier string `json:"tier,omitempty"`
+	// LegalHold and RetainUntil keep retention from deleting the backup (see Held).
+	LegalHold   bool      `json:"legal_hold,omitempty"`
+	RetainUntil time.Time `json:"retain_until,omitzero"`
+	// UncompressedBytes is the size of the dump before compression and encryption.
+	UncompressedBytes int64         `json:"uncompressed_bytes,omitempty"`
+	Timings           *StageTimings `json:"timings,omitempty"`
+	ToolVersion       string        `json:"tool_version"`
+}
+
+// KeyDerivation records the inputs a backup's data key was derived with, so it
+// can be derived again without the config that wrote it.
+type KeyDerivation struct {
+	Scheme string `json:"scheme"` // cryptoutil.KeyDerivationHKDF
+	Info   string `json:"info"`
+}
+
+// EncryptionBinding identifies the backup an encrypted stream was sealed for. The
+// stream key is derived from the encryption key and these fields, so the object
+// does not decrypt at any other backup's key, even under the same encryption key.
+type EncryptionBinding struct {
+	DatabaseType string `json:"database_type"`
+	Database     string `json:"database"`
+	Name         string `json:"name"` // the key's last element, e.g. 20240101T000000Z_full.backup.zst.enc
+}
+
+// BindingFor returns the binding of the backup stored at key. The prefixes before
+// <type>/<database>/ are left out, so a backup keeps its binding when it moves to
+// the cold tier or another bucket. ok is false for keys that do not name a backup.
+func BindingFor(key string) (EncryptionBinding, bool) {
+	dbType, database, ok := util.ParseObjectKey(key)
+	if !ok {
+		return EncryptionBinding{}, false
+	}
+	return EncryptionBinding{DatabaseType: dbType, Database: database, Name: path.Base(key)}, true
+}
+
+// String renders the binding as the input to cryptoutil.BindKey.
+func (b EncryptionBinding) String() string {
+	return b.DatabaseType + "\x00" + b.Database + "\x00" + b.Name
+}
+
+// DedupChunk is one fixed-size piece of a deduplicated backup's dump. It is stored
+// compressed and encrypted on its own, named by Hash, and shared by every backup
+// whose dump contains the same bytes.
+type DedupChunk struct {
+	Hash   string `json:"hash"`
+	Size   int64  `json:"size"`   // dump bytes
+	Stored int64  `json:"stored"` // bytes in storage
+}
+
+// StageTimings attributes a backup's wall time to pipeline stages, in milliseconds.
+// The stages overlap while streaming, so they do not add up to the total.
+type StageTimings struct {
+	DumpMS    int64 `json:"dump_ms"`    // until the dump tool exited
+	ProcessMS int64 `json:"process_ms"` // spent compressing and encrypting
+	UploadMS  int64 `json:"upload_ms"`  // pipeline blocked on storage writes
+}
+
+// Held reports whether the backup is under legal hold or must be retained past now.
+func (m Manifest) Held(now time.Time) bool {
+	return m.LegalHold || now.Before(m.RetainUntil)
+}
+
+// CompressionRatio returns uncompressed over stored size, or 0 when either is unknown.
+func (m Manifest) CompressionRatio() float64 {
+	if m.UncompressedBytes == 0 || m.SizeBytes == 0 {
+		return 0
+	}
+	return float64(m.UncompressedBytes) / float64(m.SizeBytes)
+}
+
+// MigrateManifest upgrades a decoded manifest to the current schema in memory.
+func MigrateManifest(m Manifest) (Manifest, error) {
+	if m.SchemaVersion > ManifestSchemaVersion {
+		return m, fmt.Errorf("manifest schema version %d is newer than supported version %d; upgrade dbu", m.SchemaVersion, ManifestSchemaVersion)
+	}
+	if m.SchemaVersion < 1 {
+		// Version 0 wrote an empty compression for uncompressed backups and could omit the type.
+		if m.Compression == "" {
+			m.Compression = "none"
+		}
+		if m.BackupType == "" {
+			m.BackupType = "full"
+		}
+		m.SchemaVersion = 1
+	}
+	return m, nil
 }
 
 func ManifestKey(objectKey string) string {
 	return objectKey + ManifestSuffix
 }
+
+// ChunkKey names the index-th part of a backup split by backup.chunk_size.
+func ChunkKey(objectKey string, index int) string {
+	return fmt.Sprintf("%s.part-%04d", objectKey, index)
+}
+
+// IsChunkKey reports whether key names a backup part.
+func IsChunkKey(key string) bool {
+	return chunkPattern.MatchString(key)
+}
+
+// ChunkBase returns the backup key a part belongs to.
+func ChunkBase(key string) string {
+	return chunkPattern.ReplaceAllString(key, "")
+}
+
+// RestoreMarker records a restore that has started but not yet completed.
+type RestoreMarker struct {
+	Key       string    `json:"key"`
+	Host      string    `json:"host"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// RestoreMarkerKey names the in-progress restore marker for a database prefix.
+func RestoreMarkerKey(prefix string) string {
+	return path.Join(prefix, restoreMarkerName)
+}
+
+// IsRestoreMarker reports whether key names a restore marker.
+func IsRestoreMarker(key string) bool {
+	return strings.HasSuffix(key, "/"+restoreMarkerName) || key == restoreMarkerName
+}
+
+// Status is the latest outcome of each operation on one database. It is kept in
+// storage next to the backups, so every host that runs dbu sees the same one.
+type Status struct {
+	DatabaseType string `json:"database_type"`
+	Database     string `json:"database"`
+	// Operations is keyed by operation: backup, restore, verify or compact.
+	Operations map[string]OperationStatus `json:"operations"`
+	UpdatedAt  time.Time                  `json:"updated_at"`
+}
+
+// OperationStatus is the last success and the last failure of one operation.
+type OperationStatus struct {
+	LastSuccess    time.Time `json:"last_success,omitzero"`
+	LastSuccessKey string    `json:"last_success_key,omitempty"`
+	// LastSuccessSize is the stored size of the backup a successful backup wrote.
+	LastSuccessSize int64     `json:"last_success_size,omitempty"`
+	LastFailure     time.Time `json:"last_failure,omitzero"`
+	LastFailureKey  string    `json:"last_failure_key,omitempty"`
+	LastError       string    `json:"last_error,omitempty"`
+	// Host ran the operation most recently recorded.
+	Host string `json:"host,omitempty"`
+}
+
+// StatusKey names the status object for a database prefix.
+func StatusKey(prefix string) string {
+	return path.Join(prefix, statusName)
+}
+
+// IsStatus reports whether key names a status object.
+func IsStatus(key string) bool {
+	return strings.HasSuffix(key, "/"+statusName) || key == statusName
+}
+
+// Pause holds a database's backups (dbu schedule pause) until it is removed or
+// Until passes. In-flight backups are not affected.
+type Pause struct {
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until,omitzero"`
+	// Host paused the backups.
+	Host string `json:"host,omitempty"`
+}
+
+// Active reports whether the pause still holds backups at now.
+func (p Pause) Active(now time.Time) bool {
+	return p.Until.IsZero() || now.Before(p.Until)
+}
+
+// PauseKey names the pause object for a database prefix.
+func PauseKey(prefix string) string {
+	return path.Join(prefix, pauseName)
+}
+
+// IsPause reports whether key names a pause object.
+func IsPause(key string) bool {
+	return strings.HasSuffix(key, "/"+pauseName) || key == pauseName
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMigrateManifestUnversioned(t *testing.T) {
+	var m Manifest
+	if err := json.Unmarshal([]byte(`{"key":"pg/app/x.backup","compression":"","encryption":false}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	m, err := MigrateManifest(m)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.SchemaVersion != ManifestSchemaVersion || m.Compression != "none" || m.BackupType != "full" {
+		t.Fatalf("unexpected migrated manifest: %+v", m)
+	}
+}
+
+func TestMigrateManifestNewer(t *testing.T) {
+	if _, err := MigrateManifest(Manifest{SchemaVersion: ManifestSchemaVersion + 1}); err == nil {
+		t.Fatal("expected error for newer schema version")
+	}
+}
+
+func TestCompressionRatio(t *testing.T) {
+	if got := (Manifest{UncompressedBytes: 1000, SizeBytes: 250}).CompressionRatio(); got != 4 {
+		t.Fatalf("expected 4, got %v", got)
+	}
+	if got := (Manifest{SizeBytes: 250}).CompressionRatio(); got != 0 {
+		t.Fatalf("expected 0 without uncompressed size, got %v", got)
+	}
+}
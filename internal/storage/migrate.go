@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MigrateOptions tune Migrate.
+type MigrateOptions struct {
+	// DeleteSource removes a backup's objects from the source once every one of
+	// them, manifest included, is copied and verified.
+	DeleteSource bool
+	// Progress, when set, is called for each object once its backup is handled.
+	Progress func(MigrateResult)
+}
+
+// MigrateResult is the outcome for one object.
+type MigrateResult struct {
+	Key  string
+	Size int64
+	// Skipped is set when the destination already held the object, e.g. when
+	// resuming an interrupted migration.
+	Skipped bool
+	Deleted bool
+	Err     error
+}
+
+// Migrate copies every object under prefix from src to dst under the same key,
+// checking each copy against the source's SHA-256. Backups are migrated one at a
+// time, their data before their manifest, and a manifest is only copied once all
+// parts of its backup are, so the destination never describes a backup it does
+// not fully hold. With DeleteSource a backup leaves the source only once all of
+// it has been copied, manifest first, so the source never describes a backup it
+// no longer holds either.
+//
+// Objects already at the destination with the source's size are skipped, so an
+// interrupted migration can be re-run. Restore markers, status objects and pauses
+// are not copied. Failures are reported per object and migration carries on; the returned
+// error says how many objects failed.
+func Migrate(ctx context.Context, src, dst Storage, prefix string, opts MigrateOptions) error {
+	objects, err := src.List(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("list source: %w", err)
+	}
+	existing, err := dst.List(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("list destination: %w", err)
+	}
+	present := make(map[string]int64, len(existing))
+	for _, obj := range existing {
+		present[obj.Key] = obj.Size
+	}
+
+	backups := map[string][]ObjectInfo{}
+	total := 0
+	for _, obj := range objects {
+		if IsRestoreMarker(obj.Key) || IsStatus(obj.Key) || IsPause(obj.Key) {
+			continue
+		}
+		backup := backupOf(obj)
+		backups[backup] = append(backups[backup], obj)
+		total++
+	}
+	names := make([]string, 0, len(backups))
+	for name, objs := range backups {
+		names = append(names, name)
+		// Data sorts by key, and the manifest after all of it.
+		sort.Slice(objs, func(i, j int) bool {
+			if objs[i].IsManifest != objs[j].IsManifest {
+				return objs[j].IsManifest
+			}
+			return objs[i].Key < objs[j].Key
+		})
+	}
+	sort.Strings(names)
+
+	failed := 0
+	for _, name := range names {
+		results, err := migrateBackup(ctx, src, dst, name, backups[name], present, opts.DeleteSource)
+		if err != nil {
+			return err
+		}
+		for _, res := range results {
+			if res.Err != nil {
+				failed++
+			}
+			if opts.Progress != nil {
+				opts.Progress(res)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d objects failed to migrate", failed, total)
+	}
+	return nil
+}
+
+// backupOf returns the backup obj belongs to: the key of the backup a manifest
+// describes or a part was split from. Any other object stands alone.
+func backupOf(obj ObjectInfo) string {
+	switch {
+	case obj.IsManifest:
+		return strings.TrimSuffix(obj.Key, ManifestSuffix)
+	case IsChunkKey(obj.Key):
+		return ChunkBase(obj.Key)
+	default:
+		return obj.Key
+	}
+}
+
+// migrateBackup copies the objects of one backup, its manifest last, and with
+// deleteSource then removes them from the source, the manifest first. Nothing is
+// removed unless every object was copied. The error is only set when ctx ends.
+func migrateBackup(ctx context.Context, src, dst Storage, backup string, objects []ObjectInfo, present map[string]int64, deleteSource bool) ([]MigrateResult, error) {
+	results := make([]MigrateResult, len(objects))
+	complete := true
+	for i, obj := range objects {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		res := MigrateResult{Key: obj.Key, Size: obj.Size}
+		if obj.IsManifest && !complete {
+			res.Err = fmt.Errorf("backup %s was not fully migrated", backup)
+		} else {
+			res.Skipped, res.Err = migrateObject(ctx, src, dst, obj, present, deleteSource)
+		}
+		if res.Err != nil {
+			complete = false
+		}
+		results[i] = res
+	}
+	if !deleteSource || !complete {
+		return results, nil
+	}
+	for i := len(results) - 1; i >= 0; i-- {
+		if err := src.Delete(ctx, results[i].Key); err != nil {
+			// Stopping here leaves the source holding the whole backup, or parts of
+			// it without the manifest that would describe them.
+			results[i].Err = fmt.Errorf("delete source: %w", err)
+			break
+		}
+		results[i].Deleted = true
+	}
+	return results, nil
+}
+
+// migrateObject copies obj unless dst already holds it. A skipped object is only
+// verified by size, unless the source is about to be deleted.
+func migrateObject(ctx context.Context, src, dst Storage, obj ObjectInfo, present map[string]int64, deleteSource bool) (bool, error) {
+	if size, ok := present[obj.Key]; ok && size == obj.Size {
+		if !deleteSource {
+			return true, nil
+		}
+		same, err := sameContent(ctx, src, dst, obj.Key)
+		if err != nil {
+			return true, fmt.Errorf("verify existing copy: %w", err)
+		}
+		if same {
+			return true, nil
+		}
+	}
+	info, err := src.Stat(ctx, obj.Key)
+	if err != nil {
+		return false, fmt.Errorf("stat source: %w", err)
+	}
+	reader, err := src.Get(ctx, obj.Key)
+	if err != nil {
+		return false, fmt.Errorf("read source: %w", err)
+	}
+	defer reader.Close()
+	hash := sha256.New()
+	if err := dst.Put(ctx, obj.Key, io.TeeReader(reader, hash), info.Size, info.Metadata); err != nil {
+		return false, fmt.Errorf("write destination: %w", err)
+	}
+	want := hash.Sum(nil)
+	got, err := objectSHA256(ctx, dst, obj.Key)
+	if err == nil && !bytes.Equal(got, want) {
+		err = errors.New("checksum mismatch")
+	}
+	if err != nil {
+		// Remove the bad copy so a resumed migration does not skip it.
+		_ = dst.Delete(ctx, obj.Key)
+		return false, fmt.Errorf("verify destination: %w", err)
+	}
+	return false, nil
+}
+
+func sameContent(ctx context.Context, src, dst Storage, key string) (bool, error) {
+	want, err := objectSHA256(ctx, src, key)
+	if err != nil {
+		return false, err
+	}
+	got, err := objectSHA256(ctx, dst, key)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(got, want), nil
+}
+
+func objectSHA256(ctx context.Context, s Storage, key string) ([]byte, error) {
+	reader, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// failOnce rejects the first Put of key.
+type failOnce struct {
+	Storage
+	key    string
+	failed bool
+}
+
+func (f *failOnce) Put(ctx context.Context, key string, r io.Reader, size int64, metadata map[string]string) error {
+	if key == f.key && !f.failed {
+		f.failed = true
+		return errors.New("boom")
+	}
+	return f.Storage.Put(ctx, key, r, size, metadata)
+}
+
+func TestMigrateResumesAndPairsManifests(t *testing.T) {
+	ctx := context.Background()
+	src := NewLocal(t.TempDir())
+	objects := map[string]string{
+		"db/a.backup":                  "backup a",
+		"db/a.backup" + ManifestSuffix: "{}",
+		"db/b.backup.part-0000":        "part 0",
+		"db/b.backup.part-0001":        "part 1",
+		"db/b.backup" + ManifestSuffix: "{}",
+		"db/_restore-in-progress.json": "{}",
+	}
+	for key, body := range objects {
+		if err := src.Put(ctx, key, strings.NewReader(body), int64(len(body)), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst := &failOnce{Storage: NewLocal(t.TempDir()), key: "db/b.backup.part-0001"}
+
+	var results []MigrateResult
+	progress := func(res MigrateResult) { results = append(results, res) }
+	if err := Migrate(ctx, src, dst, "db", MigrateOptions{Progress: progress}); err == nil {
+		t.Fatalf("expected the failed part to be reported")
+	}
+	if ok, _ := dst.Exists(ctx, "db/b.backup"+ManifestSuffix); ok {
+		t.Fatalf("manifest copied for a backup whose parts failed")
+	}
+	if ok, _ := dst.Exists(ctx, "db/_restore-in-progress.json"); ok {
+		t.Fatalf("restore marker copied")
+	}
+
+	results = nil
+	if err := Migrate(ctx, src, dst, "db", MigrateOptions{Progress: progress, DeleteSource: true}); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	copied := map[string]bool{}
+	for _, res := range results {
+		copied[res.Key] = !res.Skipped
+		if !res.Deleted {
+			t.Fatalf("%s not deleted from source", res.Key)
+		}
+	}
+	if !copied["db/b.backup.part-0001"] || !copied["db/b.backup"+ManifestSuffix] || copied["db/a.backup"] {
+		t.Fatalf("unexpected resume results %+v", results)
+	}
+	for key, body := range objects {
+		if IsRestoreMarker(key) {
+			continue
+		}
+		rc, err := dst.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("get %s: %v", key, err)
+		}
+		got, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(got) != body {
+			t.Fatalf("%s = %q, want %q", key, got, body)
+		}
+		if ok, _ := src.Exists(ctx, key); ok {
+			t.Fatalf("%s left in source", key)
+		}
+	}
+}
+
+func TestMigrateDeletesOnlyWholeBackups(t *testing.T) {
+	ctx := context.Background()
+	src := NewLocal(t.TempDir())
+	objects := map[string]string{
+		"db/a.backup":                  "backup a",
+		"db/a.backup" + ManifestSuffix: "{}",
+		"db/b.backup.part-0000":        "part 0",
+		"db/b.backup.part-0001":        "part 1",
+		"db/b.backup" + ManifestSuffix: "{}",
+	}
+	for key, body := range objects {
+		if err := src.Put(ctx, key, strings.NewReader(body), int64(len(body)), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst := &failOnce{Storage: NewLocal(t.TempDir()), key: "db/b.backup.part-0001"}
+
+	if err := Migrate(ctx, src, dst, "db", MigrateOptions{DeleteSource: true}); err == nil {
+		t.Fatal("expected the failed part to be reported")
+	}
+	for key := range objects {
+		want := strings.HasPrefix(key, "db/b.backup")
+		if ok, _ := src.Exists(ctx, key); ok != want {
+			t.Fatalf("%s in source = %v, want %v", key, ok, want)
+		}
+	}
+}
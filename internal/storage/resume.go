@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// resumableReader reopens an object from the last delivered offset when a read
+// fails mid-stream, so callers see one uninterrupted stream.
+type resumableReader struct {
+	ctx      context.Context
+	open     func(ctx context.Context, offset int64) (io.ReadCloser, error)
+	body     io.ReadCloser
+	offset   int64
+	attempts int           // reconnects allowed per failure
+	backoff  time.Duration // grows linearly with each consecutive failure
+	failures int
+}
+
+func (r *resumableReader) Read(p []byte) (int, error) {
+	for {
+		if r.body == nil {
+			body, err := r.open(r.ctx, r.offset)
+			if err != nil {
+				if waitErr := r.retry(err); waitErr != nil {
+					return 0, waitErr
+				}
+				continue
+			}
+			r.body = body
+		}
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			r.failures = 0
+		}
+		if err == nil || errors.Is(err, io.EOF) {
+			return n, err
+		}
+		_ = r.body.Close()
+		r.body = nil
+		if n > 0 {
+			// Deliver what arrived; the next Read reconnects.
+			return n, nil
+		}
+		if waitErr := r.retry(err); waitErr != nil {
+			return 0, waitErr
+		}
+	}
+}
+
+// retry waits before the next reconnect, or returns err once attempts are used up.
+func (r *resumableReader) retry(err error) error {
+	if r.ctx.Err() != nil {
+		return err
+	}
+	r.failures++
+	if r.failures > r.attempts {
+		return err
+	}
+	select {
+	case <-time.After(time.Duration(r.failures) * r.backoff):
+		return nil
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	}
+}
+
+func (r *resumableReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
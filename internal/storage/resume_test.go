@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// flakyBody fails once after failAfter bytes.
+type flakyBody struct {
+	r         io.Reader
+	failAfter int
+	read      int
+}
+
+func (f *flakyBody) Read(p []byte) (int, error) {
+	if f.failAfter >= 0 && f.read >= f.failAfter {
+		return 0, errors.New("connection reset by peer")
+	}
+	if f.failAfter >= 0 && len(p) > f.failAfter-f.read {
+		p = p[:f.failAfter-f.read]
+	}
+	n, err := f.r.Read(p)
+	f.read += n
+	return n, err
+}
+
+func (f *flakyBody) Close() error { return nil }
+
+func TestResumableReaderContinuesFromOffset(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	var offsets []int64
+	r := &resumableReader{
+		ctx:      context.Background(),
+		attempts: 2,
+		open: func(_ context.Context, offset int64) (io.ReadCloser, error) {
+			offsets = append(offsets, offset)
+			failAfter := 3000
+			if len(offsets) > 2 {
+				failAfter = -1
+			}
+			return &flakyBody{r: bytes.NewReader(data[offset:]), failAfter: failAfter}, nil
+		},
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("resumed stream differs from the object")
+	}
+	if len(offsets) != 3 || offsets[1] != 3000 || offsets[2] != 6000 {
+		t.Fatalf("unexpected resume offsets: %v", offsets)
+	}
+}
+
+func TestResumableReaderGivesUp(t *testing.T) {
+	opens := 0
+	r := &resumableReader{
+		ctx:      context.Background(),
+		attempts: 2,
+		open: func(context.Context, int64) (io.ReadCloser, error) {
+			opens++
+			return &flakyBody{r: bytes.NewReader(nil), failAfter: 0}, nil
+		},
+	}
+	if _, err := io.ReadAll(r); err == nil {
+		t.Fatal("expected error after exhausting attempts")
+	}
+	if opens != 3 {
+		t.Fatalf("expected 3 opens, got %d", opens)
+	}
+}
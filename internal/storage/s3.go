@@ -3,31 +3,47 @@ package storage
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/tags"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+	"github.com/rowjay/db-backup-utility/internal/util"
 )
 
 type S3 struct {
-	Client *minio.Client
-	Bucket string
+	Client         *minio.Client
+	Bucket         string
+	ResumeAttempts int
 }
 
-func NewS3(endpoint, region, bucket, accessKey, secretKey, sessionToken string, useSSL, forcePathStyle, insecure bool) (*S3, error) {
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	if insecure {
-		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+// resumeBackoff is the wait before the first reconnect of a dropped download.
+const resumeBackoff = time.Second
+
+// cleanupTimeout bounds removing what a failed upload left behind.
+const cleanupTimeout = 30 * time.Second
+
+func NewS3(cfg config.S3Store) (*S3, error) {
+	transport, err := s3Transport(cfg)
+	if err != nil {
+		return nil, err
 	}
-	client, err := minio.New(endpoint, &minio.Options{
-		Creds:     credentials.NewStaticV4(accessKey, secretKey, sessionToken),
-		Secure:    useSSL,
+	creds, region := s3Credentials(cfg)
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:     creds,
+		Secure:    cfg.UseSSL,
 		Region:    region,
 		Transport: transport,
 		BucketLookup: func() minio.BucketLookupType {
-			if forcePathStyle {
+			if cfg.ForcePathStyle {
 				return minio.BucketLookupPath
 			}
 			return minio.BucketLookupDNS
@@ -36,20 +52,132 @@ func NewS3(endpoint, region, bucket, accessKey, secretKey, sessionToken string,
 	if err != nil {
 		return nil, err
 	}
-	return &S3{Client: client, Bucket: bucket}, nil
+	return &S3{Client: client, Bucket: cfg.Bucket, ResumeAttempts: cfg.ResumeAttempts}, nil
+}
+
+// s3Credentials picks the credentials and region for cfg: a profile wins over
+// static keys, and an explicit region over the profile's.
+func s3Credentials(cfg config.S3Store) (*credentials.Credentials, string) {
+	if cfg.Profile == "" {
+		return credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, cfg.SessionToken), cfg.Region
+	}
+	region := cfg.Region
+	if region == "" {
+		region = ProfileRegion(cfg.Profile)
+	}
+	return NewProfileCredentials(cfg.Profile), region
+}
+
+// s3Transport clones the default transport, which keeps its proxy-from-environment
+// setting unless storage.s3.proxy overrides it.
+func s3Transport(cfg config.S3Store) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig, err := s3TLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+	if transport.Proxy, err = util.ProxyFunc(cfg.Proxy); err != nil {
+		return nil, fmt.Errorf("s3 %w", err)
+	}
+	return transport, nil
+}
+
+// s3TLSConfig builds the client TLS settings. A CA bundle takes precedence over
+// tls_insecure_skip, so setting ca_cert always turns verification on.
+func s3TLSConfig(cfg config.S3Store) (*tls.Config, error) {
+	if cfg.CACert == "" {
+		if cfg.TLSInsecureSkip {
+			return &tls.Config{InsecureSkipVerify: true}, nil
+		}
+		return nil, nil
+	}
+	pem, err := os.ReadFile(cfg.CACert)
+	if err != nil {
+		return nil, fmt.Errorf("read s3 ca_cert: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("s3 ca_cert %s contains no PEM certificates", cfg.CACert)
+	}
+	return &tls.Config{RootCAs: pool}, nil
 }
 
 func (s *S3) Put(ctx context.Context, key string, reader io.Reader, size int64, metadata map[string]string) error {
 	opts := minio.PutObjectOptions{UserMetadata: metadata}
 	_, err := s.Client.PutObject(ctx, s.Bucket, key, reader, size, opts)
+	if err != nil {
+		// minio-go aborts a failed multipart upload with the request's context,
+		// which is usually the one that was cancelled. Retry the abort without it
+		// so no parts are left billed in the bucket.
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+		defer cancel()
+		if abortErr := s.Client.RemoveIncompleteUpload(cleanupCtx, s.Bucket, key); abortErr != nil {
+			return fmt.Errorf("%w (aborting incomplete upload: %v)", err, abortErr)
+		}
+	}
 	return err
 }
 
+// Get streams the object, resuming with range requests if the connection drops.
+// Resumed requests are pinned to the original ETag so a replaced object fails
+// instead of being spliced.
 func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
 	obj, err := s.Client.GetObject(ctx, s.Bucket, key, minio.GetObjectOptions{})
 	if err != nil {
 		return nil, err
 	}
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, err
+	}
+	if s.ResumeAttempts <= 0 {
+		return obj, nil
+	}
+	return &resumableReader{
+		ctx:      ctx,
+		body:     obj,
+		attempts: s.ResumeAttempts,
+		backoff:  resumeBackoff,
+		open: func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+			opts := minio.GetObjectOptions{}
+			if err := opts.SetRange(offset, 0); err != nil {
+				return nil, err
+			}
+			if err := opts.SetMatchETag(info.ETag); err != nil {
+				return nil, err
+			}
+			return s.Client.GetObject(ctx, s.Bucket, key, opts)
+		},
+	}, nil
+}
+
+// GetRange reads the range with a ranged request. It is not resumed.
+func (s *S3) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	switch {
+	case length > 0:
+		if err := opts.SetRange(offset, offset+length-1); err != nil {
+			return nil, err
+		}
+	case offset > 0:
+		if err := opts.SetRange(offset, 0); err != nil {
+			return nil, err
+		}
+	}
+	obj, err := s.Client.GetObject(ctx, s.Bucket, key, opts)
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; Stat surfaces a missing object here rather than on Read.
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, err
+	}
 	return obj, nil
 }
 
@@ -87,3 +215,38 @@ func (s *S3) Exists(ctx context.Context, key string) (bool, error) {
 	}
 	return true, nil
 }
+
+// SetTags merges labels into the object's tags. S3 replaces the whole tag set, so
+// the current tags are read first to keep those set by others.
+func (s *S3) SetTags(ctx context.Context, key string, labels map[string]string) error {
+	current, err := s.Client.GetObjectTagging(ctx, s.Bucket, key, minio.GetObjectTaggingOptions{})
+	if err != nil {
+		return err
+	}
+	merged := current.ToMap()
+	for k, v := range labels {
+		if v == "" {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+	if len(merged) == 0 {
+		return s.Client.RemoveObjectTagging(ctx, s.Bucket, key, minio.RemoveObjectTaggingOptions{})
+	}
+	objectTags, err := tags.NewTags(merged, true)
+	if err != nil {
+		return err
+	}
+	return s.Client.PutObjectTagging(ctx, s.Bucket, key, objectTags, minio.PutObjectTaggingOptions{})
+}
+
+func (s *S3) Copy(ctx context.Context, srcKey, dstKey string) error {
+	// ComposeObject falls back to CopyObject for small sources and switches to a
+	// multipart server-side copy beyond the 5 GiB CopyObject limit.
+	_, err := s.Client.ComposeObject(ctx,
+		minio.CopyDestOptions{Bucket: s.Bucket, Object: dstKey},
+		minio.CopySrcOptions{Bucket: s.Bucket, Object: srcKey},
+	)
+	return err
+}
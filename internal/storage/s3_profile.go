@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/go-ini/ini"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// awsProfile resolves credentials for a named profile from the shared AWS files.
+// Static keys (or credential_process) in ~/.aws/credentials are used first; SSO
+// profiles fall back to the AWS CLI's cached session via `aws configure export-credentials`.
+type awsProfile struct {
+	credentials.Expiry
+	Profile string
+}
+
+// NewProfileCredentials returns credentials for a named profile in the shared AWS files.
+func NewProfileCredentials(profile string) *credentials.Credentials {
+	return credentials.New(&awsProfile{Profile: profile})
+}
+
+func (p *awsProfile) Retrieve() (credentials.Value, error) {
+	file := &credentials.FileAWSCredentials{Profile: p.Profile}
+	if v, err := file.Retrieve(); err == nil && v.AccessKeyID != "" {
+		p.SetExpiration(v.Expiration, credentials.DefaultExpiryWindow)
+		return v, nil
+	}
+	return p.exportCLI()
+}
+
+func (p *awsProfile) RetrieveWithCredContext(*credentials.CredContext) (credentials.Value, error) {
+	return p.Retrieve()
+}
+
+func (p *awsProfile) exportCLI() (credentials.Value, error) {
+	if _, err := exec.LookPath("aws"); err != nil {
+		return credentials.Value{}, fmt.Errorf("profile %q has no static credentials and the aws CLI is not installed", p.Profile)
+	}
+	out, err := exec.Command("aws", "configure", "export-credentials", "--profile", p.Profile, "--format", "process").Output()
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("export credentials for profile %q (run `aws sso login --profile %s`): %w", p.Profile, p.Profile, err)
+	}
+	var exported struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		SessionToken    string    `json:"SessionToken"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal(out, &exported); err != nil {
+		return credentials.Value{}, fmt.Errorf("parse exported credentials: %w", err)
+	}
+	p.SetExpiration(exported.Expiration, credentials.DefaultExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     exported.AccessKeyID,
+		SecretAccessKey: exported.SecretAccessKey,
+		SessionToken:    exported.SessionToken,
+		Expiration:      exported.Expiration,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+// ProfileRegion reads the region configured for profile in ~/.aws/config (or AWS_CONFIG_FILE).
+func ProfileRegion(profile string) string {
+	path := os.Getenv("AWS_CONFIG_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		path = filepath.Join(home, ".aws", "config")
+	}
+	cfg, err := ini.Load(path)
+	if err != nil {
+		return ""
+	}
+	section := "profile " + profile
+	if profile == "default" {
+		section = "default"
+	}
+	if !cfg.HasSection(section) {
+		return ""
+	}
+	return cfg.Section(section).Key("region").String()
+}
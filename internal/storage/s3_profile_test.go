@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+)
+
+// awsFiles points the shared AWS config and credentials files at temporary
+// copies of config and creds and clears the AWS_* variables that would win over them.
+func awsFiles(t *testing.T, config, creds string) {
+	t.Helper()
+	dir := t.TempDir()
+	configPath, credsPath := filepath.Join(dir, "config"), filepath.Join(dir, "credentials")
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(credsPath, []byte(creds), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", configPath)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credsPath)
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_REGION"} {
+		t.Setenv(name, "")
+	}
+}
+
+const testAWSConfig = `[default]
+region = us-east-1
+
+[profile sso-dev]
+region = eu-west-1
+sso_start_url = https://example.awsapps.com/start
+
+[profile no-region]
+output = json
+
+[bare]
+region = ap-south-1
+`
+
+const testAWSCredentials = `[default]
+aws_access_key_id = DEFAULTKEY
+aws_secret_access_key = defaultsecret
+
+[ci]
+aws_access_key_id = CIKEY
+aws_secret_access_key = cisecret
+aws_session_token = citoken
+`
+
+func TestProfileRegion(t *testing.T) {
+	awsFiles(t, testAWSConfig, testAWSCredentials)
+	cases := []struct {
+		profile string
+		want    string
+	}{
+		{"default", "us-east-1"},
+		{"sso-dev", "eu-west-1"},
+		{"no-region", ""},
+		{"missing", ""},
+		// Named profiles live under "[profile <name>]" in the config file.
+		{"bare", ""},
+	}
+	for _, tc := range cases {
+		if got := ProfileRegion(tc.profile); got != tc.want {
+			t.Errorf("ProfileRegion(%q) = %q, want %q", tc.profile, got, tc.want)
+		}
+	}
+}
+
+// fakeAWSCLI puts an aws command on PATH that prints out, or no aws command at
+// all when out is empty.
+func fakeAWSCLI(t *testing.T, out string) {
+	t.Helper()
+	dir := t.TempDir()
+	if out != "" {
+		// PATH holds only the fake, so the script sticks to shell builtins.
+		script := "#!/bin/sh\necho '" + out + "'\n"
+		if err := os.WriteFile(filepath.Join(dir, "aws"), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestS3CredentialsSelection(t *testing.T) {
+	cases := []struct {
+		name       string
+		cfg        config.S3Store
+		env        map[string]string
+		cli        string
+		wantKey    string
+		wantToken  string
+		wantRegion string
+		wantErr    string
+	}{
+		{
+			name:    "static keys without a profile",
+			cfg:     config.S3Store{AccessKey: "STATIC", SecretKey: "s", Region: "us-west-2"},
+			wantKey: "STATIC", wantRegion: "us-west-2",
+		},
+		{
+			name:    "profile wins over static keys",
+			cfg:     config.S3Store{AccessKey: "STATIC", SecretKey: "s", Profile: "ci"},
+			wantKey: "CIKEY", wantToken: "citoken",
+		},
+		{
+			name:    "configured profile wins over AWS_PROFILE and AWS_* keys",
+			cfg:     config.S3Store{Profile: "ci"},
+			env:     map[string]string{"AWS_PROFILE": "default", "AWS_ACCESS_KEY_ID": "ENVKEY", "AWS_SECRET_ACCESS_KEY": "envsecret"},
+			wantKey: "CIKEY", wantToken: "citoken",
+		},
+		{
+			name:    "configured region wins over the profile's",
+			cfg:     config.S3Store{Profile: "default", Region: "us-west-2"},
+			wantKey: "DEFAULTKEY", wantRegion: "us-west-2",
+		},
+		{
+			name:    "profile region fills an empty region",
+			cfg:     config.S3Store{Profile: "default"},
+			wantKey: "DEFAULTKEY", wantRegion: "us-east-1",
+		},
+		{
+			name:       "SSO profile exports the CLI session",
+			cfg:        config.S3Store{Profile: "sso-dev"},
+			cli:        `{"Version": 1, "AccessKeyId": "SSOKEY", "SecretAccessKey": "ssosecret", "SessionToken": "ssotoken", "Expiration": "2099-01-01T00:00:00Z"}`,
+			wantKey:    "SSOKEY",
+			wantToken:  "ssotoken",
+			wantRegion: "eu-west-1",
+		},
+		{
+			name:       "SSO profile without the CLI",
+			cfg:        config.S3Store{Profile: "sso-dev"},
+			wantRegion: "eu-west-1",
+			wantErr:    "aws CLI is not installed",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			awsFiles(t, testAWSConfig, testAWSCredentials)
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			fakeAWSCLI(t, tc.cli)
+
+			creds, region := s3Credentials(tc.cfg)
+			if region != tc.wantRegion {
+				t.Errorf("region = %q, want %q", region, tc.wantRegion)
+			}
+			value, err := creds.GetWithContext(nil)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value.AccessKeyID != tc.wantKey || value.SessionToken != tc.wantToken {
+				t.Fatalf("got key %q token %q, want %q %q", value.AccessKeyID, value.SessionToken, tc.wantKey, tc.wantToken)
+			}
+		})
+	}
+}
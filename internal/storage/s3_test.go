@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rowjay/db-backup-utility/internal/config"
+)
+
+func TestS3TLSConfigCACert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caPath, block, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(cfg config.S3Store) error {
+		tlsConfig, err := s3TLSConfig(cfg)
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	if err := get(config.S3Store{}); err == nil {
+		t.Fatal("expected verification failure without the CA")
+	}
+	if err := get(config.S3Store{CACert: caPath}); err != nil {
+		t.Fatalf("expected the CA bundle to verify the server: %v", err)
+	}
+	cfg, err := s3TLSConfig(config.S3Store{CACert: caPath, TLSInsecureSkip: true})
+	if err != nil || cfg.InsecureSkipVerify {
+		t.Fatalf("expected ca_cert to take precedence over tls_insecure_skip, got %+v, %v", cfg, err)
+	}
+}
+
+func TestS3TLSConfigRejectsNonPEM(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s3TLSConfig(config.S3Store{CACert: path}); err == nil {
+		t.Fatal("expected an error for a bundle without certificates")
+	}
+}
+
+func TestS3TransportProxy(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://s3.example.com/bucket", nil)
+
+	transport, err := s3Transport(config.S3Store{})
+	if err != nil || transport.Proxy == nil {
+		t.Fatalf("expected the cloned transport to keep the environment proxy, got %v", err)
+	}
+	transport, err = s3Transport(config.S3Store{Proxy: "http://proxy.internal:3128"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, err := transport.Proxy(req); err != nil || u.String() != "http://proxy.internal:3128" {
+		t.Fatalf("unexpected proxy %v, %v", u, err)
+	}
+	if transport, err = s3Transport(config.S3Store{Proxy: "none"}); err != nil || transport.Proxy != nil {
+		t.Fatalf("expected no proxy, got %v", err)
+	}
+	if _, err := s3Transport(config.S3Store{Proxy: "ftp://proxy.internal"}); err == nil {
+		t.Fatal("expected an error for an unsupported proxy scheme")
+	}
+}
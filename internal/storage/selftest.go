@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"time"
+)
+
+// CheckResult is the outcome of one step of RoundTrip.
+type CheckResult struct {
+	Step     string
+	Duration time.Duration
+	Err      error
+}
+
+// RoundTrip puts a small sentinel object under prefix, then stats, reads, lists and
+// deletes it, timing each step. It stops at the first failure but always tries to
+// remove the sentinel once it has been written.
+func RoundTrip(ctx context.Context, s Storage, prefix string) []CheckResult {
+	key := path.Join(prefix, fmt.Sprintf("_dbu-storage-test-%d", time.Now().UnixNano()))
+	payload := []byte("dbu storage round-trip " + time.Now().UTC().Format(time.RFC3339Nano))
+
+	var results []CheckResult
+	run := func(step string, fn func() error) bool {
+		start := time.Now()
+		err := fn()
+		results = append(results, CheckResult{Step: step, Duration: time.Since(start), Err: err})
+		return err == nil
+	}
+
+	if !run("put", func() error {
+		return s.Put(ctx, key, bytes.NewReader(payload), int64(len(payload)), map[string]string{"dbu-storage-test": "true"})
+	}) {
+		return results
+	}
+
+	checks := []struct {
+		step string
+		fn   func() error
+	}{
+		{"stat", func() error {
+			info, err := s.Stat(ctx, key)
+			if err != nil {
+				return err
+			}
+			if info.Size != int64(len(payload)) {
+				return fmt.Errorf("size %d, want %d", info.Size, len(payload))
+			}
+			return nil
+		}},
+		{"get", func() error {
+			rc, err := s.Get(ctx, key)
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			got, err := io.ReadAll(rc)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(got, payload) {
+				return fmt.Errorf("content mismatch")
+			}
+			return nil
+		}},
+		{"list", func() error {
+			objects, err := s.List(ctx, prefix)
+			if err != nil {
+				return err
+			}
+			for _, obj := range objects {
+				if obj.Key == key {
+					return nil
+				}
+			}
+			return fmt.Errorf("%s not listed under %q", key, prefix)
+		}},
+	}
+	for _, check := range checks {
+		if !run(check.step, check.fn) {
+			break
+		}
+	}
+
+	run("delete", func() error {
+		if err := s.Delete(ctx, key); err != nil {
+			return err
+		}
+		exists, err := s.Exists(ctx, key)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("%s still exists after delete", key)
+		}
+		return nil
+	})
+	return results
+}
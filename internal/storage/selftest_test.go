@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRoundTripLocal(t *testing.T) {
+	store := NewLocal(t.TempDir())
+	results := RoundTrip(context.Background(), store, "backups")
+	want := []string{"put", "stat", "get", "list", "delete"}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d steps, got %+v", len(want), results)
+	}
+	for i, res := range results {
+		if res.Step != want[i] || res.Err != nil {
+			t.Fatalf("step %d: %+v", i, res)
+		}
+	}
+	objects, err := store.List(context.Background(), "backups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 0 {
+		t.Fatalf("sentinel left behind: %+v", objects)
+	}
+}
@@ -2,8 +2,14 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"os"
+	"strings"
 	"time"
+
+	"github.com/minio/minio-go/v7"
 )
 
 type ObjectInfo struct {
@@ -22,4 +28,112 @@ type Storage interface {
 	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
 	Delete(ctx context.Context, key string) error
 	Exists(ctx context.Context, key string) (bool, error)
+	Copy(ctx context.Context, srcKey, dstKey string) error
+}
+
+// Tagger is implemented by backends that can label an object after it is stored.
+type Tagger interface {
+	// SetTags merges tags into the object's tags; an empty value removes the tag.
+	SetTags(ctx context.Context, key string, tags map[string]string) error
+}
+
+// SetTags labels key when the backend supports tags, looking through Cached and
+// Tiered. It reports whether the backend took the tags.
+func SetTags(ctx context.Context, s Storage, key string, tags map[string]string) (bool, error) {
+	if c, ok := s.(*Cached); ok {
+		s = c.Storage
+	}
+	if t, ok := s.(*Tiered); ok {
+		s = t.route(key)
+	}
+	tagger, ok := s.(Tagger)
+	if !ok {
+		return false, nil
+	}
+	return true, tagger.SetTags(ctx, key, tags)
+}
+
+// RangeGetter is implemented by backends that can read part of an object
+// without fetching the rest of it.
+type RangeGetter interface {
+	// GetRange reads length bytes of key from offset, or everything from offset
+	// when length is negative. A range running past the end is cut short there.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+}
+
+// GetRange reads length bytes of key from offset, or everything from offset when
+// length is negative, looking through Cached and Tiered. Backends that cannot
+// read a range read and discard the first offset bytes and stop after length,
+// which still fetches what comes before the range.
+func GetRange(ctx context.Context, s Storage, key string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("read %s: negative offset %d", key, offset)
+	}
+	if c, ok := s.(*Cached); ok {
+		s = c.Storage
+	}
+	if t, ok := s.(*Tiered); ok {
+		if r, err := GetRange(ctx, t.route(key), key, offset, length); !IsNotFound(err) {
+			return r, err
+		}
+	}
+	if length == 0 {
+		// An empty range still reports a missing object.
+		if _, err := s.Stat(ctx, key); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	if rg, ok := s.(RangeGetter); ok && (offset > 0 || length > 0) {
+		return rg.GetRange(ctx, key, offset, length)
+	}
+	reader, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, reader, offset); err != nil && err != io.EOF {
+			reader.Close()
+			return nil, err
+		}
+	}
+	if length > 0 {
+		return limitReadCloser{Reader: io.LimitReader(reader, length), Closer: reader}, nil
+	}
+	return reader, nil
+}
+
+// GetFrom reads key from offset to the end, as GetRange does.
+func GetFrom(ctx context.Context, s Storage, key string, offset int64) (io.ReadCloser, error) {
+	return GetRange(ctx, s, key, offset, -1)
+}
+
+type limitReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// IsNotFound reports whether err means the object does not exist.
+func IsNotFound(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || minio.ToErrorResponse(err).Code == "NoSuchKey"
+}
+
+// streamCopy copies an object through Get and Put. Backends without a server-side
+// copy primitive use it to implement Copy.
+func streamCopy(ctx context.Context, s Storage, srcKey, dstKey string) error {
+	return copyBetween(ctx, s, s, srcKey, dstKey)
+}
+
+// copyBetween streams an object from one store to another.
+func copyBetween(ctx context.Context, src, dst Storage, srcKey, dstKey string) error {
+	info, err := src.Stat(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	reader, err := src.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return dst.Put(ctx, dstKey, reader, info.Size, info.Metadata)
 }
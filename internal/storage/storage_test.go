@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// plainGets hides the backend's RangeGetter, like a backend without range reads.
+type plainGets struct{ Storage }
+
+func TestGetRange(t *testing.T) {
+	ctx := context.Background()
+	local := NewLocal(t.TempDir())
+	const data = "0123456789"
+	if err := local.Put(ctx, "obj", strings.NewReader(data), int64(len(data)), nil); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, data},
+		{0, 4, "0123"},
+		{3, 4, "3456"},
+		{7, -1, "789"},
+		{7, 10, "789"},
+		{4, 0, ""},
+		{10, -1, ""},
+	}
+	for _, s := range []Storage{local, plainGets{local}, NewCached(local)} {
+		for _, tc := range cases {
+			reader, err := GetRange(ctx, s, "obj", tc.offset, tc.length)
+			if err != nil {
+				t.Fatalf("%T range %d+%d: %v", s, tc.offset, tc.length, err)
+			}
+			got, err := io.ReadAll(reader)
+			reader.Close()
+			if err != nil || string(got) != tc.want {
+				t.Errorf("%T range %d+%d = %q, %v; want %q", s, tc.offset, tc.length, got, err, tc.want)
+			}
+		}
+		for _, length := range []int64{-1, 0, 4} {
+			if _, err := GetRange(ctx, s, "missing", 2, length); !IsNotFound(err) {
+				t.Errorf("%T: expected a missing object to be reported, got %v", s, err)
+			}
+		}
+	}
+	if _, err := GetRange(ctx, local, "obj", -1, 4); err == nil {
+		t.Error("expected a negative offset to be refused")
+	}
+}
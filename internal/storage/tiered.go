@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// TierCold is the manifest tier of backups that retention moved to the cold tier.
+const TierCold = "cold"
+
+// Tiered routes keys under the cold prefix to Cold and all other keys to Hot. A
+// key that is not found in its tier is looked up again under the other tier's
+// prefix, so references taken before retention moved a backup (a differential's
+// base, a key an operator noted down) still resolve.
+type Tiered struct {
+	Hot        Storage
+	Cold       Storage
+	HotPrefix  string
+	ColdPrefix string
+}
+
+// NewTiered combines a hot and a cold store. cold may be the same store as hot.
+func NewTiered(hot, cold Storage, hotPrefix, coldPrefix string) (*Tiered, error) {
+	hotPrefix, coldPrefix = strings.Trim(hotPrefix, "/"), strings.Trim(coldPrefix, "/")
+	if coldPrefix == "" {
+		return nil, fmt.Errorf("storage.tiers.cold.prefix is required")
+	}
+	// Keys are routed by prefix, so the tiers need distinct prefixes even on
+	// separate backends.
+	if hotPrefix == coldPrefix || covers(coldPrefix, hotPrefix) {
+		return nil, fmt.Errorf("storage.tiers.cold.prefix %q must differ from and not contain storage.prefix %q", coldPrefix, hotPrefix)
+	}
+	return &Tiered{Hot: hot, Cold: cold, HotPrefix: hotPrefix, ColdPrefix: coldPrefix}, nil
+}
+
+// TierKey moves key from under one prefix to under another, keeping the rest of
+// the path.
+func TierKey(key, fromPrefix, toPrefix string) string {
+	rel := strings.TrimPrefix(key, "/")
+	if from := strings.Trim(fromPrefix, "/"); from != "" {
+		rel = strings.TrimPrefix(rel, from+"/")
+	}
+	return path.Join(strings.Trim(toPrefix, "/"), rel)
+}
+
+// IsCold reports whether key (or a listing prefix) belongs to the cold tier.
+func (t *Tiered) IsCold(key string) bool {
+	key = strings.Trim(key, "/")
+	return key == t.ColdPrefix || covers(t.ColdPrefix, key)
+}
+
+// ColdKey returns the key a hot object has once moved to the cold tier.
+func (t *Tiered) ColdKey(key string) string {
+	return TierKey(key, t.HotPrefix, t.ColdPrefix)
+}
+
+func (t *Tiered) route(key string) Storage {
+	if t.IsCold(key) {
+		return t.Cold
+	}
+	return t.Hot
+}
+
+// other returns where key would be in the other tier.
+func (t *Tiered) other(key string) (Storage, string) {
+	if t.IsCold(key) {
+		return t.Hot, TierKey(key, t.ColdPrefix, t.HotPrefix)
+	}
+	return t.Cold, t.ColdKey(key)
+}
+
+func (t *Tiered) Put(ctx context.Context, key string, reader io.Reader, size int64, metadata map[string]string) error {
+	return t.route(key).Put(ctx, key, reader, size, metadata)
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	reader, err := t.route(key).Get(ctx, key)
+	if err != nil && IsNotFound(err) {
+		store, otherKey := t.other(key)
+		if r, otherErr := store.Get(ctx, otherKey); otherErr == nil {
+			return r, nil
+		}
+	}
+	return reader, err
+}
+
+func (t *Tiered) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := t.route(key).Stat(ctx, key)
+	if err != nil && IsNotFound(err) {
+		store, otherKey := t.other(key)
+		if otherInfo, otherErr := store.Stat(ctx, otherKey); otherErr == nil {
+			return otherInfo, nil
+		}
+	}
+	return info, err
+}
+
+func (t *Tiered) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	return t.route(prefix).List(ctx, prefix)
+}
+
+func (t *Tiered) Delete(ctx context.Context, key string) error {
+	return t.route(key).Delete(ctx, key)
+}
+
+func (t *Tiered) Exists(ctx context.Context, key string) (bool, error) {
+	ok, err := t.route(key).Exists(ctx, key)
+	if err != nil || ok {
+		return ok, err
+	}
+	store, otherKey := t.other(key)
+	return store.Exists(ctx, otherKey)
+}
+
+// Copy uses the backend's own copy within a tier and streams between backends.
+func (t *Tiered) Copy(ctx context.Context, srcKey, dstKey string) error {
+	src, dst := t.route(srcKey), t.route(dstKey)
+	if src == dst {
+		return src.Copy(ctx, srcKey, dstKey)
+	}
+	return copyBetween(ctx, src, dst, srcKey, dstKey)
+}
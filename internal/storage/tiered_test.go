@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTieredRoutesAndFallsBack(t *testing.T) {
+	ctx := context.Background()
+	hot, cold := NewLocal(t.TempDir()), NewLocal(t.TempDir())
+	tiered, err := NewTiered(hot, cold, "backups", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hotKey := "backups/mysql/shop/20240101T000000Z_full.backup"
+	coldKey := tiered.ColdKey(hotKey)
+	if coldKey != "archive/mysql/shop/20240101T000000Z_full.backup" {
+		t.Fatalf("unexpected cold key %q", coldKey)
+	}
+	if err := tiered.Put(ctx, hotKey, strings.NewReader("rows"), 4, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tiered.Copy(ctx, hotKey, coldKey); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := cold.Exists(ctx, coldKey); !ok {
+		t.Fatal("copy did not reach the cold backend")
+	}
+	if err := tiered.Delete(ctx, hotKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// The old hot key still resolves once the backup has moved.
+	r, err := tiered.Get(ctx, hotKey)
+	if err != nil {
+		t.Fatalf("get moved backup by hot key: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "rows" {
+		t.Fatalf("read %q", data)
+	}
+	if ok, err := tiered.Exists(ctx, hotKey); err != nil || !ok {
+		t.Fatalf("exists by hot key: %v, %v", ok, err)
+	}
+	if objects, err := tiered.List(ctx, "archive/mysql/shop"); err != nil || len(objects) != 1 {
+		t.Fatalf("cold listing: %+v, %v", objects, err)
+	}
+	if objects, err := tiered.List(ctx, "backups/mysql/shop"); err != nil || len(objects) != 0 {
+		t.Fatalf("hot listing: %+v, %v", objects, err)
+	}
+	if _, err := tiered.Stat(ctx, "backups/mysql/shop/missing.backup"); !IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestNewTieredRejectsOverlappingPrefixes(t *testing.T) {
+	local := NewLocal(t.TempDir())
+	for _, tc := range []struct{ hot, cold string }{{"backups", "backups"}, {"archive/hot", "archive"}, {"", ""}} {
+		if _, err := NewTiered(local, local, tc.hot, tc.cold); err == nil {
+			t.Errorf("hot %q, cold %q: expected an error", tc.hot, tc.cold)
+		}
+	}
+	if _, err := NewTiered(local, NewLocal(t.TempDir()), "backups", "backups"); err == nil {
+		t.Error("separate backends: expected an error for a shared prefix")
+	}
+	if _, err := NewTiered(local, local, "backups", "backups/cold"); err != nil {
+		t.Errorf("cold prefix inside the hot one: %v", err)
+	}
+}
@@ -7,11 +7,29 @@ import (
 	"os/exec"
 )
 
+// MissingBinaryError is returned by RequireBinary when a binary is not on PATH.
+// It matches exec.ErrNotFound.
+type MissingBinaryError struct {
+	Name string
+	Path string // the PATH that was searched
+	Hint string // how to install the binary, when known
+}
+
+func (e *MissingBinaryError) Error() string {
+	msg := fmt.Sprintf("required binary not found: %s (searched PATH=%q)", e.Name, e.Path)
+	if e.Hint != "" {
+		msg += "; " + e.Hint
+	}
+	return msg
+}
+
+func (e *MissingBinaryError) Unwrap() error { return exec.ErrNotFound }
+
 // RequireBinary verifies the binary is on PATH.
 func RequireBinary(name string) error {
 	_, err := exec.LookPath(name)
 	if err != nil {
-		return fmt.Errorf("required binary not found: %s", name)
+		return &MissingBinaryError{Name: name, Path: os.Getenv("PATH")}
 	}
 	return nil
 }
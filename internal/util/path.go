@@ -2,17 +2,18 @@ package util
 
 import (
 	"fmt"
+	"os"
 	"path"
+	"regexp"
 	"strings"
+	"text/template"
 	"time"
 )
 
-// BuildObjectKey constructs a normalized object key.
-func BuildObjectKey(prefix, dbType, dbName, backupType string, when time.Time, extension string) string {
-	parts := []string{}
-	if prefix != "" {
-		parts = append(parts, strings.Trim(prefix, "/"))
-	}
+// BuildObjectKey constructs a normalized object key. outputPrefix (backup.output_prefix)
+// is a further folder under the storage prefix.
+func BuildObjectKey(prefix, outputPrefix, dbType, dbName, backupType string, when time.Time, extension string) string {
+	parts := prefixParts(prefix, outputPrefix)
 	parts = append(parts, dbType, dbName)
 	suffix := fmt.Sprintf("%s_%s", when.UTC().Format("20060102T150405Z"), backupType)
 	if extension != "" {
@@ -23,11 +24,8 @@ func BuildObjectKey(prefix, dbType, dbName, backupType string, when time.Time, e
 }
 
 // BuildPrefix builds the prefix for listing backups for a database.
-func BuildPrefix(prefix, dbType, dbName string) string {
-	parts := []string{}
-	if prefix != "" {
-		parts = append(parts, strings.Trim(prefix, "/"))
-	}
+func BuildPrefix(prefix, outputPrefix, dbType, dbName string) string {
+	parts := prefixParts(prefix, outputPrefix)
 	if dbType != "" {
 		parts = append(parts, dbType)
 	}
@@ -36,3 +34,63 @@ func BuildPrefix(prefix, dbType, dbName string) string {
 	}
 	return path.Join(parts...)
 }
+
+// backupNamePattern matches the last segment of keys built by BuildObjectKey.
+var backupNamePattern = regexp.MustCompile(`^\d{8}T\d{6}Z_`)
+
+// ParseObjectKey recovers the database type and name from a key built by
+// BuildObjectKey, whatever prefixes precede them. ok is false for other keys.
+func ParseObjectKey(key string) (dbType, dbName string, ok bool) {
+	parts := strings.Split(strings.Trim(key, "/"), "/")
+	n := len(parts)
+	if n < 3 || !backupNamePattern.MatchString(parts[n-1]) {
+		return "", "", false
+	}
+	return parts[n-3], parts[n-2], true
+}
+
+func prefixParts(prefixes ...string) []string {
+	parts := []string{}
+	for _, prefix := range prefixes {
+		if prefix = strings.Trim(prefix, "/"); prefix != "" {
+			parts = append(parts, prefix)
+		}
+	}
+	return parts
+}
+
+// PrefixData is available to storage.prefix templates.
+type PrefixData struct {
+	Host  string
+	Env   string // DBU_ENV
+	Year  string
+	Month string
+	Day   string
+}
+
+// RenderPrefix expands a storage or output prefix template such as "{{.Env}}/{{.Host}}".
+// Prefixes without "{{" are returned unchanged.
+func RenderPrefix(prefix string, now time.Time) (string, error) {
+	if !strings.Contains(prefix, "{{") {
+		return prefix, nil
+	}
+	tmpl, err := template.New("prefix").Option("missingkey=error").
+		Funcs(template.FuncMap{"env": os.Getenv}).Parse(prefix)
+	if err != nil {
+		return "", fmt.Errorf("parse storage prefix: %w", err)
+	}
+	host, _ := os.Hostname()
+	now = now.UTC()
+	data := PrefixData{
+		Host:  host,
+		Env:   os.Getenv("DBU_ENV"),
+		Year:  now.Format("2006"),
+		Month: now.Format("01"),
+		Day:   now.Format("02"),
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("render storage prefix: %w", err)
+	}
+	return b.String(), nil
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -8,7 +9,7 @@ import (
 
 func TestBuildObjectKey(t *testing.T) {
 	when := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
-	key := BuildObjectKey("backups", "postgres", "appdb", "full", when, "backup.zst")
+	key := BuildObjectKey("backups", "", "postgres", "appdb", "full", when, "backup.zst")
 	if !strings.HasPrefix(key, "backups/postgres/appdb/") {
 		t.Fatalf("unexpected prefix: %s", key)
 	}
@@ -18,8 +19,58 @@ func TestBuildObjectKey(t *testing.T) {
 }
 
 func TestBuildPrefix(t *testing.T) {
-	prefix := BuildPrefix("backups", "postgres", "appdb")
+	prefix := BuildPrefix("backups", "", "postgres", "appdb")
 	if prefix != "backups/postgres/appdb" {
 		t.Fatalf("unexpected prefix: %s", prefix)
 	}
 }
+
+func TestOutputPrefix(t *testing.T) {
+	when := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	key := BuildObjectKey("backups", "/nightly/2024/", "postgres", "appdb", "full", when, "backup.zst")
+	if want := "backups/nightly/2024/postgres/appdb/20240101T100000Z_full.backup.zst"; key != want {
+		t.Fatalf("got %q, want %q", key, want)
+	}
+	if got := BuildObjectKey("", "nightly", "postgres", "appdb", "full", when, ""); got != "nightly/postgres/appdb/20240101T100000Z_full" {
+		t.Fatalf("unexpected key without storage prefix: %s", got)
+	}
+	if got := BuildPrefix("backups", "nightly/2024", "postgres", "appdb"); !strings.HasPrefix(key, got+"/") {
+		t.Fatalf("listing prefix %q does not cover key %q", got, key)
+	}
+}
+
+func TestParseObjectKey(t *testing.T) {
+	when := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	key := BuildObjectKey("backups/prod", "nightly", "mysql", "shop", "full", when, "backup.zst")
+	for _, k := range []string{key, key + ".manifest.json", key + ".part-0001"} {
+		dbType, dbName, ok := ParseObjectKey(k)
+		if !ok || dbType != "mysql" || dbName != "shop" {
+			t.Fatalf("ParseObjectKey(%q) = %q, %q, %v", k, dbType, dbName, ok)
+		}
+	}
+	for _, k := range []string{"backups/_zstd-dictionaries/0000abcd.zdict", "20240101T100000Z_full.backup.zst", "backups/mysql/shop/_restore-in-progress.json"} {
+		if _, _, ok := ParseObjectKey(k); ok {
+			t.Fatalf("ParseObjectKey(%q) unexpectedly matched", k)
+		}
+	}
+}
+
+func TestRenderPrefix(t *testing.T) {
+	t.Setenv("DBU_ENV", "staging")
+	t.Setenv("DBU_TEST_REGION", "eu")
+	host, _ := os.Hostname()
+	when := time.Date(2024, 3, 7, 23, 0, 0, 0, time.UTC)
+	got, err := RenderPrefix(`backups/{{.Env}}/{{env "DBU_TEST_REGION"}}/{{.Host}}/{{.Year}}-{{.Month}}`, when)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if want := "backups/staging/eu/" + host + "/2024-03"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got, _ := RenderPrefix("backups", when); got != "backups" {
+		t.Fatalf("static prefix changed: %q", got)
+	}
+	if _, err := RenderPrefix("{{.Nope}}", when); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
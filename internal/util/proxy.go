@@ -0,0 +1,34 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProxyFunc returns the http.Transport proxy function for a configured proxy.
+// An empty value uses HTTPS_PROXY, HTTP_PROXY and NO_PROXY from the environment,
+// "none" connects directly, and anything else must be an http, https or socks5
+// URL that every request goes through.
+func ProxyFunc(raw string) (func(*http.Request) (*url.URL, error), error) {
+	switch strings.ToLower(raw) {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case "none":
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("proxy is not a valid URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("proxy %q must start with http://, https:// or socks5://", u.Redacted())
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy %q has no host", u.Redacted())
+	}
+	return http.ProxyURL(u), nil
+}
@@ -2,22 +2,70 @@ package util
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
 	"time"
 )
 
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err so Retry returns it immediately instead of retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// RetryPolicy says how often and for how long RetryWith retries.
+type RetryPolicy struct {
+	Attempts int
+	Backoff  time.Duration
+	// Jitter adds a random delay of up to this long to each backoff, so runs that
+	// failed together do not retry in lockstep.
+	Jitter time.Duration
+	// MaxElapsed stops retrying once the next attempt would start this long after
+	// the first one; 0 leaves only Attempts as the limit.
+	MaxElapsed time.Duration
+}
+
 // Retry executes fn with retries and backoff.
 func Retry(ctx context.Context, attempts int, backoff time.Duration, fn func() error) error {
-	if attempts <= 1 {
-		return fn()
-	}
+	return RetryWith(ctx, RetryPolicy{Attempts: attempts, Backoff: backoff}, fn)
+}
+
+// RetryWith executes fn until it succeeds, returns a Permanent error, or the
+// policy's attempts or time budget run out. Running out of time wraps the last
+// error with a note saying so.
+func RetryWith(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	attempts := max(policy.Attempts, 1)
+	start := time.Now()
 	var err error
 	for i := 0; i < attempts; i++ {
 		err = fn()
 		if err == nil {
 			return nil
 		}
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if i == attempts-1 {
+			break
+		}
+		wait := policy.Backoff
+		if policy.Jitter > 0 {
+			wait += rand.N(policy.Jitter)
+		}
+		if policy.MaxElapsed > 0 && time.Since(start)+wait >= policy.MaxElapsed {
+			return fmt.Errorf("%w (gave up after %d attempts: retry time budget of %s exhausted)", err, i+1, policy.MaxElapsed)
+		}
 		select {
-		case <-time.After(backoff):
+		case <-time.After(wait):
 		case <-ctx.Done():
 			return ctx.Err()
 		}
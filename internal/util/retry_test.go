@@ -0,0 +1,72 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryStopsOnPermanent(t *testing.T) {
+	sentinel := errors.New("skip")
+	calls := 0
+	err := Retry(context.Background(), 5, time.Millisecond, func() error {
+		calls++
+		return Permanent(sentinel)
+	})
+	if err != sentinel {
+		t.Fatalf("expected unwrapped sentinel, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestRetryNoSleepAfterLastAttempt(t *testing.T) {
+	calls := 0
+	start := time.Now()
+	err := Retry(context.Background(), 2, 200*time.Millisecond, func() error {
+		calls++
+		return errors.New("boom")
+	})
+	if err == nil || calls != 2 {
+		t.Fatalf("expected 2 failed calls, got %d (%v)", calls, err)
+	}
+	if elapsed := time.Since(start); elapsed >= 400*time.Millisecond {
+		t.Fatalf("slept after final attempt: %s", elapsed)
+	}
+}
+
+func TestRetryStopsAtMaxElapsed(t *testing.T) {
+	calls := 0
+	start := time.Now()
+	err := RetryWith(context.Background(), RetryPolicy{Attempts: 10, Backoff: 30 * time.Millisecond, MaxElapsed: 100 * time.Millisecond}, func() error {
+		calls++
+		return errors.New("boom")
+	})
+	if err == nil || !strings.Contains(err.Error(), "boom") || !strings.Contains(err.Error(), "time budget of 100ms exhausted") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if calls < 2 || calls > 4 {
+		t.Fatalf("expected the budget to allow 2 to 4 attempts, got %d", calls)
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Fatalf("retried past the budget: %s", elapsed)
+	}
+}
+
+func TestRetryJitterBoundsWait(t *testing.T) {
+	calls := 0
+	start := time.Now()
+	err := RetryWith(context.Background(), RetryPolicy{Attempts: 3, Backoff: 10 * time.Millisecond, Jitter: 20 * time.Millisecond}, func() error {
+		calls++
+		return errors.New("boom")
+	})
+	if err == nil || calls != 3 {
+		t.Fatalf("expected 3 failed calls, got %d (%v)", calls, err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed >= 200*time.Millisecond {
+		t.Fatalf("waits outside backoff plus jitter: %s", elapsed)
+	}
+}
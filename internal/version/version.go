@@ -1,7 +1,53 @@
 package version
 
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at link time, e.g. -ldflags "-X github.com/rowjay/db-backup-utility/internal/version.Version=v1.2.3".
 var (
 	Version = "dev"
 	Commit  = "none"
 	Date    = "unknown"
 )
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+// Info returns the build metadata along with the toolchain and platform. Values
+// not stamped at link time fall back to what the Go toolchain recorded (module
+// version for go install, VCS revision and time for builds from a checkout).
+func Info() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch {
+		case s.Key == "vcs.revision" && info.Commit == "none":
+			info.Commit = s.Value
+		case s.Key == "vcs.time" && info.Date == "unknown":
+			info.Date = s.Value
+		}
+	}
+	return info
+}